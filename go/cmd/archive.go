@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/archive"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+)
+
+// sendDirArchive packs the matching files of dir into one archive in a
+// temporary directory and sends it as a single document.
+func sendDirArchive(ctx context.Context, client *telegram.Client, chatID string, topicID *int, dir string, sendType string, include []string, exclude []string, walk fswalk.Options, format string, password string, sums *checksumSet, split splitter.Spec, notes *runNotes, retry telegram.RetryConfig) error {
+	client = client.PinFolder(dir)
+	files, unreadable, err := collectFiles(dir, include, exclude, walk, false, allowedExtsForType(sendType))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		log.Printf("no files found in %s", dir)
+		return nil
+	}
+
+	name := archive.Filename(dir, format)
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "archive", Source: name, Count: len(files), StartedAt: startedAt})
+
+	tempDir, err := tempdir.MkdirTemp("archive-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	archivePath := filepath.Join(tempDir, name)
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	err = archive.Write(out, format, dir, files, password)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("pack %s: %w", dir, err)
+	}
+
+	sentBytes, err := sendSourceOrSplit(ctx, client, chatID, topicID, "file", fileSource{path: archivePath, origin: filepath.Join(filepath.Dir(absRoot(dir)), name)}, split, sums, retry)
+	if err != nil {
+		return err
+	}
+	sums.flush(ctx, client, chatID, topicID, retry)
+
+	finishedAt := time.Now()
+	elapsed := finishedAt.Sub(startedAt)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "archive", Source: name, Count: len(files), Sent: 1, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("archive", dir, startedAt, finishedAt, elapsed, 1, 0, sentBytes, unreadable)
+	return nil
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/spf13/cobra"
+)
+
+func newBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "bench",
+		Short:  "Measure local processing throughput",
+		Hidden: true,
+	}
+	cmd.AddCommand(newBenchImageCmd())
+	return cmd
+}
+
+// benchImage is one input of bench image, read into memory so the runs
+// measure decoding, resizing and encoding rather than disk reads.
+type benchImage struct {
+	name   string
+	data   []byte
+	pixels int64
+}
+
+func newBenchImageCmd() *cobra.Command {
+	backends := &stringSlice{}
+	var maxDimension int
+	var maxBytes int
+	var pngStartLevel int
+	var workers int
+	var rounds int
+
+	cmd := &cobra.Command{
+		Use:   "image <file|dir>...",
+		Short: "Compare image preparation throughput of the resize backends",
+		Long: "bench image prepares the given images (and the images directly inside given directories) the way\n" +
+			"send-images does, once per resize backend, with --workers images in parallel, and prints the\n" +
+			"throughput of each backend. Nothing is sent.",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if workers < 1 {
+				workers = 1
+			}
+			if rounds < 1 {
+				rounds = 1
+			}
+			names := backends.Values()
+			if len(names) == 0 {
+				for _, name := range imageutil.ResizeBackends {
+					if imageutil.CheckResizeBackend(name) == nil {
+						names = append(names, name)
+					}
+				}
+			}
+			for _, name := range names {
+				if err := imageutil.CheckResizeBackend(name); err != nil {
+					return err
+				}
+			}
+			images, err := loadBenchImages(args)
+			if err != nil {
+				return err
+			}
+			if len(images) == 0 {
+				return fmt.Errorf("no images found")
+			}
+			megapixels := int64(0)
+			for _, img := range images {
+				megapixels += img.pixels
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d image(s), %.1f MP, %d worker(s), %d round(s), max dimension %d\n", len(images), float64(megapixels)/1e6, workers, rounds, maxDimension)
+
+			out := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(out, "BACKEND\tELAPSED\tIMAGES/S\tMP/S\tOUTPUT\tERRORS")
+			for _, name := range names {
+				startedAt := time.Now()
+				output, failed := benchPrepare(images, rounds, workers, func(img benchImage) (*imageutil.Result, error) {
+					return imageutil.PrepareWithBackend(img.data, img.name, maxDimension, maxBytes, pngStartLevel, name)
+				})
+				elapsed := time.Since(startedAt)
+				count := float64(len(images) * rounds)
+				seconds := elapsed.Seconds()
+				fmt.Fprintf(out, "%s\t%s\t%.2f\t%.1f\t%s\t%d\n", name, elapsed.Round(time.Millisecond), count/seconds, float64(megapixels)*float64(rounds)/1e6/seconds, formatBytes(output/int64(rounds)), failed)
+			}
+			return out.Flush()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Var(backends, "backend", "Resize backend to measure (repeatable or comma-separated; default: all available)")
+	flags.IntVar(&maxDimension, "max-dimension", 2000, "Max image dimension")
+	flags.IntVar(&maxBytes, "max-bytes", 10*1024*1024, "Max image bytes")
+	flags.IntVar(&pngStartLevel, "png-start-level", 8, "PNG compression start level (0-9)")
+	flags.IntVar(&workers, "workers", runtime.NumCPU(), "Images prepared in parallel")
+	flags.IntVar(&rounds, "rounds", 1, "Times each image is prepared per backend")
+	return cmd
+}
+
+func loadBenchImages(args []string) ([]benchImage, error) {
+	paths := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isImage(entry.Name()) {
+				paths = append(paths, filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	images := make([]benchImage, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		img := benchImage{name: filepath.Base(path), data: data}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			img.pixels = int64(config.Width) * int64(config.Height)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// benchPrepare runs prepare over every image rounds times on workers
+// goroutines and returns the bytes produced and the number of failures.
+func benchPrepare(images []benchImage, rounds int, workers int, prepare func(benchImage) (*imageutil.Result, error)) (int64, int) {
+	jobs := make(chan benchImage)
+	var output atomic.Int64
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range jobs {
+				result, err := prepare(img)
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				output.Add(int64(len(result.Data)))
+			}
+		}()
+	}
+	for range rounds {
+		for _, img := range images {
+			jobs <- img
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return output.Load(), int(failed.Load())
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+func newChatCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Inspect destination chats",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newChatInfoCmd())
+	return cmd
+}
+
+func newChatInfoCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	var timeoutSec int
+
+	cmd := &cobra.Command{
+		Use:   "info",
+		Short: "Show a chat's details, the bots' rights in it and its topics",
+		Long: "chat info resolves --chat-id with getChat and prints its title, type, member count and\n" +
+			"administrators, then the status and rights of every bot in the token pool and the forum topics\n" +
+			"seen in the bots' recent updates (the Bot API cannot list topics directly).",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if timeoutSec > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
+				defer cancel()
+			}
+			if cfg.chatID == "" {
+				return fmt.Errorf("chat-id is required")
+			}
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+
+			chat, err := client.GetChatContext(ctx, cfg.chatID)
+			if err != nil {
+				return fmt.Errorf("chat %s not found or no bot is a member: %w", cfg.chatID, err)
+			}
+			out := cmd.OutOrStdout()
+			kind := chat.Type
+			if chat.IsForum {
+				kind += " (forum)"
+			}
+			fmt.Fprintf(out, "Title:    %s\n", chat.DisplayName())
+			fmt.Fprintf(out, "ID:       %d\n", chat.ID)
+			fmt.Fprintf(out, "Type:     %s\n", kind)
+			if chat.Username != "" {
+				fmt.Fprintf(out, "Username: @%s\n", chat.Username)
+			}
+			if count, err := client.GetChatMemberCount(ctx, cfg.chatID); err == nil {
+				fmt.Fprintf(out, "Members:  %d\n", count)
+			} else {
+				fmt.Fprintf(out, "Members:  unknown (%v)\n", err)
+			}
+			if chat.Description != "" {
+				fmt.Fprintf(out, "About:    %s\n", strings.ReplaceAll(chat.Description, "\n", " "))
+			}
+
+			fmt.Fprintln(out, "\nBots:")
+			table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			for _, membership := range client.BotMemberships(ctx, cfg.chatID) {
+				name := telegram.MaskToken(membership.Token)
+				if membership.Bot != nil {
+					name = "@" + membership.Bot.Username
+				}
+				if membership.Err != nil {
+					fmt.Fprintf(table, "  %s\terror\t%v\n", name, membership.Err)
+					continue
+				}
+				fmt.Fprintf(table, "  %s\t%s\t%s\n", name, membership.Member.Status, rightsText(*membership.Member))
+			}
+			table.Flush()
+
+			if chat.Type != "private" {
+				fmt.Fprintln(out, "\nAdministrators:")
+				admins, err := client.GetChatAdministrators(ctx, cfg.chatID)
+				if err != nil {
+					fmt.Fprintf(out, "  unknown (%v)\n", err)
+				}
+				table = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				for _, admin := range admins {
+					fmt.Fprintf(table, "  %s\t%s\t%s\n", memberName(admin), admin.Status, rightsText(admin))
+				}
+				table.Flush()
+			}
+
+			if chat.IsForum {
+				fmt.Fprintln(out, "\nTopics (seen in recent updates):")
+				topics, err := client.DiscoverTopics(strconv.FormatInt(chat.ID, 10))
+				switch {
+				case err != nil:
+					fmt.Fprintf(out, "  unknown (%v)\n", err)
+				case len(topics) == 0:
+					fmt.Fprintln(out, "  none seen; post in a topic and run again")
+				}
+				for _, topic := range topics {
+					fmt.Fprintf(out, "  %d\t%s\n", topic.ThreadID, topic.Name)
+				}
+			}
+			return nil
+		},
+	}
+
+	bindConnectionFlags(cmd, cfg)
+	cmd.Flags().StringVar(&cfg.chatID, "chat-id", "", "Chat ID or @username to inspect")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 30, "Overall timeout (seconds; 0 for none)")
+	return cmd
+}
+
+func memberName(member telegram.ChatMember) string {
+	if member.User == nil {
+		return "?"
+	}
+	name := member.User.FirstName
+	if member.User.Username != "" {
+		name += " (@" + member.User.Username + ")"
+	}
+	if member.CustomTitle != "" {
+		name += " [" + member.CustomTitle + "]"
+	}
+	return name
+}
+
+// rightsText lists a member's rights, noting that creators hold them all.
+func rightsText(member telegram.ChatMember) string {
+	if member.Status == "creator" {
+		return "all rights"
+	}
+	rights := member.Rights()
+	if len(rights) == 0 {
+		return "-"
+	}
+	return strings.Join(rights, ", ")
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+const checksumsFilename = "checksums.txt"
+
+// checksumSet computes SHA-256 sums of files as they are sent, for
+// --checksum-caption, the --checksums sidecar and the --manifest. A nil set
+// sends files unchanged.
+type checksumSet struct {
+	sidecar bool
+	caption bool
+	lines   []string
+
+	// manifestPath is rewritten with every file sent by the command;
+	// manifestUpload sends the files of each run as manifest.json.
+	manifestPath   string
+	manifestUpload bool
+	manifest       []manifestEntry
+	pending        []manifestEntry
+}
+
+func newChecksumSet(sidecar bool, caption bool, manifestPath string, manifestUpload bool) *checksumSet {
+	if !sidecar && !caption && manifestPath == "" && !manifestUpload {
+		return nil
+	}
+	return &checksumSet{sidecar: sidecar, caption: caption, manifestPath: manifestPath, manifestUpload: manifestUpload}
+}
+
+// sendFile sends file, loaded or streamed from disk, like sendMediaFile and
+// records its checksum once it is delivered.
+func (c *checksumSet) sendFile(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, source fileSource, file telegram.MediaFile, retry telegram.RetryConfig) (telegram.Result, error) {
+	filename := source.name()
+	file.Filename = filename
+	file.Source = source.path
+	if source.origin != "" {
+		file.Source = source.origin
+	}
+	if c == nil {
+		return sendMediaFile(ctx, client, chatID, topicID, sendType, file, retry)
+	}
+	hexSum, err := fileSHA256(file)
+	if err != nil {
+		return telegram.Result{}, err
+	}
+	if c.caption {
+		file.Caption = "SHA-256: " + hexSum
+	}
+	result, err := sendMediaFile(ctx, client, chatID, topicID, sendType, file, retry)
+	if err != nil {
+		return result, err
+	}
+	if c.sidecar {
+		c.lines = append(c.lines, hexSum+"  "+filename)
+	}
+	if c.manifestPath != "" || c.manifestUpload {
+		c.pending = append(c.pending, newManifestEntry(source, file.Len(), hexSum, result))
+	}
+	return result, nil
+}
+
+func fileSHA256(file telegram.MediaFile) (string, error) {
+	if file.Data != nil || file.Path == "" {
+		sum := sha256.Sum256(file.Data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	source, err := os.Open(file.Path)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, source); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// flush sends the sums recorded since the last flush as a checksums.txt
+// document in sha256sum format, so recipients can run sha256sum -c, and
+// writes or sends the manifest.
+func (c *checksumSet) flush(ctx context.Context, client *telegram.Client, chatID string, topicID *int, retry telegram.RetryConfig) {
+	if c == nil {
+		return
+	}
+	if len(c.lines) > 0 {
+		data := []byte(strings.Join(c.lines, "\n") + "\n")
+		c.lines = nil
+		file := telegram.MediaFile{Filename: checksumsFilename, Data: data}
+		if _, err := client.SendDocument(ctx, chatID, file, topicID, retry); err != nil {
+			log.Printf("send %s failed: %v", checksumsFilename, err)
+		}
+	}
+	if len(c.pending) == 0 {
+		return
+	}
+	pending := c.pending
+	c.pending = nil
+	c.manifest = append(c.manifest, pending...)
+	if c.manifestPath != "" {
+		data, err := encodeManifest(chatID, topicID, c.manifest)
+		if err == nil {
+			err = writeManifest(c.manifestPath, data)
+		}
+		if err != nil {
+			log.Printf("write manifest %s failed: %v", c.manifestPath, err)
+		}
+	}
+	if c.manifestUpload {
+		data, err := encodeManifest(chatID, topicID, pending)
+		if err != nil {
+			log.Printf("encode %s failed: %v", manifestFilename, err)
+			return
+		}
+		file := telegram.MediaFile{Filename: manifestFilename, Data: data}
+		if _, err := client.SendDocument(ctx, chatID, file, topicID, retry); err != nil {
+			log.Printf("send %s failed: %v", manifestFilename, err)
+		}
+	}
+}
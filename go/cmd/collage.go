@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// photoMaxBytes is Telegram's size limit for a photo upload.
+const photoMaxBytes = 10 << 20
+
+// collageGrid is the cells of a contact sheet, from --collage NxM.
+type collageGrid struct {
+	cols int
+	rows int
+}
+
+func parseCollage(value string) (collageGrid, error) {
+	cols, rows, ok := strings.Cut(strings.ToLower(strings.TrimSpace(value)), "x")
+	if !ok {
+		return collageGrid{}, fmt.Errorf("invalid collage %q: use COLSxROWS, e.g. 4x3", value)
+	}
+	grid := collageGrid{}
+	var err error
+	if grid.cols, err = strconv.Atoi(cols); err != nil || grid.cols < 1 || grid.cols > 10 {
+		return collageGrid{}, fmt.Errorf("invalid collage %q: columns must be 1-10", value)
+	}
+	if grid.rows, err = strconv.Atoi(rows); err != nil || grid.rows < 1 || grid.rows > 10 {
+		return collageGrid{}, fmt.Errorf("invalid collage %q: rows must be 1-10", value)
+	}
+	if grid.cells() < 2 {
+		return collageGrid{}, fmt.Errorf("invalid collage %q: a sheet needs at least 2 cells", value)
+	}
+	return grid, nil
+}
+
+func (g collageGrid) cells() int {
+	return g.cols * g.rows
+}
+
+// sendCollagesFromDir sends the images under dir as contact sheets of
+// grid.cells() images each, captioned with the sheet number and the first
+// and last file name. With originals, the images of each sheet follow it
+// as document albums.
+func sendCollagesFromDir(ctx context.Context, client *telegram.Client, chatID string, topicID *int, dir string, grid collageGrid, originals bool, delay time.Duration, include []string, exclude []string, walk fswalk.Options, maxBytes int, notes *runNotes, retry telegram.RetryConfig) error {
+	dir = absRoot(dir)
+	client = client.PinFolder(dir)
+	files, unreadable, err := collectImages(dir, include, exclude, walk, false)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		log.Printf("no images found in %s", dir)
+		return nil
+	}
+	sheetMaxBytes := photoMaxBytes
+	if maxBytes > 0 && maxBytes < sheetMaxBytes {
+		sheetMaxBytes = maxBytes
+	}
+
+	sizes := pathSizes(files)
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: dir, Count: len(files), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
+	progressState := newProgressTracker(len(files), "collage").withSizes(sizes)
+
+	sheets := (len(files) + grid.cells() - 1) / grid.cells()
+	processed := 0
+	sent := 0
+	skipped := 0
+	sentBytes := int64(0)
+	for sheet := 0; sheet < sheets && ctx.Err() == nil; sheet++ {
+		chunk := files[sheet*grid.cells() : min((sheet+1)*grid.cells(), len(files))]
+		images := []image.Image{}
+		placed := []string{}
+		for _, path := range chunk {
+			data, err := os.ReadFile(path)
+			if err == nil {
+				var img image.Image
+				if img, err = imageutil.Decode(data); err == nil {
+					images = append(images, img)
+					placed = append(placed, path)
+					continue
+				}
+			}
+			log.Printf("invalid image %s: %v", filepath.Base(path), err)
+			skipped++
+		}
+		processed += len(chunk)
+		if len(images) == 0 {
+			progressState.Print(processed, sent, skipped, false)
+			continue
+		}
+		data, err := imageutil.EncodeJPEG(imageutil.ApplyWatermark(imageutil.Collage(images, grid.cols, grid.rows)), sheetMaxBytes)
+		if err != nil {
+			log.Printf("collage %d/%d failed: %v", sheet+1, sheets, err)
+			skipped += len(placed)
+			progressState.Print(processed, sent, skipped, false)
+			continue
+		}
+		caption := fmt.Sprintf("%d/%d · %s", sheet+1, sheets, filepath.Base(placed[0]))
+		if len(placed) > 1 {
+			caption += " – " + filepath.Base(placed[len(placed)-1])
+		}
+		sheetFile := telegram.MediaFile{Filename: fmt.Sprintf("collage-%03d.jpg", sheet+1), Data: data, Caption: caption}
+		if _, err := client.SendPhoto(ctx, chatID, sheetFile, topicID, retry); err != nil {
+			log.Printf("send collage %d/%d failed: %v", sheet+1, sheets, err)
+			skipped += len(placed)
+			progressState.Print(processed, sent, skipped, false)
+			continue
+		}
+		sentBytes += int64(len(data))
+		if !originals {
+			sent += len(placed)
+		} else {
+			docSent, docBytes := sendOriginals(ctx, client, chatID, topicID, placed, retry)
+			sent += docSent
+			skipped += len(placed) - docSent
+			sentBytes += docBytes
+		}
+		progressState.Print(processed, sent, skipped, false)
+		time.Sleep(delay)
+	}
+	progressState.Print(processed, sent, skipped, true)
+
+	finishedAt := time.Now()
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: dir, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("image", dir, startedAt, finishedAt, finishedAt.Sub(startedAt), sent, skipped, sentBytes, unreadable)
+	return nil
+}
+
+// sendOriginals sends paths unchanged as document albums and returns how
+// many were delivered and their bytes.
+func sendOriginals(ctx context.Context, client *telegram.Client, chatID string, topicID *int, paths []string, retry telegram.RetryConfig) (int, int64) {
+	media := []telegram.MediaFile{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("read %s failed: %v", filepath.Base(path), err)
+			continue
+		}
+		media = append(media, telegram.MediaFile{Filename: filepath.Base(path), Data: data, Type: telegram.MediaDocument, Source: path})
+	}
+	if len(media) == 0 {
+		return 0, 0
+	}
+	sent := 0
+	sentBytes := int64(0)
+	_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("send %s failed: %v", media[i].Filename, err)
+			continue
+		}
+		sent++
+		sentBytes += int64(len(media[i].Data))
+	}
+	return sent, sentBytes
+}
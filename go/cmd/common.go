@@ -1,13 +1,26 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/chatid"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/config"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/rename"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sentindex"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/thumbnail"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/transcode"
 	"github.com/spf13/cobra"
 )
 
@@ -15,26 +28,242 @@ type commonFlags struct {
 	configPath     string
 	botToken       string
 	apiURL         string
+	preferURL      string
 	chatID         string
+	chatRef        string
 	topicID        int
 	validateTokens bool
+	verifyTarget   bool
+	spoiler        bool
+	protectContent bool
+	silent         bool
+	replyTo        int
+	replyToStart   bool
+	templateStart  string
+	templateDone   string
+	noRunMessages  bool
+	notifyButtons  string
 	maxRetries     int
 	retryDelaySec  int
 	retryDelay     time.Duration
+	followSymlinks bool
+	includeHidden  bool
+	strict         bool
+	ignoreFile     string
+	tokenPinning   string
+	videoPreset    string
+	thumbnails     bool
+	renameTemplate string
+	sandbox        bool
+	sandboxChatID  string
+	localAPIFiles  bool
+	alsoAsDocument bool
+	queueForce     bool
+	sendOrder      string
+	globalDedup    bool
+	resizeBackend  string
+	watermark      string
+	watermarkPos   string
+	watermarkAlpha float64
+	qualityGuard   string
+	quarantine     string
 }
 
 func bindCommonFlags(cmd *cobra.Command, cfg *commonFlags) {
+	bindConnectionFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.chatID, "chat-id", "", "Target chat ID (channel/group/user)")
+	bindSendOptionFlags(cmd, cfg)
+}
+
+// bindSendOptionFlags adds the flags that shape how messages are posted,
+// for commands that take their targets some other way.
+func bindSendOptionFlags(cmd *cobra.Command, cfg *commonFlags) {
+	flags := cmd.Flags()
+	flags.IntVar(&cfg.topicID, "topic-id", 0, "Topic/thread ID inside group/channel")
+	flags.BoolVar(&cfg.verifyTarget, "verify-target", false, "Check that the chat exists, every bot may post there and the topic ID is valid before sending")
+	flags.BoolVar(&cfg.spoiler, "spoiler", false, "Send photos and videos hidden behind a spoiler")
+	flags.BoolVar(&cfg.protectContent, "protect-content", false, "Protect sent messages from forwarding and saving")
+	flags.BoolVar(&cfg.silent, "silent", false, "Send without notifying chat members")
+	flags.IntVar(&cfg.replyTo, "reply-to", 0, "Send everything as a reply to this message ID")
+	flags.StringVar(&cfg.tokenPinning, "token-pinning", telegram.TokenPinningOff, "Keep related sends on one bot token: off, group (each album) or folder (each source folder or zip)")
+	flags.StringVar(&cfg.videoPreset, "video-preset", "", "Transcode oversized or unsupported videos with ffmpeg before sending: telegram-480p, telegram-720p or telegram-1080p (without ffmpeg they are sent as documents)")
+	flags.BoolVar(&cfg.thumbnails, "thumbnails", false, "Attach thumbnails to documents, videos and audio: PDF first page, image preview, video frame (ffmpeg) or embedded album art")
+	flags.BoolVar(&cfg.localAPIFiles, "local-api-files", false, "Pass large files to a local Bot API server (telegram-bot-api --local) as file:// paths instead of uploading them; the server must see the same paths")
+	flags.BoolVar(&cfg.alsoAsDocument, "also-as-document", false, "Send every image twice: as a compressed photo, then its untouched original as a document with the same caption")
+	flags.BoolVar(&cfg.sandbox, "sandbox", false, "Rehearse the run: send everything to --sandbox-chat-id and only log the real chat and topic")
+	flags.StringVar(&cfg.sandboxChatID, "sandbox-chat-id", "", "Private test chat that receives all sends with --sandbox")
+	flags.StringVar(&cfg.renameTemplate, "rename-template", "", "Upload files under names built from a template, e.g. \"{index:04d}_{basename}\"; variables: index, basename, ext, dir, date, hash (the extension is kept unless {ext} is used)")
+}
+
+// bindConnectionFlags adds the flags that select API URLs, tokens and
+// retries, for commands that talk to the Bot API without sending.
+func bindConnectionFlags(cmd *cobra.Command, cfg *commonFlags) {
 	flags := cmd.Flags()
 	flags.StringVar(&cfg.configPath, "config", "", "Path to INI config file")
 	flags.StringVar(&cfg.botToken, "bot-token", "", "Telegram bot token(s), comma-separated")
 	flags.StringVar(&cfg.apiURL, "api-url", "", "Telegram API URL(s), comma-separated")
-	flags.StringVar(&cfg.chatID, "chat-id", "", "Target chat ID (channel/group/user)")
-	flags.IntVar(&cfg.topicID, "topic-id", 0, "Topic/thread ID inside group/channel")
+	flags.StringVar(&cfg.preferURL, "prefer-url", "", "API URL(s) to use first while healthy, comma-separated in priority order")
 	flags.BoolVar(&cfg.validateTokens, "validate-tokens", false, "Validate tokens via getMe before sending")
 	flags.IntVar(&cfg.maxRetries, "max-retries", 3, "Maximum retries for Telegram API calls")
 	flags.IntVar(&cfg.retryDelaySec, "retry-delay", 3, "Delay between retries (seconds)")
 }
 
+// bindRunFlags adds flags for one-shot batch sends that post "Starting
+// upload" and "Completed upload" messages.
+func bindRunFlags(cmd *cobra.Command, cfg *commonFlags) {
+	flags := cmd.Flags()
+	flags.BoolVar(&cfg.replyToStart, "reply-to-start", false, "Send the run's media as replies to its \"Starting upload\" message")
+	flags.StringVar(&cfg.templateStart, "notify-template-start", "", "Go text/template for the start message; fields: .Kind .Source .Count .TotalBytes .TotalBytesRaw .ETA .Time")
+	flags.StringVar(&cfg.templateDone, "notify-template-done", "", "Go text/template for the completion message; fields: .Kind .Source .Count .Sent .Skipped .Unreadable .Bytes .BytesRaw .Elapsed .AvgPerFile .Speed .Time")
+	flags.BoolVar(&cfg.noRunMessages, "no-run-messages", false, "Do not post start and completion messages")
+	flags.StringVar(&cfg.notifyButtons, "notify-buttons", "", `Buttons under the completion message, as JSON rows: [[{"text":"Open","url":"https://..."}]]`)
+}
+
+// bindWalkFlags adds flags for commands that collect files from directories.
+func bindWalkFlags(cmd *cobra.Command, cfg *commonFlags) {
+	flags := cmd.Flags()
+	flags.BoolVar(&cfg.followSymlinks, "follow-symlinks", false, "Descend into symlinked directories (links back into the directory tree and loops are skipped)")
+	flags.BoolVar(&cfg.includeHidden, "include-hidden", false, "Include files and directories whose name starts with a dot")
+	flags.BoolVar(&cfg.strict, "strict", false, "Abort when a source directory is partially unreadable instead of skipping what cannot be read")
+	flags.StringVar(&cfg.ignoreFile, "ignore-file", fswalk.DefaultIgnoreFile, "Name of the per-directory file whose gitignore patterns exclude files below it, on top of --exclude (empty disables)")
+}
+
+func bindQueueForceFlag(cmd *cobra.Command, cfg *commonFlags) {
+	cmd.Flags().BoolVar(&cfg.queueForce, "queue-force", false, "Open the queue file even when another process holds its lock")
+}
+
+func bindQuarantineFlag(cmd *cobra.Command, cfg *commonFlags) {
+	cmd.Flags().StringVar(&cfg.quarantine, "quarantine", "", "Move files that fail permanently (invalid image, too big, rejected by Telegram) into this folder with a NAME.error.txt note; a relative path is inside each source folder, which then skips it")
+}
+
+func bindSendOrderFlag(cmd *cobra.Command, cfg *commonFlags) {
+	cmd.Flags().StringVar(&cfg.sendOrder, "send-order", queue.OrderOldest, "Order of queued items of the same priority: oldest, newest, largest or smallest")
+}
+
+func bindGlobalDedupFlag(cmd *cobra.Command, cfg *commonFlags) {
+	cmd.Flags().BoolVar(&cfg.globalDedup, "global-dedup", false, "Skip files whose content was already sent to the chat by any run, using sent-index.jsonl in the state directory")
+}
+
+func bindResizeBackendFlag(cmd *cobra.Command, cfg *commonFlags) {
+	cmd.Flags().StringVar(&cfg.resizeBackend, "resize-backend", imageutil.ResizeLanczos, "Image resize backend: lanczos (sharpest), fast (nearest+bilinear, for huge downscales) or vips (vipsthumbnail in PATH)")
+	cmd.Flags().StringVar(&cfg.watermark, "watermark", "", "Image (PNG with transparency) drawn over every image before upload")
+	cmd.Flags().StringVar(&cfg.watermarkPos, "watermark-pos", imageutil.WatermarkBottomRight, "Watermark position: tl, tr, bl, br or center")
+	cmd.Flags().Float64Var(&cfg.watermarkAlpha, "watermark-opacity", 0.5, "Watermark opacity, above 0 up to 1")
+	cmd.Flags().StringVar(&cfg.qualityGuard, "quality-guard", "off", "Send images as documents with their original bytes when fitting them to the photo limits would lose too much: on, off or size=50,dim=30 (max % size and dimension loss)")
+}
+
+// setupImages applies --resize-backend, --quality-guard and the watermark
+// flags to image preparation.
+func (cfg *commonFlags) setupImages() error {
+	if err := imageutil.SetResizeBackend(cfg.resizeBackend); err != nil {
+		return err
+	}
+	if err := setQualityGuard(cfg.qualityGuard); err != nil {
+		return err
+	}
+	if cfg.watermark == "" {
+		imageutil.SetWatermark(nil)
+		return nil
+	}
+	mark, err := imageutil.LoadWatermark(cfg.watermark, cfg.watermarkPos, cfg.watermarkAlpha)
+	if err != nil {
+		return err
+	}
+	imageutil.SetWatermark(mark)
+	return nil
+}
+
+// setQualityGuard parses a --quality-guard value and applies it.
+func setQualityGuard(value string) error {
+	guard, err := imageutil.ParseQualityGuard(value)
+	if err != nil {
+		return err
+	}
+	imageutil.SetQualityGuard(guard)
+	return nil
+}
+
+// openQueue opens the queue file for this run, honouring --queue-force and
+// --send-order.
+func (cfg *commonFlags) openQueue(path string, meta *queue.Meta) (*queue.Queue, error) {
+	order, err := queue.ParseOrder(cfg.sendOrder)
+	if err != nil {
+		return nil, err
+	}
+	var q *queue.Queue
+	if cfg.queueForce {
+		q, err = queue.NewForced(path, meta)
+	} else {
+		q, err = queue.New(path, meta)
+	}
+	var locked *queue.LockedError
+	if errors.As(err, &locked) {
+		return nil, fmt.Errorf("%w; stop the other process or pass --queue-force", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.SetOrder(order)
+	return q, nil
+}
+
+// attachSentIndex makes q skip content already sent to chatID and record
+// what it sends, when --global-dedup is set.
+func (cfg *commonFlags) attachSentIndex(q *queue.Queue, chatID string) error {
+	if !cfg.globalDedup {
+		return nil
+	}
+	index, err := openSentIndex()
+	if err != nil {
+		return fmt.Errorf("open sent index: %w", err)
+	}
+	if cfg.sandbox {
+		chatID = cfg.sandboxChatID
+	}
+	q.SetSentIndex(index, chatID)
+	return nil
+}
+
+func openSentIndex() (*sentindex.Index, error) {
+	dir, err := statedir.Resolve(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	return sentindex.Open(filepath.Join(dir, sentindex.FileName))
+}
+
+func (cfg *commonFlags) walkOptions() fswalk.Options {
+	return fswalk.Options{FollowSymlinks: cfg.followSymlinks, IncludeHidden: cfg.includeHidden, Strict: cfg.strict, IgnoreFile: cfg.ignoreFile, Skip: quarantineSkip(cfg.quarantine)}
+}
+
+// quarantineSkip returns the directories a walk leaves out so quarantined
+// files are not picked up again.
+func quarantineSkip(quarantine string) []string {
+	if quarantine == "" {
+		return nil
+	}
+	return []string{quarantine}
+}
+
+// walkProblems logs the paths a walk of root could not read and returns how
+// many there were. Other walk errors, and any unreadable path with
+// --strict, are returned as errors.
+func walkProblems(root string, walk fswalk.Options, err error) (int, error) {
+	var unreadable fswalk.Errors
+	if !errors.As(err, &unreadable) {
+		return 0, err
+	}
+	for _, problem := range unreadable {
+		log.Printf("cannot read: %v", problem)
+	}
+	if walk.Strict {
+		return len(unreadable), fmt.Errorf("%s is partially unreadable (--strict): %w", root, err)
+	}
+	log.Printf("skipped %d unreadable path(s) in %s", len(unreadable), root)
+	return len(unreadable), nil
+}
+
 func resolveConfig(cfg *commonFlags) ([]string, []string, error) {
 	apiURLs := []string{}
 	tokens := []string{}
@@ -76,7 +305,20 @@ func resolveConfig(cfg *commonFlags) ([]string, []string, error) {
 }
 
 func buildClient(cfg *commonFlags, apiURLs []string, tokens []string) (*telegram.Client, *telegram.URLPool, *telegram.TokenPool, error) {
+	tokenPinning, err := telegram.ParseTokenPinning(cfg.tokenPinning)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	videoPreset, err := transcode.ParsePreset(cfg.videoPreset)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	renameHook, err := rename.Hook(cfg.renameTemplate)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	urlPool := telegram.NewURLPool(apiURLs)
+	urlPool.SetPreferred(preferredURLs(cfg.preferURL))
 	tokenPool := telegram.NewTokenPool(tokens)
 	client := telegram.NewClient(urlPool, tokenPool)
 
@@ -100,9 +342,104 @@ func buildClient(cfg *commonFlags, apiURLs []string, tokens []string) (*telegram
 		client = telegram.NewClient(urlPool, tokenPool)
 	}
 
+	sendOpts := telegram.SendOptions{
+		Spoiler:        cfg.spoiler,
+		ProtectContent: cfg.protectContent,
+		Silent:         cfg.silent,
+		ReplyTo:        cfg.replyTo,
+		ReplyToStart:   cfg.replyToStart,
+		TokenPinning:   tokenPinning,
+		PrepareVideo:   videoPreset.Hook(),
+		Rename:         renameHook,
+		LocalFiles:     cfg.localAPIFiles,
+		AlsoAsDocument: cfg.alsoAsDocument,
+	}
+	if cfg.thumbnails {
+		sendOpts.Thumbnail = thumbnail.Generate
+	}
+	if cfg.sandbox {
+		if cfg.sandboxChatID == "" {
+			return nil, nil, nil, fmt.Errorf("--sandbox needs --sandbox-chat-id")
+		}
+		sandboxChat, err := resolveChatID(context.Background(), client, cfg.sandboxChatID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cfg.sandboxChatID = sandboxChat
+		sendOpts.Sandbox = sandboxChat
+		// Message IDs to reply to belong to the real chat.
+		sendOpts.ReplyTo = 0
+		log.Printf("sandbox: sending to chat %s instead of the real target", sandboxChat)
+	}
+	client = client.WithSendOptions(sendOpts)
+
+	if cfg.chatID != "" {
+		chatID, err := resolveChatID(context.Background(), client, cfg.chatID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if chatID != cfg.chatID {
+			cfg.chatRef = cfg.chatID
+			cfg.chatID = chatID
+		}
+	}
+
+	if cfg.verifyTarget && cfg.chatID != "" {
+		if err := client.VerifyTarget(context.Background(), cfg.chatID, topicPtr(cfg)); err != nil {
+			return nil, nil, nil, fmt.Errorf("target verification failed: %w", err)
+		}
+		log.Printf("verified target chat %s", cfg.chatID)
+	}
+
 	return client, urlPool, tokenPool, nil
 }
 
+func preferredURLs(value string) []string {
+	urls := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if url := config.NormalizeAPIURL(entry); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func defaultWatchQueueFile(watchDirs []string, chatID string, topicID *int) (string, error) {
+	dir, err := statedir.Resolve(stateDir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat("queue.jsonl"); err == nil {
+		log.Printf("found queue.jsonl in the current directory; pass --queue-file queue.jsonl to keep using it")
+	}
+	path := statedir.WatchQueuePath(dir, watchDirs, chatID, topicID)
+	log.Printf("using queue file %s", path)
+	return path, nil
+}
+
+// checkGroupSize clamps an album size to Telegram's 2-10 limit and warns
+// when the configured value had to change.
+func checkGroupSize(size int) int {
+	clamped := telegram.ClampGroupSize(size)
+	if clamped != size {
+		log.Printf("warning: group size %d is outside Telegram's %d-%d album limit, using %d", size, telegram.MinMediaGroupSize, telegram.MaxMediaGroupSize, clamped)
+	}
+	return clamped
+}
+
+// queueChatID is the chat as given on the command line, which names and
+// identifies queue files even after it was resolved to a numeric ID. A
+// sandbox run uses the sandbox chat so it never marks the real queue sent.
+func (cfg *commonFlags) queueChatID() string {
+	if cfg.sandbox {
+		return cfg.sandboxChatID
+	}
+	if cfg.chatRef != "" {
+		return cfg.chatRef
+	}
+	return cfg.chatID
+}
+
 func topicPtr(cfg *commonFlags) *int {
 	if cfg.topicID == 0 {
 		return nil
@@ -159,3 +496,7 @@ func (s *stringSlice) Type() string {
 func (s *stringSlice) Values() []string {
 	return s.values
 }
+
+func resolveChatID(ctx context.Context, client *telegram.Client, value string) (string, error) {
+	return chatid.Resolve(ctx, client, stateDir, value)
+}
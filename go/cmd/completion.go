@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate shell completion script",
+		Long: `Generate a shell completion script for telegram-send-go.
+
+Bash:
+  source <(telegram-send-go completion bash)
+  telegram-send-go completion bash > /etc/bash_completion.d/telegram-send-go
+
+Zsh:
+  telegram-send-go completion zsh > "${fpath[1]}/_telegram-send-go"
+
+Fish:
+  telegram-send-go completion fish > ~/.config/fish/completions/telegram-send-go.fish
+
+PowerShell:
+  telegram-send-go completion powershell | Out-String | Invoke-Expression`,
+		Args:                  cobra.ExactArgs(1),
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		DisableFlagsInUseLine: true,
+		SilenceUsage:          true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			out := cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return fmt.Errorf("unsupported shell: %s", args[0])
+			}
+		},
+	}
+}
+
+func newGenDocsCmd() *cobra.Command {
+	var outDir string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:          "gen-docs",
+		Short:        "Generate man pages or markdown docs for all commands",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				return fmt.Errorf("create output dir: %w", err)
+			}
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			switch format {
+			case "man":
+				header := &doc.GenManHeader{
+					Title:   "TELEGRAM-SEND-GO",
+					Section: "1",
+					Source:  "telegram-upload-watcher",
+				}
+				if err := doc.GenManTree(root, header, outDir); err != nil {
+					return fmt.Errorf("generate man pages: %w", err)
+				}
+			case "markdown", "md":
+				if err := doc.GenMarkdownTree(root, outDir); err != nil {
+					return fmt.Errorf("generate markdown docs: %w", err)
+				}
+			default:
+				return fmt.Errorf("unsupported format: %s (use man or markdown)", format)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Docs written to %s\n", outDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&outDir, "out", "docs/man", "Output directory")
+	cmd.Flags().StringVar(&format, "format", "man", "Output format: man or markdown")
+	return cmd
+}
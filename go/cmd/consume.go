@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+// queueSenderFlags are the sending options of commands that only send what
+// other processes put in queue files.
+type queueSenderFlags struct {
+	sendInterval     int
+	statusInterval   int
+	onModified       string
+	ordering         string
+	queueFsync       bool
+	metadataCaptions bool
+	groupSize        int
+	groupMaxBytes    int64
+	albumVideos      bool
+	batchDelay       int
+	pauseEvery       int
+	pauseSeconds     int
+	maxDimension     int
+	maxBytes         int
+	pngStart         int
+	zipPasses        stringSlice
+	zipPassFile      string
+	controlSocket    string
+	phashDedup       bool
+	phashDistance    int
+	autoSplit        string
+	memoryBudget     string
+	dailyLimitFiles  int
+	dailyLimitBytes  int64
+	quotaTimezone    string
+}
+
+func newConsumeCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	send := &queueSenderFlags{}
+	queueFiles := &stringSlice{}
+
+	cmd := &cobra.Command{
+		Use:   "consume",
+		Short: "Send the items of several queue files with one sender",
+		Long: "consume sends what other processes add to the given queue files, for example watchers or\n" +
+			"queue add runs on other hosts writing to shared storage. Items from all queues go out in one\n" +
+			"order: highest priority first, then by --send-order (oldest by default). Each queue is sent\n" +
+			"to the chat recorded in its metadata, or to --chat-id when it has none. Queue files matching\n" +
+			"a --queue-file pattern are picked up at start; restart to add new ones.",
+		Args:         cobra.NoArgs,
+		Annotations:  map[string]string{longRunningAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths, err := expandQueueFiles(queueFiles.Values())
+			if err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				return fmt.Errorf("queue-file is required")
+			}
+			return send.run(cmd.Context(), cfg, paths)
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.Lookup("chat-id").Usage = "Target chat for queue files whose metadata records none"
+	flags.Var(queueFiles, "queue-file", "Queue file or glob pattern to consume (repeatable or comma-separated)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.StringVar(&send.controlSocket, "control-socket", "", "Unix socket for ctl pause|resume|status (default none)")
+	send.bind(cmd, cfg)
+	return cmd
+}
+
+func newSendQueueCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	send := &queueSenderFlags{}
+	watchDirs := &stringSlice{}
+	var queueFile string
+
+	cmd := &cobra.Command{
+		Use:   "send-queue",
+		Short: "Send the items a watch --enqueue-only adds to a queue file",
+		Long: "send-queue is the sending half of watch --enqueue-only: it keeps sending the items added to the\n" +
+			"queue file and picks up new ones before every batch. Pass the same --queue-file, or the same\n" +
+			"--watch-dir, --chat-id and --topic-id, to use the watch's default queue file. Items go to the\n" +
+			"chat recorded in the queue metadata, or to --chat-id when it has none.",
+		Args:         cobra.NoArgs,
+		Annotations:  map[string]string{longRunningAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if queueFile == "" {
+				absWatchDirs, err := resolveWatchDirs(watchDirs.Values())
+				if err != nil {
+					return err
+				}
+				if len(absWatchDirs) == 0 || cfg.chatID == "" {
+					return fmt.Errorf("queue-file, or watch-dir and chat-id, is required")
+				}
+				if queueFile, err = defaultWatchQueueFile(absWatchDirs, cfg.chatID, topicPtr(cfg)); err != nil {
+					return err
+				}
+			}
+			queueFile, err := filepath.Abs(queueFile)
+			if err != nil {
+				return err
+			}
+			if send.controlSocket == "" {
+				send.controlSocket = controlSocketPath(queueFile)
+			} else if send.controlSocket == "none" {
+				send.controlSocket = ""
+			}
+			return send.run(cmd.Context(), cfg, []string{queueFile})
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&queueFile, "queue-file", "", "Queue file to send from (default: the watch's per-target file under --state-dir)")
+	flags.Var(watchDirs, "watch-dir", "Folder of the enqueue-only watch, to find its default queue file (repeatable or comma-separated)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.StringVar(&send.controlSocket, "control-socket", "", "Unix socket for ctl pause|resume|status (default <queue-file>.sock, \"none\" disables)")
+	send.bind(cmd, cfg)
+	return cmd
+}
+
+func (send *queueSenderFlags) bind(cmd *cobra.Command, cfg *commonFlags) {
+	flags := cmd.Flags()
+	flags.IntVar(&send.sendInterval, "send-interval", 30, "Queue send interval (seconds)")
+	flags.IntVar(&send.statusInterval, "status-interval", 0, "Log each queue's depth, send rate and ETA every N seconds (0 disables)")
+	flags.StringVar(&send.onModified, "on-modified", sender.ModifiedUpdate, "Files changed between enqueue and send: update (send current content), resend (skip; the watcher re-enqueues once settled) or skip")
+	flags.StringVar(&send.ordering, "ordering", sender.OrderingRelaxed, "Media group order: strict (hold later items until a failed group is sent) or relaxed (retry failed groups in a later pass)")
+	flags.BoolVar(&send.queueFsync, "queue-fsync", false, "Fsync the queue files after every write batch so a power loss cannot lose recorded progress")
+	flags.BoolVar(&send.metadataCaptions, "metadata-captions", false, "Caption documents, videos and audio with their path relative to the watch directory in the queue metadata, size and mtime")
+	flags.IntVar(&send.groupSize, "group-size", 4, "Images per media group")
+	flags.Int64Var(&send.groupMaxBytes, "group-max-bytes", 0, "Close a media group early when its images would exceed this many bytes (0 disables)")
+	flags.BoolVar(&send.albumVideos, "album-videos", false, "Batch videos up to 20 MB into albums with images instead of sending them alone")
+	flags.IntVar(&send.batchDelay, "batch-delay", 3, "Delay between media groups (seconds)")
+	flags.IntVar(&send.pauseEvery, "pause-every", 0, "Pause after sending this many images (0 disables)")
+	flags.IntVar(&send.pauseSeconds, "pause-seconds", 0, "Pause duration in seconds")
+	flags.IntVar(&send.maxDimension, "max-dimension", 2000, "Maximum image dimension before scaling")
+	bindResizeBackendFlag(cmd, cfg)
+	flags.IntVar(&send.maxBytes, "max-bytes", 5*1024*1024, "Maximum image size in bytes before PNG compression")
+	flags.IntVar(&send.pngStart, "png-start-level", 8, "Initial PNG compression level (0-9)")
+	flags.BoolVar(&send.phashDedup, "phash-dedup", false, "Skip images that look like an image already sent from the same queue")
+	flags.IntVar(&send.phashDistance, "phash-distance", 4, "Maximum perceptual hash distance (0-64 bits) treated as a duplicate")
+	flags.StringVar(&send.memoryBudget, "memory-budget", "", "Cap the memory used for loading and resizing files, e.g. 256MB; albums close early and files over a quarter of it are streamed from disk")
+	flags.StringVar(&send.autoSplit, "auto-split", "", "Split files larger than SIZE into zip or 7z volumes and send the parts, e.g. zip:1900MB (7z needs the 7z binary)")
+	flags.IntVar(&send.dailyLimitFiles, "daily-limit-files", 0, "Pause sending until midnight after this many files in a day across all queues (0 disables)")
+	flags.Int64Var(&send.dailyLimitBytes, "daily-limit-bytes", 0, "Pause sending until midnight after this many bytes in a day across all queues (0 disables)")
+	flags.StringVar(&send.quotaTimezone, "quota-timezone", "", "IANA timezone whose midnight resets the daily limits (default local time)")
+	flags.Var(&send.zipPasses, "zip-pass", "Zip password (repeatable or comma-separated)")
+	flags.StringVar(&send.zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
+}
+
+// run opens the queue files at paths and sends their items until ctx is
+// done. Each queue goes to the chat in its metadata, or cfg's chat.
+func (send *queueSenderFlags) run(ctx context.Context, cfg *commonFlags, paths []string) error {
+	cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+	groupSize := checkGroupSize(send.groupSize)
+	if err := cfg.setupImages(); err != nil {
+		return err
+	}
+	split, err := splitter.ParseSpec(send.autoSplit)
+	if err != nil {
+		return err
+	}
+	memoryLimit := int64(0)
+	if send.memoryBudget != "" && send.memoryBudget != "0" {
+		if memoryLimit, err = splitter.ParseSize(send.memoryBudget); err != nil {
+			return fmt.Errorf("invalid memory-budget: %w", err)
+		}
+	}
+	modifiedPolicy, err := sender.ParseModifiedPolicy(send.onModified)
+	if err != nil {
+		return err
+	}
+	ordering, err := sender.ParseOrdering(send.ordering)
+	if err != nil {
+		return err
+	}
+	quotaLocation, err := sender.LoadQuotaLocation(send.quotaTimezone)
+	if err != nil {
+		return err
+	}
+	zipPasswords, err := loadZipPasswords(send.zipPasses.Values(), send.zipPassFile)
+	if err != nil {
+		return err
+	}
+
+	apiURLs, tokens, err := resolveConfig(cfg)
+	if err != nil {
+		return err
+	}
+	client, _, _, err := buildClient(cfg, apiURLs, tokens)
+	if err != nil {
+		return err
+	}
+
+	sources := make([]sender.Source, 0, len(paths))
+	defer func() {
+		for _, src := range sources {
+			src.Queue.Close()
+		}
+	}()
+	captionRoots := []string{}
+	for _, path := range paths {
+		q, err := cfg.openQueue(path, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		q.SetFsync(send.queueFsync)
+		sources = append(sources, sender.Source{Queue: q, Name: path})
+		src := &sources[len(sources)-1]
+		meta := q.FileMeta()
+		if meta != nil && meta.Params.ChatID != "" {
+			chatID, err := resolveChatID(ctx, client, meta.Params.ChatID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			src.ChatID = chatID
+			src.TopicID = meta.Params.TopicID
+		} else if cfg.chatID == "" {
+			return fmt.Errorf("%s records no chat; pass --chat-id", path)
+		}
+		if meta != nil {
+			captionRoots = append(captionRoots, meta.Params.WatchDir...)
+		}
+		target := cfg.chatID
+		if src.ChatID != "" {
+			target = src.ChatID
+		}
+		if err := cfg.attachSentIndex(q, target); err != nil {
+			return err
+		}
+		log.Printf("sending %s (%d pending) to chat %s", path, len(q.Pending(0)), target)
+	}
+
+	retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+	sendCfg := sender.Config{
+		ChatID:        cfg.chatID,
+		TopicID:       topicPtr(cfg),
+		GroupSize:     groupSize,
+		GroupMaxBytes: send.groupMaxBytes,
+		SendInterval:  time.Duration(send.sendInterval) * time.Second,
+		BatchDelay:    time.Duration(send.batchDelay) * time.Second,
+		PauseEvery:    send.pauseEvery,
+		PauseSeconds:  time.Duration(send.pauseSeconds) * time.Second,
+		MaxDimension:  send.maxDimension,
+		MaxBytes:      send.maxBytes,
+		PNGStartLevel: send.pngStart,
+		Retry:         retry,
+		ZipPasswords:  zipPasswords,
+		PHashDedup:    send.phashDedup,
+		PHashDistance: send.phashDistance,
+		AlbumVideos:   send.albumVideos,
+		AutoSplit:     split,
+		DailyQuota:    sender.Quota{Files: send.dailyLimitFiles, Bytes: send.dailyLimitBytes, Location: quotaLocation},
+
+		ModifiedPolicy:   modifiedPolicy,
+		Ordering:         ordering,
+		MetadataCaptions: send.metadataCaptions,
+		CaptionRoots:     captionRoots,
+		StatusInterval:   time.Duration(send.statusInterval) * time.Second,
+		Memory:           sender.NewMemoryBudget(memoryLimit),
+		Quarantine:       cfg.quarantine,
+	}
+
+	pause := runcontrol.NewPauseGate()
+	controlDone := make(chan struct{})
+	if send.controlSocket == "" {
+		close(controlDone)
+	} else {
+		go func() {
+			defer close(controlDone)
+			stats := func() map[string]map[string]int {
+				all := map[string]map[string]int{}
+				for _, src := range sources {
+					all[src.Name] = src.Queue.Stats()
+				}
+				return all
+			}
+			if err := runcontrol.ServeControl(ctx, send.controlSocket, pause, stats); err != nil {
+				log.Printf("control socket disabled: %v", err)
+			}
+		}()
+		log.Printf("control socket %s", send.controlSocket)
+	}
+	go sender.LoopSources(ctx, runcontrol.NewLive(sendCfg), sources, client, pause, nil)
+
+	<-ctx.Done()
+	<-controlDone
+	return nil
+}
+
+// expandQueueFiles expands glob patterns among values and returns the
+// absolute queue file paths without repeats. Values without glob
+// characters are kept even when the file does not exist yet.
+func expandQueueFiles(values []string) ([]string, error) {
+	paths := []string{}
+	seen := map[string]struct{}{}
+	for _, value := range values {
+		matches := []string{value}
+		if strings.ContainsAny(value, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(value); err != nil {
+				return nil, fmt.Errorf("invalid queue-file pattern %q: %w", value, err)
+			}
+			if len(matches) == 0 {
+				log.Printf("no queue files match %s", value)
+			}
+		}
+		for _, match := range matches {
+			abs, err := filepath.Abs(match)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[abs]; ok {
+				continue
+			}
+			seen[abs] = struct{}{}
+			paths = append(paths, abs)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/spf13/cobra"
+)
+
+func newCtlCmd() *cobra.Command {
+	var socketPath string
+	var queueFile string
+
+	cmd := &cobra.Command{
+		Use:          "ctl pause|resume|status",
+		Short:        "Pause, resume or query a running watch or daemon",
+		Args:         cobra.ExactArgs(1),
+		ValidArgs:    []string{"pause", "resume", "status"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if socketPath == "" && queueFile != "" {
+				socketPath = controlSocketPath(queueFile)
+			}
+			if socketPath == "" {
+				return fmt.Errorf("socket or queue-file is required")
+			}
+			response, err := runcontrol.SendControl(socketPath, args[0])
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			state := "running"
+			if response.Paused {
+				state = "paused"
+			}
+			fmt.Fprintf(out, "state: %s\n", state)
+			names := make([]string, 0, len(response.Queues))
+			for name := range response.Queues {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				stats := response.Queues[name]
+				fmt.Fprintf(out, "%s: queued=%d sending=%d sent=%d failed=%d failed_permanent=%d source_missing=%d skipped=%d\n",
+					name, stats[queue.StatusQueued], stats[queue.StatusSending], stats[queue.StatusSent], stats[queue.StatusFailed], stats[queue.StatusFailedPermanent], stats[queue.StatusSourceMissing], stats[queue.StatusSkipped])
+			}
+			for _, stats := range response.Latency {
+				fmt.Fprintf(out, "api %s\n", formatRequestStats(stats))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&socketPath, "socket", "", "Control socket of the running watch or daemon")
+	cmd.Flags().StringVar(&queueFile, "queue-file", "", "Queue file of the running watch (uses <queue-file>.sock)")
+	return cmd
+}
+
+// controlSocketPath is the default control socket of a watch using queueFile.
+func controlSocketPath(queueFile string) string {
+	return queueFile + ".sock"
+}
@@ -0,0 +1,663 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/api"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/config"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/notify"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/rename"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/thumbnail"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/transcode"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newDaemonCmd() *cobra.Command {
+	var configPath string
+	var logFormat string
+	var controlSocket string
+	var apiListen string
+
+	cmd := &cobra.Command{
+		Use:          "daemon",
+		Short:        "Run all watch jobs from one config file (container entrypoint)",
+		Args:         cobra.NoArgs,
+		Annotations:  map[string]string{longRunningAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := config.DaemonConfigPath(configPath)
+			daemonCfg, err := config.LoadDaemonConfig(path)
+			if err != nil {
+				return err
+			}
+			if logFormat == "" {
+				logFormat = daemonCfg.LogFormat
+			}
+			setupDaemonLogger(logFormat)
+			if err := imageutil.SetResizeBackend(daemonCfg.ResizeBackend); err != nil {
+				return err
+			}
+			if err := setDaemonWatermark(daemonCfg); err != nil {
+				return err
+			}
+			if err := setQualityGuard(daemonCfg.QualityGuard); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("lang") && daemonCfg.Lang != "" {
+				if err := i18n.SetLang(daemonCfg.Lang); err != nil {
+					return err
+				}
+			}
+			if tempDir == "" && daemonCfg.TempDir != "" {
+				if err := tempdir.Set(daemonCfg.TempDir); err != nil {
+					return err
+				}
+			}
+			if otlpEndpoint == "" && daemonCfg.OTLPEndpoint != "" {
+				headers := otlpHeaders
+				if len(headers) == 0 {
+					headers = daemonCfg.OTLPHeaders
+				}
+				if err := setupTracing(daemonCfg.OTLPEndpoint, headers); err != nil {
+					return err
+				}
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+			defer signal.Stop(signals)
+
+			changes := make(chan struct{}, 1)
+			watchCtx, stopWatch := context.WithCancel(context.Background())
+			defer stopWatch()
+			go runcontrol.WatchFile(watchCtx, path, 2*time.Second, func() {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			})
+
+			pause := runcontrol.NewPauseGate()
+			var current atomic.Pointer[daemonJobs]
+			if controlSocket == "" {
+				controlSocket = daemonCfg.ControlSocket
+			}
+			controlDone := make(chan struct{})
+			defer func() {
+				stopWatch()
+				<-controlDone
+			}()
+			if controlSocket == "none" {
+				close(controlDone)
+			} else {
+				go func() {
+					defer close(controlDone)
+					stats := func() map[string]map[string]int { return current.Load().stats() }
+					if err := runcontrol.ServeControl(watchCtx, controlSocket, pause, stats); err != nil {
+						slog.Warn("control socket disabled", "path", controlSocket, "error", err)
+					}
+				}()
+				slog.Info("control socket", "path", controlSocket)
+			}
+
+			if apiListen == "" {
+				apiListen = daemonCfg.APIListen
+			}
+			apiDone := make(chan struct{})
+			defer func() {
+				stopWatch()
+				<-apiDone
+			}()
+			if apiListen == "" || apiListen == "none" {
+				close(apiDone)
+			} else {
+				if daemonCfg.APIToken == "" && !loopbackAddr(apiListen) {
+					slog.Warn("API listens beyond localhost without api_token", "addr", apiListen)
+				}
+				go func() {
+					defer close(apiDone)
+					jobs := func() (map[string]api.Job, func()) { return current.Load().apiJobs() }
+					if err := api.Serve(watchCtx, apiListen, daemonCfg.APIToken, pause, jobs); err != nil {
+						slog.Warn("API disabled", "addr", apiListen, "error", err)
+					}
+				}()
+				slog.Info("API server", "addr", apiListen)
+			}
+
+			prepared, err := prepareDaemonJobs(daemonCfg)
+			if err != nil {
+				return err
+			}
+			jobs, err := launchDaemonJobs(daemonCfg, prepared, pause)
+			if err != nil {
+				return err
+			}
+			current.Store(jobs)
+			for {
+				select {
+				case <-changes:
+					reloaded, err := config.LoadDaemonConfig(path)
+					if err != nil {
+						slog.Error("config changed but is invalid, keeping current settings", "path", path, "error", err)
+						continue
+					}
+					jobs.applySafe(reloaded)
+				case sig := <-signals:
+					if sig != syscall.SIGHUP {
+						slog.Info("shutting down", "signal", sig.String())
+						current.Store(nil)
+						jobs.stop()
+						return nil
+					}
+					slog.Info("reloading config", "path", path)
+					reloaded, err := config.LoadDaemonConfig(path)
+					if err != nil {
+						slog.Error("reload failed, keeping current jobs", "error", err)
+						continue
+					}
+					// Resolve chats before stopping anything, so a network
+					// outage leaves the current jobs running.
+					prepared, err := prepareDaemonJobs(reloaded)
+					if err != nil {
+						slog.Error("reload failed, keeping current jobs", "error", err)
+						continue
+					}
+					if err := imageutil.SetResizeBackend(reloaded.ResizeBackend); err != nil {
+						slog.Error("keeping resize backend", "error", err)
+					}
+					if err := setDaemonWatermark(reloaded); err != nil {
+						slog.Error("keeping watermark", "error", err)
+					}
+					if err := setQualityGuard(reloaded.QualityGuard); err != nil {
+						slog.Error("keeping quality guard", "error", err)
+					}
+					// Unpublish the jobs before stopping them so the control
+					// socket and API never see queues being closed.
+					previous := jobs
+					current.Store(nil)
+					previous.stop()
+					jobs, err = launchDaemonJobs(reloaded, prepared, pause)
+					if err != nil {
+						slog.Error("reload failed, restarting previous jobs", "error", err)
+						if jobs, err = launchDaemonJobs(previous.cfg, previous.prepared, pause); err != nil {
+							return err
+						}
+					}
+					current.Store(jobs)
+				}
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&configPath, "config", "", "Path to INI config file (default $TELEGRAM_UPLOAD_WATCHER_CONFIG or ./config.ini)")
+	flags.StringVar(&controlSocket, "control-socket", "", "Unix socket for ctl pause|resume|status (default from [Daemon] control_socket, daemon.sock next to the config; \"none\" disables)")
+	flags.StringVar(&apiListen, "api-listen", "", "Serve the HTTP control API on this address, e.g. 127.0.0.1:8787 (default from [Daemon] api_listen, off; \"none\" disables)")
+	flags.StringVar(&logFormat, "log-format", "", "Log format: json or text (default from [Daemon] log_format, json)")
+	return cmd
+}
+
+// setupDaemonLogger routes both slog and the standard log package through a
+// single handler so internal log.Printf output is structured too.
+func setupDaemonLogger(format string) {
+	var handler slog.Handler
+	if format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(handler))
+	log.SetFlags(0)
+}
+
+type daemonJobs struct {
+	cfg      *config.DaemonConfig
+	prepared []*preparedJob
+	pause    *runcontrol.PauseGate
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	jobs     map[string]*daemonJob
+	memory   *sender.MemoryBudget
+	// users is held for reading by API requests using the jobs, so that
+	// stop waits for them before closing the queues.
+	users   sync.RWMutex
+	stopped bool
+}
+
+// preparedJob is a job with its options parsed and its chat resolved, so
+// that starting it needs no network.
+type preparedJob struct {
+	job       config.WatchJob
+	client    *telegram.Client
+	chatID    string
+	watchCfgs []watcher.Config
+	sendCfg   sender.Config
+	notifyCfg notify.Config
+	meta      *queue.Meta
+}
+
+type daemonJob struct {
+	job config.WatchJob
+	// prepared is kept in step with live changes so that a failed reload
+	// can restart the job as it runs now.
+	prepared *preparedJob
+	// chatID is job.ChatID resolved to a numeric ID.
+	chatID     string
+	queue      *queue.Queue
+	watchLives []*runcontrol.Live[watcher.Config]
+	sendLive   *runcontrol.Live[sender.Config]
+	notifyLive *runcontrol.Live[notify.Config]
+	scan       *runcontrol.Trigger
+}
+
+// prepareDaemonJobs parses the options of every job and resolves and
+// verifies its chat.
+func prepareDaemonJobs(cfg *config.DaemonConfig) ([]*preparedJob, error) {
+	client := telegram.NewClient(telegram.NewURLPool(cfg.APIURLs), telegram.NewTokenPool(cfg.Tokens))
+	prepared := []*preparedJob{}
+	for _, job := range cfg.Jobs {
+		p, err := prepareDaemonJob(context.Background(), job, client)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		prepared = append(prepared, p)
+	}
+	return prepared, nil
+}
+
+// launchDaemonJobs opens the queues of prepared jobs and starts them.
+func launchDaemonJobs(cfg *config.DaemonConfig, prepared []*preparedJob, pause *runcontrol.PauseGate) (*daemonJobs, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := &daemonJobs{cfg: cfg, prepared: prepared, pause: pause, cancel: cancel, jobs: map[string]*daemonJob{}, memory: sender.NewMemoryBudget(cfg.MemoryBudget)}
+	for _, p := range prepared {
+		if err := jobs.start(ctx, p); err != nil {
+			jobs.stop()
+			return nil, fmt.Errorf("job %s: %w", p.job.Name, err)
+		}
+		slog.Info("started job", "job", p.job.Name, "watch_dir", p.job.WatchDirs, "chat_id", p.job.ChatID, "queue_file", p.job.QueueFile)
+	}
+	return jobs, nil
+}
+
+func prepareDaemonJob(ctx context.Context, job config.WatchJob, client *telegram.Client) (*preparedJob, error) {
+	watchCfgs, sendCfg, notifyCfg, meta, err := daemonJobConfigs(job)
+	if err != nil {
+		return nil, err
+	}
+	tokenPinning, err := telegram.ParseTokenPinning(job.TokenPinning)
+	if err != nil {
+		return nil, err
+	}
+	videoPreset, err := transcode.ParsePreset(job.VideoPreset)
+	if err != nil {
+		return nil, err
+	}
+	renameHook, err := rename.Hook(job.RenameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	sendOpts := telegram.SendOptions{
+		Spoiler:        job.Spoiler,
+		ProtectContent: job.ProtectContent,
+		Silent:         job.Silent,
+		ReplyTo:        job.ReplyTo,
+		TokenPinning:   tokenPinning,
+		PrepareVideo:   videoPreset.Hook(),
+		Rename:         renameHook,
+		LocalFiles:     job.LocalAPIFiles,
+		AlsoAsDocument: job.AlsoAsDocument,
+	}
+	if job.Thumbnails {
+		sendOpts.Thumbnail = thumbnail.Generate
+	}
+	client = client.WithSendOptions(sendOpts)
+	chatID, err := resolveChatID(ctx, client, job.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	sendCfg.ChatID = chatID
+	if job.VerifyTarget {
+		if err := client.VerifyTarget(ctx, chatID, sendCfg.TopicID); err != nil {
+			return nil, fmt.Errorf("target verification failed: %w", err)
+		}
+	}
+	return &preparedJob{job: job, client: client, chatID: chatID, watchCfgs: watchCfgs, sendCfg: sendCfg, notifyCfg: notifyCfg, meta: meta}, nil
+}
+
+func (j *daemonJobs) start(ctx context.Context, p *preparedJob) error {
+	job, client, chatID, meta := p.job, p.client, p.chatID, p.meta
+	sendCfg := p.sendCfg
+	sendCfg.Memory = j.memory
+	q, err := queue.New(job.QueueFile, meta)
+	if err != nil {
+		return err
+	}
+	q.SetFsync(job.QueueFsync)
+	q.SetOrder(job.SendOrder)
+	if job.GlobalDedup {
+		index, err := openSentIndex()
+		if err != nil {
+			q.Close()
+			return fmt.Errorf("open sent index: %w", err)
+		}
+		q.SetSentIndex(index, chatID)
+	}
+	running := &daemonJob{
+		job:        job,
+		prepared:   p,
+		chatID:     chatID,
+		queue:      q,
+		sendLive:   runcontrol.NewLive(sendCfg),
+		notifyLive: runcontrol.NewLive(p.notifyCfg),
+		scan:       runcontrol.NewTrigger(),
+	}
+	j.jobs[job.Name] = running
+
+	for _, watchCfg := range p.watchCfgs {
+		live := runcontrol.NewLive(watchCfg)
+		running.watchLives = append(running.watchLives, live)
+		j.run(func() { watcher.WatchLoopTriggered(ctx, live, q, j.pause, running.scan) })
+	}
+	j.run(func() { sweepLoop(ctx, q, job.QueueFile) })
+	if job.PruneSent > 0 {
+		j.run(func() { pruneLoop(ctx, q, job.QueueFile, job.PruneSent) })
+	}
+	j.run(func() { sender.LoopLive(ctx, running.sendLive, q, client, j.pause, nil) })
+	j.run(func() { notify.LoopLive(ctx, running.notifyLive, q, client, chatID, meta.Params.TopicID) })
+	return nil
+}
+
+// stats reports queue counts per job for the control socket.
+func (j *daemonJobs) stats() map[string]map[string]int {
+	stats := map[string]map[string]int{}
+	if j == nil {
+		return stats
+	}
+	for name, job := range j.jobs {
+		stats[name] = job.queue.Stats()
+	}
+	return stats
+}
+
+// apiJobs returns the running jobs for the HTTP API and the func that
+// releases them, or nil jobs while a reload replaces them.
+func (j *daemonJobs) apiJobs() (map[string]api.Job, func()) {
+	if j == nil {
+		return nil, func() {}
+	}
+	j.users.RLock()
+	if j.stopped {
+		j.users.RUnlock()
+		return nil, func() {}
+	}
+	jobs := map[string]api.Job{}
+	for name, job := range j.jobs {
+		jobs[name] = api.Job{Queue: job.queue, Send: job.sendLive, Watch: job.watchLives, Scan: job.scan}
+	}
+	return jobs, j.users.RUnlock
+}
+
+// loopbackAddr reports whether a listen address only accepts local
+// connections.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// applySafe updates running jobs in place from a reloaded config. Changes
+// that need new queues or clients are logged and left for SIGHUP.
+func (j *daemonJobs) applySafe(next *config.DaemonConfig) {
+	if !reflect.DeepEqual(j.cfg.APIURLs, next.APIURLs) || !reflect.DeepEqual(j.cfg.Tokens, next.Tokens) {
+		slog.Warn("credential changes are not applied live; send SIGHUP or restart to apply")
+	}
+	seen := map[string]bool{}
+	for _, job := range next.Jobs {
+		seen[job.Name] = true
+		running, ok := j.jobs[job.Name]
+		if !ok {
+			slog.Warn("new job is not started live; send SIGHUP or restart to apply", "job", job.Name)
+			continue
+		}
+		merged, rejected := config.MergeSafeJobChanges(running.job, job)
+		if len(rejected) > 0 {
+			slog.Error("rejected unsafe config change; send SIGHUP or restart to apply", "job", job.Name, "fields", rejected)
+		}
+		if reflect.DeepEqual(merged, running.job) {
+			continue
+		}
+		watchCfgs, sendCfg, notifyCfg, meta, err := daemonJobConfigs(merged)
+		if err != nil {
+			slog.Error("config change not applied", "job", job.Name, "error", err)
+			continue
+		}
+		for i, live := range running.watchLives {
+			live.Store(watchCfgs[i])
+		}
+		sendCfg.Memory = j.memory
+		sendCfg.ChatID = running.chatID
+		running.sendLive.Store(sendCfg)
+		running.notifyLive.Store(notifyCfg)
+		if err := running.queue.UpdateMeta(meta); err != nil {
+			slog.Error("queue metadata update failed", "job", job.Name, "error", err)
+		}
+		running.queue.SetFsync(merged.QueueFsync)
+		running.queue.SetOrder(merged.SendOrder)
+		running.job = merged
+		*running.prepared = preparedJob{job: merged, client: running.prepared.client, chatID: running.chatID, watchCfgs: watchCfgs, sendCfg: sendCfg, notifyCfg: notifyCfg, meta: meta}
+		slog.Info("applied config change", "job", job.Name)
+	}
+	for name := range j.jobs {
+		if !seen[name] {
+			slog.Warn("removed job keeps running; send SIGHUP or restart to apply", "job", name)
+		}
+	}
+}
+
+func daemonJobConfigs(job config.WatchJob) ([]watcher.Config, sender.Config, notify.Config, *queue.Meta, error) {
+	zipPasswords, err := loadZipPasswords(job.ZipPasswords, job.ZipPassFile)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, err
+	}
+	split, err := splitter.ParseSpec(job.AutoSplit)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	modifiedPolicy, err := sender.ParseModifiedPolicy(job.OnModified)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	ordering, err := sender.ParseOrdering(job.Ordering)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	quotaLocation, err := sender.LoadQuotaLocation(job.QuotaTimezone)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	topics, err := watcher.ParseTopicMap(job.TopicMap)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	sinks, err := notify.ParseSinks(job.NotifySinks)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	notifyMode, err := notify.ParseMode(job.NotifyMode)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	dailyAt, err := notify.ParseDailyAt(job.NotifyDailyAt)
+	if err != nil {
+		return nil, sender.Config{}, notify.Config{}, nil, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.WithAll {
+		job.WithImage = true
+		job.WithVideo = true
+		job.WithAudio = true
+	}
+	if !job.WithImage && !job.WithVideo && !job.WithAudio {
+		job.WithImage = true
+	}
+	var topicID *int
+	if job.TopicID != 0 {
+		topicID = &job.TopicID
+	}
+
+	absWatchDirs := make([]string, 0, len(job.WatchDirs))
+	for _, watchDir := range job.WatchDirs {
+		absWatchDir, err := filepath.Abs(watchDir)
+		if err != nil {
+			return nil, sender.Config{}, notify.Config{}, nil, err
+		}
+		absWatchDirs = append(absWatchDirs, absWatchDir)
+	}
+	meta := &queue.Meta{
+		Params: queue.MetaParams{
+			Command:   "watch",
+			WatchDir:  queue.WatchDirs(absWatchDirs),
+			Recursive: job.Recursive,
+			ChatID:    job.ChatID,
+			TopicID:   topicID,
+			WithImage: job.WithImage,
+			WithVideo: job.WithVideo,
+			WithAudio: job.WithAudio,
+			WithAll:   job.WithAll,
+			Include:   job.Include,
+			Exclude:   job.Exclude,
+		},
+	}
+
+	unreadable := &fswalk.Unreadable{}
+	watchCfgs := make([]watcher.Config, 0, len(absWatchDirs))
+	for _, watchDir := range absWatchDirs {
+		watchCfgs = append(watchCfgs, watcher.Config{
+			Root:           watchDir,
+			Recursive:      job.Recursive,
+			IncludeGlobs:   job.Include,
+			ExcludeGlobs:   job.Exclude,
+			WithImage:      job.WithImage,
+			WithVideo:      job.WithVideo,
+			WithAudio:      job.WithAudio,
+			WithAll:        job.WithAll,
+			ScanInterval:   time.Duration(job.ScanInterval) * time.Second,
+			SettleSeconds:  job.SettleSeconds,
+			ScanWorkers:    job.ScanWorkers,
+			DirCache:       job.ScanDirCache,
+			FollowSymlinks: job.FollowSymlinks,
+			IncludeHidden:  job.IncludeHidden,
+			Strict:         job.Strict,
+			IgnoreFile:     job.IgnoreFile,
+			Skip:           quarantineSkip(job.Quarantine),
+			Unreadable:     unreadable,
+			Priority:       job.Priority,
+			Topics:         topics,
+		})
+	}
+	notifyCfg := notify.Config{
+		Enabled:      job.Notify || job.NotifyErrorOnly || len(sinks) > 0,
+		Interval:     time.Duration(job.NotifyInterval) * time.Second,
+		NotifyOnIdle: true,
+
+		FailureInterval: time.Duration(job.DigestInterval) * time.Second,
+		ErrorOnly:       job.NotifyErrorOnly,
+		Sinks:           sinks,
+		SinkOnly:        job.NotifySinkOnly,
+		Unreadable:      unreadable,
+		Mode:            notifyMode,
+		IdleMax:         time.Duration(job.NotifyIdleMax) * time.Second,
+		DailyAt:         dailyAt,
+	}
+	sendCfg := sender.Config{
+		ChatID:        job.ChatID,
+		TopicID:       topicID,
+		GroupSize:     checkGroupSize(job.GroupSize),
+		GroupMaxBytes: job.GroupMaxBytes,
+		SendInterval:  time.Duration(job.SendInterval) * time.Second,
+		BatchDelay:    time.Duration(job.BatchDelay) * time.Second,
+		PauseEvery:    job.PauseEvery,
+		PauseSeconds:  time.Duration(job.PauseSeconds) * time.Second,
+		MaxDimension:  job.MaxDimension,
+		MaxBytes:      job.MaxBytes,
+		PNGStartLevel: job.PNGStartLevel,
+		Retry:         telegram.RetryConfig{MaxRetries: job.MaxRetries, Delay: time.Duration(job.RetryDelay) * time.Second},
+		ZipPasswords:  zipPasswords,
+		PHashDedup:    job.PHashDedup,
+		PHashDistance: job.PHashDistance,
+		AlbumVideos:   job.AlbumVideos,
+		AutoSplit:     split,
+		DailyQuota:    sender.Quota{Files: job.DailyLimitFiles, Bytes: job.DailyLimitBytes, Location: quotaLocation},
+		Notify:        notifyCfg,
+
+		ModifiedPolicy:   modifiedPolicy,
+		Ordering:         ordering,
+		MetadataCaptions: job.MetaCaptions,
+		CaptionRoots:     absWatchDirs,
+		StatusInterval:   time.Duration(job.StatusInterval) * time.Second,
+		StatusName:       job.Name,
+		Quarantine:       job.Quarantine,
+	}
+	return watchCfgs, sendCfg, notifyCfg, meta, nil
+}
+
+func (j *daemonJobs) run(loop func()) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		loop()
+	}()
+}
+
+func (j *daemonJobs) stop() {
+	j.cancel()
+	j.wg.Wait()
+	j.users.Lock()
+	defer j.users.Unlock()
+	j.stopped = true
+	for _, job := range j.jobs {
+		job.queue.Close()
+	}
+}
+
+// setDaemonWatermark applies the [Daemon] watermark keys; an empty
+// watermark turns it off.
+func setDaemonWatermark(daemonCfg *config.DaemonConfig) error {
+	if daemonCfg.Watermark == "" {
+		imageutil.SetWatermark(nil)
+		return nil
+	}
+	mark, err := imageutil.LoadWatermark(daemonCfg.Watermark, daemonCfg.WatermarkPos, daemonCfg.WatermarkOpacity)
+	if err != nil {
+		return err
+	}
+	imageutil.SetWatermark(mark)
+	return nil
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+// doctorReport prints one line per check and counts the failures.
+type doctorReport struct {
+	out    io.Writer
+	failed int
+}
+
+func (r *doctorReport) line(status string, check string, format string, args ...any) {
+	fmt.Fprintf(r.out, "[%-4s] %-8s %s\n", status, check, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) ok(check string, format string, args ...any) {
+	r.line("ok", check, format, args...)
+}
+
+func (r *doctorReport) fail(check string, format string, args ...any) {
+	r.failed++
+	r.line("FAIL", check, format, args...)
+}
+
+func (r *doctorReport) skip(check string, format string, args ...any) {
+	r.line("skip", check, format, args...)
+}
+
+func newDoctorCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	var noSend bool
+	var timeoutSec int
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check config, tokens, proxy and chat access, then send a test message and image",
+		Long: "doctor validates a deployment end to end: it parses the config, checks the proxy and every API URL,\n" +
+			"validates every token, checks that each bot may post in the chat and topic, and sends a test message\n" +
+			"and a tiny test image. It exits non-zero when any check fails.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			timeout := time.Duration(timeoutSec) * time.Second
+			report := &doctorReport{out: cmd.OutOrStdout()}
+
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				report.fail("config", "%v", err)
+				return doctorResult(report)
+			}
+			source := "flags"
+			if cfg.configPath != "" {
+				source = cfg.configPath
+			}
+			report.ok("config", "%s: %d API URL(s), %d token(s)", source, len(apiURLs), len(tokens))
+
+			if dir, err := statedir.Resolve(stateDir); err != nil {
+				report.fail("state", "%v", err)
+			} else if err := checkWritable(dir); err != nil {
+				report.fail("state", "%s is not writable: %v", dir, err)
+			} else {
+				report.ok("state", "%s", dir)
+			}
+
+			if proxy := telegram.ProxyFromEnv(); proxy == "" {
+				report.skip("proxy", "https_proxy/HTTPS_PROXY not set")
+			} else {
+				host := proxy
+				if at := strings.LastIndex(host, "@"); at >= 0 {
+					host = host[at+1:]
+				}
+				start := time.Now()
+				conn, err := net.DialTimeout("tcp", host, timeout)
+				if err != nil {
+					report.fail("proxy", "%s unreachable: %v", host, err)
+				} else {
+					conn.Close()
+					report.ok("proxy", "%s reachable in %s", host, time.Since(start).Round(time.Millisecond))
+				}
+			}
+
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				report.fail("token", "%v", err)
+				return doctorResult(report)
+			}
+
+			reachable := ""
+			for _, apiURL := range apiURLs {
+				pingCtx, cancel := context.WithTimeout(ctx, timeout)
+				elapsed, err := client.Ping(pingCtx, apiURL, tokens[0])
+				cancel()
+				if err != nil {
+					report.fail("api", "%s unreachable: %v", apiURL, err)
+					continue
+				}
+				if reachable == "" {
+					reachable = apiURL
+				}
+				report.ok("api", "%s answered in %s", apiURL, elapsed.Round(time.Millisecond))
+			}
+			if reachable == "" {
+				report.skip("token", "no API URL reachable")
+				return doctorResult(report)
+			}
+
+			validTokens := 0
+			for _, token := range tokens {
+				meCtx, cancel := context.WithTimeout(ctx, timeout)
+				bot, err := client.GetMeContext(meCtx, reachable, token)
+				cancel()
+				if err != nil {
+					report.fail("token", "%s rejected: %v", telegram.MaskToken(token), err)
+					continue
+				}
+				validTokens++
+				report.ok("token", "%s is @%s", telegram.MaskToken(token), bot.Username)
+			}
+			if validTokens == 0 {
+				return doctorResult(report)
+			}
+
+			if cfg.chatID == "" {
+				report.skip("chat", "no --chat-id given")
+				report.skip("send", "no --chat-id given")
+				return doctorResult(report)
+			}
+			chatCtx, cancel := context.WithTimeout(ctx, timeout)
+			err = client.VerifyTarget(chatCtx, cfg.chatID, topicPtr(cfg))
+			cancel()
+			target := cfg.chatID
+			if topicID := topicPtr(cfg); topicID != nil {
+				target = fmt.Sprintf("%s topic %d", cfg.chatID, *topicID)
+			}
+			if err != nil {
+				for _, problem := range strings.Split(err.Error(), "\n") {
+					report.fail("chat", "%s", problem)
+				}
+				report.skip("send", "chat check failed")
+				return doctorResult(report)
+			}
+			report.ok("chat", "every bot may post in %s", target)
+
+			if noSend {
+				report.skip("send", "--no-send given")
+				return doctorResult(report)
+			}
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+			host, _ := os.Hostname()
+			text := fmt.Sprintf("telegram-send-go doctor: test message from %s at %s", host, time.Now().Format(time.RFC3339))
+			messageID, err := client.SendMessageID(ctx, cfg.chatID, text, topicPtr(cfg), retry)
+			if err != nil {
+				report.fail("send", "test message: %v", err)
+			} else {
+				report.ok("send", "test message %d posted to %s", messageID, target)
+			}
+			photo, err := doctorTestImage()
+			if err != nil {
+				report.fail("send", "test image: %v", err)
+				return doctorResult(report)
+			}
+			file := telegram.MediaFile{Filename: "doctor.png", Data: photo, Caption: "telegram-send-go doctor: test image"}
+			if _, err := client.SendPhoto(ctx, cfg.chatID, file, topicPtr(cfg), retry); err != nil {
+				report.fail("send", "test image: %v", err)
+			} else {
+				report.ok("send", "test image (%d bytes) posted to %s", len(photo), target)
+			}
+			return doctorResult(report)
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	cmd.Flags().BoolVar(&noSend, "no-send", false, "Run the checks without posting the test message and image")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 15, "Timeout for each network check (seconds)")
+	return cmd
+}
+
+func doctorResult(report *doctorReport) error {
+	if report.failed > 0 {
+		return fmt.Errorf("doctor: %d check(s) failed", report.failed)
+	}
+	fmt.Fprintln(report.out, "all checks passed")
+	return nil
+}
+
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return err
+	}
+	name := file.Name()
+	file.Close()
+	return os.Remove(name)
+}
+
+// doctorTestImage draws a small gradient PNG, so the photo path is exercised
+// without reading anything from disk.
+func doctorTestImage() ([]byte, error) {
+	const size = 64
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 160, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+// downloadEntry is one file to fetch back: its file_id and where it came
+// from. sha256 is empty for queue items.
+type downloadEntry struct {
+	fileID string
+	path   string
+	inner  string
+	size   int64
+	sha256 string
+}
+
+func newDownloadCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	var manifestPath string
+	var queueFile string
+	var outDir string
+	var overwrite bool
+
+	cmd := &cobra.Command{
+		Use:   "download",
+		Short: "Download the files of a manifest or queue file back from Telegram",
+		Long: "download reads the file_ids recorded by --manifest or by a --queue-file send and fetches each file\n" +
+			"with getFile, recreating the original directory layout under --out. Paths are made relative to the\n" +
+			"deepest directory shared by all files; zip entries are restored under a directory named after the\n" +
+			"archive. The cloud Bot API only serves files up to 20 MB, and images sent as photos come back as\n" +
+			"Telegram's recompressed JPEG; files already present with the right size and checksum are skipped.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			if (manifestPath == "") == (queueFile == "") {
+				return fmt.Errorf("exactly one of manifest or queue-file is required")
+			}
+			if outDir == "" {
+				return fmt.Errorf("out is required")
+			}
+
+			source := manifestPath
+			var entries []downloadEntry
+			var err error
+			if manifestPath != "" {
+				entries, err = manifestEntries(manifestPath)
+			} else {
+				source = queueFile
+				entries, err = queueEntries(queueFile)
+			}
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				log.Printf("no downloadable files in %s", source)
+				return nil
+			}
+
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+
+			root := commonRoot(entries)
+			progressState := newProgressTracker(len(entries), "download")
+			startedAt := time.Now()
+			processed := 0
+			fetched := 0
+			skipped := 0
+			failed := 0
+			fetchedBytes := int64(0)
+			for _, entry := range entries {
+				if ctx.Err() != nil {
+					break
+				}
+				processed++
+				rel := restorePath(root, entry)
+				if !filepath.IsLocal(rel) {
+					log.Printf("refusing to restore %s outside %s", rel, outDir)
+					failed++
+					progressState.Print(processed, fetched, skipped, false)
+					continue
+				}
+				dest := filepath.Join(outDir, rel)
+				if !overwrite && alreadyRestored(dest, entry) {
+					skipped++
+					progressState.Print(processed, fetched, skipped, false)
+					continue
+				}
+				if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+					return err
+				}
+				size, err := client.Download(ctx, entry.fileID, dest, retry)
+				if err == nil && entry.sha256 != "" {
+					if err = checkSHA256(dest, entry.sha256); err != nil {
+						os.Remove(dest)
+					}
+				}
+				if err != nil {
+					log.Printf("download %s failed: %v", dest, err)
+					failed++
+					progressState.Print(processed, fetched, skipped, false)
+					continue
+				}
+				fetched++
+				fetchedBytes += size
+				progressState.Print(processed, fetched, skipped, false)
+			}
+			progressState.Print(processed, fetched, skipped, true)
+
+			finishedAt := time.Now()
+			printSummary("download", source, startedAt, finishedAt, finishedAt.Sub(startedAt), fetched, skipped, fetchedBytes, 0)
+			if failed > 0 {
+				return fmt.Errorf("%d file(s) could not be downloaded", failed)
+			}
+			return ctx.Err()
+		},
+	}
+
+	bindConnectionFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&manifestPath, "manifest", "", "Manifest written by --manifest or sent by --manifest-upload")
+	flags.StringVar(&queueFile, "queue-file", "", "Queue file whose sent items recorded a file_id")
+	flags.StringVar(&outDir, "out", "", "Directory to restore the files into")
+	flags.BoolVar(&overwrite, "overwrite", false, "Download files again even when they already exist")
+	return cmd
+}
+
+func manifestEntries(path string) ([]downloadEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc manifest
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	entries := make([]downloadEntry, 0, len(doc.Files))
+	for _, file := range doc.Files {
+		if file.FileID == "" {
+			continue
+		}
+		entries = append(entries, downloadEntry{fileID: file.FileID, path: file.Path, inner: file.InnerPath, size: file.Size, sha256: file.SHA256})
+	}
+	return entries, nil
+}
+
+func queueEntries(path string) ([]downloadEntry, error) {
+	items, err := queue.ReadItems(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []downloadEntry{}
+	for _, item := range items {
+		if item.Status != queue.StatusSent || item.FileID == "" {
+			continue
+		}
+		entry := downloadEntry{fileID: item.FileID, path: item.Path}
+		// Images were resized before sending; only other files come back
+		// at their original size.
+		if item.SendType != "" && item.SendType != "image" {
+			entry.size = item.Size
+		}
+		if item.InnerPath != nil {
+			entry.inner = *item.InnerPath
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// commonRoot is the deepest directory containing every entry's path.
+func commonRoot(entries []downloadEntry) string {
+	root := filepath.Dir(entries[0].path)
+	for _, entry := range entries[1:] {
+		for !within(entry.path, root) {
+			parent := filepath.Dir(root)
+			if parent == root {
+				return ""
+			}
+			root = parent
+		}
+	}
+	return root
+}
+
+func within(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// restorePath is where entry goes below the output directory: its path
+// relative to root, and for zip entries the entry path below a directory
+// named after the archive.
+func restorePath(root string, entry downloadEntry) string {
+	rel := entry.path
+	if root != "" {
+		if r, err := filepath.Rel(root, entry.path); err == nil {
+			rel = r
+		}
+	}
+	// Paths from different volumes share no root; drop the volume and the
+	// leading separator so they stay below the output directory.
+	rel = strings.TrimLeft(strings.TrimPrefix(rel, filepath.VolumeName(rel)), `/\`)
+	if entry.inner != "" {
+		rel = filepath.Join(rel, filepath.FromSlash(entry.inner))
+	}
+	return filepath.Clean(rel)
+}
+
+// alreadyRestored reports whether dest holds the entry already: the size
+// matches and, when known, the SHA-256 does too.
+func alreadyRestored(dest string, entry downloadEntry) bool {
+	info, err := os.Stat(dest)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if entry.size > 0 && info.Size() != entry.size {
+		return false
+	}
+	return entry.sha256 == "" || checkSHA256(dest, entry.sha256) == nil
+}
+
+func checkSHA256(path string, want string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+func newEditMessageCmd() *cobra.Command {
+	return newEditCmd("edit-message", "Replace the text of a sent message", "message", "New message text", false)
+}
+
+func newEditCaptionCmd() *cobra.Command {
+	return newEditCmd("edit-caption", "Replace the caption of a sent photo, video or file", "caption", "New caption (empty removes it)", true)
+}
+
+// newEditCmd builds edit-message and edit-caption, which differ only in the
+// field they replace. Captions may be emptied; message text may not.
+func newEditCmd(use string, short string, field string, usage string, allowEmpty bool) *cobra.Command {
+	cfg := &commonFlags{}
+	var messageID int
+	var text string
+	var buttonsJSON string
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long: short + " by its ID, e.g. to keep one status post up to date instead of posting a new one\n" +
+			"each run. Setting the " + field + " it already has is not an error.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			if cfg.chatID == "" || messageID <= 0 {
+				return fmt.Errorf("chat-id and message-id are required")
+			}
+			if !cmd.Flags().Changed(field) || (text == "" && !allowEmpty) {
+				return fmt.Errorf("%s is required", field)
+			}
+			var buttons telegram.InlineKeyboard
+			if buttonsJSON != "" {
+				var err error
+				if buttons, err = telegram.ParseInlineKeyboard(buttonsJSON); err != nil {
+					return err
+				}
+			}
+
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+			if field == "caption" {
+				return client.EditMessageCaption(ctx, cfg.chatID, messageID, text, buttons, retry)
+			}
+			return client.EditMessageText(ctx, cfg.chatID, messageID, text, buttons, retry)
+		},
+	}
+
+	bindConnectionFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.chatID, "chat-id", "", "Chat ID the message is in")
+	flags.IntVar(&messageID, "message-id", 0, "ID of the message to edit")
+	flags.StringVar(&text, field, "", usage)
+	flags.StringVar(&buttonsJSON, "buttons", "", `Replace the buttons under the message, as JSON rows: [[{"text":"Open","url":"https://..."}]]`)
+	return cmd
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// slowRun is how long a projected run may take before startRun warns.
+const slowRun = 24 * time.Hour
+
+// runPace is how a one-shot send spaces its messages, for the estimate
+// logged before it starts.
+type runPace struct {
+	// groupSize is the files per album; 0 or 1 sends a message per file.
+	groupSize  int
+	batchDelay time.Duration
+}
+
+// runEstimate projects a run against Telegram's per-chat limits.
+type runEstimate struct {
+	Messages  int
+	PerMinute float64
+	// Limited is the time the messages take at PerMinute, Upload the time
+	// the bytes take at assumedUploadRate; Duration is the longer one.
+	Limited  time.Duration
+	Upload   time.Duration
+	Duration time.Duration
+	// Suggestions say how to make a slow run faster.
+	Suggestions []string
+}
+
+func messagesFor(files int, groupSize int) int {
+	if groupSize <= 1 {
+		return files
+	}
+	return (files + groupSize - 1) / groupSize
+}
+
+// estimateRun projects how long sending files of totalBytes to chatID takes.
+// Every bot token has its own per-chat limit, and --batch-delay slows the
+// run further when it is longer than the limit's spacing.
+func estimateRun(chatID string, files int, totalBytes int64, tokens int, pace runPace) runEstimate {
+	if tokens < 1 {
+		tokens = 1
+	}
+	limit := telegram.ChatLimit(chatID)
+	perMinute := float64(limit * tokens)
+	if pace.batchDelay > 0 && float64(time.Minute)/float64(pace.batchDelay) < perMinute {
+		perMinute = float64(time.Minute) / float64(pace.batchDelay)
+	}
+	est := runEstimate{
+		Messages:  messagesFor(files, pace.groupSize),
+		PerMinute: perMinute,
+		Upload:    estimateUpload(totalBytes),
+	}
+	est.Limited = time.Duration(float64(est.Messages) / perMinute * float64(time.Minute))
+	est.Duration = max(est.Limited, est.Upload)
+	if est.Duration < slowRun || est.Limited < est.Upload {
+		return est
+	}
+	if pace.groupSize > 1 && pace.groupSize < telegram.MaxMediaGroupSize {
+		est.Suggestions = append(est.Suggestions, fmt.Sprintf("--group-size %d sends %d messages instead of %d",
+			telegram.MaxMediaGroupSize, messagesFor(files, telegram.MaxMediaGroupSize), est.Messages))
+	}
+	if pace.batchDelay > 0 && float64(time.Minute)/float64(pace.batchDelay) < float64(limit*tokens) {
+		est.Suggestions = append(est.Suggestions, fmt.Sprintf("--batch-delay %s allows only %.0f messages/min; Telegram allows %d per bot",
+			pace.batchDelay, perMinute, limit))
+	} else {
+		est.Suggestions = append(est.Suggestions, fmt.Sprintf("more bot tokens (--bot-token a,b or the config file) each add %d messages/min", limit))
+	}
+	return est
+}
+
+// logEstimate logs the projected duration of a run and warns with
+// suggestions when it will take more than a day.
+func logEstimate(chatID string, files int, totalBytes int64, tokens int, pace runPace) runEstimate {
+	est := estimateRun(chatID, files, totalBytes, tokens, pace)
+	log.Printf("estimate: %d file(s) in %d message(s) to chat %s at up to %.0f messages/min (%d bot(s)): ~%s",
+		files, est.Messages, chatID, est.PerMinute, max(tokens, 1), formatDuration(est.Duration))
+	if est.Duration >= slowRun && est.Limited >= est.Upload {
+		log.Printf("warning: this run will take about %s (%.1f days) at Telegram's rate limits", formatDuration(est.Duration), est.Duration.Hours()/24)
+		for _, suggestion := range est.Suggestions {
+			log.Printf("  try: %s", suggestion)
+		}
+	}
+	return est
+}
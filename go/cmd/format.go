@@ -23,7 +23,7 @@ func formatBytes(size int64) string {
 	if size < 1024 {
 		return fmt.Sprintf("%d B", size)
 	}
-	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
 	value := float64(size)
 	idx := 0
 	for value >= 1024 && idx < len(units)-1 {
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/service"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/shellmenu"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
+	"github.com/spf13/cobra"
+)
+
+func newIntegrateShellCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "integrate-shell",
+		Short: "Add \"Send to Telegram\" to the file manager's context menu",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newIntegrateShellInstallCmd())
+	cmd.AddCommand(newIntegrateShellUninstallCmd())
+	cmd.AddCommand(newIntegrateShellStatusCmd())
+	return cmd
+}
+
+func newIntegrateShellInstallCmd() *cobra.Command {
+	var label string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "install [flags] -- <send-mixed flags>",
+		Short: "Register a context menu entry running send-mixed on the selected files and folders",
+		Long: "install adds a context menu entry to Explorer (Windows), Finder Quick Actions (macOS) or\n" +
+			"Nautilus, Nemo and Dolphin (Linux). Choosing it runs send-mixed with the flags after -- on the\n" +
+			"selected files and folders. On Linux and macOS the output goes to shell-send.log in the state\n" +
+			"directory; on Windows a console window shows it and stays open if the send fails.",
+		Example:      "  telegram-send-go integrate-shell install -- --chat-id -1001234567890 --config ./config.ini",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sendMixed := newSendMixedCmd()
+			if err := sendMixed.ParseFlags(args); err != nil {
+				return fmt.Errorf("invalid send-mixed flags: %w", err)
+			}
+			if len(sendMixed.Flags().Args()) > 0 {
+				return fmt.Errorf("unexpected send-mixed arguments: %v", sendMixed.Flags().Args())
+			}
+			if !sendMixed.Flags().Changed("chat-id") {
+				return fmt.Errorf("chat-id is required")
+			}
+			sendArgs, err := service.AbsoluteArgs(args)
+			if err != nil {
+				return err
+			}
+			dir, err := statedir.Resolve(stateDir)
+			if err != nil {
+				return err
+			}
+			menuArgs := append([]string{"send-mixed"}, sendArgs...)
+			menuArgs = append(menuArgs, "--")
+			menuCfg := shellmenu.Config{Label: label, Args: menuArgs, LogFile: filepath.Join(dir, "shell-send.log")}
+
+			if dryRun {
+				rendered, err := shellmenu.Render(menuCfg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(cmd.OutOrStdout(), rendered)
+				return nil
+			}
+			paths, err := shellmenu.Install(menuCfg)
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				fmt.Fprintf(cmd.OutOrStdout(), "Installed %s\n", path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", shellmenu.DefaultLabel, "Menu entry text")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the generated menu entry without installing")
+	return cmd
+}
+
+func newIntegrateShellUninstallCmd() *cobra.Command {
+	var label string
+
+	cmd := &cobra.Command{
+		Use:          "uninstall",
+		Short:        "Remove the context menu entry",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths, err := shellmenu.Uninstall(shellmenu.Config{Label: label})
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed %s\n", path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", shellmenu.DefaultLabel, "Menu entry text")
+	return cmd
+}
+
+func newIntegrateShellStatusCmd() *cobra.Command {
+	var label string
+
+	cmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show whether the context menu entry is installed",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths, err := shellmenu.Installed(shellmenu.Config{Label: label})
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "entry: %s\n", label)
+			fmt.Fprintf(out, "installed: %t\n", len(paths) > 0)
+			for _, path := range paths {
+				fmt.Fprintf(out, "path: %s\n", path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", shellmenu.DefaultLabel, "Menu entry text")
+	return cmd
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// logRequestLatency logs, per API endpoint, the latency percentiles and
+// upload throughput of the requests made by the run, so a slow self-hosted
+// Bot API server stands out. Runs that made no requests log nothing.
+func logRequestLatency() {
+	for _, stats := range telegram.EndpointStats() {
+		log.Printf("api %s", formatRequestStats(stats))
+	}
+}
+
+func formatRequestStats(stats telegram.RequestStats) string {
+	text := fmt.Sprintf("%s: %d request(s), p50 %s, p90 %s, p99 %s, max %s",
+		stats.Endpoint, stats.Requests, formatLatency(stats.P50), formatLatency(stats.P90), formatLatency(stats.P99), formatLatency(stats.Max))
+	if failures := stats.Failures(); failures > 0 {
+		text += fmt.Sprintf(", %d failed", failures)
+		if flood := stats.Outcomes[telegram.OutcomeFloodWait]; flood > 0 {
+			text += fmt.Sprintf(" (%d flood wait)", flood)
+		}
+	}
+	if stats.Throughput > 0 {
+		text += fmt.Sprintf(", %s sent at %s/s", formatBytes(stats.BytesSent), formatBytes(int64(stats.Throughput)))
+	}
+	return text
+}
+
+func formatLatency(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+const manifestFilename = "manifest.json"
+
+// fileSource is where a sent file came from: a path on disk, or an entry
+// inside the zip archive at path. origin, when set, is what the manifest
+// lists instead of path, for files built for the send: a --as-archive
+// archive is listed beside the directory it packs.
+type fileSource struct {
+	path   string
+	inner  string
+	origin string
+}
+
+func (s fileSource) name() string {
+	if s.inner != "" {
+		return path.Base(s.inner)
+	}
+	return filepath.Base(s.path)
+}
+
+// manifestEntry maps one delivered file to the message that carries it.
+type manifestEntry struct {
+	Path      string `json:"path"`
+	InnerPath string `json:"inner_path,omitempty"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	MessageID int    `json:"message_id"`
+	FileID    string `json:"file_id"`
+	SentAt    string `json:"sent_at"`
+}
+
+// manifest is the --manifest document: enough to find every file again with
+// getFile or forwardMessage and to check it against the original.
+type manifest struct {
+	ChatID    string          `json:"chat_id"`
+	TopicID   *int            `json:"topic_id,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	Files     []manifestEntry `json:"files"`
+}
+
+func newManifestEntry(source fileSource, size int64, sum string, result telegram.Result) manifestEntry {
+	origin := source.path
+	if source.origin != "" {
+		origin = source.origin
+	}
+	entry := manifestEntry{
+		Path:      origin,
+		InnerPath: source.inner,
+		Size:      size,
+		SHA256:    sum,
+		SentAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	if abs, err := filepath.Abs(origin); err == nil {
+		entry.Path = abs
+	}
+	if len(result.MessageIDs) > 0 {
+		entry.MessageID = result.MessageIDs[0]
+	}
+	if len(result.FileIDs) > 0 {
+		entry.FileID = result.FileIDs[0]
+	}
+	return entry
+}
+
+func encodeManifest(chatID string, topicID *int, entries []manifestEntry) ([]byte, error) {
+	doc := manifest{ChatID: chatID, TopicID: topicID, CreatedAt: time.Now().UTC().Format(time.RFC3339), Files: entries}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeManifest replaces the file at path through a temporary file, so an
+// interrupted run never leaves a truncated manifest behind.
+func writeManifest(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
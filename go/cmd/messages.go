@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// assumedUploadRate is a typical Bot API upload speed in bytes per second,
+// used for the rough ETA of the start message before anything was sent.
+const assumedUploadRate = 2 << 20
+
+func estimateUpload(size int64) time.Duration {
+	return time.Duration(float64(size) / assumedUploadRate * float64(time.Second))
+}
+
+// runReport describes one upload run for the start and completion messages.
+type runReport struct {
+	Kind    string
+	Source  string
+	Count   int
+	Sent    int
+	Skipped int
+	Bytes   int64
+	// TotalBytes is the source size of everything the run will send,
+	// known before it starts.
+	TotalBytes int64
+	// ETA, when set, replaces the upload-rate estimate of the start message.
+	ETA        time.Duration
+	Unreadable int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// runMessageData is what templates see; durations, sizes and times are
+// preformatted.
+type runMessageData struct {
+	Kind       string
+	Source     string
+	Count      int
+	Sent       int
+	Skipped    int
+	Unreadable int
+	Bytes      string
+	BytesRaw   int64
+	// TotalBytes and ETA describe the run up front; ETA assumes
+	// assumedUploadRate and Telegram's per-chat rate limits.
+	TotalBytes    string
+	TotalBytesRaw int64
+	ETA           string
+	Elapsed       string
+	AvgPerFile    string
+	Speed         string
+	Time          string
+}
+
+// runNotes sends the start and completion messages of one-shot sends. A nil
+// *runNotes uses the default templates of the selected language.
+type runNotes struct {
+	start *template.Template
+	done  *template.Template
+	quiet bool
+	// buttons go under the completion message.
+	buttons telegram.InlineKeyboard
+	// pace shapes the estimate logged before a run starts.
+	pace runPace
+}
+
+// defaultRunNotes uses the run.start and run.done messages of the selected
+// language. Every value is a plain word or number so a translation only has
+// to move the {{.Field}} placeholders.
+func defaultRunNotes() *runNotes {
+	notes, err := parseRunNotes(i18n.T("run.start"), i18n.T("run.done"), false)
+	if err != nil {
+		panic(err)
+	}
+	return notes
+}
+
+func parseRunNotes(start string, done string, quiet bool) (*runNotes, error) {
+	startTmpl, err := template.New("start").Option("missingkey=error").Parse(start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify-template-start: %w", err)
+	}
+	doneTmpl, err := template.New("done").Option("missingkey=error").Parse(done)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify-template-done: %w", err)
+	}
+	notes := &runNotes{start: startTmpl, done: doneTmpl, quiet: quiet}
+	// Render a sample so unknown fields fail before anything is sent.
+	sample := runReport{Kind: "image", Source: "sample", StartedAt: time.Now(), FinishedAt: time.Now()}
+	if _, err := notes.render(notes.start, sample); err != nil {
+		return nil, fmt.Errorf("invalid notify-template-start: %w", err)
+	}
+	if _, err := notes.render(notes.done, sample); err != nil {
+		return nil, fmt.Errorf("invalid notify-template-done: %w", err)
+	}
+	return notes, nil
+}
+
+// newRunNotes builds the run messages from the command flags.
+func newRunNotes(cfg *commonFlags) (*runNotes, error) {
+	start := cfg.templateStart
+	if start == "" {
+		start = i18n.T("run.start")
+	}
+	done := cfg.templateDone
+	if done == "" {
+		done = i18n.T("run.done")
+	}
+	notes, err := parseRunNotes(start, done, cfg.noRunMessages)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.notifyButtons != "" {
+		if notes.buttons, err = telegram.ParseInlineKeyboard(cfg.notifyButtons); err != nil {
+			return nil, fmt.Errorf("invalid notify-buttons: %w", err)
+		}
+	}
+	return notes, nil
+}
+
+func (n *runNotes) render(tmpl *template.Template, report runReport) (string, error) {
+	at := report.StartedAt
+	if !report.FinishedAt.IsZero() {
+		at = report.FinishedAt
+	}
+	elapsed := time.Duration(0)
+	if !report.FinishedAt.IsZero() {
+		elapsed = report.FinishedAt.Sub(report.StartedAt)
+	}
+	avgPer := time.Duration(0)
+	if report.Sent > 0 {
+		avgPer = elapsed / time.Duration(report.Sent)
+	}
+	data := runMessageData{
+		Kind:       i18n.T(report.Kind),
+		Source:     report.Source,
+		Count:      report.Count,
+		Sent:       report.Sent,
+		Skipped:    report.Skipped,
+		Unreadable: report.Unreadable,
+		Bytes:      formatBytes(report.Bytes),
+		BytesRaw:   report.Bytes,
+
+		TotalBytes:    formatBytes(report.TotalBytes),
+		TotalBytesRaw: report.TotalBytes,
+		ETA:           formatDuration(max(report.ETA, estimateUpload(report.TotalBytes))),
+		Elapsed:       formatDuration(elapsed),
+		AvgPerFile:    formatDuration(avgPer),
+		Speed:         formatSpeed(report.Bytes, elapsed),
+		Time:          formatTimestamp(at),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// startRun posts the start message and returns the client to use for the run,
+// threaded under that message when --reply-to-start is set.
+func (n *runNotes) startRun(ctx context.Context, client *telegram.Client, chatID string, topicID *int, retry telegram.RetryConfig, report runReport) *telegram.Client {
+	if n == nil {
+		n = defaultRunNotes()
+	}
+	if report.Count > 1 {
+		report.ETA = logEstimate(chatID, report.Count, report.TotalBytes, client.TokenCount(), n.pace).Duration
+	}
+	if n.quiet {
+		return client
+	}
+	text, err := n.render(n.start, report)
+	if err != nil {
+		log.Printf("start message failed: %v", err)
+		return client
+	}
+	startID, _ := client.SendMessageID(ctx, chatID, text, topicID, retry)
+	return client.ThreadRun(startID)
+}
+
+// finishRun posts the completion message.
+func (n *runNotes) finishRun(ctx context.Context, client *telegram.Client, chatID string, topicID *int, retry telegram.RetryConfig, report runReport) {
+	if n == nil {
+		n = defaultRunNotes()
+	}
+	if n.quiet {
+		return
+	}
+	text, err := n.render(n.done, report)
+	if err != nil {
+		log.Printf("completion message failed: %v", err)
+		return
+	}
+	_, _ = client.SendMessageButtons(ctx, chatID, text, n.buttons, topicID, retry)
+}
@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"archive/zip"
 	"fmt"
 	"os"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 
 	ansi "github.com/k0kubun/go-ansi"
 	"github.com/schollz/progressbar/v3"
@@ -13,6 +18,11 @@ type progressTracker struct {
 	enabled bool
 	total   int
 	label   string
+	// stopFlood stops showing flood-control pauses in the bar.
+	stopFlood func()
+	// cumulative[i] is the size of the first i items, set by withSizes.
+	cumulative []int64
+	startedAt  time.Time
 }
 
 func newProgressTracker(total int, label string) progressTracker {
@@ -27,7 +37,10 @@ func newProgressTracker(total int, label string) progressTracker {
 		progressbar.OptionSetPredictTime(false),
 		progressbar.OptionSetDescription(label),
 	)
-	return progressTracker{bar: bar, enabled: true, total: total, label: label}
+	stopFlood := telegram.WatchFlood(func(chatID string, wait time.Duration) {
+		bar.Describe(fmt.Sprintf("%s paused %s (flood control, chat %s)", label, wait, chatID))
+	})
+	return progressTracker{bar: bar, enabled: true, total: total, label: label, stopFlood: stopFlood}
 }
 
 func (p progressTracker) Print(processed int, sent int, skipped int, done bool) {
@@ -41,14 +54,73 @@ func (p progressTracker) Print(processed int, sent int, skipped int, done bool)
 		processed = p.total
 	}
 	desc := fmt.Sprintf("%s sent=%d skipped=%d", p.label, sent, skipped)
+	if len(p.cumulative) > 1 {
+		total := p.cumulative[len(p.cumulative)-1]
+		doneBytes := p.cumulative[min(processed, len(p.cumulative)-1)]
+		desc += fmt.Sprintf(" %s/%s", formatBytes(doneBytes), formatBytes(total))
+		if doneBytes > 0 && doneBytes < total && !done {
+			elapsed := time.Since(p.startedAt)
+			desc += " ETA " + formatDuration(time.Duration(float64(elapsed)*float64(total-doneBytes)/float64(doneBytes)))
+		}
+	}
 	p.bar.Describe(desc)
 	_ = p.bar.Set(processed)
 	if done {
+		p.stopFlood()
 		_ = p.bar.Finish()
 		fmt.Fprintln(os.Stdout)
 	}
 }
 
+// withSizes adds bytes done of the total and an ETA to the bar; sizes are
+// the source sizes of the items in the order they are processed.
+func (p progressTracker) withSizes(sizes []int64) progressTracker {
+	p.cumulative = make([]int64, len(sizes)+1)
+	for i, size := range sizes {
+		p.cumulative[i+1] = p.cumulative[i] + size
+	}
+	p.startedAt = time.Now()
+	return p
+}
+
+// pathSizes stats each path; unreadable paths count as empty.
+func pathSizes(paths []string) []int64 {
+	sizes := make([]int64, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+		}
+	}
+	return sizes
+}
+
+// zipSizes returns the uncompressed sizes of the named zip entries.
+func zipSizes(filesByName map[string]*zip.File, names []string) []int64 {
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		if file := filesByName[name]; file != nil {
+			sizes[i] = int64(file.UncompressedSize64)
+		}
+	}
+	return sizes
+}
+
+func itemSizes(items []*queue.Item) []int64 {
+	sizes := make([]int64, len(items))
+	for i, item := range items {
+		sizes[i] = item.Size
+	}
+	return sizes
+}
+
+func sumSizes(sizes []int64) int64 {
+	total := int64(0)
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
+
 func clampRange(start int, end int, total int) (int, int) {
 	if start < 0 {
 		start = 0
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+)
+
+const (
+	pruneInterval = 24 * time.Hour
+	sweepInterval = 10 * time.Minute
+)
+
+// pruneLoop compacts q at start and then daily, removing sent items older
+// than retention, along with source_missing items. It returns when ctx is done.
+func pruneLoop(ctx context.Context, q *queue.Queue, queueFile string, retention time.Duration) {
+	age := retention.String()
+	if retention%(24*time.Hour) == 0 {
+		age = fmt.Sprintf("%dd", retention/(24*time.Hour))
+	}
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		pruned, err := q.Compact(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("compact %s failed: %v", queueFile, err)
+		} else if pruned > 0 {
+			log.Printf("pruned %d sent or source_missing item(s) older than %s from %s", pruned, age, queueFile)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepLoop marks pending items whose file was deleted source_missing every
+// sweepInterval, so they are reported once instead of failing on every
+// attempt. It returns when ctx is done.
+func sweepLoop(ctx context.Context, q *queue.Queue, queueFile string) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if marked := sender.SweepMissing(q); marked > 0 {
+			log.Printf("marked %d item(s) of %s source_missing: file no longer exists", marked, queueFile)
+		}
+	}
+}
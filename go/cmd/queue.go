@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
+	"github.com/spf13/cobra"
+)
+
+func newQueueCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspect or modify queue files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newQueueAddCmd())
+	cmd.AddCommand(newQueueImportHistoryCmd())
+	cmd.AddCommand(newQueueFsckCmd())
+	cmd.AddCommand(newQueueUpgradeCmd())
+	return cmd
+}
+
+func newQueueAddCmd() *cobra.Command {
+	files := &stringSlice{}
+	var queueFile string
+	var sendType string
+	var priorityName string
+
+	cmd := &cobra.Command{
+		Use:          "add",
+		Short:        "Append files to a queue, including one used by a running watch",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if queueFile == "" {
+				return fmt.Errorf("queue-file is required")
+			}
+			if len(files.Values()) == 0 {
+				return fmt.Errorf("file is required")
+			}
+			switch sendType {
+			case "", "image", "video", "audio", "file":
+			default:
+				return fmt.Errorf("invalid send-type %q (use image, video, audio or file)", sendType)
+			}
+			priority, err := queue.ParsePriority(priorityName)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(queueFile); err != nil {
+				return fmt.Errorf("queue file %s: %w", queueFile, err)
+			}
+
+			paths, err := resolveAbsPaths(files.Values())
+			if err != nil {
+				return err
+			}
+			items := make([]queue.Item, 0, len(paths))
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return fmt.Errorf("%s is a directory", path)
+				}
+				itemType := sendType
+				if itemType == "" {
+					itemType = detectSendType(path)
+				}
+				mtimeNS := info.ModTime().UnixNano()
+				items = append(items, queue.Item{
+					SourceType:        "file",
+					SourcePath:        path,
+					SourceFingerprint: queue.BuildSourceFingerprint(path, info.Size(), &mtimeNS),
+					Path:              path,
+					Size:              info.Size(),
+					MTimeNS:           &mtimeNS,
+					SendType:          itemType,
+					Priority:          priority,
+					Fingerprint:       queue.BuildFingerprint("file", path, nil, info.Size(), &mtimeNS, nil),
+				})
+			}
+
+			added, err := queue.AppendItems(queueFile, items)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Added %d item(s) to %s (%d already queued)\n", added, queueFile, len(items)-added)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&queueFile, "queue-file", "", "Existing JSONL queue file")
+	flags.Var(files, "file", "File to add (repeatable or comma-separated)")
+	flags.StringVar(&sendType, "send-type", "", "Send as image, video, audio or file (default: by extension)")
+	flags.StringVar(&priorityName, "priority", "normal", "Item priority: low, normal or high")
+	return cmd
+}
+
+func newQueueFsckCmd() *cobra.Command {
+	var queueFile string
+	var repair bool
+
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check a queue file for truncated or corrupt lines and optionally repair it",
+		Long: "fsck reads a queue file and reports the lines a watch or send skips when loading it: a final line\n" +
+			"cut short by a crash or power loss, invalid JSON, lines whose checksum does not match and items\n" +
+			"without an id. --repair rewrites the file without them and keeps the original as <queue-file>.bak;\n" +
+			"stop any watch using the queue first.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if queueFile == "" {
+				return fmt.Errorf("queue-file is required")
+			}
+			check := queue.Check
+			if repair {
+				check = queue.Repair
+			}
+			report, err := check(queueFile)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, problem := range report.Problems {
+				fmt.Fprintf(out, "line %d: %s\n", problem.Line, problem.Reason)
+			}
+			fmt.Fprintf(out, "%s: %d line(s), %d item(s), %d problem(s)\n", queueFile, report.Lines, report.Items, len(report.Problems))
+			if !report.MetaFound {
+				fmt.Fprintln(out, "no queue metadata header")
+			}
+			if len(report.Problems) == 0 {
+				return nil
+			}
+			if repair {
+				fmt.Fprintf(out, "removed %d line(s); original kept as %s.bak\n", len(report.Problems), queueFile)
+				return nil
+			}
+			return fmt.Errorf("%d corrupt line(s); run with --repair to remove them", len(report.Problems))
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&queueFile, "queue-file", "", "Queue file to check")
+	flags.BoolVar(&repair, "repair", false, "Rewrite the file without the corrupt lines")
+	return cmd
+}
+
+func newQueueUpgradeCmd() *cobra.Command {
+	queueFiles := &stringSlice{}
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Rebuild the fingerprints of queue items written by an older version",
+		Long: "upgrade rebuilds the fingerprints of queue items recorded with an older fingerprint scheme, so\n" +
+			"files already sent are still recognised after an upgrade changes how files are fingerprinted.\n" +
+			"Without --queue-file it upgrades every queue under <state-dir>/queues. Each rewritten file keeps\n" +
+			"its original as <queue-file>.bak; stop any watch using the queues first.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values := queueFiles.Values()
+			if len(values) == 0 {
+				dir, err := statedir.Resolve(stateDir)
+				if err != nil {
+					return err
+				}
+				values = []string{filepath.Join(dir, "queues", "*.jsonl")}
+			}
+			paths, err := expandQueueFiles(values)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			failed := 0
+			for _, path := range paths {
+				report, err := upgradeQueueFile(path, dryRun)
+				if err != nil {
+					fmt.Fprintf(out, "%s: %v\n", path, err)
+					failed++
+					continue
+				}
+				verb := "upgraded"
+				if dryRun {
+					verb = "to upgrade"
+				}
+				fmt.Fprintf(out, "%s: %d item(s), %d %s, %d fingerprint(s) changed\n", path, report.Items, report.Upgraded, verb, report.Changed)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d queue file(s) could not be upgraded", failed, len(paths))
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Var(queueFiles, "queue-file", "Queue file or glob pattern to upgrade (repeatable or comma-separated; default: every queue under --state-dir)")
+	flags.BoolVar(&dryRun, "dry-run", false, "Report what would change without rewriting anything")
+	return cmd
+}
+
+// upgradeQueueFile opens the queue at path, locked unless dryRun only
+// reads it, and upgrades its fingerprints.
+func upgradeQueueFile(path string, dryRun bool) (queue.UpgradeReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return queue.UpgradeReport{}, err
+	}
+	open := queue.New
+	if dryRun {
+		open = queue.NewShared
+	}
+	q, err := open(path, nil)
+	if err != nil {
+		return queue.UpgradeReport{}, err
+	}
+	defer q.Close()
+	return q.UpgradeFingerprints(dryRun)
+}
+
+// detectSendType picks the send type for a file from its extension.
+func detectSendType(path string) string {
+	switch {
+	case isImage(path):
+		return "image"
+	case matchesExt(path, allowedExtsForType("video")):
+		return "video"
+	case matchesExt(path, allowedExtsForType("audio")):
+		return "audio"
+	default:
+		return "file"
+	}
+}
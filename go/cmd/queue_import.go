@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
+	"github.com/spf13/cobra"
+)
+
+const exportResultFilename = "result.json"
+
+// chatExport is the part of a Telegram Desktop "Machine-readable JSON" chat
+// export that import-history reads.
+type chatExport struct {
+	Name     string          `json:"name"`
+	Messages []exportMessage `json:"messages"`
+}
+
+// exportMessage is one exported message. File and Photo are paths relative
+// to the export directory, or a "(File not included…)" note when the media
+// was not downloaded; FileName and FileSize are only written by recent
+// Telegram Desktop versions.
+type exportMessage struct {
+	Type      string `json:"type"`
+	File      string `json:"file"`
+	FileName  string `json:"file_name"`
+	FileSize  int64  `json:"file_size"`
+	Photo     string `json:"photo"`
+	MediaType string `json:"media_type"`
+}
+
+// exportKey identifies a document, video or audio message by what survives
+// the upload unchanged: its file name and size.
+type exportKey struct {
+	name string
+	size int64
+}
+
+// exportedMedia is what a chat export holds: the files by name and size and
+// the difference hashes of the photos, which Telegram recompressed.
+type exportedMedia struct {
+	files       map[exportKey]struct{}
+	photoHashes []uint64
+	unmatchable int
+}
+
+func newQueueImportHistoryCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	watchDirs := &stringSlice{}
+	includes := &stringSlice{}
+	excludes := &stringSlice{}
+	var exportPath string
+	var queueFile string
+	var recursive bool
+	var withImage bool
+	var withVideo bool
+	var withAudio bool
+	var withAll bool
+	var phashDistance int
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "import-history",
+		Short: "Mark files already posted to a chat as sent in a watch queue",
+		Long: "import-history reads a Telegram Desktop chat export (Export chat history, format \"Machine-readable\n" +
+			"JSON\") and marks the files under --watch-dir that the chat already holds as sent in the queue a watch\n" +
+			"with the same options uses, so the watch skips them. Bots cannot read chat history, hence the export.\n" +
+			"Documents, videos and audio match by file name and size; photos match by perceptual hash when the\n" +
+			"export includes them. Files inside zip archives are not matched.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if exportPath == "" {
+				return fmt.Errorf("export is required")
+			}
+			if cfg.chatID == "" {
+				return fmt.Errorf("chat-id is required")
+			}
+			if withAll {
+				withImage = true
+				withVideo = true
+				withAudio = true
+			}
+			if !withImage && !withVideo && !withAudio && !withAll {
+				withImage = true
+			}
+			absWatchDirs, err := resolveWatchDirs(watchDirs.Values())
+			if err != nil {
+				return err
+			}
+			if len(absWatchDirs) == 0 {
+				return fmt.Errorf("watch-dir is required")
+			}
+			if queueFile == "" {
+				queueFile, err = defaultWatchQueueFile(absWatchDirs, cfg.chatID, topicPtr(cfg))
+				if err != nil {
+					return err
+				}
+			}
+
+			media, err := loadChatExport(exportPath)
+			if err != nil {
+				return err
+			}
+			if media.unmatchable > 0 {
+				log.Printf("%d exported message(s) have no downloaded media and cannot be matched", media.unmatchable)
+			}
+
+			items := []queue.Item{}
+			candidates := 0
+			for _, watchDir := range absWatchDirs {
+				watchCfg := watcher.Config{
+					Root:           watchDir,
+					Recursive:      recursive,
+					IncludeGlobs:   includes.Values(),
+					ExcludeGlobs:   excludes.Values(),
+					WithImage:      withImage,
+					WithVideo:      withVideo,
+					WithAudio:      withAudio,
+					WithAll:        withAll,
+					FollowSymlinks: cfg.followSymlinks,
+					IncludeHidden:  cfg.includeHidden,
+				}
+				files, problems := watcher.Candidates(watchCfg)
+				for _, problem := range problems {
+					log.Printf("skip unreadable path: %v", problem)
+				}
+				if cfg.strict && len(problems) > 0 {
+					return fmt.Errorf("%d unreadable path(s) under %s", len(problems), watchDir)
+				}
+				candidates += len(files)
+				for _, file := range files {
+					phash, ok := media.match(file, phashDistance)
+					if !ok {
+						continue
+					}
+					item := watcher.NewFileItem(watchCfg, file.Path, file.Info, file.SendType)
+					item.Status = queue.StatusSent
+					item.PHash = phash
+					items = append(items, item)
+					if dryRun {
+						fmt.Fprintln(cmd.OutOrStdout(), file.Path)
+					}
+				}
+			}
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "%d of %d file(s) are already in the chat\n", len(items), candidates)
+				return nil
+			}
+
+			// A new queue file gets the watch's metadata so the watch
+			// adopts it; an existing one is appended to, even while a
+			// watch runs on it.
+			if _, err := os.Stat(queueFile); os.IsNotExist(err) {
+				meta := watchQueueMeta(absWatchDirs, recursive, cfg, withImage, withVideo, withAudio, withAll, includes.Values(), excludes.Values())
+				q, err := queue.New(queueFile, meta)
+				if err != nil {
+					return err
+				}
+				q.Close()
+			}
+			added, err := queue.AppendItems(queueFile, items)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Marked %d of %d file(s) as sent in %s (%d already queued)\n", added, candidates, queueFile, len(items)-added)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&exportPath, "export", "", "Telegram Desktop JSON export: result.json or the directory containing it")
+	flags.Var(watchDirs, "watch-dir", "Directory the watch will scan (repeatable or comma-separated)")
+	flags.StringVar(&cfg.chatID, "chat-id", "", "Chat ID the watch sends to")
+	flags.IntVar(&cfg.topicID, "topic-id", 0, "Topic/thread ID the watch sends to")
+	flags.StringVar(&queueFile, "queue-file", "", "Queue file of the watch (default: the watch's own default)")
+	flags.BoolVar(&recursive, "recursive", false, "Scan subdirectories, as the watch does")
+	flags.BoolVar(&withImage, "with-image", false, "Match images")
+	flags.BoolVar(&withVideo, "with-video", false, "Match videos")
+	flags.BoolVar(&withAudio, "with-audio", false, "Match audio")
+	flags.BoolVar(&withAll, "all", false, "Match all files")
+	flags.Var(includes, "include", "Include glob pattern (repeatable or comma-separated)")
+	flags.Var(excludes, "exclude", "Exclude glob pattern (repeatable or comma-separated)")
+	flags.IntVar(&phashDistance, "phash-distance", 4, "Max Hamming distance between a local image and an exported photo")
+	flags.BoolVar(&dryRun, "dry-run", false, "List the matching files without writing the queue")
+	bindWalkFlags(cmd, cfg)
+	return cmd
+}
+
+// loadChatExport reads the export at path, a result.json file or the
+// directory holding one, and hashes the photos it contains.
+func loadChatExport(path string) (*exportedMedia, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, exportResultFilename)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export chatExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid chat export %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	media := &exportedMedia{files: map[exportKey]struct{}{}}
+	for _, message := range export.Messages {
+		if message.Type != "message" {
+			continue
+		}
+		if message.Photo != "" {
+			data, err := readExportedFile(dir, message.Photo)
+			if err != nil {
+				media.unmatchable++
+				continue
+			}
+			hash, err := imageutil.DHash(data)
+			if err != nil {
+				log.Printf("hash %s failed: %v", message.Photo, err)
+				continue
+			}
+			media.photoHashes = append(media.photoHashes, hash)
+			continue
+		}
+		if message.File == "" {
+			continue
+		}
+		name := message.FileName
+		if name == "" {
+			if !exportedFileIncluded(message.File) {
+				media.unmatchable++
+				continue
+			}
+			name = filepath.Base(filepath.FromSlash(message.File))
+		}
+		size := message.FileSize
+		if size == 0 && exportedFileIncluded(message.File) {
+			if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(message.File))); err == nil {
+				size = info.Size()
+			}
+		}
+		if size == 0 {
+			media.unmatchable++
+			continue
+		}
+		media.files[exportKey{name: strings.ToLower(name), size: size}] = struct{}{}
+	}
+	return media, nil
+}
+
+// exportedFileIncluded reports whether value is a path rather than the note
+// Telegram Desktop writes for media it did not download.
+func exportedFileIncluded(value string) bool {
+	return value != "" && !strings.HasPrefix(value, "(")
+}
+
+func readExportedFile(dir string, value string) ([]byte, error) {
+	if !exportedFileIncluded(value) {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(dir, filepath.FromSlash(value)))
+}
+
+// match reports whether the chat holds file and, for images matched by
+// perceptual hash, returns the hash to record for --phash-dedup.
+func (m *exportedMedia) match(file watcher.Candidate, distance int) (string, bool) {
+	if _, ok := m.files[exportKey{name: strings.ToLower(file.Info.Name()), size: file.Info.Size()}]; ok {
+		return "", true
+	}
+	if file.SendType != "image" || len(m.photoHashes) == 0 {
+		return "", false
+	}
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		log.Printf("read %s failed: %v", file.Path, err)
+		return "", false
+	}
+	hash, err := imageutil.DHash(data)
+	if err != nil {
+		return "", false
+	}
+	for _, photo := range m.photoHashes {
+		if imageutil.HammingDistance(hash, photo) <= distance {
+			return fmt.Sprintf("%016x", hash), true
+		}
+	}
+	return "", false
+}
@@ -2,15 +2,23 @@ package cmd
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tracing"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
 )
@@ -19,6 +27,8 @@ type queueSendConfig struct {
 	chatID          string
 	topicID         *int
 	groupSize       int
+	groupMaxBytes   int64
+	albumVideos     bool
 	batchDelay      time.Duration
 	maxDimension    int
 	maxBytes        int
@@ -27,6 +37,13 @@ type queueSendConfig struct {
 	zipPasswords    []string
 	logZipPasswords bool
 	queueRetries    int
+	checksums       *checksumSet
+	autoSplit       splitter.Spec
+	ordering        string
+	// quarantine and roots are passed to sender.QuarantineFailed after
+	// the queue is drained.
+	quarantine string
+	roots      []string
 }
 
 func resolveAbsPaths(values []string) ([]string, error) {
@@ -45,6 +62,17 @@ func resolveAbsPaths(values []string) ([]string, error) {
 	return paths, nil
 }
 
+// absRoot makes a directory to walk absolute so the collected paths stay
+// usable on Windows once they grow past MAX_PATH: package os only extends
+// absolute paths.
+func absRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	return abs
+}
+
 func validateQueueRetries(value int) (int, error) {
 	if value < 1 {
 		return 0, fmt.Errorf("queue-retries must be >= 1")
@@ -52,7 +80,7 @@ func validateQueueRetries(value int) (int, error) {
 	return value, nil
 }
 
-func enqueueFileItem(q *queue.Queue, path string, sendType string) int {
+func enqueueFileItem(q *queue.Queue, path string, sendType string, priority int) int {
 	info, err := os.Stat(path)
 	if err != nil {
 		log.Printf("stat failed for %s: %v", path, err)
@@ -68,6 +96,7 @@ func enqueueFileItem(q *queue.Queue, path string, sendType string) int {
 		MTimeNS:           &mtimeNS,
 		SendType:          sendType,
 		Fingerprint:       queue.BuildFingerprint("file", path, nil, info.Size(), &mtimeNS, nil),
+		Priority:          priority,
 	}
 	added, err := q.Enqueue(item)
 	if err != nil {
@@ -80,30 +109,32 @@ func enqueueFileItem(q *queue.Queue, path string, sendType string) int {
 	return 1
 }
 
-func enqueueImagesFromDir(q *queue.Queue, dir string, include []string, exclude []string, enableZip bool, startIndex int, endIndex int, groupSize int, zipPasswords []string) int {
-	files := collectFiles(dir, include, exclude, enableZip, constants.ImageExtensions)
+func enqueueImagesFromDir(q *queue.Queue, dir string, include []string, exclude []string, walk fswalk.Options, enableZip bool, startIndex int, endIndex int, groupSize int, zipPasswords []string, priority int) (enqueued int, unreadable int, err error) {
+	files, unreadable, err := collectFiles(dir, include, exclude, walk, enableZip, constants.ImageExtensions)
+	if err != nil {
+		return 0, unreadable, err
+	}
 	if len(files) == 0 {
 		log.Printf("no images found in %s", dir)
-		return 0
+		return 0, unreadable, nil
 	}
 	minIndex := startIndex * groupSize
 	maxIndex := endIndex * groupSize
 	rangeStart, rangeEnd := clampRange(minIndex, maxIndex, len(files))
-	enqueued := 0
 	for _, path := range files[rangeStart:rangeEnd] {
 		if enableZip && strings.HasSuffix(strings.ToLower(path), ".zip") {
-			enqueued += enqueueZipImages(q, path, include, exclude, 0, 0, groupSize, zipPasswords)
+			enqueued += enqueueZipImages(q, path, include, exclude, 0, 0, groupSize, zipPasswords, priority)
 			continue
 		}
 		if !isImage(path) {
 			continue
 		}
-		enqueued += enqueueFileItem(q, path, "image")
+		enqueued += enqueueFileItem(q, path, "image", priority)
 	}
-	return enqueued
+	return enqueued, unreadable, nil
 }
 
-func enqueueZipImages(q *queue.Queue, zipPath string, include []string, exclude []string, startIndex int, endIndex int, groupSize int, zipPasswords []string) int {
+func enqueueZipImages(q *queue.Queue, zipPath string, include []string, exclude []string, startIndex int, endIndex int, groupSize int, zipPasswords []string, priority int) int {
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -162,6 +193,7 @@ func enqueueZipImages(q *queue.Queue, zipPath string, include []string, exclude
 			CRC:               &crcCopy,
 			SendType:          "image",
 			Fingerprint:       queue.BuildFingerprint("zip", zipPath, &innerCopy, size, nil, &crcCopy),
+			Priority:          priority,
 		}
 		added, err := q.Enqueue(item)
 		if err != nil {
@@ -175,26 +207,28 @@ func enqueueZipImages(q *queue.Queue, zipPath string, include []string, exclude
 	return enqueued
 }
 
-func enqueueFilesFromDir(q *queue.Queue, dir string, sendType string, include []string, exclude []string, enableZip bool, startIndex int, endIndex int, zipPasswords []string) int {
+func enqueueFilesFromDir(q *queue.Queue, dir string, sendType string, include []string, exclude []string, walk fswalk.Options, enableZip bool, startIndex int, endIndex int, zipPasswords []string, priority int) (enqueued int, unreadable int, err error) {
 	allowed := allowedExtsForType(sendType)
-	files := collectFiles(dir, include, exclude, enableZip, allowed)
+	files, unreadable, err := collectFiles(dir, include, exclude, walk, enableZip, allowed)
+	if err != nil {
+		return 0, unreadable, err
+	}
 	if len(files) == 0 {
 		log.Printf("no files found in %s", dir)
-		return 0
+		return 0, unreadable, nil
 	}
 	rangeStart, rangeEnd := clampRange(startIndex, endIndex, len(files))
-	enqueued := 0
 	for _, path := range files[rangeStart:rangeEnd] {
 		if enableZip && strings.HasSuffix(strings.ToLower(path), ".zip") {
-			enqueued += enqueueZipFiles(q, path, sendType, include, exclude, 0, 0, zipPasswords)
+			enqueued += enqueueZipFiles(q, path, sendType, include, exclude, 0, 0, zipPasswords, priority)
 			continue
 		}
-		enqueued += enqueueFileItem(q, path, sendType)
+		enqueued += enqueueFileItem(q, path, sendType, priority)
 	}
-	return enqueued
+	return enqueued, unreadable, nil
 }
 
-func enqueueZipFiles(q *queue.Queue, zipPath string, sendType string, include []string, exclude []string, startIndex int, endIndex int, zipPasswords []string) int {
+func enqueueZipFiles(q *queue.Queue, zipPath string, sendType string, include []string, exclude []string, startIndex int, endIndex int, zipPasswords []string, priority int) int {
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -251,6 +285,7 @@ func enqueueZipFiles(q *queue.Queue, zipPath string, sendType string, include []
 			CRC:               &crcCopy,
 			SendType:          sendType,
 			Fingerprint:       queue.BuildFingerprint("zip", zipPath, &innerCopy, size, nil, &crcCopy),
+			Priority:          priority,
 		}
 		added, err := q.Enqueue(item)
 		if err != nil {
@@ -264,10 +299,11 @@ func enqueueZipFiles(q *queue.Queue, zipPath string, sendType string, include []
 	return enqueued
 }
 
-func collectSourceFiles(dir string, include []string, exclude []string) []string {
+func collectSourceFiles(dir string, include []string, exclude []string, walk fswalk.Options) ([]string, int, error) {
+	dir = absRoot(dir)
 	files := []string{}
-	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := fswalk.Walk(dir, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 		rel, err := filepath.Rel(dir, path)
@@ -284,10 +320,14 @@ func collectSourceFiles(dir string, include []string, exclude []string) []string
 		files = append(files, path)
 		return nil
 	})
-	return files
+	unreadable, err := walkProblems(dir, walk, err)
+	if err != nil {
+		return nil, unreadable, err
+	}
+	return files, unreadable, nil
 }
 
-func enqueueMixedFromPaths(q *queue.Queue, paths []string, sel mixedSelection, include []string, exclude []string, applyFilters bool, enableZip bool, zipPasswords []string) int {
+func enqueueMixedFromPaths(q *queue.Queue, paths []string, sel mixedSelection, include []string, exclude []string, applyFilters bool, enableZip bool, zipPasswords []string, priority int) int {
 	enqueued := 0
 	for _, path := range paths {
 		name := filepath.Base(path)
@@ -300,19 +340,19 @@ func enqueueMixedFromPaths(q *queue.Queue, paths []string, sel mixedSelection, i
 			}
 		}
 		if enableZip && strings.HasSuffix(strings.ToLower(path), ".zip") {
-			enqueued += enqueueZipMixed(q, path, sel, include, exclude, zipPasswords)
+			enqueued += enqueueZipMixed(q, path, sel, include, exclude, zipPasswords, priority)
 			continue
 		}
 		sendType := mixedSendType(name, sel)
 		if sendType == "" {
 			continue
 		}
-		enqueued += enqueueFileItem(q, path, sendType)
+		enqueued += enqueueFileItem(q, path, sendType, priority)
 	}
 	return enqueued
 }
 
-func enqueueZipMixed(q *queue.Queue, zipPath string, sel mixedSelection, include []string, exclude []string, zipPasswords []string) int {
+func enqueueZipMixed(q *queue.Queue, zipPath string, sel mixedSelection, include []string, exclude []string, zipPasswords []string, priority int) int {
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -359,6 +399,7 @@ func enqueueZipMixed(q *queue.Queue, zipPath string, sel mixedSelection, include
 			CRC:               &crcCopy,
 			SendType:          sendType,
 			Fingerprint:       queue.BuildFingerprint("zip", zipPath, &innerCopy, size, nil, &crcCopy),
+			Priority:          priority,
 		}
 		added, err := q.Enqueue(item)
 		if err != nil {
@@ -405,37 +446,118 @@ func loadQueueItem(item *queue.Item, zipPasswords []string, opts ziputil.ReadOpt
 	}
 }
 
+// markSent records the message and file_id of a file sent as one message,
+// for download --queue-file.
+func markSent(q *queue.Queue, item *queue.Item, result telegram.Result) {
+	if len(result.MessageIDs) != 1 {
+		_ = q.UpdateStatus(item.ID, queue.StatusSent, nil)
+		return
+	}
+	fileID := ""
+	if len(result.FileIDs) == 1 {
+		fileID = result.FileIDs[0]
+	}
+	_ = q.MarkSent(item.ID, result.MessageIDs[0], fileID)
+}
+
 func markFailed(q *queue.Queue, item *queue.Item, err error) {
 	if item == nil {
 		return
 	}
+	var floodWait *telegram.ErrFloodWait
+	var unauthorized *telegram.ErrUnauthorized
+	if errors.As(err, &floodWait) || errors.As(err, &unauthorized) {
+		// A rate limit or a rejected token says nothing about the item: the
+		// flood pause or another token handles the next attempt.
+		log.Printf("requeued %s without counting an attempt: %v", item.Path, err)
+		if updateErr := q.UpdateStatus(item.ID, queue.StatusQueued, nil); updateErr != nil {
+			log.Printf("queue update failed: %v", updateErr)
+		}
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) && !sender.CheckSource(q, item) {
+		return
+	}
 	msg := err.Error()
 	attempts := item.Attempts + 1
-	if updateErr := q.UpdateStatusWithAttempts(item.ID, queue.StatusFailed, &msg, &attempts); updateErr != nil {
+	status := queue.StatusFailed
+	if sender.Permanent(err) {
+		status = queue.StatusFailedPermanent
+		log.Printf("permanent failure, not retrying %s: %v", item.Path, err)
+	}
+	if updateErr := q.UpdateStatusWithAttempts(item.ID, status, &msg, &attempts); updateErr != nil {
+		log.Printf("queue update failed: %v", updateErr)
+	}
+}
+
+// markFailedOrRequeue returns items interrupted by cancellation to the
+// queue instead of recording a failed attempt.
+func markFailedOrRequeue(ctx context.Context, q *queue.Queue, item *queue.Item, err error) {
+	if ctx.Err() == nil {
+		markFailed(q, item, err)
+		return
+	}
+	if updateErr := q.UpdateStatus(item.ID, queue.StatusQueued, nil); updateErr != nil {
 		log.Printf("queue update failed: %v", updateErr)
 	}
 }
 
-func drainQueue(client *telegram.Client, q *queue.Queue, label string, cfg queueSendConfig) (int, int, int64) {
+// albumItem reports whether a queued video may join a mixed album.
+func (cfg queueSendConfig) albumItem(item *queue.Item, sendType string) bool {
+	return cfg.albumVideos && sendType == "video" && item.Size <= constants.AlbumVideoMaxBytes
+}
+
+func drainQueue(ctx context.Context, client *telegram.Client, q *queue.Queue, label string, cfg queueSendConfig) (int, int, int64) {
 	pending := q.PendingWithAttempts(0, cfg.queueRetries)
 	if len(pending) == 0 {
 		return 0, 0, 0
 	}
+	ctx, span := tracing.Start(ctx, "send "+label)
+	span.Set("telegram.chat_id", cfg.chatID)
+	span.Set("queue.pending", len(pending))
 
-	progressState := newProgressTracker(len(pending), label)
+	progressState := newProgressTracker(len(pending), label).withSizes(itemSizes(pending))
 	processed := 0
 	sent := 0
 	skipped := 0
 	sentBytes := int64(0)
 	zipOpts := ziputil.ReadOptions{LogPasswords: cfg.logZipPasswords}
+	failures := failureTally{}
+	fail := func(item *queue.Item, err error) {
+		markFailedOrRequeue(ctx, q, item, err)
+		skipped++
+		if ctx.Err() == nil {
+			failures.add(err)
+		}
+	}
+	// hold records a failed send and reports whether strict ordering sends
+	// the item again before anything queued after it. Items out of attempts
+	// or failed permanently are given up on.
+	hold := func(item *queue.Item, err error) bool {
+		if cfg.ordering != sender.OrderingStrict || ctx.Err() != nil {
+			fail(item, err)
+			return false
+		}
+		markFailed(q, item, err)
+		if q.IsPending(item.ID) && item.Attempts < cfg.queueRetries {
+			log.Printf("strict ordering: retrying %s before later items", item.Path)
+			return true
+		}
+		skipped++
+		failures.add(err)
+		return false
+	}
 
 	for i := 0; i < len(pending); {
+		if ctx.Err() != nil {
+			break
+		}
 		item := pending[i]
 		sendType := item.SendType
 		if sendType == "" {
 			sendType = "image"
 		}
-		if sendType == "image" {
+		if sendType == "image" || cfg.albumItem(item, sendType) {
 			group := []*queue.Item{}
 			for i < len(pending) && len(group) < cfg.groupSize {
 				current := pending[i]
@@ -443,47 +565,74 @@ func drainQueue(client *telegram.Client, q *queue.Queue, label string, cfg queue
 				if currentType == "" {
 					currentType = "image"
 				}
-				if currentType != "image" {
+				if currentType != "image" && !cfg.albumItem(current, currentType) {
 					break
 				}
 				group = append(group, current)
 				i++
 			}
 
+			groupClient := client.PinFolder(group[0].Folder())
 			media := []telegram.MediaFile{}
 			itemRefs := []*queue.Item{}
-			groupBytes := int64(0)
+			sourceBytes := []int64{}
 			for _, entry := range group {
 				_ = q.UpdateStatus(entry.ID, queue.StatusSending, nil)
 				data, filename, err := loadQueueItem(entry, cfg.zipPasswords, zipOpts)
 				if err != nil {
-					markFailed(q, entry, err)
-					skipped++
+					fail(entry, err)
+					continue
+				}
+				if entry.SendType == "video" {
+					media = append(media, telegram.MediaFile{Filename: filename, Data: data, Type: telegram.MediaVideo, Source: entry.Path})
+					itemRefs = append(itemRefs, entry)
+					sourceBytes = append(sourceBytes, int64(len(data)))
 					continue
 				}
 				prepared, err := prepareImageMedia(data, filename, cfg.maxDimension, cfg.maxBytes, cfg.pngStartLevel)
 				if err != nil {
-					markFailed(q, entry, err)
-					skipped++
+					fail(entry, err)
 					continue
 				}
-				media = append(media, prepared)
+				prepared.Source = entry.Path
+				media = append(media, groupClient.WithOriginal(prepared, data, filename))
 				itemRefs = append(itemRefs, entry)
-				groupBytes += int64(len(data))
+				sourceBytes = append(sourceBytes, int64(len(data)))
 			}
 
-			if len(media) > 0 {
-				if err := client.SendMediaGroup(cfg.chatID, media, cfg.topicID, cfg.retry); err != nil {
-					for _, entry := range itemRefs {
-						markFailed(q, entry, err)
+			offset := 0
+			for _, chunk := range telegram.SplitMediaGroup(media, cfg.groupMaxBytes) {
+				refs := itemRefs[offset : offset+len(chunk)]
+				sizes := sourceBytes[offset : offset+len(chunk)]
+				offset += len(chunk)
+				for len(chunk) > 0 {
+					_, errs := groupClient.SendMediaGroupEachFunc(ctx, cfg.chatID, chunk, cfg.topicID, cfg.retry, func(first int, results []telegram.Result) {
+						for j, result := range results {
+							markSent(q, refs[first+j], result)
+						}
+						if err := q.Flush(); err != nil {
+							log.Printf("queue flush failed: %v", err)
+						}
+					})
+					retryChunk := []telegram.MediaFile{}
+					retryRefs := []*queue.Item{}
+					retrySizes := []int64{}
+					for j, entry := range refs {
+						if errs[j] == nil {
+							sent++
+							sentBytes += sizes[j]
+							continue
+						}
+						if hold(entry, errs[j]) {
+							retryChunk = append(retryChunk, chunk[j])
+							retryRefs = append(retryRefs, entry)
+							retrySizes = append(retrySizes, sizes[j])
+						}
 					}
-					skipped += len(itemRefs)
-				} else {
-					for _, entry := range itemRefs {
-						_ = q.UpdateStatus(entry.ID, queue.StatusSent, nil)
+					chunk, refs, sizes = retryChunk, retryRefs, retrySizes
+					if len(chunk) > 0 && !waitContext(ctx, cfg.retry.Delay) {
+						break
 					}
-					sent += len(itemRefs)
-					sentBytes += groupBytes
 				}
 				time.Sleep(cfg.batchDelay)
 			}
@@ -494,23 +643,49 @@ func drainQueue(client *telegram.Client, q *queue.Queue, label string, cfg queue
 		}
 
 		_ = q.UpdateStatus(item.ID, queue.StatusSending, nil)
-		data, filename, err := loadQueueItem(item, cfg.zipPasswords, zipOpts)
+		if item.SourceType == "file" && cfg.autoSplit.Needed(item.Size) {
+			for {
+				size, err := sendPathOrSplit(ctx, client.PinFolder(item.Folder()), cfg.chatID, cfg.topicID, sendType, item.Path, cfg.autoSplit, cfg.checksums, cfg.retry)
+				if err == nil {
+					_ = q.UpdateStatus(item.ID, queue.StatusSent, nil)
+					sent++
+					sentBytes += size
+					break
+				}
+				if !hold(item, err) || !waitContext(ctx, cfg.retry.Delay) {
+					break
+				}
+			}
+			processed++
+			progressState.Print(processed, sent, skipped, false)
+			i++
+			time.Sleep(cfg.batchDelay)
+			continue
+		}
+		data, _, err := loadQueueItem(item, cfg.zipPasswords, zipOpts)
 		if err != nil {
-			markFailed(q, item, err)
-			skipped++
+			fail(item, err)
 			processed++
 			progressState.Print(processed, sent, skipped, false)
 			i++
 			continue
 		}
 
-		if err := sendSingleFile(client, cfg.chatID, cfg.topicID, sendType, filename, data, cfg.retry); err != nil {
-			markFailed(q, item, err)
-			skipped++
-		} else {
-			_ = q.UpdateStatus(item.ID, queue.StatusSent, nil)
-			sent++
-			sentBytes += int64(len(data))
+		source := fileSource{path: item.Path}
+		if item.InnerPath != nil {
+			source.inner = *item.InnerPath
+		}
+		for {
+			result, err := sendDataOrSplit(ctx, client.PinFolder(item.Folder()), cfg.chatID, cfg.topicID, sendType, source, data, cfg.autoSplit, cfg.checksums, cfg.retry)
+			if err == nil {
+				markSent(q, item, result)
+				sent++
+				sentBytes += int64(len(data))
+				break
+			}
+			if !hold(item, err) || !waitContext(ctx, cfg.retry.Delay) {
+				break
+			}
 		}
 		processed++
 		progressState.Print(processed, sent, skipped, false)
@@ -519,5 +694,52 @@ func drainQueue(client *telegram.Client, q *queue.Queue, label string, cfg queue
 	}
 
 	progressState.Print(processed, sent, skipped, true)
+	failures.print()
+	sender.QuarantineFailed(q, cfg.quarantine, cfg.roots)
+	span.Set("run.sent", sent)
+	span.Set("run.skipped", skipped)
+	span.Set("run.bytes", sentBytes)
+	span.SetError(ctx.Err())
+	span.End()
 	return sent, skipped, sentBytes
 }
+
+// waitContext sleeps for d and reports whether ctx is still live.
+func waitContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// failureTally counts a run's failed items by telegram.ErrorClass for the
+// summary.
+type failureTally map[string]int
+
+func (t failureTally) add(err error) {
+	class := telegram.ErrorClass(err)
+	if class == "" {
+		class = "other"
+	}
+	t[class]++
+}
+
+func (t failureTally) print() {
+	if len(t) == 0 {
+		return
+	}
+	classes := make([]string, 0, len(t))
+	for class := range t {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		parts = append(parts, fmt.Sprintf("%s=%d", class, t[class]))
+	}
+	fmt.Fprintf(os.Stdout, "Failures: %s\n", strings.Join(parts, " "))
+}
@@ -1,38 +1,136 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tracing"
 	"github.com/spf13/cobra"
 )
 
 var verbose bool
+var stateDir string
+var tempDir string
+var lang string
+var otlpEndpoint string
+var otlpHeaders []string
+var buildVersion string
+
+// runSpan is the root span of the command's trace; nil when tracing is off
+// or the command runs until stopped.
+var runSpan *tracing.Span
 
 func newRootCmd(version string, buildTime string, gitCommit string) *cobra.Command {
+	buildVersion = version
 	cmd := &cobra.Command{
 		Use:   "telegram-send-go",
 		Short: "telegram-send-go is a Telegram upload watcher CLI.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmd.Help()
 		},
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := i18n.SetLang(lang); err != nil {
+				return err
+			}
+			if err := tempdir.Set(tempDir); err != nil {
+				return err
+			}
+			if err := setupTracing(otlpEndpoint, otlpHeaders); err != nil {
+				return err
+			}
+			// Commands that run until stopped start a trace per batch
+			// instead, so their spans do not wait for the process to end.
+			if cmd.Annotations[longRunningAnnotation] == "" {
+				ctx, span := tracing.Start(cmd.Context(), cmd.CommandPath())
+				runSpan = span
+				cmd.SetContext(ctx)
+			}
+			return nil
+		},
 	}
 
 	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.PersistentFlags().StringVar(&tempDir, "temp-dir", "", "Directory for temporary files such as transcoded videos, archive volumes and extracted zip entries (default the system temp directory); leftovers older than a day are removed")
+	cmd.PersistentFlags().StringVar(&lang, "lang", i18n.English, "Language of the start, completion and notify messages posted to Telegram: "+strings.Join(i18n.Languages, ", "))
+	cmd.PersistentFlags().StringVar(&stateDir, "state-dir", "", "State directory for default queue files (default $XDG_STATE_HOME/telegram-upload-watcher)")
+	cmd.PersistentFlags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export traces of the sends to this OTLP/HTTP collector, such as http://localhost:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT; off when empty)")
+	cmd.PersistentFlags().StringArrayVar(&otlpHeaders, "otlp-header", nil, "Header sent with trace exports as KEY=VALUE, such as an API key (repeatable; default $OTEL_EXPORTER_OTLP_HEADERS)")
 
 	cmd.AddCommand(newSendMessageCmd())
+	cmd.AddCommand(newSendPollCmd())
+	cmd.AddCommand(newSendLocationCmd())
+	cmd.AddCommand(newEditMessageCmd())
+	cmd.AddCommand(newEditCaptionCmd())
+	cmd.AddCommand(newChatCmd())
 	cmd.AddCommand(newSendImagesCmd())
 	cmd.AddCommand(newSendFileCmd())
 	cmd.AddCommand(newSendVideoCmd())
 	cmd.AddCommand(newSendAudioCmd())
 	cmd.AddCommand(newSendMixedCmd())
+	cmd.AddCommand(newSendPDFCmd())
 	cmd.AddCommand(newWatchCmd())
+	cmd.AddCommand(newSendQueueCmd())
+	cmd.AddCommand(newConsumeCmd())
+	cmd.AddCommand(newDownloadCmd())
+	cmd.AddCommand(newZipCmd())
+	cmd.AddCommand(newQueueCmd())
+	cmd.AddCommand(newStatsCmd())
+	cmd.AddCommand(newCtlCmd())
+	cmd.AddCommand(newDaemonCmd())
+	cmd.AddCommand(newDoctorCmd())
+	cmd.AddCommand(newServiceCmd())
+	cmd.AddCommand(newIntegrateShellCmd())
+	cmd.AddCommand(newCompletionCmd())
+	cmd.AddCommand(newGenDocsCmd())
+	cmd.AddCommand(newBenchCmd())
 	cmd.AddCommand(newVersionCmd(version, buildTime, gitCommit))
 	return cmd
 }
 
+// longRunningAnnotation marks the commands that send until they are
+// stopped.
+const longRunningAnnotation = "long-running"
+
+// setupTracing starts trace export to endpoint with headers, falling back
+// to the OTEL_EXPORTER_OTLP_* environment variables for what is unset.
+func setupTracing(endpoint string, headers []string) error {
+	cfg := tracing.ConfigFromEnv()
+	cfg.Version = buildVersion
+	if endpoint != "" {
+		cfg.Endpoint = endpoint
+	}
+	if len(headers) > 0 {
+		parsed, err := tracing.ParseHeaders(headers)
+		if err != nil {
+			return err
+		}
+		cfg.Headers = parsed
+	}
+	return tracing.Setup(cfg)
+}
+
 func Execute(version string, buildTime string, gitCommit string) error {
-	if err := newRootCmd(version, buildTime, gitCommit).Execute(); err != nil {
+	// The first interrupt cancels the command context so in-flight uploads
+	// are aborted and queue items are returned; a second one exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := newRootCmd(version, buildTime, gitCommit).ExecuteContext(ctx)
+	logRequestLatency()
+	runSpan.SetError(err)
+	runSpan.End()
+	tracing.Shutdown(5 * time.Second)
+	if err != nil {
 		return fmt.Errorf("error executing root command: %w", err)
 	}
 	return nil
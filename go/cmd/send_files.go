@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -9,7 +11,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/archive"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
@@ -44,6 +50,16 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 	var logZipPasswords bool
 	var queueFile string
 	var queueRetries int
+	var ordering string
+	var priorityName string
+	var checksums bool
+	var checksumCaption bool
+	var manifestPath string
+	var manifestUpload bool
+	var autoSplit string
+	var asArchive bool
+	var archiveFormat string
+	var archivePassword string
 
 	cmd := &cobra.Command{
 		Use:          use,
@@ -51,6 +67,7 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
 			if cfg.chatID == "" {
 				return fmt.Errorf("chat-id is required")
@@ -59,6 +76,11 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 				return fmt.Errorf("file, dir, or zip-file is required")
 			}
 
+			notes, err := newRunNotes(cfg)
+			if err != nil {
+				return err
+			}
+			notes.pace = runPace{batchDelay: time.Duration(batchDelay) * time.Second}
 			apiURLs, tokens, err := resolveConfig(cfg)
 			if err != nil {
 				return err
@@ -72,12 +94,38 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if asArchive && len(dirPaths.Values()) == 0 {
+				return fmt.Errorf("as-archive requires dir")
+			}
+			if asArchive && queueFile != "" {
+				return fmt.Errorf("as-archive cannot be used with queue-file")
+			}
+			format, err := archive.ParseFormat(archiveFormat)
+			if err != nil {
+				return err
+			}
+			if archivePassword != "" && format != archive.FormatZip {
+				return fmt.Errorf("archive-password needs --archive-format zip")
+			}
+			sums := newChecksumSet(checksums, checksumCaption, manifestPath, manifestUpload)
+			split, err := splitter.ParseSpec(autoSplit)
+			if err != nil {
+				return err
+			}
 
 			if queueFile != "" {
+				priority, err := queue.ParsePriority(priorityName)
+				if err != nil {
+					return err
+				}
 				queueRetries, err = validateQueueRetries(queueRetries)
 				if err != nil {
 					return err
 				}
+				ordering, err = sender.ParseOrdering(ordering)
+				if err != nil {
+					return err
+				}
 				resolvedFiles, err := resolveAbsPaths(filePaths.Values())
 				if err != nil {
 					return err
@@ -93,7 +141,7 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 				meta := &queue.Meta{
 					Params: queue.MetaParams{
 						Command:      use,
-						ChatID:       cfg.chatID,
+						ChatID:       cfg.queueChatID(),
 						TopicID:      topicPtr(cfg),
 						Files:        resolvedFiles,
 						Dirs:         resolvedDirs,
@@ -109,29 +157,37 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 						RetryDelay:   cfg.retryDelaySec,
 					},
 				}
-				q, err := queue.New(queueFile, meta)
+				q, err := cfg.openQueue(queueFile, meta)
 				if err != nil {
 					return err
 				}
 				defer q.Close()
+				if err := cfg.attachSentIndex(q, cfg.chatID); err != nil {
+					return err
+				}
 
+				unreadable := 0
 				for _, filePath := range resolvedFiles {
 					if _, err := os.Stat(filePath); err != nil {
 						return err
 					}
-					enqueueFileItem(q, filePath, sendType)
+					enqueueFileItem(q, filePath, sendType, priority)
 				}
 				for _, dirPath := range resolvedDirs {
 					if _, err := os.Stat(dirPath); err != nil {
 						return err
 					}
-					enqueueFilesFromDir(q, dirPath, sendType, includes.Values(), excludes.Values(), enableZip, startIndex, endIndex, zipPasswords)
+					_, dirUnreadable, err := enqueueFilesFromDir(q, dirPath, sendType, includes.Values(), excludes.Values(), cfg.walkOptions(), enableZip, startIndex, endIndex, zipPasswords, priority)
+					if err != nil {
+						return err
+					}
+					unreadable += dirUnreadable
 				}
 				for _, zipPath := range resolvedZips {
 					if _, err := os.Stat(zipPath); err != nil {
 						return err
 					}
-					enqueueZipFiles(q, zipPath, sendType, includes.Values(), excludes.Values(), startIndex, endIndex, zipPasswords)
+					enqueueZipFiles(q, zipPath, sendType, includes.Values(), excludes.Values(), startIndex, endIndex, zipPasswords, priority)
 				}
 
 				pending := q.PendingWithAttempts(0, queueRetries)
@@ -143,14 +199,9 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 				label := sendTypeLabel(sendType)
 				startedAt := time.Now()
 				retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf("Starting %s upload from queue: %d file(s) at %s", label, len(pending), formatTimestamp(startedAt)),
-					topicPtr(cfg),
-					retry,
-				)
+				client = notes.startRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: label, Source: queueFile, Count: len(pending), TotalBytes: sumSizes(itemSizes(pending)), StartedAt: startedAt})
 
-				sent, skipped, sentBytes := drainQueue(client, q, label, queueSendConfig{
+				sent, skipped, sentBytes := drainQueue(ctx, client, q, label, queueSendConfig{
 					chatID:          cfg.chatID,
 					topicID:         topicPtr(cfg),
 					groupSize:       1,
@@ -162,32 +213,18 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 					zipPasswords:    zipPasswords,
 					logZipPasswords: logZipPasswords,
 					queueRetries:    queueRetries,
+					ordering:        ordering,
+					checksums:       sums,
+					autoSplit:       split,
+					quarantine:      cfg.quarantine,
+					roots:           resolvedDirs,
 				})
+				sums.flush(ctx, client, cfg.chatID, topicPtr(cfg), retry)
 
 				finishedAt := time.Now()
 				elapsed := finishedAt.Sub(startedAt)
-				avgPer := time.Duration(0)
-				if sent > 0 {
-					avgPer = elapsed / time.Duration(sent)
-				}
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf(
-						"Completed %s upload from %s at %s (elapsed %s, avg/file %s, total %s, avg %s, sent %d, skipped %d)",
-						label,
-						queueFile,
-						formatTimestamp(finishedAt),
-						formatDuration(elapsed),
-						formatDuration(avgPer),
-						formatBytes(sentBytes),
-						formatSpeed(sentBytes, elapsed),
-						sent,
-						skipped,
-					),
-					topicPtr(cfg),
-					retry,
-				)
-				printSummary(label, queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+				notes.finishRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: label, Source: queueFile, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+				printSummary(label, queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
 				return nil
 			}
 
@@ -196,48 +233,29 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 				label := sendTypeLabel(sendType)
 				progressState := newProgressTracker(1, label)
 				startedAt := time.Now()
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf("Starting %s upload: 1 file(s) at %s", label, formatTimestamp(startedAt)),
-					topicPtr(cfg),
-					retry,
-				)
-				data, err := os.ReadFile(filePath)
-				if err != nil {
-					progressState.Print(1, 0, 1, true)
-					return err
-				}
+				client = notes.startRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: label, Source: filepath.Base(filePath), Count: 1, StartedAt: startedAt})
 				filename := filepath.Base(filePath)
-				if err := sendSingleFile(client, cfg.chatID, topicPtr(cfg), sendType, filename, data, retry); err != nil {
+				sentBytes, err := sendPathOrSplit(ctx, client, cfg.chatID, topicPtr(cfg), sendType, filePath, split, sums, retry)
+				if err != nil {
 					progressState.Print(1, 0, 1, true)
 					return err
 				}
 				progressState.Print(1, 1, 0, true)
+				sums.flush(ctx, client, cfg.chatID, topicPtr(cfg), retry)
 				finishedAt := time.Now()
 				elapsed := finishedAt.Sub(startedAt)
-				avgPer := elapsed
-				sentBytes := int64(len(data))
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf(
-						"Completed %s upload from %s at %s (elapsed %s, avg/file %s, total %s, avg %s, sent %d, skipped %d)",
-						label,
-						filename,
-						formatTimestamp(finishedAt),
-						formatDuration(elapsed),
-						formatDuration(avgPer),
-						formatBytes(sentBytes),
-						formatSpeed(sentBytes, elapsed),
-						1,
-						0,
-					),
-					topicPtr(cfg),
-					retry,
-				)
-				printSummary(label, filename, startedAt, finishedAt, elapsed, 1, 0, sentBytes)
+				notes.finishRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: label, Source: filename, Count: 1, Sent: 1, Bytes: sentBytes, StartedAt: startedAt, FinishedAt: finishedAt})
+				printSummary(label, filename, startedAt, finishedAt, elapsed, 1, 0, sentBytes, 0)
 			}
 			for _, dirPath := range dirPaths.Values() {
-				sendFilesFromDir(
+				if asArchive {
+					if err := sendDirArchive(ctx, client, cfg.chatID, topicPtr(cfg), dirPath, sendType, includes.Values(), excludes.Values(), cfg.walkOptions(), format, archivePassword, sums, split, notes, retry); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := sendFilesFromDir(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
@@ -248,14 +266,21 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 					time.Duration(batchDelay)*time.Second,
 					includes.Values(),
 					excludes.Values(),
+					cfg.walkOptions(),
 					enableZip,
 					zipPasswords,
 					logZipPasswords,
+					sums,
+					split,
+					notes,
 					retry,
-				)
+				); err != nil {
+					return err
+				}
 			}
 			for _, zipPath := range zipPaths.Values() {
 				sendFilesFromZip(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
@@ -268,6 +293,9 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 					excludes.Values(),
 					zipPasswords,
 					logZipPasswords,
+					sums,
+					split,
+					notes,
 					retry,
 				)
 			}
@@ -276,6 +304,8 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 	}
 
 	bindCommonFlags(cmd, cfg)
+	bindRunFlags(cmd, cfg)
+	bindWalkFlags(cmd, cfg)
 	flags := cmd.Flags()
 	flags.Var(filePaths, "file", "File path (repeatable or comma-separated)")
 	flags.Var(dirPaths, "dir", "Directory path (repeatable or comma-separated)")
@@ -290,30 +320,52 @@ func newSendFilesCmd(use string, short string, sendType string) *cobra.Command {
 	flags.StringVar(&zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
 	flags.BoolVar(&logZipPasswords, "zip-pass-log", false, "Log zip passwords while checking (use with care)")
 	flags.StringVar(&queueFile, "queue-file", "", "Path to JSONL queue file (enables resume mode)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.StringVar(&priorityName, "priority", "normal", "Priority of enqueued items with --queue-file: low, normal or high")
 	flags.IntVar(&queueRetries, "queue-retries", 3, "Maximum queue retry attempts per item")
+	flags.StringVar(&ordering, "ordering", sender.OrderingRelaxed, "Queue mode media group order: strict (retry a failed group before sending later ones) or relaxed")
+	flags.BoolVar(&checksums, "checksums", false, "Send a checksums.txt document with the SHA-256 of each file after every run")
+	flags.BoolVar(&checksumCaption, "checksum-caption", false, "Caption each file with its SHA-256")
+	flags.StringVar(&manifestPath, "manifest", "", "Write a JSON manifest mapping each sent file's path and SHA-256 to its message_id and file_id")
+	flags.BoolVar(&manifestUpload, "manifest-upload", false, "Send a manifest.json document with the files of each run to the chat after the run")
+	flags.BoolVar(&asArchive, "as-archive", false, "Pack each --dir into one archive and send it instead of the individual files")
+	flags.StringVar(&archiveFormat, "archive-format", "zip", "Archive format for --as-archive: zip or tar.zst")
+	flags.StringVar(&archivePassword, "archive-password", "", "Encrypt the --as-archive zip with this password (ZipCrypto)")
+	flags.StringVar(&autoSplit, "auto-split", "", "Split files larger than SIZE into zip or 7z volumes and send the parts, e.g. zip:1900MB (7z needs the 7z binary)")
 	return cmd
 }
 
-func sendFilesFromDir(client *telegram.Client, chatID string, topicID *int, dir string, sendType string, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, enableZip bool, zipPasswords []string, logZipPasswords bool, retry telegram.RetryConfig) {
+func sendFilesFromDir(ctx context.Context, client *telegram.Client, chatID string, topicID *int, dir string, sendType string, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, walk fswalk.Options, enableZip bool, zipPasswords []string, logZipPasswords bool, sums *checksumSet, split splitter.Spec, notes *runNotes, retry telegram.RetryConfig) error {
+	client = client.PinFolder(dir)
 	allowed := allowedExtsForType(sendType)
-	files := collectFiles(dir, include, exclude, enableZip, allowed)
+	files, unreadable, err := collectFiles(dir, include, exclude, walk, enableZip, allowed)
+	if err != nil {
+		return err
+	}
 	if len(files) == 0 {
 		log.Printf("no files found in %s", dir)
-		return
+		return nil
 	}
 
 	label := sendTypeLabel(sendType)
 	startedAt := time.Now()
-	_ = client.SendMessage(chatID, fmt.Sprintf("Starting %s upload: %d file(s) at %s", label, len(files), formatTimestamp(startedAt)), topicID, retry)
-
 	rangeStart, rangeEnd := clampRange(startIndex, endIndex, len(files))
 	total := rangeEnd - rangeStart
-	progressState := newProgressTracker(total, label)
+	sizes := pathSizes(files[rangeStart:rangeEnd])
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: label, Source: dir, Count: len(files), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
+
+	progressState := newProgressTracker(total, label).withSizes(sizes)
 	processed := 0
 	sent := 0
 	skipped := 0
 	sentBytes := int64(0)
 	for idx, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
 		if idx < rangeStart {
 			continue
 		}
@@ -321,19 +373,13 @@ func sendFilesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 			break
 		}
 		if strings.HasSuffix(strings.ToLower(path), ".zip") && enableZip {
-			sendFilesFromZip(client, chatID, topicID, path, sendType, 0, 0, delay, include, exclude, zipPasswords, logZipPasswords, retry)
+			sendFilesFromZip(ctx, client, chatID, topicID, path, sendType, 0, 0, delay, include, exclude, zipPasswords, logZipPasswords, sums, split, notes, retry)
 			processed++
 			progressState.Print(processed, sent, skipped, false)
 			continue
 		}
-		data, err := os.ReadFile(path)
+		size, err := sendPathOrSplit(ctx, client, chatID, topicID, sendType, path, split, sums, retry)
 		if err != nil {
-			processed++
-			skipped++
-			progressState.Print(processed, sent, skipped, false)
-			continue
-		}
-		if err := sendSingleFile(client, chatID, topicID, sendType, filepath.Base(path), data, retry); err != nil {
 			log.Printf("send failed: %v", err)
 			processed++
 			skipped++
@@ -341,40 +387,23 @@ func sendFilesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 		} else {
 			processed++
 			sent++
-			sentBytes += int64(len(data))
+			sentBytes += size
 			progressState.Print(processed, sent, skipped, false)
 		}
 		time.Sleep(delay)
 	}
 	progressState.Print(processed, sent, skipped, true)
+	sums.flush(ctx, client, chatID, topicID, retry)
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed %s upload from %s at %s (elapsed %s, avg/file %s, total %s, avg %s, sent %d, skipped %d)",
-			label,
-			dir,
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary(label, dir, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: label, Source: dir, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary(label, dir, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
+	return nil
 }
 
-func sendFilesFromZip(client *telegram.Client, chatID string, topicID *int, zipPath string, sendType string, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, retry telegram.RetryConfig) {
+func sendFilesFromZip(ctx context.Context, client *telegram.Client, chatID string, topicID *int, zipPath string, sendType string, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, sums *checksumSet, split splitter.Spec, notes *runNotes, retry telegram.RetryConfig) {
+	client = client.PinFolder(zipPath)
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -423,23 +452,27 @@ func sendFilesFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 				first.CRC32,
 				err,
 			)
-			_ = client.SendMessage(chatID, fmt.Sprintf("Skipping zip (passwords failed): %s", filepath.Base(zipPath)), topicID, retry)
+			_ = client.SendMessage(ctx, chatID, fmt.Sprintf("Skipping zip (passwords failed): %s", filepath.Base(zipPath)), topicID, retry)
 			return
 		}
 	}
 
 	label := sendTypeLabel(sendType)
 	startedAt := time.Now()
-	_ = client.SendMessage(chatID, fmt.Sprintf("Starting %s upload: %d file(s) at %s", label, len(names), formatTimestamp(startedAt)), topicID, retry)
-
 	rangeStart, rangeEnd := clampRange(startIndex, endIndex, len(names))
 	total := rangeEnd - rangeStart
-	progressState := newProgressTracker(total, label)
+	sizes := zipSizes(filesByName, names[rangeStart:rangeEnd])
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: label, Source: filepath.Base(zipPath), Count: len(names), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
+
+	progressState := newProgressTracker(total, label).withSizes(sizes)
 	processed := 0
 	sent := 0
 	skipped := 0
 	sentBytes := int64(0)
 	for idx, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
 		if idx < rangeStart {
 			continue
 		}
@@ -460,7 +493,7 @@ func sendFilesFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 			progressState.Print(processed, sent, skipped, false)
 			continue
 		}
-		if err := sendSingleFile(client, chatID, topicID, sendType, filepath.Base(name), data, retry); err != nil {
+		if _, err := sendDataOrSplit(ctx, client, chatID, topicID, sendType, fileSource{path: zipPath, inner: name}, data, split, sums, retry); err != nil {
 			log.Printf("send failed: %v", err)
 			processed++
 			skipped++
@@ -474,37 +507,21 @@ func sendFilesFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 		time.Sleep(delay)
 	}
 	progressState.Print(processed, sent, skipped, true)
+	sums.flush(ctx, client, chatID, topicID, retry)
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed %s upload from %s at %s (elapsed %s, avg/file %s, total %s, avg %s, sent %d, skipped %d)",
-			label,
-			filepath.Base(zipPath),
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary(label, filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: label, Source: filepath.Base(zipPath), Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary(label, filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes, 0)
 }
 
-func collectFiles(root string, include []string, exclude []string, enableZip bool, allowedExts []string) []string {
+// collectFiles lists the matching files under root and how many paths could
+// not be read; with walk.Strict an unreadable path is an error.
+func collectFiles(root string, include []string, exclude []string, walk fswalk.Options, enableZip bool, allowedExts []string) ([]string, int, error) {
+	root = absRoot(root)
 	files := []string{}
-	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := fswalk.Walk(root, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 		rel, err := filepath.Rel(root, path)
@@ -530,20 +547,70 @@ func collectFiles(root string, include []string, exclude []string, enableZip boo
 		}
 		return nil
 	})
-	return files
+	unreadable, err := walkProblems(root, walk, err)
+	if err != nil {
+		return nil, unreadable, err
+	}
+	return files, unreadable, nil
+}
+
+// sendPathOrSplit sends the file at path, splitting it into volumes when it
+// is larger than split allows, and returns its size.
+func sendPathOrSplit(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, path string, split splitter.Spec, sums *checksumSet, retry telegram.RetryConfig) (int64, error) {
+	return sendSourceOrSplit(ctx, client, chatID, topicID, sendType, fileSource{path: path}, split, sums, retry)
+}
+
+// sendSourceOrSplit is sendPathOrSplit for a file whose manifest entry
+// names its origin rather than the path it is read from.
+func sendSourceOrSplit(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, source fileSource, split splitter.Spec, sums *checksumSet, retry telegram.RetryConfig) (int64, error) {
+	info, err := os.Stat(source.path)
+	if err != nil {
+		return 0, err
+	}
+	if split.Needed(info.Size()) {
+		file, err := os.Open(source.path)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		return info.Size(), splitter.Send(ctx, client, chatID, topicID, retry, split, source.name(), info.Size(), file)
+	}
+	file := telegram.MediaFile{Path: source.path, Size: info.Size()}
+	if info.Size() < constants.StreamMinBytes {
+		data, err := os.ReadFile(source.path)
+		if err != nil {
+			return 0, err
+		}
+		file = telegram.MediaFile{Data: data}
+	}
+	_, err = sums.sendFile(ctx, client, chatID, topicID, sendType, source, file, retry)
+	return file.Len(), err
+}
+
+// sendDataOrSplit is sendPathOrSplit for data already in memory. The result
+// is empty for split files.
+func sendDataOrSplit(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, source fileSource, data []byte, split splitter.Spec, sums *checksumSet, retry telegram.RetryConfig) (telegram.Result, error) {
+	if split.Needed(int64(len(data))) {
+		return telegram.Result{}, splitter.Send(ctx, client, chatID, topicID, retry, split, source.name(), int64(len(data)), bytes.NewReader(data))
+	}
+	return sums.sendFile(ctx, client, chatID, topicID, sendType, source, telegram.MediaFile{Data: data}, retry)
+}
+
+func sendSingleFile(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, source string, filename string, data []byte, retry telegram.RetryConfig) error {
+	_, err := sendMediaFile(ctx, client, chatID, topicID, sendType, telegram.MediaFile{Filename: filename, Data: data, Source: source}, retry)
+	return err
 }
 
-func sendSingleFile(client *telegram.Client, chatID string, topicID *int, sendType string, filename string, data []byte, retry telegram.RetryConfig) error {
-	file := telegram.MediaFile{Filename: filename, Data: data}
+func sendMediaFile(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, file telegram.MediaFile, retry telegram.RetryConfig) (telegram.Result, error) {
 	switch sendType {
 	case "file":
-		return client.SendDocument(chatID, file, topicID, retry)
+		return client.SendDocument(ctx, chatID, file, topicID, retry)
 	case "video":
-		return client.SendVideo(chatID, file, topicID, retry)
+		return client.SendVideo(ctx, chatID, file, topicID, retry)
 	case "audio":
-		return client.SendAudio(chatID, file, topicID, retry)
+		return client.SendAudio(ctx, chatID, file, topicID, retry)
 	default:
-		return fmt.Errorf("unsupported send type: %s", sendType)
+		return telegram.Result{}, fmt.Errorf("unsupported send type: %s", sendType)
 	}
 }
 
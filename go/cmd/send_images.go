@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,8 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
@@ -23,6 +26,7 @@ func newSendImagesCmd() *cobra.Command {
 	imageDirs := &stringSlice{}
 	zipFiles := &stringSlice{}
 	var groupSize int
+	var groupMaxBytes int64
 	var startIndex int
 	var endIndex int
 	var batchDelay int
@@ -37,6 +41,10 @@ func newSendImagesCmd() *cobra.Command {
 	var pngStartLevel int
 	var queueFile string
 	var queueRetries int
+	var ordering string
+	var priorityName string
+	var collage string
+	var collageOriginals bool
 
 	cmd := &cobra.Command{
 		Use:          "send-images",
@@ -44,14 +52,40 @@ func newSendImagesCmd() *cobra.Command {
 		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			groupSize = checkGroupSize(groupSize)
 			if cfg.chatID == "" {
 				return fmt.Errorf("chat-id is required")
 			}
+			if err := cfg.setupImages(); err != nil {
+				return err
+			}
 			if len(imageDirs.Values()) == 0 && len(zipFiles.Values()) == 0 {
 				return fmt.Errorf("image-dir or zip-file is required")
 			}
 
+			var grid collageGrid
+			if collage != "" {
+				var err error
+				if grid, err = parseCollage(collage); err != nil {
+					return err
+				}
+				if queueFile != "" || len(zipFiles.Values()) > 0 {
+					return fmt.Errorf("--collage works with --image-dir only")
+				}
+			} else if collageOriginals {
+				return fmt.Errorf("--collage-originals needs --collage")
+			}
+
+			notes, err := newRunNotes(cfg)
+			if err != nil {
+				return err
+			}
+			notes.pace = runPace{groupSize: groupSize, batchDelay: time.Duration(batchDelay) * time.Second}
+			if collage != "" {
+				notes.pace.groupSize = grid.cells()
+			}
 			apiURLs, tokens, err := resolveConfig(cfg)
 			if err != nil {
 				return err
@@ -67,10 +101,18 @@ func newSendImagesCmd() *cobra.Command {
 			}
 
 			if queueFile != "" {
+				priority, err := queue.ParsePriority(priorityName)
+				if err != nil {
+					return err
+				}
 				queueRetries, err = validateQueueRetries(queueRetries)
 				if err != nil {
 					return err
 				}
+				ordering, err = sender.ParseOrdering(ordering)
+				if err != nil {
+					return err
+				}
 				resolvedDirs, err := resolveAbsPaths(imageDirs.Values())
 				if err != nil {
 					return err
@@ -82,7 +124,7 @@ func newSendImagesCmd() *cobra.Command {
 				meta := &queue.Meta{
 					Params: queue.MetaParams{
 						Command:       "send-images",
-						ChatID:        cfg.chatID,
+						ChatID:        cfg.queueChatID(),
 						TopicID:       topicPtr(cfg),
 						Dirs:          resolvedDirs,
 						ZipFiles:      resolvedZips,
@@ -101,23 +143,31 @@ func newSendImagesCmd() *cobra.Command {
 						PNGStartLevel: pngStartLevel,
 					},
 				}
-				q, err := queue.New(queueFile, meta)
+				q, err := cfg.openQueue(queueFile, meta)
 				if err != nil {
 					return err
 				}
 				defer q.Close()
+				if err := cfg.attachSentIndex(q, cfg.chatID); err != nil {
+					return err
+				}
 
+				unreadable := 0
 				for _, imageDir := range resolvedDirs {
 					if _, err := os.Stat(imageDir); err != nil {
 						return err
 					}
-					enqueueImagesFromDir(q, imageDir, includes.Values(), excludes.Values(), enableZip, startIndex, endIndex, groupSize, zipPasswords)
+					_, dirUnreadable, err := enqueueImagesFromDir(q, imageDir, includes.Values(), excludes.Values(), cfg.walkOptions(), enableZip, startIndex, endIndex, groupSize, zipPasswords, priority)
+					if err != nil {
+						return err
+					}
+					unreadable += dirUnreadable
 				}
 				for _, zipFile := range resolvedZips {
 					if _, err := os.Stat(zipFile); err != nil {
 						return err
 					}
-					enqueueZipImages(q, zipFile, includes.Values(), excludes.Values(), startIndex, endIndex, groupSize, zipPasswords)
+					enqueueZipImages(q, zipFile, includes.Values(), excludes.Values(), startIndex, endIndex, groupSize, zipPasswords, priority)
 				}
 
 				pending := q.PendingWithAttempts(0, queueRetries)
@@ -128,17 +178,13 @@ func newSendImagesCmd() *cobra.Command {
 
 				startedAt := time.Now()
 				retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf("Starting image upload from queue: %d file(s) at %s", len(pending), formatTimestamp(startedAt)),
-					topicPtr(cfg),
-					retry,
-				)
+				client = notes.startRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: "image", Source: queueFile, Count: len(pending), TotalBytes: sumSizes(itemSizes(pending)), StartedAt: startedAt})
 
-				sent, skipped, sentBytes := drainQueue(client, q, "image", queueSendConfig{
+				sent, skipped, sentBytes := drainQueue(ctx, client, q, "image", queueSendConfig{
 					chatID:          cfg.chatID,
 					topicID:         topicPtr(cfg),
 					groupSize:       groupSize,
+					groupMaxBytes:   groupMaxBytes,
 					batchDelay:      time.Duration(batchDelay) * time.Second,
 					maxDimension:    maxDimension,
 					maxBytes:        maxBytes,
@@ -147,63 +193,61 @@ func newSendImagesCmd() *cobra.Command {
 					zipPasswords:    zipPasswords,
 					logZipPasswords: logZipPasswords,
 					queueRetries:    queueRetries,
+					ordering:        ordering,
+					quarantine:      cfg.quarantine,
+					roots:           resolvedDirs,
 				})
 
 				finishedAt := time.Now()
 				elapsed := finishedAt.Sub(startedAt)
-				avgPer := time.Duration(0)
-				if sent > 0 {
-					avgPer = elapsed / time.Duration(sent)
-				}
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf(
-						"Completed image upload from %s at %s (elapsed %s, avg/image %s, total %s, avg %s, sent %d, skipped %d)",
-						queueFile,
-						formatTimestamp(finishedAt),
-						formatDuration(elapsed),
-						formatDuration(avgPer),
-						formatBytes(sentBytes),
-						formatSpeed(sentBytes, elapsed),
-						sent,
-						skipped,
-					),
-					topicPtr(cfg),
-					retry,
-				)
-				printSummary("image", queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+				notes.finishRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: "image", Source: queueFile, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+				printSummary("image", queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
 				return nil
 			}
 
 			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
 			for _, imageDir := range imageDirs.Values() {
-				sendImagesFromDir(
+				if collage != "" {
+					if err := sendCollagesFromDir(ctx, client, cfg.chatID, topicPtr(cfg), imageDir, grid, collageOriginals, time.Duration(batchDelay)*time.Second, includes.Values(), excludes.Values(), cfg.walkOptions(), maxBytes, notes, retry); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := sendImagesFromDir(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
 					imageDir,
 					groupSize,
+					groupMaxBytes,
 					startIndex,
 					endIndex,
 					time.Duration(batchDelay)*time.Second,
 					includes.Values(),
 					excludes.Values(),
+					cfg.walkOptions(),
 					enableZip,
 					zipPasswords,
 					logZipPasswords,
 					maxDimension,
 					maxBytes,
 					pngStartLevel,
+					notes,
 					retry,
-				)
+				); err != nil {
+					return err
+				}
 			}
 			for _, zipFile := range zipFiles.Values() {
 				sendImagesFromZip(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
 					zipFile,
 					groupSize,
+					groupMaxBytes,
 					startIndex,
 					endIndex,
 					time.Duration(batchDelay)*time.Second,
@@ -214,6 +258,7 @@ func newSendImagesCmd() *cobra.Command {
 					maxDimension,
 					maxBytes,
 					pngStartLevel,
+					notes,
 					retry,
 				)
 			}
@@ -222,10 +267,13 @@ func newSendImagesCmd() *cobra.Command {
 	}
 
 	bindCommonFlags(cmd, cfg)
+	bindRunFlags(cmd, cfg)
+	bindWalkFlags(cmd, cfg)
 	flags := cmd.Flags()
 	flags.Var(imageDirs, "image-dir", "Image directory (repeatable or comma-separated)")
 	flags.Var(zipFiles, "zip-file", "Zip file path (repeatable or comma-separated)")
 	flags.IntVar(&groupSize, "group-size", 4, "Images per media group")
+	flags.Int64Var(&groupMaxBytes, "group-max-bytes", 0, "Close a media group early when its images would exceed this many bytes (0 disables)")
 	flags.IntVar(&startIndex, "start-index", 0, "Start group index (0-based)")
 	flags.IntVar(&endIndex, "end-index", 0, "End group index (0 for no limit)")
 	flags.IntVar(&batchDelay, "batch-delay", 3, "Delay between media groups (seconds)")
@@ -236,52 +284,44 @@ func newSendImagesCmd() *cobra.Command {
 	flags.StringVar(&zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
 	flags.BoolVar(&logZipPasswords, "zip-pass-log", false, "Log zip passwords while checking (use with care)")
 	flags.IntVar(&maxDimension, "max-dimension", 2000, "Max image dimension (0 to disable resize)")
+	bindResizeBackendFlag(cmd, cfg)
 	flags.IntVar(&maxBytes, "max-bytes", 5*1024*1024, "Max image size in bytes (0 to disable size limit)")
 	flags.IntVar(&pngStartLevel, "png-start-level", 8, "PNG compression start level (0-9)")
 	flags.StringVar(&queueFile, "queue-file", "", "Path to JSONL queue file (enables resume mode)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.StringVar(&priorityName, "priority", "normal", "Priority of enqueued items with --queue-file: low, normal or high")
 	flags.IntVar(&queueRetries, "queue-retries", 3, "Maximum queue retry attempts per item")
+	flags.StringVar(&collage, "collage", "", "Send contact sheets of COLSxROWS images (e.g. 4x3) instead of albums (--image-dir only)")
+	flags.BoolVar(&collageOriginals, "collage-originals", false, "With --collage, send each sheet's images as documents after it")
+	flags.StringVar(&ordering, "ordering", sender.OrderingRelaxed, "Queue mode media group order: strict (retry a failed group before sending later ones) or relaxed")
 	return cmd
 }
 
-func sendImagesFromDir(client *telegram.Client, chatID string, topicID *int, dir string, groupSize int, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, retry telegram.RetryConfig) {
-	files := []string{}
-	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
-		}
-		rel, err := filepath.Rel(dir, path)
-		if err != nil {
-			return nil
-		}
-		rel = filepath.ToSlash(rel)
-		if !matchesInclude(rel, include) {
-			return nil
-		}
-		if matchesExclude(rel, exclude) {
-			return nil
-		}
-		nameLower := strings.ToLower(path)
-		if isImage(nameLower) {
-			files = append(files, path)
-		} else if enableZip && strings.HasSuffix(nameLower, ".zip") {
-			files = append(files, path)
-		}
-		return nil
-	})
+func sendImagesFromDir(ctx context.Context, client *telegram.Client, chatID string, topicID *int, dir string, groupSize int, groupMaxBytes int64, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, walk fswalk.Options, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, notes *runNotes, retry telegram.RetryConfig) error {
+	dir = absRoot(dir)
+	client = client.PinFolder(dir)
+	files, unreadable, err := collectImages(dir, include, exclude, walk, enableZip)
+	if err != nil {
+		return err
+	}
 
 	if len(files) == 0 {
 		log.Printf("no images found in %s", dir)
-		return
+		return nil
 	}
 
-	startedAt := time.Now()
-	_ = client.SendMessage(chatID, fmt.Sprintf("Starting image upload: %d file(s) at %s", len(files), formatTimestamp(startedAt)), topicID, retry)
-
 	minIndex := startIndex * groupSize
 	maxIndex := endIndex * groupSize
 	rangeStart, rangeEnd := clampRange(minIndex, maxIndex, len(files))
 	total := rangeEnd - rangeStart
-	progressState := newProgressTracker(total, "image")
+	sizes := pathSizes(files[rangeStart:rangeEnd])
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: dir, Count: len(files), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
+
+	progressState := newProgressTracker(total, "image").withSizes(sizes)
 
 	media := []telegram.MediaFile{}
 	batchBytes := int64(0)
@@ -289,7 +329,32 @@ func sendImagesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 	sent := 0
 	skipped := 0
 	sentBytes := int64(0)
+
+	flushImages := func() {
+		if len(media) == 0 {
+			return
+		}
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
+		}
+		processed += len(media)
+		progressState.Print(processed, sent, skipped, false)
+		media = media[:0]
+		batchBytes = 0
+		time.Sleep(delay)
+	}
+
 	for idx, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
 		if idx < rangeStart {
 			continue
 		}
@@ -297,7 +362,7 @@ func sendImagesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 			break
 		}
 		if strings.HasSuffix(strings.ToLower(path), ".zip") {
-			sendImagesFromZip(client, chatID, topicID, path, groupSize, 0, 0, delay, include, exclude, zipPasswords, logZipPasswords, maxDimension, maxBytes, pngStartLevel, retry)
+			sendImagesFromZip(ctx, client, chatID, topicID, path, groupSize, groupMaxBytes, 0, 0, delay, include, exclude, zipPasswords, logZipPasswords, maxDimension, maxBytes, pngStartLevel, notes, retry)
 			processed++
 			progressState.Print(processed, sent, skipped, false)
 			continue
@@ -317,31 +382,28 @@ func sendImagesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 			progressState.Print(processed, sent, skipped, false)
 			continue
 		}
+		prepared.Source = path
+		prepared = client.WithOriginal(prepared, data, filepath.Base(path))
+		if exceedsGroupBytes(media, batchBytes, prepared, groupMaxBytes) {
+			flushImages()
+		}
 		media = append(media, prepared)
 		batchBytes += int64(len(prepared.Data))
 		if len(media) >= groupSize {
-			if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-				log.Printf("send media group failed: %v", err)
-				skipped += len(media)
-			} else {
-				sent += len(media)
-				sentBytes += batchBytes
-			}
-			processed += len(media)
-			progressState.Print(processed, sent, skipped, false)
-			media = media[:0]
-			batchBytes = 0
-			time.Sleep(delay)
+			flushImages()
 		}
 	}
 
 	if len(media) > 0 {
-		if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-			log.Printf("send media group failed: %v", err)
-			skipped += len(media)
-		} else {
-			sent += len(media)
-			sentBytes += batchBytes
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
 		}
 		processed += len(media)
 	}
@@ -349,30 +411,44 @@ func sendImagesFromDir(client *telegram.Client, chatID string, topicID *int, dir
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed image upload from %s at %s (elapsed %s, avg/image %s, total %s, avg %s, sent %d, skipped %d)",
-			dir,
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary("image", dir, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: dir, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("image", dir, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
+	return nil
+}
+
+// collectImages lists the images under dir, and zip files when enableZip is
+// set, along with the number of paths the walk could not read.
+func collectImages(dir string, include []string, exclude []string, walk fswalk.Options, enableZip bool) ([]string, int, error) {
+	files := []string{}
+	err := fswalk.Walk(dir, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchesInclude(rel, include) {
+			return nil
+		}
+		if matchesExclude(rel, exclude) {
+			return nil
+		}
+		nameLower := strings.ToLower(path)
+		if isImage(nameLower) {
+			files = append(files, path)
+		} else if enableZip && strings.HasSuffix(nameLower, ".zip") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	unreadable, err := walkProblems(dir, walk, err)
+	return files, unreadable, err
 }
 
-func sendImagesFromZip(client *telegram.Client, chatID string, topicID *int, zipPath string, groupSize int, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, retry telegram.RetryConfig) {
+func sendImagesFromZip(ctx context.Context, client *telegram.Client, chatID string, topicID *int, zipPath string, groupSize int, groupMaxBytes int64, startIndex int, endIndex int, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, notes *runNotes, retry telegram.RetryConfig) {
+	client = client.PinFolder(zipPath)
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -405,24 +481,15 @@ func sendImagesFromZip(client *telegram.Client, chatID string, topicID *int, zip
 
 	zipOpts := ziputil.ReadOptions{LogPasswords: logZipPasswords}
 
-	startedAt := time.Now()
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Starting image upload from %s: %d file(s) at %s",
-			filepath.Base(zipPath),
-			len(names),
-			formatTimestamp(startedAt),
-		),
-		topicID,
-		retry,
-	)
-
 	minIndex := startIndex * groupSize
 	maxIndex := endIndex * groupSize
 	rangeStart, rangeEnd := clampRange(minIndex, maxIndex, len(names))
 	total := rangeEnd - rangeStart
-	progressState := newProgressTracker(total, "image")
+	sizes := zipSizes(filesByName, names[rangeStart:rangeEnd])
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: filepath.Base(zipPath), Count: len(names), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
+
+	progressState := newProgressTracker(total, "image").withSizes(sizes)
 	media := []telegram.MediaFile{}
 	batchBytes := int64(0)
 	processed := 0
@@ -432,7 +499,31 @@ func sendImagesFromZip(client *telegram.Client, chatID string, topicID *int, zip
 	readErrors := 0
 	var lastReadErr error
 
+	flushImages := func() {
+		if len(media) == 0 {
+			return
+		}
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
+		}
+		processed += len(media)
+		progressState.Print(processed, sent, skipped, false)
+		media = media[:0]
+		batchBytes = 0
+		time.Sleep(delay)
+	}
+
 	for idx, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
 		if idx < rangeStart {
 			continue
 		}
@@ -463,31 +554,28 @@ func sendImagesFromZip(client *telegram.Client, chatID string, topicID *int, zip
 			progressState.Print(processed, sent, skipped, false)
 			continue
 		}
+		prepared.Source = zipPath
+		prepared = client.WithOriginal(prepared, data, filepath.Base(name))
+		if exceedsGroupBytes(media, batchBytes, prepared, groupMaxBytes) {
+			flushImages()
+		}
 		media = append(media, prepared)
 		batchBytes += int64(len(prepared.Data))
 		if len(media) >= groupSize {
-			if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-				log.Printf("send media group failed: %v", err)
-				skipped += len(media)
-			} else {
-				sent += len(media)
-				sentBytes += batchBytes
-			}
-			processed += len(media)
-			progressState.Print(processed, sent, skipped, false)
-			media = media[:0]
-			batchBytes = 0
-			time.Sleep(delay)
+			flushImages()
 		}
 	}
 
 	if len(media) > 0 {
-		if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-			log.Printf("send media group failed: %v", err)
-			skipped += len(media)
-		} else {
-			sent += len(media)
-			sentBytes += batchBytes
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
 		}
 		processed += len(media)
 	}
@@ -498,27 +586,8 @@ func sendImagesFromZip(client *telegram.Client, chatID string, topicID *int, zip
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed image upload from %s at %s (elapsed %s, avg/image %s, total %s, avg %s, sent %d, skipped %d)",
-			filepath.Base(zipPath),
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary("image", filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "image", Source: filepath.Base(zipPath), Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("image", filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes, 0)
 }
 
 func matchesExclude(rel string, patterns []string) bool {
@@ -563,7 +632,7 @@ func isImage(name string) bool {
 }
 
 func prepareImageMedia(data []byte, filename string, maxDimension int, maxBytes int, pngStartLevel int) (telegram.MediaFile, error) {
-	if maxDimension <= 0 && maxBytes <= 0 {
+	if maxDimension <= 0 && maxBytes <= 0 && !imageutil.WatermarkEnabled() {
 		return telegram.MediaFile{Filename: filename, Data: data}, nil
 	}
 	if maxBytes <= 0 {
@@ -573,21 +642,38 @@ func prepareImageMedia(data []byte, filename string, maxDimension int, maxBytes
 	if err != nil {
 		return telegram.MediaFile{}, err
 	}
-	return telegram.MediaFile{Filename: result.Filename, Data: result.Data}, nil
+	media := telegram.MediaFile{Filename: result.Filename, Data: result.Data}
+	if result.Document {
+		log.Printf("%s: %s, sending the original as a document", filename, result.Reason)
+		media.Type = telegram.MediaDocument
+	}
+	return media, nil
+}
+
+// exceedsGroupBytes reports whether adding next to a non-empty media group
+// would push it past maxBytes (0 disables the budget).
+func exceedsGroupBytes(media []telegram.MediaFile, batchBytes int64, next telegram.MediaFile, maxBytes int64) bool {
+	return maxBytes > 0 && len(media) > 0 && batchBytes+int64(len(next.Data)) > maxBytes
 }
 
 func maxInt() int {
 	return int(^uint(0) >> 1)
 }
 
-func printSummary(kind string, source string, startedAt time.Time, finishedAt time.Time, elapsed time.Duration, sent int, skipped int, bytes int64) {
+// printSummary prints the run summary line; unreadable counts the source
+// paths a directory walk could not read and is only shown when non-zero.
+func printSummary(kind string, source string, startedAt time.Time, finishedAt time.Time, elapsed time.Duration, sent int, skipped int, bytes int64, unreadable int) {
 	avgPer := time.Duration(0)
 	if sent > 0 {
 		avgPer = elapsed / time.Duration(sent)
 	}
+	suffix := ""
+	if unreadable > 0 {
+		suffix = fmt.Sprintf(" unreadable=%d", unreadable)
+	}
 	fmt.Fprintf(
 		os.Stdout,
-		"Summary %s from %s: start=%s end=%s elapsed=%s avg=%s total=%s speed=%s sent=%d skipped=%d\n",
+		"Summary %s from %s: start=%s end=%s elapsed=%s avg=%s total=%s speed=%s sent=%d skipped=%d%s\n",
 		kind,
 		source,
 		formatTimestamp(startedAt),
@@ -598,5 +684,6 @@ func printSummary(kind string, source string, startedAt time.Time, finishedAt ti
 		formatSpeed(bytes, elapsed),
 		sent,
 		skipped,
+		suffix,
 	)
 }
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+func newSendLocationCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	var latitude float64
+	var longitude float64
+	var livePeriod int
+
+	cmd := &cobra.Command{
+		Use:          "send-location",
+		Short:        "Send a map location",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			if cfg.chatID == "" || !cmd.Flags().Changed("latitude") || !cmd.Flags().Changed("longitude") {
+				return fmt.Errorf("chat-id, latitude and longitude are required")
+			}
+			if livePeriod != 0 && (livePeriod < 60 || livePeriod > 86400) {
+				return fmt.Errorf("live-period must be between 60 and 86400 seconds")
+			}
+
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+			location := telegram.Location{Latitude: latitude, Longitude: longitude, LivePeriod: livePeriod}
+			_, err = client.SendLocation(ctx, cfg.chatID, location, topicPtr(cfg), retry)
+			return err
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.Float64Var(&latitude, "latitude", 0, "Latitude in degrees (-90 to 90)")
+	flags.Float64Var(&longitude, "longitude", 0, "Longitude in degrees (-180 to 180)")
+	flags.IntVar(&livePeriod, "live-period", 0, "Send a live location that stays updatable for this many seconds (60-86400)")
+	return cmd
+}
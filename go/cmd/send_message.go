@@ -1,27 +1,49 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/spf13/cobra"
 )
 
+// messageChatFields are the placeholders that need a getChat lookup.
+var messageChatFields = []string{"{chat_id}", "{chat_title}", "{chat_username}"}
+
 func newSendMessageCmd() *cobra.Command {
 	cfg := &commonFlags{}
+	chats := &stringSlice{}
 	var message string
+	var buttonsJSON string
 
 	cmd := &cobra.Command{
-		Use:          "send-message",
-		Short:        "Send a text message",
+		Use:   "send-message",
+		Short: "Send a text message",
+		Long: "send-message posts --message to every --chat-id. In the message, {chat} is replaced by the chat as\n" +
+			"given, and {chat_id}, {chat_title} and {chat_username} by the chat's numeric ID, title and username\n" +
+			"from getChat. A chat that fails does not stop the others; with several chats a report of each\n" +
+			"delivery is printed at the end.",
 		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
-			if cfg.chatID == "" || message == "" {
+			if len(chats.Values()) == 0 || message == "" {
 				return fmt.Errorf("chat-id and message are required")
 			}
+			var buttons telegram.InlineKeyboard
+			if buttonsJSON != "" {
+				var err error
+				if buttons, err = telegram.ParseInlineKeyboard(buttonsJSON); err != nil {
+					return err
+				}
+			}
 
 			apiURLs, tokens, err := resolveConfig(cfg)
 			if err != nil {
@@ -31,13 +53,106 @@ func newSendMessageCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if cfg.verifyTarget {
+				problems := []string{}
+				for _, chat := range chats.Values() {
+					chatID, err := resolveChatID(ctx, client, chat)
+					if err == nil {
+						err = client.VerifyTarget(ctx, chatID, topicPtr(cfg))
+					}
+					if err != nil {
+						problems = append(problems, fmt.Sprintf("%s: %v", chat, err))
+					}
+				}
+				if len(problems) > 0 {
+					return fmt.Errorf("target verification failed:\n%s", strings.Join(problems, "\n"))
+				}
+				log.Printf("verified %d target chat(s)", len(chats.Values()))
+			}
 
 			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
-			return client.SendMessage(cfg.chatID, message, topicPtr(cfg), retry)
+			if len(chats.Values()) == 1 {
+				chatID, err := resolveChatID(ctx, client, chats.Values()[0])
+				if err != nil {
+					return err
+				}
+				text, err := renderMessage(client, message, chats.Values()[0], chatID)
+				if err != nil {
+					return err
+				}
+				_, err = client.SendMessageButtons(ctx, chatID, text, buttons, topicPtr(cfg), retry)
+				return err
+			}
+			return broadcastMessage(ctx, cmd, client, chats.Values(), message, buttons, topicPtr(cfg), retry)
 		},
 	}
 
-	bindCommonFlags(cmd, cfg)
-	cmd.Flags().StringVar(&message, "message", "", "Message text to send")
+	bindConnectionFlags(cmd, cfg)
+	cmd.Flags().Var(chats, "chat-id", "Target chat ID (channel/group/user); repeatable or comma-separated to send to several chats")
+	bindSendOptionFlags(cmd, cfg)
+	cmd.Flags().StringVar(&message, "message", "", "Message text to send; {chat}, {chat_id}, {chat_title} and {chat_username} are filled in per chat")
+	cmd.Flags().StringVar(&buttonsJSON, "buttons", "", `Buttons under the message, as JSON rows: [[{"text":"Open","url":"https://..."}]]`)
 	return cmd
 }
+
+// broadcastMessage sends message to each chat in turn and prints which
+// ones got it. It fails when any chat did not.
+func broadcastMessage(ctx context.Context, cmd *cobra.Command, client *telegram.Client, chats []string, message string, buttons telegram.InlineKeyboard, topicID *int, retry telegram.RetryConfig) error {
+	out := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "CHAT\tSTATUS\tDETAIL")
+	failed := 0
+	for _, chat := range chats {
+		if ctx.Err() != nil {
+			failed++
+			fmt.Fprintf(out, "%s\tskipped\t%v\n", chat, ctx.Err())
+			continue
+		}
+		messageID := 0
+		chatID, err := resolveChatID(ctx, client, chat)
+		text := ""
+		if err == nil {
+			text, err = renderMessage(client, message, chat, chatID)
+		}
+		if err == nil {
+			messageID, err = client.SendMessageButtons(ctx, chatID, text, buttons, topicID, retry)
+		}
+		if err != nil {
+			failed++
+			log.Printf("send to %s failed: %v", chat, err)
+			fmt.Fprintf(out, "%s\tfailed\t%v\n", chat, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s\tsent\tmessage %d\n", chat, messageID)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%d of %d chat(s) sent\n", len(chats)-failed, len(chats))
+	if failed > 0 {
+		return fmt.Errorf("%d chat(s) could not be sent to", failed)
+	}
+	return nil
+}
+
+// renderMessage fills the chat placeholders of message for chat, given as
+// chat and resolved to chatID, looking it up only when a placeholder needs
+// it.
+func renderMessage(client *telegram.Client, message string, chat string, chatID string) (string, error) {
+	pairs := []string{"{chat}", chat}
+	for _, field := range messageChatFields {
+		if !strings.Contains(message, field) {
+			continue
+		}
+		info, err := client.GetChat(chatID)
+		if err != nil {
+			return "", fmt.Errorf("look up chat %s: %w", chat, err)
+		}
+		username := ""
+		if info.Username != "" {
+			username = "@" + info.Username
+		}
+		pairs = append(pairs, "{chat_id}", strconv.FormatInt(info.ID, 10), "{chat_title}", info.DisplayName(), "{chat_username}", username)
+		break
+	}
+	return strings.NewReplacer(pairs...).Replace(message), nil
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -9,7 +10,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
@@ -21,6 +24,8 @@ type mixedSelection struct {
 	withVideo bool
 	withAudio bool
 	withFile  bool
+	// albumVideos batches small videos into albums with images.
+	albumVideos bool
 }
 
 func resolveMixedSelection(withImage bool, withVideo bool, withAudio bool, withFile bool) mixedSelection {
@@ -57,12 +62,39 @@ func mixedSendType(name string, sel mixedSelection) string {
 	return ""
 }
 
+// addPathArgs sorts positional paths, as a file manager's "Send to
+// Telegram" entry passes them, into files, directories and zips.
+func addPathArgs(args []string, enableZip bool, files *stringSlice, dirs *stringSlice, zips *stringSlice) error {
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			dirs.values = append(dirs.values, arg)
+		case enableZip && strings.EqualFold(filepath.Ext(arg), ".zip"):
+			zips.values = append(zips.values, arg)
+		default:
+			files.values = append(files.values, arg)
+		}
+	}
+	return nil
+}
+
+// albumVideo reports whether a video is small enough to join a mixed album.
+func albumVideo(sel mixedSelection, sendType string, size int64) bool {
+	return sel.albumVideos && sendType == "video" && size <= constants.AlbumVideoMaxBytes
+}
+
 func newSendMixedCmd() *cobra.Command {
 	cfg := &commonFlags{}
 	filePaths := &stringSlice{}
 	dirPaths := &stringSlice{}
 	zipPaths := &stringSlice{}
 	var groupSize int
+	var groupMaxBytes int64
+	var albumVideos bool
 	var batchDelay int
 	var enableZip bool
 	includes := &stringSlice{}
@@ -79,21 +111,36 @@ func newSendMixedCmd() *cobra.Command {
 	var withFile bool
 	var queueFile string
 	var queueRetries int
+	var ordering string
+	var priorityName string
 
 	cmd := &cobra.Command{
-		Use:          "send-mixed",
+		Use:          "send-mixed [PATH...]",
 		Short:        "Send mixed media from files, directories, or zips",
-		Args:         cobra.NoArgs,
+		Long:         "send-mixed sends the given files, directories and zips. Paths passed as arguments are sorted into\n--dir, --file and, with --enable-zip, --zip-file by what they are.",
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
 			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			groupSize = checkGroupSize(groupSize)
 			if cfg.chatID == "" {
 				return fmt.Errorf("chat-id is required")
 			}
+			if err := addPathArgs(args, enableZip, filePaths, dirPaths, zipPaths); err != nil {
+				return err
+			}
+			if err := cfg.setupImages(); err != nil {
+				return err
+			}
 			if len(filePaths.Values()) == 0 && len(dirPaths.Values()) == 0 && len(zipPaths.Values()) == 0 {
 				return fmt.Errorf("file, dir, or zip-file is required")
 			}
 
+			notes, err := newRunNotes(cfg)
+			if err != nil {
+				return err
+			}
+			notes.pace = runPace{groupSize: groupSize, batchDelay: time.Duration(batchDelay) * time.Second}
 			apiURLs, tokens, err := resolveConfig(cfg)
 			if err != nil {
 				return err
@@ -108,13 +155,22 @@ func newSendMixedCmd() *cobra.Command {
 				return err
 			}
 			selection := resolveMixedSelection(withImage, withVideo, withAudio, withFile)
+			selection.albumVideos = albumVideos
 			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
 
 			if queueFile != "" {
+				priority, err := queue.ParsePriority(priorityName)
+				if err != nil {
+					return err
+				}
 				queueRetries, err = validateQueueRetries(queueRetries)
 				if err != nil {
 					return err
 				}
+				ordering, err = sender.ParseOrdering(ordering)
+				if err != nil {
+					return err
+				}
 				resolvedFiles, err := resolveAbsPaths(filePaths.Values())
 				if err != nil {
 					return err
@@ -130,7 +186,7 @@ func newSendMixedCmd() *cobra.Command {
 				meta := &queue.Meta{
 					Params: queue.MetaParams{
 						Command:       "send-mixed",
-						ChatID:        cfg.chatID,
+						ChatID:        cfg.queueChatID(),
 						TopicID:       topicPtr(cfg),
 						Files:         resolvedFiles,
 						Dirs:          resolvedDirs,
@@ -152,32 +208,40 @@ func newSendMixedCmd() *cobra.Command {
 						PNGStartLevel: pngStartLevel,
 					},
 				}
-				q, err := queue.New(queueFile, meta)
+				q, err := cfg.openQueue(queueFile, meta)
 				if err != nil {
 					return err
 				}
 				defer q.Close()
+				if err := cfg.attachSentIndex(q, cfg.chatID); err != nil {
+					return err
+				}
 
+				unreadable := 0
 				if len(resolvedFiles) > 0 {
 					for _, filePath := range resolvedFiles {
 						if _, err := os.Stat(filePath); err != nil {
 							return err
 						}
 					}
-					enqueueMixedFromPaths(q, resolvedFiles, selection, includes.Values(), excludes.Values(), true, enableZip, zipPasswords)
+					enqueueMixedFromPaths(q, resolvedFiles, selection, includes.Values(), excludes.Values(), true, enableZip, zipPasswords, priority)
 				}
 				for _, dirPath := range resolvedDirs {
 					if _, err := os.Stat(dirPath); err != nil {
 						return err
 					}
-					files := collectSourceFiles(dirPath, includes.Values(), excludes.Values())
-					enqueueMixedFromPaths(q, files, selection, includes.Values(), excludes.Values(), false, enableZip, zipPasswords)
+					files, dirUnreadable, err := collectSourceFiles(dirPath, includes.Values(), excludes.Values(), cfg.walkOptions())
+					if err != nil {
+						return err
+					}
+					unreadable += dirUnreadable
+					enqueueMixedFromPaths(q, files, selection, includes.Values(), excludes.Values(), false, enableZip, zipPasswords, priority)
 				}
 				for _, zipPath := range resolvedZips {
 					if _, err := os.Stat(zipPath); err != nil {
 						return err
 					}
-					enqueueZipMixed(q, zipPath, selection, includes.Values(), excludes.Values(), zipPasswords)
+					enqueueZipMixed(q, zipPath, selection, includes.Values(), excludes.Values(), zipPasswords, priority)
 				}
 
 				pending := q.PendingWithAttempts(0, queueRetries)
@@ -187,17 +251,14 @@ func newSendMixedCmd() *cobra.Command {
 				}
 
 				startedAt := time.Now()
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf("Starting mixed upload from queue: %d file(s) at %s", len(pending), formatTimestamp(startedAt)),
-					topicPtr(cfg),
-					retry,
-				)
+				client = notes.startRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: "mixed", Source: queueFile, Count: len(pending), TotalBytes: sumSizes(itemSizes(pending)), StartedAt: startedAt})
 
-				sent, skipped, sentBytes := drainQueue(client, q, "mixed", queueSendConfig{
+				sent, skipped, sentBytes := drainQueue(ctx, client, q, "mixed", queueSendConfig{
 					chatID:          cfg.chatID,
 					topicID:         topicPtr(cfg),
 					groupSize:       groupSize,
+					groupMaxBytes:   groupMaxBytes,
+					albumVideos:     albumVideos,
 					batchDelay:      time.Duration(batchDelay) * time.Second,
 					maxDimension:    maxDimension,
 					maxBytes:        maxBytes,
@@ -206,36 +267,21 @@ func newSendMixedCmd() *cobra.Command {
 					zipPasswords:    zipPasswords,
 					logZipPasswords: logZipPasswords,
 					queueRetries:    queueRetries,
+					ordering:        ordering,
+					quarantine:      cfg.quarantine,
+					roots:           resolvedDirs,
 				})
 
 				finishedAt := time.Now()
 				elapsed := finishedAt.Sub(startedAt)
-				avgPer := time.Duration(0)
-				if sent > 0 {
-					avgPer = elapsed / time.Duration(sent)
-				}
-				_ = client.SendMessage(
-					cfg.chatID,
-					fmt.Sprintf(
-						"Completed mixed upload from %s at %s (elapsed %s, avg/item %s, total %s, avg %s, sent %d, skipped %d)",
-						queueFile,
-						formatTimestamp(finishedAt),
-						formatDuration(elapsed),
-						formatDuration(avgPer),
-						formatBytes(sentBytes),
-						formatSpeed(sentBytes, elapsed),
-						sent,
-						skipped,
-					),
-					topicPtr(cfg),
-					retry,
-				)
-				printSummary("mixed", queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+				notes.finishRun(ctx, client, cfg.chatID, topicPtr(cfg), retry, runReport{Kind: "mixed", Source: queueFile, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+				printSummary("mixed", queueFile, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
 				return nil
 			}
 
 			if len(filePaths.Values()) > 0 {
 				sendMixedFromPaths(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
@@ -243,6 +289,7 @@ func newSendMixedCmd() *cobra.Command {
 					filePaths.Values(),
 					selection,
 					groupSize,
+					groupMaxBytes,
 					time.Duration(batchDelay)*time.Second,
 					includes.Values(),
 					excludes.Values(),
@@ -253,37 +300,47 @@ func newSendMixedCmd() *cobra.Command {
 					maxDimension,
 					maxBytes,
 					pngStartLevel,
+					0,
+					notes,
 					retry,
 				)
 			}
 			for _, dirPath := range dirPaths.Values() {
-				sendMixedFromDir(
+				if err := sendMixedFromDir(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
 					dirPath,
 					selection,
 					groupSize,
+					groupMaxBytes,
 					time.Duration(batchDelay)*time.Second,
 					includes.Values(),
 					excludes.Values(),
+					cfg.walkOptions(),
 					enableZip,
 					zipPasswords,
 					logZipPasswords,
 					maxDimension,
 					maxBytes,
 					pngStartLevel,
+					notes,
 					retry,
-				)
+				); err != nil {
+					return err
+				}
 			}
 			for _, zipPath := range zipPaths.Values() {
 				sendMixedFromZip(
+					ctx,
 					client,
 					cfg.chatID,
 					topicPtr(cfg),
 					zipPath,
 					selection,
 					groupSize,
+					groupMaxBytes,
 					time.Duration(batchDelay)*time.Second,
 					includes.Values(),
 					excludes.Values(),
@@ -292,6 +349,7 @@ func newSendMixedCmd() *cobra.Command {
 					maxDimension,
 					maxBytes,
 					pngStartLevel,
+					notes,
 					retry,
 				)
 			}
@@ -300,11 +358,15 @@ func newSendMixedCmd() *cobra.Command {
 	}
 
 	bindCommonFlags(cmd, cfg)
+	bindRunFlags(cmd, cfg)
+	bindWalkFlags(cmd, cfg)
 	flags := cmd.Flags()
 	flags.Var(filePaths, "file", "File path (repeatable or comma-separated)")
 	flags.Var(dirPaths, "dir", "Directory path (repeatable or comma-separated)")
 	flags.Var(zipPaths, "zip-file", "Zip file path (repeatable or comma-separated)")
 	flags.IntVar(&groupSize, "group-size", 4, "Images per media group")
+	flags.Int64Var(&groupMaxBytes, "group-max-bytes", 0, "Close a media group early when its images would exceed this many bytes (0 disables)")
+	flags.BoolVar(&albumVideos, "album-videos", false, "Batch videos up to 20 MB into albums with images instead of sending them alone")
 	flags.IntVar(&batchDelay, "batch-delay", 3, "Delay between sends (seconds)")
 	flags.BoolVar(&enableZip, "enable-zip", false, "Process zip files when scanning directories")
 	flags.Var(includes, "include", "Glob patterns to include (repeatable or comma-separated)")
@@ -313,6 +375,7 @@ func newSendMixedCmd() *cobra.Command {
 	flags.StringVar(&zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
 	flags.BoolVar(&logZipPasswords, "zip-pass-log", false, "Log zip passwords while checking (use with care)")
 	flags.IntVar(&maxDimension, "max-dimension", 2000, "Max image dimension (0 to disable resize)")
+	bindResizeBackendFlag(cmd, cfg)
 	flags.IntVar(&maxBytes, "max-bytes", 5*1024*1024, "Max image size in bytes (0 to disable size limit)")
 	flags.IntVar(&pngStartLevel, "png-start-level", 8, "PNG compression start level (0-9)")
 	flags.BoolVar(&withImage, "with-image", false, "Send matching images (media groups)")
@@ -320,7 +383,13 @@ func newSendMixedCmd() *cobra.Command {
 	flags.BoolVar(&withAudio, "with-audio", false, "Send matching audio files")
 	flags.BoolVar(&withFile, "with-file", false, "Send other files as documents")
 	flags.StringVar(&queueFile, "queue-file", "", "Path to JSONL queue file (enables resume mode)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.StringVar(&priorityName, "priority", "normal", "Priority of enqueued items with --queue-file: low, normal or high")
 	flags.IntVar(&queueRetries, "queue-retries", 3, "Maximum queue retry attempts per item")
+	flags.StringVar(&ordering, "ordering", sender.OrderingRelaxed, "Queue mode media group order: strict (retry a failed group before sending later ones) or relaxed")
 	return cmd
 }
 
@@ -330,10 +399,12 @@ type mixedEntry struct {
 	sendTyp string
 }
 
-func sendMixedFromDir(client *telegram.Client, chatID string, topicID *int, dir string, sel mixedSelection, groupSize int, delay time.Duration, include []string, exclude []string, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, retry telegram.RetryConfig) {
+func sendMixedFromDir(ctx context.Context, client *telegram.Client, chatID string, topicID *int, dir string, sel mixedSelection, groupSize int, groupMaxBytes int64, delay time.Duration, include []string, exclude []string, walk fswalk.Options, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, notes *runNotes, retry telegram.RetryConfig) error {
+	dir = absRoot(dir)
+	client = client.PinFolder(dir)
 	files := []string{}
-	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := fswalk.Walk(dir, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 		rel, err := filepath.Rel(dir, path)
@@ -350,11 +421,16 @@ func sendMixedFromDir(client *telegram.Client, chatID string, topicID *int, dir
 		files = append(files, path)
 		return nil
 	})
+	unreadable, err := walkProblems(dir, walk, err)
+	if err != nil {
+		return err
+	}
 	if len(files) == 0 {
 		log.Printf("no matching files found in %s", dir)
-		return
+		return nil
 	}
 	sendMixedFromPaths(
+		ctx,
 		client,
 		chatID,
 		topicID,
@@ -362,6 +438,7 @@ func sendMixedFromDir(client *telegram.Client, chatID string, topicID *int, dir
 		files,
 		sel,
 		groupSize,
+		groupMaxBytes,
 		delay,
 		include,
 		exclude,
@@ -372,11 +449,14 @@ func sendMixedFromDir(client *telegram.Client, chatID string, topicID *int, dir
 		maxDimension,
 		maxBytes,
 		pngStartLevel,
+		unreadable,
+		notes,
 		retry,
 	)
+	return nil
 }
 
-func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, sourceLabel string, paths []string, sel mixedSelection, groupSize int, delay time.Duration, include []string, exclude []string, applyFilters bool, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, retry telegram.RetryConfig) {
+func sendMixedFromPaths(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sourceLabel string, paths []string, sel mixedSelection, groupSize int, groupMaxBytes int64, delay time.Duration, include []string, exclude []string, applyFilters bool, enableZip bool, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, unreadable int, notes *runNotes, retry telegram.RetryConfig) {
 	entries := []mixedEntry{}
 	for _, path := range paths {
 		rel := filepath.Base(path)
@@ -401,15 +481,15 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 		return
 	}
 
+	entryPaths := make([]string, len(entries))
+	for i, entry := range entries {
+		entryPaths[i] = entry.path
+	}
+	sizes := pathSizes(entryPaths)
 	startedAt := time.Now()
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf("Starting mixed upload from %s: %d file(s) at %s", sourceLabel, len(entries), formatTimestamp(startedAt)),
-		topicID,
-		retry,
-	)
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "mixed", Source: sourceLabel, Count: len(entries), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
 
-	progressState := newProgressTracker(len(entries), "mixed")
+	progressState := newProgressTracker(len(entries), "mixed").withSizes(sizes)
 	media := []telegram.MediaFile{}
 	batchBytes := int64(0)
 	processed := 0
@@ -422,12 +502,15 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 			return
 		}
 		batchCount := len(media)
-		if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-			log.Printf("send media group failed: %v", err)
-			skipped += len(media)
-		} else {
-			sent += len(media)
-			sentBytes += batchBytes
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
 		}
 		processed += batchCount
 		progressState.Print(processed, sent, skipped, false)
@@ -436,16 +519,32 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 		time.Sleep(delay)
 	}
 
+	addToGroup := func(file telegram.MediaFile) {
+		if exceedsGroupBytes(media, batchBytes, file, groupMaxBytes) {
+			flushImages()
+		}
+		media = append(media, file)
+		batchBytes += int64(len(file.Data))
+		if len(media) >= groupSize {
+			flushImages()
+		}
+	}
+
 	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
 		if entry.isZip {
 			flushImages()
 			sendMixedFromZip(
+				ctx,
 				client,
 				chatID,
 				topicID,
 				entry.path,
 				sel,
 				groupSize,
+				groupMaxBytes,
 				delay,
 				include,
 				exclude,
@@ -454,6 +553,7 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 				maxDimension,
 				maxBytes,
 				pngStartLevel,
+				notes,
 				retry,
 			)
 			processed++
@@ -477,16 +577,17 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 				progressState.Print(processed, sent, skipped, false)
 				continue
 			}
-			media = append(media, prepared)
-			batchBytes += int64(len(prepared.Data))
-			if len(media) >= groupSize {
-				flushImages()
-			}
+			prepared.Source = entry.path
+			addToGroup(client.WithOriginal(prepared, data, filepath.Base(entry.path)))
 			continue
 		}
 
-		flushImages()
 		data, err := os.ReadFile(entry.path)
+		if err == nil && albumVideo(sel, entry.sendTyp, int64(len(data))) {
+			addToGroup(telegram.MediaFile{Filename: filepath.Base(entry.path), Data: data, Type: telegram.MediaVideo, Source: entry.path})
+			continue
+		}
+		flushImages()
 		if err != nil {
 			skipped++
 			processed++
@@ -494,7 +595,7 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 			continue
 		}
 		sourceBytes := int64(len(data))
-		if err := sendSingleFile(client, chatID, topicID, entry.sendTyp, filepath.Base(entry.path), data, retry); err != nil {
+		if err := sendSingleFile(ctx, client, chatID, topicID, entry.sendTyp, entry.path, filepath.Base(entry.path), data, retry); err != nil {
 			log.Printf("send failed: %v", err)
 			skipped++
 		} else {
@@ -511,30 +612,12 @@ func sendMixedFromPaths(client *telegram.Client, chatID string, topicID *int, so
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed mixed upload from %s at %s (elapsed %s, avg/item %s, total %s, avg %s, sent %d, skipped %d)",
-			sourceLabel,
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary("mixed", sourceLabel, startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "mixed", Source: sourceLabel, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, Unreadable: unreadable, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("mixed", sourceLabel, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, unreadable)
 }
 
-func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipPath string, sel mixedSelection, groupSize int, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, retry telegram.RetryConfig) {
+func sendMixedFromZip(ctx context.Context, client *telegram.Client, chatID string, topicID *int, zipPath string, sel mixedSelection, groupSize int, groupMaxBytes int64, delay time.Duration, include []string, exclude []string, zipPasswords []string, logZipPasswords bool, maxDimension int, maxBytes int, pngStartLevel int, notes *runNotes, retry telegram.RetryConfig) {
+	client = client.PinFolder(zipPath)
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
 		log.Printf("invalid zip: %s", zipPath)
@@ -567,21 +650,12 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 		return
 	}
 
+	sizes := zipSizes(filesByName, names)
 	startedAt := time.Now()
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Starting mixed upload from %s: %d file(s) at %s",
-			filepath.Base(zipPath),
-			len(names),
-			formatTimestamp(startedAt),
-		),
-		topicID,
-		retry,
-	)
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "mixed", Source: filepath.Base(zipPath), Count: len(names), TotalBytes: sumSizes(sizes), StartedAt: startedAt})
 
 	zipOpts := ziputil.ReadOptions{LogPasswords: logZipPasswords}
-	progressState := newProgressTracker(len(names), "mixed")
+	progressState := newProgressTracker(len(names), "mixed").withSizes(sizes)
 	media := []telegram.MediaFile{}
 	batchBytes := int64(0)
 	processed := 0
@@ -594,12 +668,15 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 			return
 		}
 		batchCount := len(media)
-		if err := client.SendMediaGroup(chatID, media, topicID, retry); err != nil {
-			log.Printf("send media group failed: %v", err)
-			skipped += len(media)
-		} else {
-			sent += len(media)
-			sentBytes += batchBytes
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
 		}
 		processed += batchCount
 		progressState.Print(processed, sent, skipped, false)
@@ -608,7 +685,21 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 		time.Sleep(delay)
 	}
 
+	addToGroup := func(file telegram.MediaFile) {
+		if exceedsGroupBytes(media, batchBytes, file, groupMaxBytes) {
+			flushImages()
+		}
+		media = append(media, file)
+		batchBytes += int64(len(file.Data))
+		if len(media) >= groupSize {
+			flushImages()
+		}
+	}
+
 	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
 		file := filesByName[name]
 		if file == nil {
 			skipped++
@@ -636,16 +727,17 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 				progressState.Print(processed, sent, skipped, false)
 				continue
 			}
-			media = append(media, prepared)
-			batchBytes += int64(len(prepared.Data))
-			if len(media) >= groupSize {
-				flushImages()
-			}
+			prepared.Source = zipPath
+			addToGroup(client.WithOriginal(prepared, data, filepath.Base(name)))
 			continue
 		}
 
-		flushImages()
 		data, err := ziputil.ReadFileWithOptions(file, zipPasswords, zipOpts)
+		if err == nil && albumVideo(sel, sendType, int64(len(data))) {
+			addToGroup(telegram.MediaFile{Filename: filepath.Base(name), Data: data, Type: telegram.MediaVideo, Source: zipPath})
+			continue
+		}
+		flushImages()
 		if err != nil {
 			skipped++
 			processed++
@@ -653,7 +745,7 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 			continue
 		}
 		sourceBytes := int64(len(data))
-		if err := sendSingleFile(client, chatID, topicID, sendType, filepath.Base(name), data, retry); err != nil {
+		if err := sendSingleFile(ctx, client, chatID, topicID, sendType, zipPath, filepath.Base(name), data, retry); err != nil {
 			log.Printf("send failed: %v", err)
 			skipped++
 		} else {
@@ -670,25 +762,6 @@ func sendMixedFromZip(client *telegram.Client, chatID string, topicID *int, zipP
 
 	finishedAt := time.Now()
 	elapsed := finishedAt.Sub(startedAt)
-	avgPer := time.Duration(0)
-	if sent > 0 {
-		avgPer = elapsed / time.Duration(sent)
-	}
-	_ = client.SendMessage(
-		chatID,
-		fmt.Sprintf(
-			"Completed mixed upload from %s at %s (elapsed %s, avg/item %s, total %s, avg %s, sent %d, skipped %d)",
-			filepath.Base(zipPath),
-			formatTimestamp(finishedAt),
-			formatDuration(elapsed),
-			formatDuration(avgPer),
-			formatBytes(sentBytes),
-			formatSpeed(sentBytes, elapsed),
-			sent,
-			skipped,
-		),
-		topicID,
-		retry,
-	)
-	printSummary("mixed", filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "mixed", Source: filepath.Base(zipPath), Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("mixed", filepath.Base(zipPath), startedAt, finishedAt, elapsed, sent, skipped, sentBytes, 0)
 }
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/pdf"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pdfAsImages   = "images"
+	pdfAsDocument = "document"
+)
+
+// pdfImageOptions controls how send-pdf renders and batches pages.
+type pdfImageOptions struct {
+	dpi           int
+	firstPage     int
+	lastPage      int
+	groupSize     int
+	groupMaxBytes int64
+	delay         time.Duration
+	maxDimension  int
+	maxBytes      int
+	pngStartLevel int
+	captions      bool
+}
+
+func newSendPDFCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	filePaths := &stringSlice{}
+	var as string
+	opts := pdfImageOptions{}
+	var batchDelay int
+
+	cmd := &cobra.Command{
+		Use:   "send-pdf",
+		Short: "Send PDFs as page images or as documents",
+		Long: "send-pdf renders each page of a PDF to an image and sends the pages in order as media groups, captioned\n" +
+			"with their page number, so scanned documents can be read in the chat. Rendering needs pdftoppm (poppler)\n" +
+			"or mutool (MuPDF) in PATH. --as document sends the PDF file unchanged.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			opts.groupSize = checkGroupSize(opts.groupSize)
+			opts.delay = time.Duration(batchDelay) * time.Second
+			if cfg.chatID == "" {
+				return fmt.Errorf("chat-id is required")
+			}
+			if err := cfg.setupImages(); err != nil {
+				return err
+			}
+			if len(filePaths.Values()) == 0 {
+				return fmt.Errorf("file is required")
+			}
+			as = strings.ToLower(strings.TrimSpace(as))
+			if as != pdfAsImages && as != pdfAsDocument {
+				return fmt.Errorf("invalid --as %q (use images or document)", as)
+			}
+			if opts.dpi < 36 || opts.dpi > 600 {
+				return fmt.Errorf("dpi must be between 36 and 600")
+			}
+			if opts.firstPage < 0 || opts.lastPage < 0 || (opts.lastPage > 0 && opts.lastPage < opts.firstPage) {
+				return fmt.Errorf("invalid page range %d-%d", opts.firstPage, opts.lastPage)
+			}
+
+			notes, err := newRunNotes(cfg)
+			if err != nil {
+				return err
+			}
+			notes.pace = runPace{groupSize: opts.groupSize, batchDelay: opts.delay}
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+			for _, path := range filePaths.Values() {
+				if ctx.Err() != nil {
+					break
+				}
+				if as == pdfAsDocument {
+					if err := sendPDFDocument(ctx, client, cfg.chatID, topicPtr(cfg), path, notes, retry); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := sendPDFImages(ctx, client, cfg.chatID, topicPtr(cfg), path, opts, notes, retry); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	bindRunFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.Var(filePaths, "file", "PDF file path (repeatable or comma-separated)")
+	flags.StringVar(&as, "as", pdfAsImages, "Send each PDF as page images (images) or as the PDF file (document)")
+	flags.IntVar(&opts.dpi, "dpi", 150, "Page rendering resolution for --as images")
+	flags.IntVar(&opts.firstPage, "first-page", 0, "First page to send (1-based, 0 for the first page)")
+	flags.IntVar(&opts.lastPage, "last-page", 0, "Last page to send (0 for the last page)")
+	flags.BoolVar(&opts.captions, "page-captions", true, "Caption each page image with the file name and page number")
+	flags.IntVar(&opts.groupSize, "group-size", 10, "Pages per media group")
+	flags.Int64Var(&opts.groupMaxBytes, "group-max-bytes", 0, "Close a media group early when its pages would exceed this many bytes (0 disables)")
+	flags.IntVar(&batchDelay, "batch-delay", 3, "Delay between media groups (seconds)")
+	flags.IntVar(&opts.maxDimension, "max-dimension", 2560, "Max page image dimension (0 to disable resize)")
+	bindResizeBackendFlag(cmd, cfg)
+	flags.IntVar(&opts.maxBytes, "max-bytes", 5*1024*1024, "Max page image size in bytes (0 to disable size limit)")
+	flags.IntVar(&opts.pngStartLevel, "png-start-level", 8, "PNG compression start level (0-9)")
+	return cmd
+}
+
+// sendPDFImages renders the pages of a PDF into a temporary directory and
+// sends them in page order as media groups.
+func sendPDFImages(ctx context.Context, client *telegram.Client, chatID string, topicID *int, path string, opts pdfImageOptions, notes *runNotes, retry telegram.RetryConfig) error {
+	client = client.PinFolder(path)
+	name := filepath.Base(path)
+	tempDir, err := tempdir.MkdirTemp("pdf-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	log.Printf("rendering %s at %d dpi", name, opts.dpi)
+	pages, err := pdf.Rasterize(ctx, path, opts.dpi, opts.firstPage, opts.lastPage, tempDir)
+	if err != nil {
+		return fmt.Errorf("render %s: %w", name, err)
+	}
+	// The page count is only known when the whole document was rendered.
+	total := 0
+	if opts.firstPage <= 1 && opts.lastPage == 0 {
+		total = len(pages)
+	}
+
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "pdf", Source: name, Count: len(pages), StartedAt: startedAt})
+	progressState := newProgressTracker(len(pages), "pdf")
+
+	media := []telegram.MediaFile{}
+	batchBytes := int64(0)
+	processed := 0
+	sent := 0
+	skipped := 0
+	sentBytes := int64(0)
+
+	flushPages := func() {
+		if len(media) == 0 {
+			return
+		}
+		_, errs := client.SendMediaGroupEach(ctx, chatID, media, topicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+				skipped++
+			} else {
+				sent++
+				sentBytes += int64(len(media[j].Data))
+			}
+		}
+		processed += len(media)
+		progressState.Print(processed, sent, skipped, false)
+		media = media[:0]
+		batchBytes = 0
+	}
+
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, page := range pages {
+		if ctx.Err() != nil {
+			break
+		}
+		data, err := os.ReadFile(page.Path)
+		if err != nil {
+			log.Printf("read page %d of %s failed: %v", page.Number, name, err)
+			processed++
+			skipped++
+			continue
+		}
+		filename := fmt.Sprintf("%s-p%03d%s", stem, page.Number, filepath.Ext(page.Path))
+		prepared, err := prepareImageMedia(data, filename, opts.maxDimension, opts.maxBytes, opts.pngStartLevel)
+		if err != nil {
+			log.Printf("invalid page image %s: %v", filename, err)
+			processed++
+			skipped++
+			continue
+		}
+		if opts.captions {
+			prepared.Caption = pdfPageCaption(name, page.Number, total)
+		}
+		prepared = client.WithOriginal(prepared, data, filename)
+		if exceedsGroupBytes(media, batchBytes, prepared, opts.groupMaxBytes) {
+			flushPages()
+			time.Sleep(opts.delay)
+		}
+		media = append(media, prepared)
+		batchBytes += int64(len(prepared.Data))
+		if len(media) >= opts.groupSize {
+			flushPages()
+			time.Sleep(opts.delay)
+		}
+	}
+	flushPages()
+	progressState.Print(processed, sent, skipped, true)
+
+	finishedAt := time.Now()
+	elapsed := finishedAt.Sub(startedAt)
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "pdf", Source: name, Count: sent + skipped, Sent: sent, Skipped: skipped, Bytes: sentBytes, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("pdf", path, startedAt, finishedAt, elapsed, sent, skipped, sentBytes, 0)
+	return nil
+}
+
+func pdfPageCaption(name string, page int, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("%s · page %d/%d", name, page, total)
+	}
+	return fmt.Sprintf("%s · page %d", name, page)
+}
+
+// sendPDFDocument sends the PDF file itself.
+func sendPDFDocument(ctx context.Context, client *telegram.Client, chatID string, topicID *int, path string, notes *runNotes, retry telegram.RetryConfig) error {
+	name := filepath.Base(path)
+	startedAt := time.Now()
+	client = notes.startRun(ctx, client, chatID, topicID, retry, runReport{Kind: "pdf", Source: name, Count: 1, StartedAt: startedAt})
+	size, err := sendPathOrSplit(ctx, client, chatID, topicID, "file", path, splitter.Spec{}, nil, retry)
+	if err != nil {
+		return fmt.Errorf("send %s: %w", name, err)
+	}
+	finishedAt := time.Now()
+	notes.finishRun(ctx, client, chatID, topicID, retry, runReport{Kind: "pdf", Source: name, Count: 1, Sent: 1, Bytes: size, StartedAt: startedAt, FinishedAt: finishedAt})
+	printSummary("pdf", path, startedAt, finishedAt, finishedAt.Sub(startedAt), 1, 0, size, 0)
+	return nil
+}
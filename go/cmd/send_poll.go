@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+func newSendPollCmd() *cobra.Command {
+	cfg := &commonFlags{}
+	options := &stringSlice{}
+	var question string
+	var anonymous bool
+	var multipleAnswers bool
+
+	cmd := &cobra.Command{
+		Use:          "send-poll",
+		Short:        "Send a poll",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			if cfg.chatID == "" || question == "" {
+				return fmt.Errorf("chat-id and question are required")
+			}
+			if count := len(options.Values()); count < telegram.MinPollOptions || count > telegram.MaxPollOptions {
+				return fmt.Errorf("a poll needs %d-%d options, got %d", telegram.MinPollOptions, telegram.MaxPollOptions, count)
+			}
+
+			apiURLs, tokens, err := resolveConfig(cfg)
+			if err != nil {
+				return err
+			}
+			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			if err != nil {
+				return err
+			}
+
+			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
+			poll := telegram.Poll{Question: question, Options: options.Values(), Anonymous: anonymous, MultipleAnswers: multipleAnswers}
+			_, err = client.SendPoll(ctx, cfg.chatID, poll, topicPtr(cfg), retry)
+			return err
+		},
+	}
+
+	bindCommonFlags(cmd, cfg)
+	flags := cmd.Flags()
+	flags.StringVar(&question, "question", "", "Poll question")
+	flags.Var(options, "option", "Poll answer option (repeat for each option, 2-10)")
+	flags.BoolVar(&anonymous, "anonymous", true, "Hide who voted for what (--anonymous=false shows voters)")
+	flags.BoolVar(&multipleAnswers, "multiple-answers", false, "Let voters pick more than one option")
+	return cmd
+}
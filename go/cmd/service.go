@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type serviceFlags struct {
+	name string
+	user bool
+}
+
+func bindServiceFlags(cmd *cobra.Command, cfg *serviceFlags) {
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.name, "name", service.DefaultName, "Service name")
+	flags.BoolVar(&cfg.user, "user", false, "Install as a per-user service (systemd --user / LaunchAgents)")
+}
+
+func newServiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Install the watch command as a system service",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newServiceInstallCmd())
+	cmd.AddCommand(newServiceUninstallCmd())
+	cmd.AddCommand(newServiceStatusCmd())
+	cmd.AddCommand(newServiceRunCmd())
+	return cmd
+}
+
+func newServiceInstallCmd() *cobra.Command {
+	cfg := &serviceFlags{}
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:          "install [flags] -- <watch flags>",
+		Short:        "Register a systemd unit, launchd plist or Windows service running watch",
+		Example:      "  telegram-send-go service install -- --watch-dir /data/incoming --chat-id -1001234567890 --config ./config.ini",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("watch flags are required after --")
+			}
+			watch := newWatchCmd()
+			copyFlags(watch.Flags(), cmd.Root().PersistentFlags())
+			if err := watch.ParseFlags(args); err != nil {
+				return fmt.Errorf("invalid watch flags: %w", err)
+			}
+			if len(watch.Flags().Args()) > 0 {
+				return fmt.Errorf("unexpected watch arguments: %v", watch.Flags().Args())
+			}
+			if !watch.Flags().Changed("chat-id") {
+				return fmt.Errorf("chat-id is required")
+			}
+			if !watch.Flags().Changed("watch-dir") {
+				return fmt.Errorf("watch-dir is required")
+			}
+			watchArgs, err := service.AbsoluteArgs(args)
+			if err != nil {
+				return err
+			}
+
+			serviceArgs := append([]string{"watch"}, watchArgs...)
+			if runtime.GOOS == "windows" {
+				serviceArgs = append([]string{"service", "run", "--name", cfg.name, "--"}, watchArgs...)
+			}
+			workingDir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			svcCfg := service.Config{Name: cfg.name, Args: serviceArgs, WorkingDir: workingDir, User: cfg.user}
+
+			if dryRun {
+				rendered, err := service.Render(svcCfg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(cmd.OutOrStdout(), rendered)
+				return nil
+			}
+			path, err := service.Install(svcCfg)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Installed service %s (%s)\n", cfg.name, path)
+			return nil
+		},
+	}
+
+	bindServiceFlags(cmd, cfg)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the generated service definition without installing")
+	return cmd
+}
+
+func newServiceUninstallCmd() *cobra.Command {
+	cfg := &serviceFlags{}
+
+	cmd := &cobra.Command{
+		Use:          "uninstall",
+		Short:        "Stop and remove the installed service",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := service.Uninstall(service.Config{Name: cfg.name, User: cfg.user})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed service %s (%s)\n", cfg.name, path)
+			return nil
+		},
+	}
+
+	bindServiceFlags(cmd, cfg)
+	return cmd
+}
+
+func newServiceStatusCmd() *cobra.Command {
+	cfg := &serviceFlags{}
+
+	cmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show whether the service is installed and running",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := service.QueryStatus(service.Config{Name: cfg.name, User: cfg.user})
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "service: %s\n", cfg.name)
+			fmt.Fprintf(out, "path: %s\n", status.Path)
+			fmt.Fprintf(out, "installed: %t\n", status.Installed)
+			fmt.Fprintf(out, "running: %t\n", status.Running)
+			if status.Detail != "" {
+				fmt.Fprintf(out, "state: %s\n", status.Detail)
+			}
+			return nil
+		},
+	}
+
+	bindServiceFlags(cmd, cfg)
+	return cmd
+}
+
+func newServiceRunCmd() *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:          "run -- <watch flags>",
+		Short:        "Run watch under the service manager",
+		Hidden:       true,
+		Annotations:  map[string]string{longRunningAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return service.Run(name, func() error {
+				// Run watch under a root command of its own so that its
+				// --lang, --temp-dir and tracing flags take effect.
+				root := newRootCmd(buildVersion, "", "")
+				root.SetArgs(append([]string{"watch"}, args...))
+				root.SilenceErrors = true
+				return root.ExecuteContext(cmd.Context())
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", service.DefaultName, "Service name")
+	return cmd
+}
+
+// copyFlags declares the flags of from on to with storage of their own, so
+// that parsing to leaves the values of from alone.
+func copyFlags(to *pflag.FlagSet, from *pflag.FlagSet) {
+	from.VisitAll(func(flag *pflag.Flag) {
+		switch flag.Value.Type() {
+		case "bool":
+			to.BoolP(flag.Name, flag.Shorthand, false, flag.Usage)
+		case "stringArray":
+			to.StringArrayP(flag.Name, flag.Shorthand, nil, flag.Usage)
+		default:
+			to.StringP(flag.Name, flag.Shorthand, flag.DefValue, flag.Usage)
+		}
+	})
+}
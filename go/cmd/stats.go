@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/notify"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/spf13/cobra"
+)
+
+var statsStatuses = []string{queue.StatusQueued, queue.StatusSending, queue.StatusSent, queue.StatusFailed, queue.StatusFailedPermanent, queue.StatusSourceMissing, queue.StatusSkipped}
+
+// errorNumbers masks numbers in error messages so "retry after 30" and
+// "retry after 31" count as one reason.
+var errorNumbers = regexp.MustCompile(`\d+`)
+
+type statsCount struct {
+	items int
+	bytes int64
+}
+
+func newStatsCmd() *cobra.Command {
+	var queueFile string
+	var topErrors int
+	var days int
+
+	cmd := &cobra.Command{
+		Use:          "stats",
+		Short:        "Summarize a queue file: totals, errors, backlog and daily activity",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if queueFile == "" {
+				return fmt.Errorf("queue-file is required")
+			}
+			if _, err := os.Stat(queueFile); err != nil {
+				return fmt.Errorf("queue file %s: %w", queueFile, err)
+			}
+			items, err := queue.ReadItems(queueFile)
+			if err != nil {
+				return err
+			}
+			printQueueStats(cmd.OutOrStdout(), queueFile, items, topErrors, days, time.Now())
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&queueFile, "queue-file", "", "Queue file to summarize")
+	flags.IntVar(&topErrors, "top-errors", 5, "Number of error reasons to list")
+	flags.IntVar(&days, "days", 14, "Show the most recent N days with activity in the per-day table (0 shows all)")
+	return cmd
+}
+
+func printQueueStats(out io.Writer, path string, items []queue.Item, topErrors int, days int, now time.Time) {
+	byStatus := map[string]*statsCount{}
+	byType := map[string]*statsCount{}
+	errorCounts := map[string]int{}
+	enqueuedByDay := map[string]int{}
+	sentByDay := map[string]int{}
+	total := statsCount{}
+	var oldestQueued time.Time
+
+	for _, item := range items {
+		total.items++
+		total.bytes += item.Size
+		addStatsCount(byStatus, item.Status, item.Size)
+		sendType := item.SendType
+		if sendType == "" {
+			sendType = "image"
+		}
+		addStatsCount(byType, sendType, item.Size)
+
+		enqueuedAt, enqueuedErr := time.Parse(time.RFC3339Nano, item.EnqueuedAt)
+		if enqueuedErr == nil {
+			enqueuedByDay[enqueuedAt.In(now.Location()).Format("2006-01-02")]++
+		}
+		switch item.Status {
+		case queue.StatusQueued:
+			if enqueuedErr == nil && (oldestQueued.IsZero() || enqueuedAt.Before(oldestQueued)) {
+				oldestQueued = enqueuedAt
+			}
+		case queue.StatusSent:
+			if updatedAt, err := time.Parse(time.RFC3339Nano, item.UpdatedAt); err == nil {
+				sentByDay[updatedAt.In(now.Location()).Format("2006-01-02")]++
+			}
+		case queue.StatusFailed, queue.StatusFailedPermanent, queue.StatusSourceMissing:
+			if item.Error != nil {
+				errorCounts[errorNumbers.ReplaceAllString(*item.Error, "N")]++
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "queue: %s\n", path)
+	fmt.Fprintf(out, "items: %d (%s)\n", total.items, formatBytes(total.bytes))
+
+	fmt.Fprintln(out, "\nby status:")
+	for _, status := range statsStatuses {
+		count := byStatus[status]
+		if count == nil {
+			count = &statsCount{}
+		}
+		fmt.Fprintf(out, "  %-16s %6d  %s\n", status, count.items, formatBytes(count.bytes))
+	}
+
+	fmt.Fprintln(out, "\nby send type:")
+	types := make([]string, 0, len(byType))
+	for sendType := range byType {
+		types = append(types, sendType)
+	}
+	sort.Strings(types)
+	for _, sendType := range types {
+		fmt.Fprintf(out, "  %-8s %6d  %s\n", sendType, byType[sendType].items, formatBytes(byType[sendType].bytes))
+	}
+
+	pending := int64(0)
+	for _, status := range []string{queue.StatusQueued, queue.StatusSending, queue.StatusFailed} {
+		if count := byStatus[status]; count != nil {
+			pending += count.bytes
+		}
+	}
+	sent := int64(0)
+	if count := byStatus[queue.StatusSent]; count != nil {
+		sent = count.bytes
+	}
+	fmt.Fprintf(out, "\nbytes: pending %s, sent %s\n", formatBytes(pending), formatBytes(sent))
+	if oldestQueued.IsZero() {
+		fmt.Fprintln(out, "oldest queued: none")
+	} else {
+		fmt.Fprintf(out, "oldest queued: %s (%s ago)\n", formatTimestamp(oldestQueued.In(now.Location())), formatDuration(now.Sub(oldestQueued)))
+	}
+
+	if len(errorCounts) > 0 && topErrors > 0 {
+		reasons := make([]string, 0, len(errorCounts))
+		for reason := range errorCounts {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			if errorCounts[reasons[i]] != errorCounts[reasons[j]] {
+				return errorCounts[reasons[i]] > errorCounts[reasons[j]]
+			}
+			return reasons[i] < reasons[j]
+		})
+		if len(reasons) > topErrors {
+			reasons = reasons[:topErrors]
+		}
+		fmt.Fprintln(out, "\ntop errors:")
+		for _, reason := range reasons {
+			fmt.Fprintf(out, "  %6d  [%s] %s\n", errorCounts[reason], notify.ErrorClass(reason), reason)
+		}
+	}
+
+	dates := make([]string, 0, len(enqueuedByDay))
+	for date := range enqueuedByDay {
+		dates = append(dates, date)
+	}
+	for date := range sentByDay {
+		if _, ok := enqueuedByDay[date]; !ok {
+			dates = append(dates, date)
+		}
+	}
+	if len(dates) == 0 {
+		return
+	}
+	sort.Strings(dates)
+	if days > 0 && len(dates) > days {
+		dates = dates[len(dates)-days:]
+	}
+	fmt.Fprintln(out, "\nper day:      enqueued     sent")
+	for _, date := range dates {
+		fmt.Fprintf(out, "  %s %9d %8d\n", date, enqueuedByDay[date], sentByDay[date])
+	}
+}
+
+func addStatsCount(counts map[string]*statsCount, key string, size int64) {
+	count := counts[key]
+	if count == nil {
+		count = &statsCount{}
+		counts[key] = count
+	}
+	count.items++
+	count.bytes += size
+}
@@ -2,12 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"path/filepath"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/notify"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
 	"github.com/spf13/cobra"
@@ -27,7 +31,17 @@ func newWatchCmd() *cobra.Command {
 	var scanInterval int
 	var sendInterval int
 	var settleSeconds int
+	var scanWorkers int
+	var scanDirCache bool
+	var onModified string
+	var ordering string
+	var metadataCaptions bool
+	var pruneSent string
+	var queueFsync bool
+	var statusInterval int
 	var groupSize int
+	var groupMaxBytes int64
+	var albumVideos bool
 	var batchDelay int
 	var pauseEvery int
 	var pauseSeconds int
@@ -36,32 +50,115 @@ func newWatchCmd() *cobra.Command {
 	var pngStart int
 	var notifyEnabled bool
 	var notifyInterval int
+	var notifyErrorOnly bool
+	var notifyFailureInterval int
+	notifySinks := &stringSlice{}
+	var notifySinkOnly bool
+	var notifyMode string
+	var notifyIdleMax int
+	var notifyDailyAt string
 	zipPasses := &stringSlice{}
 	var zipPassFile string
+	var priorityName string
+	var controlSocket string
+	var phashDedup bool
+	var phashDistance int
+	var autoSplit string
+	var memoryBudget string
+	var dailyLimitFiles int
+	var dailyLimitBytes int64
+	var quotaTimezone string
+	topicMap := &stringSlice{}
+	var enqueueOnly bool
 
 	cmd := &cobra.Command{
 		Use:          "watch",
 		Short:        "Watch folder and send queued images",
 		Args:         cobra.NoArgs,
+		Annotations:  map[string]string{longRunningAnnotation: "true"},
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg.retryDelay = time.Duration(cfg.retryDelaySec) * time.Second
+			groupSize = checkGroupSize(groupSize)
 			if cfg.chatID == "" {
 				return fmt.Errorf("chat-id is required")
 			}
+			if err := cfg.setupImages(); err != nil {
+				return err
+			}
+			sinks, err := notify.ParseSinks(notifySinks.Values())
+			if err != nil {
+				return err
+			}
+			notifyMode, err = notify.ParseMode(notifyMode)
+			if err != nil {
+				return err
+			}
+			dailyAt, err := notify.ParseDailyAt(notifyDailyAt)
+			if err != nil {
+				return err
+			}
+			if notifyErrorOnly || len(sinks) > 0 {
+				notifyEnabled = true
+			}
+			if enqueueOnly && notifyEnabled {
+				return fmt.Errorf("notify needs the sending process; it cannot be used with enqueue-only")
+			}
+			if enqueueOnly && pruneSent != "" {
+				return fmt.Errorf("queue-prune-sent belongs to the sending process; it cannot be used with enqueue-only")
+			}
 			if len(watchDirs.Values()) == 0 {
 				return fmt.Errorf("watch-dir is required")
 			}
 
-			apiURLs, tokens, err := resolveConfig(cfg)
+			priority, err := queue.ParsePriority(priorityName)
 			if err != nil {
 				return err
 			}
-			client, _, _, err := buildClient(cfg, apiURLs, tokens)
+			split, err := splitter.ParseSpec(autoSplit)
+			if err != nil {
+				return err
+			}
+			memoryLimit := int64(0)
+			if memoryBudget != "" && memoryBudget != "0" {
+				if memoryLimit, err = splitter.ParseSize(memoryBudget); err != nil {
+					return fmt.Errorf("invalid memory-budget: %w", err)
+				}
+			}
+			modifiedPolicy, err := sender.ParseModifiedPolicy(onModified)
+			if err != nil {
+				return err
+			}
+			ordering, err = sender.ParseOrdering(ordering)
+			if err != nil {
+				return err
+			}
+			quotaLocation, err := sender.LoadQuotaLocation(quotaTimezone)
+			if err != nil {
+				return err
+			}
+			retention, err := queue.ParseRetention(pruneSent)
+			if err != nil {
+				return err
+			}
+			topics, err := watcher.ParseTopicMap(topicMap.Values())
 			if err != nil {
 				return err
 			}
 
+			// An enqueue-only watch never talks to Telegram, so it needs no
+			// tokens; its queue is named after the chat ID as given.
+			var client *telegram.Client
+			if !enqueueOnly {
+				apiURLs, tokens, err := resolveConfig(cfg)
+				if err != nil {
+					return err
+				}
+				if client, _, _, err = buildClient(cfg, apiURLs, tokens); err != nil {
+					return err
+				}
+			}
+
 			zipPasswords, err := loadZipPasswords(zipPasses.Values(), zipPassFile)
 			if err != nil {
 				return err
@@ -76,62 +173,83 @@ func newWatchCmd() *cobra.Command {
 				withImage = true
 			}
 
-			absWatchDirs := make([]string, 0, len(watchDirs.Values()))
-			seen := map[string]struct{}{}
-			for _, watchDir := range watchDirs.Values() {
-				absWatchDir, err := filepath.Abs(watchDir)
+			absWatchDirs, err := resolveWatchDirs(watchDirs.Values())
+			if err != nil {
+				return err
+			}
+			if len(absWatchDirs) == 0 {
+				return fmt.Errorf("watch-dir is required")
+			}
+			if queueFile == "" {
+				queueFile, err = defaultWatchQueueFile(absWatchDirs, cfg.queueChatID(), topicPtr(cfg))
 				if err != nil {
 					return err
 				}
-				if _, ok := seen[absWatchDir]; ok {
-					continue
-				}
-				seen[absWatchDir] = struct{}{}
-				absWatchDirs = append(absWatchDirs, absWatchDir)
 			}
-			if len(absWatchDirs) == 0 {
-				return fmt.Errorf("watch-dir is required")
+			meta := watchQueueMeta(absWatchDirs, recursive, cfg, withImage, withVideo, withAudio, withAll, includes.Values(), excludes.Values())
+			var q *queue.Queue
+			if enqueueOnly {
+				q, err = queue.NewShared(queueFile, meta)
+			} else {
+				q, err = cfg.openQueue(queueFile, meta)
 			}
-			q, err := queue.New(queueFile, &queue.Meta{
-				Params: queue.MetaParams{
-					Command:   "watch",
-					WatchDir:  queue.WatchDirs(absWatchDirs),
-					Recursive: recursive,
-					ChatID:    cfg.chatID,
-					TopicID:   topicPtr(cfg),
-					WithImage: withImage,
-					WithVideo: withVideo,
-					WithAudio: withAudio,
-					WithAll:   withAll,
-					Include:   includes.Values(),
-					Exclude:   excludes.Values(),
-				},
-			})
 			if err != nil {
 				return err
 			}
+			q.SetFsync(queueFsync)
+			// An enqueue-only watch keys the index by the chat as given.
+			if err := cfg.attachSentIndex(q, cfg.chatID); err != nil {
+				return err
+			}
 
+			unreadable := &fswalk.Unreadable{}
 			watchConfigs := make([]watcher.Config, 0, len(absWatchDirs))
 			for _, watchDir := range absWatchDirs {
 				watchConfigs = append(watchConfigs, watcher.Config{
-					Root:          watchDir,
-					Recursive:     recursive,
-					IncludeGlobs:  includes.Values(),
-					ExcludeGlobs:  excludes.Values(),
-					WithImage:     withImage,
-					WithVideo:     withVideo,
-					WithAudio:     withAudio,
-					WithAll:       withAll,
-					ScanInterval:  time.Duration(scanInterval) * time.Second,
-					SettleSeconds: settleSeconds,
+					Root:           watchDir,
+					Recursive:      recursive,
+					IncludeGlobs:   includes.Values(),
+					ExcludeGlobs:   excludes.Values(),
+					WithImage:      withImage,
+					WithVideo:      withVideo,
+					WithAudio:      withAudio,
+					WithAll:        withAll,
+					ScanInterval:   time.Duration(scanInterval) * time.Second,
+					SettleSeconds:  settleSeconds,
+					ScanWorkers:    scanWorkers,
+					DirCache:       scanDirCache,
+					FollowSymlinks: cfg.followSymlinks,
+					IncludeHidden:  cfg.includeHidden,
+					Strict:         cfg.strict,
+					IgnoreFile:     cfg.ignoreFile,
+					Skip:           quarantineSkip(cfg.quarantine),
+					Unreadable:     unreadable,
+					Priority:       priority,
+					Topics:         topics,
 				})
 			}
 
+			notifyCfg := notify.Config{
+				Enabled:      notifyEnabled,
+				Interval:     time.Duration(notifyInterval) * time.Second,
+				NotifyOnIdle: true,
+
+				FailureInterval: time.Duration(notifyFailureInterval) * time.Second,
+				ErrorOnly:       notifyErrorOnly,
+				Sinks:           sinks,
+				SinkOnly:        notifySinkOnly,
+				Unreadable:      unreadable,
+				Mode:            notifyMode,
+				IdleMax:         time.Duration(notifyIdleMax) * time.Second,
+				DailyAt:         dailyAt,
+			}
+
 			retry := telegram.RetryConfig{MaxRetries: cfg.maxRetries, Delay: cfg.retryDelay}
 			sendCfg := sender.Config{
 				ChatID:        cfg.chatID,
 				TopicID:       topicPtr(cfg),
 				GroupSize:     groupSize,
+				GroupMaxBytes: groupMaxBytes,
 				SendInterval:  time.Duration(sendInterval) * time.Second,
 				BatchDelay:    time.Duration(batchDelay) * time.Second,
 				PauseEvery:    pauseEvery,
@@ -141,31 +259,83 @@ func newWatchCmd() *cobra.Command {
 				PNGStartLevel: pngStart,
 				Retry:         retry,
 				ZipPasswords:  zipPasswords,
-			}
+				PHashDedup:    phashDedup,
+				PHashDistance: phashDistance,
+				AlbumVideos:   albumVideos,
+				AutoSplit:     split,
+				DailyQuota:    sender.Quota{Files: dailyLimitFiles, Bytes: dailyLimitBytes, Location: quotaLocation},
+				Notify:        notifyCfg,
 
-			notifyCfg := notify.Config{
-				Enabled:      notifyEnabled,
-				Interval:     time.Duration(notifyInterval) * time.Second,
-				NotifyOnIdle: true,
+				ModifiedPolicy:   modifiedPolicy,
+				Ordering:         ordering,
+				MetadataCaptions: metadataCaptions,
+				CaptionRoots:     absWatchDirs,
+				StatusInterval:   time.Duration(statusInterval) * time.Second,
+				Memory:           sender.NewMemoryBudget(memoryLimit),
+				Quarantine:       cfg.quarantine,
 			}
 
+			ctx := cmd.Context()
+			pause := runcontrol.NewPauseGate()
+			if controlSocket == "" {
+				controlSocket = controlSocketPath(queueFile)
+				if enqueueOnly {
+					// Leave the default socket to the sending process.
+					controlSocket = queueFile + ".watch.sock"
+				}
+			}
+			controlDone := make(chan struct{})
+			if controlSocket == "none" {
+				close(controlDone)
+			} else {
+				go func() {
+					defer close(controlDone)
+					stats := func() map[string]map[string]int {
+						return map[string]map[string]int{queueFile: q.Stats()}
+					}
+					if err := runcontrol.ServeControl(ctx, controlSocket, pause, stats); err != nil {
+						log.Printf("control socket disabled: %v", err)
+					}
+				}()
+				log.Printf("control socket %s", controlSocket)
+			}
 			for _, watchCfg := range watchConfigs {
-				go watcher.WatchLoop(watchCfg, q)
+				go watcher.WatchLoopWithContext(ctx, watchCfg, q, pause)
+			}
+			go sweepLoop(ctx, q, queueFile)
+			if retention > 0 {
+				go pruneLoop(ctx, q, queueFile, retention)
+			}
+			if enqueueOnly {
+				log.Printf("enqueue-only: run send-queue --queue-file %s to send", queueFile)
+			} else {
+				go sender.LoopWithContext(ctx, sendCfg, q, client, pause, nil)
 			}
-			go sender.Loop(sendCfg, q, client)
 			if notifyCfg.Enabled {
-				go notify.Loop(notifyCfg, q, client, cfg.chatID, topicPtr(cfg))
+				go notify.LoopWithContext(ctx, notifyCfg, q, client, cfg.chatID, topicPtr(cfg))
 			}
 
-			select {}
+			<-ctx.Done()
+			<-controlDone
+			q.Close()
+			return nil
 		},
 	}
 
 	bindCommonFlags(cmd, cfg)
+	bindWalkFlags(cmd, cfg)
 	flags := cmd.Flags()
 	flags.Var(watchDirs, "watch-dir", "Folder to watch (repeatable or comma-separated)")
-	flags.StringVar(&queueFile, "queue-file", "queue.jsonl", "Path to JSONL queue file")
+	flags.StringVar(&queueFile, "queue-file", "", "Path to JSONL queue file (default: per-target file under --state-dir)")
+	bindQueueForceFlag(cmd, cfg)
+	bindQuarantineFlag(cmd, cfg)
+	bindSendOrderFlag(cmd, cfg)
+	bindGlobalDedupFlag(cmd, cfg)
+	flags.BoolVar(&enqueueOnly, "enqueue-only", false, "Only scan and add files to the queue file, without its lock; run send-queue on it to send (needs no bot token)")
 	flags.BoolVar(&recursive, "recursive", false, "Enable recursive scan")
+	flags.StringVar(&controlSocket, "control-socket", "", "Unix socket for ctl pause|resume|status (default <queue-file>.sock, \"none\" disables)")
+	flags.StringVar(&priorityName, "priority", "normal", "Priority of files found by the watcher: low, normal or high")
+	flags.Var(topicMap, "topic-map", "Route files to forum topics by type or extension, e.g. image=5,video=7,.pdf=11,*=9 (repeatable or comma-separated)")
 	flags.BoolVar(&withImage, "with-image", false, "Send matching images (media groups)")
 	flags.BoolVar(&withVideo, "with-video", false, "Send matching videos")
 	flags.BoolVar(&withAudio, "with-audio", false, "Send matching audio files")
@@ -174,17 +344,80 @@ func newWatchCmd() *cobra.Command {
 	flags.Var(excludes, "exclude", "Glob patterns to exclude (repeatable or comma-separated)")
 	flags.IntVar(&scanInterval, "scan-interval", 30, "Folder scan interval (seconds)")
 	flags.IntVar(&sendInterval, "send-interval", 30, "Queue send interval (seconds)")
+	flags.IntVar(&statusInterval, "status-interval", 0, "Log queue depth, send rate and ETA every N seconds (0 disables)")
 	flags.IntVar(&settleSeconds, "settle-seconds", 5, "Seconds to wait for file stability")
+	flags.IntVar(&scanWorkers, "scan-workers", 1, "Directories to read concurrently during a recursive scan")
+	flags.BoolVar(&scanDirCache, "scan-dir-cache", false, "Skip directories whose mtime is unchanged since the last scan (in-place file edits go unnoticed)")
+	flags.StringVar(&onModified, "on-modified", sender.ModifiedUpdate, "Files changed between enqueue and send: update (send current content), resend (skip; the watcher re-enqueues once settled) or skip")
+	flags.StringVar(&ordering, "ordering", sender.OrderingRelaxed, "Media group order: strict (hold later items until a failed group is sent) or relaxed (retry failed groups in a later pass)")
+	flags.BoolVar(&queueFsync, "queue-fsync", false, "Fsync the queue file after every write batch so a power loss cannot lose recorded progress")
+	flags.StringVar(&pruneSent, "queue-prune-sent", "", "Remove sent items older than this from the queue file at start and daily, e.g. 30d (files still in the watch directory are sent again)")
+	flags.BoolVar(&metadataCaptions, "metadata-captions", false, "Caption documents, videos and audio with their path relative to the watch directory, size and mtime")
 	flags.IntVar(&groupSize, "group-size", 4, "Images per media group")
+	flags.Int64Var(&groupMaxBytes, "group-max-bytes", 0, "Close a media group early when its images would exceed this many bytes (0 disables)")
+	flags.BoolVar(&albumVideos, "album-videos", false, "Batch videos up to 20 MB into albums with images instead of sending them alone")
 	flags.IntVar(&batchDelay, "batch-delay", 3, "Delay between media groups (seconds)")
 	flags.IntVar(&pauseEvery, "pause-every", 0, "Pause after sending this many images (0 disables)")
 	flags.IntVar(&pauseSeconds, "pause-seconds", 0, "Pause duration in seconds")
 	flags.IntVar(&maxDimension, "max-dimension", 2000, "Maximum image dimension before scaling")
+	bindResizeBackendFlag(cmd, cfg)
 	flags.IntVar(&maxBytes, "max-bytes", 5*1024*1024, "Maximum image size in bytes before PNG compression")
 	flags.IntVar(&pngStart, "png-start-level", 8, "Initial PNG compression level (0-9)")
+	flags.BoolVar(&phashDedup, "phash-dedup", false, "Skip images that look like an image already sent from this queue")
+	flags.IntVar(&phashDistance, "phash-distance", 4, "Maximum perceptual hash distance (0-64 bits) treated as a duplicate")
+	flags.StringVar(&memoryBudget, "memory-budget", "", "Cap the memory used for loading and resizing files, e.g. 256MB; albums close early and files over a quarter of it are streamed from disk")
+	flags.StringVar(&autoSplit, "auto-split", "", "Split files larger than SIZE into zip or 7z volumes and send the parts, e.g. zip:1900MB (7z needs the 7z binary)")
+	flags.IntVar(&dailyLimitFiles, "daily-limit-files", 0, "Pause sending until midnight after this many files in a day (0 disables)")
+	flags.Int64Var(&dailyLimitBytes, "daily-limit-bytes", 0, "Pause sending until midnight after this many bytes in a day (0 disables)")
+	flags.StringVar(&quotaTimezone, "quota-timezone", "", "IANA timezone whose midnight resets the daily limits (default local time)")
 	flags.BoolVar(&notifyEnabled, "notify", false, "Send watch notifications")
 	flags.IntVar(&notifyInterval, "notify-interval", 300, "Seconds between status notifications")
+	flags.BoolVar(&notifyErrorOnly, "notify-on-error-only", false, "Only send failure digests and quota notices (implies --notify)")
+	flags.IntVar(&notifyFailureInterval, "notify-failure-interval", 300, "Minimum seconds between failure digests")
+	flags.Var(notifySinks, "notify-sink", "Also send notifications to webhook:URL, slack:URL or discord:URL (repeatable; implies --notify)")
+	flags.BoolVar(&notifySinkOnly, "notify-sink-only", false, "Send notifications only to --notify-sink targets, not the Telegram chat")
+	flags.StringVar(&notifyMode, "notify-mode", notify.ModeInterval, "When status notifications go out: interval (every --notify-interval), changes (only when the counts moved, with reminders at doubling gaps while idle) or daily (one summary a day at --notify-daily-at)")
+	flags.IntVar(&notifyIdleMax, "notify-idle-max", int(notify.DefaultIdleMax/time.Second), "Longest gap in seconds between idle reminders in --notify-mode changes (0 disables reminders)")
+	flags.StringVar(&notifyDailyAt, "notify-daily-at", "09:00", "Local time (HH:MM) of the summary in --notify-mode daily")
 	flags.Var(zipPasses, "zip-pass", "Zip password (repeatable or comma-separated)")
 	flags.StringVar(&zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
 	return cmd
 }
+
+// resolveWatchDirs makes the watch directories absolute and drops repeats.
+func resolveWatchDirs(values []string) ([]string, error) {
+	absWatchDirs := make([]string, 0, len(values))
+	seen := map[string]struct{}{}
+	for _, watchDir := range values {
+		absWatchDir, err := filepath.Abs(watchDir)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[absWatchDir]; ok {
+			continue
+		}
+		seen[absWatchDir] = struct{}{}
+		absWatchDirs = append(absWatchDirs, absWatchDir)
+	}
+	return absWatchDirs, nil
+}
+
+// watchQueueMeta is the queue metadata of a watch; a queue file only
+// serves a watch started with the same values.
+func watchQueueMeta(absWatchDirs []string, recursive bool, cfg *commonFlags, withImage bool, withVideo bool, withAudio bool, withAll bool, include []string, exclude []string) *queue.Meta {
+	return &queue.Meta{
+		Params: queue.MetaParams{
+			Command:   "watch",
+			WatchDir:  queue.WatchDirs(absWatchDirs),
+			Recursive: recursive,
+			ChatID:    cfg.queueChatID(),
+			TopicID:   topicPtr(cfg),
+			WithImage: withImage,
+			WithVideo: withVideo,
+			WithAudio: withAudio,
+			WithAll:   withAll,
+			Include:   include,
+			Exclude:   exclude,
+		},
+	}
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
+	"github.com/spf13/cobra"
+)
+
+func newZipCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "zip",
+		Short: "Inspect zip files before sending them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newZipCheckCmd())
+	cmd.AddCommand(newZipListCmd())
+	return cmd
+}
+
+func newZipCheckCmd() *cobra.Command {
+	zipFiles := &stringSlice{}
+	zipPasses := &stringSlice{}
+	var zipPassFile string
+	var allEntries bool
+
+	cmd := &cobra.Command{
+		Use:   "check [zip files...]",
+		Short: "Report whether the given passwords open each zip, its encryption and entry counts",
+		Long: "check opens every zip without sending anything and prints its entries, size and encryption.\n" +
+			"For encrypted zips it tries the passwords on the smallest encrypted entry and names the one that\n" +
+			"opens it (by its position: --zip-pass values first, then --zip-pass-file lines). --all-entries tries\n" +
+			"every encrypted entry, which reads the whole archive. It fails when a zip cannot be read or opened.",
+		Example:      "  telegram-send-go zip check --zip-file photos.zip --zip-pass-file pw.txt",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths := append(zipFiles.Values(), args...)
+			if len(paths) == 0 {
+				return fmt.Errorf("zip-file is required")
+			}
+			passwords, err := loadZipPasswords(zipPasses.Values(), zipPassFile)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, path := range paths {
+				if err := checkZip(cmd.OutOrStdout(), path, passwords, allEntries); err != nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: %v\n", path, err)
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d zip file(s) failed the check", failed, len(paths))
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Var(zipFiles, "zip-file", "Zip file path (repeatable or comma-separated)")
+	flags.Var(zipPasses, "zip-pass", "Zip password (repeatable or comma-separated)")
+	flags.StringVar(&zipPassFile, "zip-pass-file", "", "Path to file with zip passwords (one per line)")
+	flags.BoolVar(&allEntries, "all-entries", false, "Try the passwords on every encrypted entry instead of the smallest one")
+	return cmd
+}
+
+// checkZip prints the report of one zip and returns an error when it cannot
+// be read or no password opens it.
+func checkZip(out io.Writer, path string, passwords []string, allEntries bool) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	files := 0
+	dirs := 0
+	size := int64(0)
+	encrypted := []*zip.File{}
+	methods := map[string]int{}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			dirs++
+			continue
+		}
+		files++
+		size += int64(file.UncompressedSize64)
+		if ziputil.IsEncrypted(file) {
+			encrypted = append(encrypted, file)
+			methods[ziputil.Encryption(file)]++
+		}
+	}
+	fmt.Fprintf(out, "%s: %d file(s), %d dir(s), %s, %s\n", path, files, dirs, formatBytes(size), describeEncryption(len(encrypted), files, methods))
+	if len(encrypted) == 0 {
+		return nil
+	}
+	if len(passwords) == 0 {
+		return fmt.Errorf("encrypted but no passwords given")
+	}
+
+	if !allEntries {
+		smallest := encrypted[0]
+		for _, file := range encrypted[1:] {
+			if file.CompressedSize64 < smallest.CompressedSize64 {
+				smallest = file
+			}
+		}
+		idx, err := ziputil.MatchPassword(smallest, passwords)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", smallest.Name, err)
+		}
+		if idx < 0 {
+			return fmt.Errorf("none of %d password(s) opens %s", len(passwords), smallest.Name)
+		}
+		fmt.Fprintf(out, "  password %d of %d opens %s\n", idx+1, len(passwords), smallest.Name)
+		return nil
+	}
+
+	opened := map[int]int{}
+	unopened := []string{}
+	for _, file := range encrypted {
+		idx, err := ziputil.MatchPassword(file, passwords)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file.Name, err)
+		}
+		if idx < 0 {
+			unopened = append(unopened, file.Name)
+			continue
+		}
+		opened[idx]++
+	}
+	indexes := make([]int, 0, len(opened))
+	for idx := range opened {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		fmt.Fprintf(out, "  password %d of %d opens %d of %d encrypted file(s)\n", idx+1, len(passwords), opened[idx], len(encrypted))
+	}
+	if len(unopened) > 0 {
+		for _, name := range unopened {
+			fmt.Fprintf(out, "  no password opens %s\n", name)
+		}
+		return fmt.Errorf("%d encrypted file(s) cannot be opened", len(unopened))
+	}
+	return nil
+}
+
+func describeEncryption(encrypted int, files int, methods map[string]int) string {
+	if encrypted == 0 {
+		return "not encrypted"
+	}
+	names := make([]string, 0, len(methods))
+	for method := range methods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%d of %d encrypted (%s)", encrypted, files, strings.Join(names, ", "))
+}
+
+func newZipListCmd() *cobra.Command {
+	zipFiles := &stringSlice{}
+	includes := &stringSlice{}
+	excludes := &stringSlice{}
+	var withImage bool
+	var withVideo bool
+	var withAudio bool
+	var withFile bool
+	var showSkipped bool
+
+	cmd := &cobra.Command{
+		Use:   "list [zip files...]",
+		Short: "List the zip entries the given filters and type selection would send",
+		Long: "list applies --include, --exclude and the --with-* type selection the way send-mixed does\n" +
+			"(no --with-* flag selects every type; send-images is --with-image) and prints each selected entry\n" +
+			"with its send type and size, then a total. --skipped also lists the other entries and why they\n" +
+			"were left out, to find out why a zip has \"no images found\".",
+		Example:      "  telegram-send-go zip list --zip-file photos.zip --include \"*.png\" --with-image --skipped",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths := append(zipFiles.Values(), args...)
+			if len(paths) == 0 {
+				return fmt.Errorf("zip-file is required")
+			}
+			sel := resolveMixedSelection(withImage, withVideo, withAudio, withFile)
+			for _, path := range paths {
+				if err := listZip(cmd.OutOrStdout(), path, includes.Values(), excludes.Values(), sel, showSkipped); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Var(zipFiles, "zip-file", "Zip file path (repeatable or comma-separated)")
+	flags.Var(includes, "include", "Glob patterns to include (repeatable or comma-separated)")
+	flags.Var(excludes, "exclude", "Glob patterns to exclude (repeatable or comma-separated)")
+	flags.BoolVar(&withImage, "with-image", false, "Select images")
+	flags.BoolVar(&withVideo, "with-video", false, "Select videos")
+	flags.BoolVar(&withAudio, "with-audio", false, "Select audio files")
+	flags.BoolVar(&withFile, "with-file", false, "Select other files (sent as documents)")
+	flags.BoolVar(&showSkipped, "skipped", false, "Also list the entries left out and the reason")
+	return cmd
+}
+
+// listZip prints the entries of the zip at path that the filters select.
+func listZip(out io.Writer, path string, include []string, exclude []string, sel mixedSelection, showSkipped bool) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	fmt.Fprintf(out, "%s:\n", path)
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	selected := 0
+	files := 0
+	size := int64(0)
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		files++
+		name := filepath.ToSlash(file.Name)
+		reason := ""
+		sendType := mixedSendType(name, sel)
+		switch {
+		case !matchesInclude(name, include):
+			reason = "not included"
+		case matchesExclude(name, exclude):
+			reason = "excluded"
+		case sendType == "":
+			reason = "type not selected"
+		}
+		if reason != "" {
+			if showSkipped {
+				fmt.Fprintf(table, "  skip\t%s\t%s\t%s\n", formatBytes(int64(file.UncompressedSize64)), name, reason)
+			}
+			continue
+		}
+		selected++
+		size += int64(file.UncompressedSize64)
+		encrypted := ""
+		if ziputil.IsEncrypted(file) {
+			encrypted = "encrypted"
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\t%s\n", sendType, formatBytes(int64(file.UncompressedSize64)), name, encrypted)
+	}
+	table.Flush()
+	fmt.Fprintf(out, "  %d of %d file(s) selected, %s\n", selected, files, formatBytes(size))
+	return nil
+}
@@ -10,17 +10,42 @@ import (
 )
 
 type App struct {
-	ctx context.Context
-	mu  sync.Mutex
-	run *runState
+	ctx       context.Context
+	mu        sync.Mutex
+	runs      map[string]*runState
+	nextRunID int
+	tray      *trayState
+	// window is where the window was when the GUI last closed.
+	window *gui.WindowState
+
+	stopReload context.CancelFunc
+	// starting is cancelled at shutdown so that runs still resolving their
+	// chat give up.
+	starting     context.Context
+	stopStarting context.CancelFunc
 }
 
 func NewApp() *App {
-	return &App{}
+	starting, stopStarting := context.WithCancel(context.Background())
+	return &App{runs: map[string]*runState{}, starting: starting, stopStarting: stopStarting}
 }
 
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.restoreWindow(a.window)
+	a.startTray()
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	a.stopReload = stopReload
+	go a.watchSettingsFile(reloadCtx)
+}
+
+func (a *App) shutdown(ctx context.Context) {
+	if a.stopReload != nil {
+		a.stopReload()
+	}
+	a.stopStarting()
+	a.stopAll()
+	a.stopTray()
 }
 
 type SettingsBundle struct {
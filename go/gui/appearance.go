@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/wailsapp/wails/v2/pkg/options"
+	"github.com/wailsapp/wails/v2/pkg/options/mac"
+	"github.com/wailsapp/wails/v2/pkg/options/windows"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Appearance is the look of the GUI, sent to the frontend on the
+// "appearance" event when the settings file changes.
+type Appearance struct {
+	Theme     string  `json:"theme"`
+	FontScale float64 `json:"font_scale"`
+}
+
+// SetTheme saves the theme, system, dark or light, and applies it to the
+// window. The frontend styles the page itself.
+func (a *App) SetTheme(theme string) error {
+	theme, err := gui.ParseTheme(theme)
+	if err != nil {
+		return err
+	}
+	if _, err := gui.UpdateSettings("", func(settings *gui.Settings) { settings.Theme = theme }); err != nil {
+		return err
+	}
+	a.applyTheme(theme)
+	return nil
+}
+
+// SetFontScale saves the text size multiplier and returns it as saved,
+// within gui.MinFontScale and gui.MaxFontScale.
+func (a *App) SetFontScale(scale float64) (float64, error) {
+	settings, err := gui.UpdateSettings("", func(settings *gui.Settings) { settings.FontScale = scale })
+	if err != nil {
+		return 0, err
+	}
+	return settings.FontScale, nil
+}
+
+func (a *App) applyTheme(theme string) {
+	if a.ctx == nil {
+		return
+	}
+	switch theme {
+	case gui.ThemeDark:
+		runtime.WindowSetDarkTheme(a.ctx)
+	case gui.ThemeLight:
+		runtime.WindowSetLightTheme(a.ctx)
+	default:
+		runtime.WindowSetSystemDefaultTheme(a.ctx)
+	}
+}
+
+// applyAppearance applies settings changed outside the GUI, such as a
+// hand-edited settings file.
+func (a *App) applyAppearance(settings gui.Settings) {
+	a.applyTheme(settings.Theme)
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "appearance", Appearance{Theme: settings.Theme, FontScale: settings.FontScale})
+	}
+}
+
+// windowOptions opens the window with the size, state and theme of the
+// last session. The position is restored by restoreWindow once it exists.
+func windowOptions(app *options.App, settings gui.Settings) {
+	app.Width = gui.DefaultWindowWidth
+	app.Height = gui.DefaultWindowHeight
+	if window := settings.Window; window != nil {
+		app.Width = window.Width
+		app.Height = window.Height
+		if window.Maximised {
+			app.WindowStartState = options.Maximised
+		}
+	}
+	switch settings.Theme {
+	case gui.ThemeDark:
+		app.Windows = &windows.Options{Theme: windows.Dark}
+		app.Mac = &mac.Options{Appearance: mac.NSAppearanceNameDarkAqua}
+	case gui.ThemeLight:
+		app.Windows = &windows.Options{Theme: windows.Light}
+		app.Mac = &mac.Options{Appearance: mac.NSAppearanceNameAqua}
+	}
+}
+
+// restoreWindow moves the window to where it was when the GUI last closed,
+// unless that is off the screen, say after a monitor was unplugged.
+func (a *App) restoreWindow(window *gui.WindowState) {
+	if window == nil || window.Maximised || a.ctx == nil {
+		return
+	}
+	screens, err := runtime.ScreenGetAll(a.ctx)
+	if err != nil {
+		return
+	}
+	for _, screen := range screens {
+		if !screen.IsCurrent {
+			continue
+		}
+		if window.X < 0 || window.Y < 0 || window.X >= screen.Size.Width || window.Y >= screen.Size.Height {
+			return
+		}
+	}
+	runtime.WindowSetPosition(a.ctx, window.X, window.Y)
+}
+
+// beforeClose saves the window's size and position for the next launch. It
+// never cancels the close.
+func (a *App) beforeClose(ctx context.Context) bool {
+	maximised := runtime.WindowIsMaximised(ctx)
+	x, y := runtime.WindowGetPosition(ctx)
+	width, height := runtime.WindowGetSize(ctx)
+	_, err := gui.UpdateSettings("", func(settings *gui.Settings) {
+		state := gui.WindowState{X: x, Y: y, Width: width, Height: height, Maximised: maximised}
+		if maximised && settings.Window != nil {
+			// Keep the size and place to return to when unmaximised.
+			state.X, state.Y = settings.Window.X, settings.Window.Y
+			state.Width, state.Height = settings.Window.Width, settings.Window.Height
+		}
+		settings.Window = &state
+	})
+	if err != nil {
+		log.Printf("save window state failed: %v", err)
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+)
+
+type ChatOption struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	IsForum  bool   `json:"is_forum"`
+}
+
+type TopicOption struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (a *App) ListChats(cfg gui.TelegramConfig) ([]ChatOption, error) {
+	client, err := buildClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chats, err := client.DiscoverChats()
+	if err != nil {
+		return nil, err
+	}
+	options := make([]ChatOption, 0, len(chats))
+	for _, chat := range chats {
+		options = append(options, ChatOption{
+			ID:       strconv.FormatInt(chat.ID, 10),
+			Title:    chat.DisplayName(),
+			Type:     chat.Type,
+			Username: chat.Username,
+			IsForum:  chat.IsForum,
+		})
+	}
+	return options, nil
+}
+
+func (a *App) ListTopics(cfg gui.TelegramConfig, chatID string) ([]TopicOption, error) {
+	if chatID == "" {
+		return nil, errors.New("chat_id is required")
+	}
+	client, err := buildClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	topics, err := client.DiscoverTopics(chatID)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]TopicOption, 0, len(topics))
+	for _, topic := range topics {
+		options = append(options, TopicOption{ID: topic.ThreadID, Name: topic.Name})
+	}
+	return options, nil
+}
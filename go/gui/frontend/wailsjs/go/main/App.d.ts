@@ -2,28 +2,48 @@
 // This file is automatically generated. DO NOT EDIT
 import {gui, main} from '../models';
 
+export function ListChats(arg1:gui.TelegramConfig):Promise<Array<main.ChatOption>>;
+
+export function ListRuns():Promise<Array<main.RunStatus>>;
+
+export function ListTopics(arg1:gui.TelegramConfig,arg2:string):Promise<Array<main.TopicOption>>;
+
 export function LoadSettings():Promise<main.SettingsBundle>;
 
 export function LoadTelegramConfig(arg1:string):Promise<gui.TelegramConfig>;
 
-export function PauseRun():Promise<void>;
+export function Locale():Promise<main.Locale>;
+
+export function PauseRun(arg1:string):Promise<void>;
 
 export function PickDirectory(arg1:string,arg2:string):Promise<string>;
 
 export function PickFile(arg1:string,arg2:string):Promise<string>;
 
-export function QueueStats():Promise<Record<string, number>>;
+export function QueueStats(arg1:string):Promise<Record<string, number>>;
 
-export function ResumeRun():Promise<void>;
+export function ResumeRun(arg1:string):Promise<void>;
 
-export function RunStatus():Promise<main.RunStatus>;
+export function RunStatus(arg1:string):Promise<main.RunStatus>;
 
 export function SaveSettings(arg1:main.SettingsBundle):Promise<void>;
 
-export function StartRun(arg1:main.SettingsBundle):Promise<void>;
+export function SetFontScale(arg1:number):Promise<number>;
+
+export function SetLanguage(arg1:string):Promise<main.Locale>;
+
+export function SetTheme(arg1:string):Promise<void>;
+
+export function StartRun(arg1:main.SettingsBundle):Promise<string>;
+
+export function StartSendFiles(arg1:main.SettingsBundle,arg2:main.SendFilesRequest):Promise<string>;
+
+export function StartSendImages(arg1:main.SettingsBundle,arg2:main.SendImagesRequest):Promise<string>;
+
+export function StopRun(arg1:string):Promise<void>;
 
-export function StartSendFiles(arg1:main.SettingsBundle,arg2:main.SendFilesRequest):Promise<void>;
+export function UploadHistory(arg1:number):Promise<Array<gui.HistoryRecord>>;
 
-export function StartSendImages(arg1:main.SettingsBundle,arg2:main.SendImagesRequest):Promise<void>;
+export function UploadStats(arg1:number):Promise<Array<gui.DailyStats>>;
 
-export function StopRun():Promise<void>;
+export function ValidateTokens(arg1:gui.TelegramConfig):Promise<Array<main.TokenStatus>>;
@@ -2,6 +2,18 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ListChats(arg1) {
+  return window['go']['main']['App']['ListChats'](arg1);
+}
+
+export function ListRuns() {
+  return window['go']['main']['App']['ListRuns']();
+}
+
+export function ListTopics(arg1, arg2) {
+  return window['go']['main']['App']['ListTopics'](arg1, arg2);
+}
+
 export function LoadSettings() {
   return window['go']['main']['App']['LoadSettings']();
 }
@@ -10,8 +22,12 @@ export function LoadTelegramConfig(arg1) {
   return window['go']['main']['App']['LoadTelegramConfig'](arg1);
 }
 
-export function PauseRun() {
-  return window['go']['main']['App']['PauseRun']();
+export function Locale() {
+  return window['go']['main']['App']['Locale']();
+}
+
+export function PauseRun(arg1) {
+  return window['go']['main']['App']['PauseRun'](arg1);
 }
 
 export function PickDirectory(arg1, arg2) {
@@ -22,22 +38,34 @@ export function PickFile(arg1, arg2) {
   return window['go']['main']['App']['PickFile'](arg1, arg2);
 }
 
-export function QueueStats() {
-  return window['go']['main']['App']['QueueStats']();
+export function QueueStats(arg1) {
+  return window['go']['main']['App']['QueueStats'](arg1);
 }
 
-export function ResumeRun() {
-  return window['go']['main']['App']['ResumeRun']();
+export function ResumeRun(arg1) {
+  return window['go']['main']['App']['ResumeRun'](arg1);
 }
 
-export function RunStatus() {
-  return window['go']['main']['App']['RunStatus']();
+export function RunStatus(arg1) {
+  return window['go']['main']['App']['RunStatus'](arg1);
 }
 
 export function SaveSettings(arg1) {
   return window['go']['main']['App']['SaveSettings'](arg1);
 }
 
+export function SetFontScale(arg1) {
+  return window['go']['main']['App']['SetFontScale'](arg1);
+}
+
+export function SetLanguage(arg1) {
+  return window['go']['main']['App']['SetLanguage'](arg1);
+}
+
+export function SetTheme(arg1) {
+  return window['go']['main']['App']['SetTheme'](arg1);
+}
+
 export function StartRun(arg1) {
   return window['go']['main']['App']['StartRun'](arg1);
 }
@@ -50,6 +78,18 @@ export function StartSendImages(arg1, arg2) {
   return window['go']['main']['App']['StartSendImages'](arg1, arg2);
 }
 
-export function StopRun() {
-  return window['go']['main']['App']['StopRun']();
+export function StopRun(arg1) {
+  return window['go']['main']['App']['StopRun'](arg1);
+}
+
+export function UploadHistory(arg1) {
+  return window['go']['main']['App']['UploadHistory'](arg1);
+}
+
+export function UploadStats(arg1) {
+  return window['go']['main']['App']['UploadStats'](arg1);
+}
+
+export function ValidateTokens(arg1) {
+  return window['go']['main']['App']['ValidateTokens'](arg1);
 }
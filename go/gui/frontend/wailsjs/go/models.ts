@@ -1,5 +1,63 @@
 export namespace gui {
 	
+	export class DailyStats {
+	    date: string;
+	    runs: number;
+	    sent: number;
+	    failed: number;
+	    bytes: number;
+	    success_rate: number;
+	    avg_speed: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DailyStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.date = source["date"];
+	        this.runs = source["runs"];
+	        this.sent = source["sent"];
+	        this.failed = source["failed"];
+	        this.bytes = source["bytes"];
+	        this.success_rate = source["success_rate"];
+	        this.avg_speed = source["avg_speed"];
+	    }
+	}
+	export class HistoryRecord {
+	    id: string;
+	    kind: string;
+	    source: string;
+	    chat_id: string;
+	    topic_id?: number;
+	    started_at: string;
+	    finished_at: string;
+	    duration_sec: number;
+	    sent: number;
+	    failed: number;
+	    bytes: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.kind = source["kind"];
+	        this.source = source["source"];
+	        this.chat_id = source["chat_id"];
+	        this.topic_id = source["topic_id"];
+	        this.started_at = source["started_at"];
+	        this.finished_at = source["finished_at"];
+	        this.duration_sec = source["duration_sec"];
+	        this.sent = source["sent"];
+	        this.failed = source["failed"];
+	        this.bytes = source["bytes"];
+	        this.error = source["error"];
+	    }
+	}
 	export class Settings {
 	    config_path: string;
 	    chat_id: string;
@@ -13,6 +71,8 @@ export namespace gui {
 	    with_all: boolean;
 	    include?: string[];
 	    exclude?: string[];
+	    follow_symlinks: boolean;
+	    include_hidden: boolean;
 	    zip_passwords?: string[];
 	    zip_pass_file: string;
 	    scan_interval_sec: number;
@@ -27,6 +87,11 @@ export namespace gui {
 	    max_dimension: number;
 	    max_bytes: number;
 	    png_start_level: number;
+	    minimize_to_tray: boolean;
+	    language?: string;
+	    theme?: string;
+	    font_scale?: number;
+	    window?: WindowState;
 	
 	    static createFrom(source: any = {}) {
 	        return new Settings(source);
@@ -46,6 +111,8 @@ export namespace gui {
 	        this.with_all = source["with_all"];
 	        this.include = source["include"];
 	        this.exclude = source["exclude"];
+	        this.follow_symlinks = source["follow_symlinks"];
+	        this.include_hidden = source["include_hidden"];
 	        this.zip_passwords = source["zip_passwords"];
 	        this.zip_pass_file = source["zip_pass_file"];
 	        this.scan_interval_sec = source["scan_interval_sec"];
@@ -60,7 +127,30 @@ export namespace gui {
 	        this.max_dimension = source["max_dimension"];
 	        this.max_bytes = source["max_bytes"];
 	        this.png_start_level = source["png_start_level"];
+	        this.minimize_to_tray = source["minimize_to_tray"];
+	        this.language = source["language"];
+	        this.theme = source["theme"];
+	        this.font_scale = source["font_scale"];
+	        this.window = this.convertValues(source["window"], WindowState);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class TelegramConfig {
 	    api_urls: string[];
@@ -76,12 +166,69 @@ export namespace gui {
 	        this.tokens = source["tokens"];
 	    }
 	}
+	export class WindowState {
+	    x: number;
+	    y: number;
+	    width: number;
+	    height: number;
+	    maximised: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new WindowState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.x = source["x"];
+	        this.y = source["y"];
+	        this.width = source["width"];
+	        this.height = source["height"];
+	        this.maximised = source["maximised"];
+	    }
+	}
 
 }
 
 export namespace main {
 	
+	export class ChatOption {
+	    id: string;
+	    title: string;
+	    type: string;
+	    username: string;
+	    is_forum: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChatOption(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.type = source["type"];
+	        this.username = source["username"];
+	        this.is_forum = source["is_forum"];
+	    }
+	}
+	export class Locale {
+	    lang: string;
+	    messages: Record<string, string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new Locale(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.lang = source["lang"];
+	        this.messages = source["messages"];
+	    }
+	}
 	export class RunStatus {
+	    id: string;
+	    kind: string;
+	    started_at: string;
 	    running: boolean;
 	    paused: boolean;
 	    error?: string;
@@ -92,6 +239,9 @@ export namespace main {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.kind = source["kind"];
+	        this.started_at = source["started_at"];
 	        this.running = source["running"];
 	        this.paused = source["paused"];
 	        this.error = source["error"];
@@ -181,6 +331,44 @@ export namespace main {
 		    return a;
 		}
 	}
+	export class TokenStatus {
+	    index: number;
+	    token: string;
+	    valid: boolean;
+	    bot_id: number;
+	    username: string;
+	    first_name: string;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TokenStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.token = source["token"];
+	        this.valid = source["valid"];
+	        this.bot_id = source["bot_id"];
+	        this.username = source["username"];
+	        this.first_name = source["first_name"];
+	        this.error = source["error"];
+	    }
+	}
+	export class TopicOption {
+	    id: number;
+	    name: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TopicOption(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	    }
+	}
 
 }
 
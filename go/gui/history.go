@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// runTally counts what a one-off run delivered, for its history record.
+type runTally struct {
+	mu     sync.Mutex
+	sent   int
+	failed int
+	bytes  int64
+}
+
+func (t *runTally) add(ok bool, size int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !ok {
+		t.failed++
+		return
+	}
+	t.sent++
+	t.bytes += size
+}
+
+// UploadHistory returns up to limit finished runs, newest first.
+func (a *App) UploadHistory(limit int) ([]gui.HistoryRecord, error) {
+	path, err := gui.HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	records, err := gui.LoadHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// UploadStats returns per-day totals for the last days days.
+func (a *App) UploadStats(days int) ([]gui.DailyStats, error) {
+	path, err := gui.HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	records, err := gui.LoadHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	return gui.SummarizeDaily(records, days, time.Now()), nil
+}
+
+// recordHistoryLocked appends the run's summary to the history file and
+// tells the frontend. Watch runs are counted from their queue, one-off runs
+// from their tally. Callers must hold a.mu.
+func (a *App) recordHistoryLocked(run *runState) {
+	finished := time.Now()
+	record := gui.HistoryRecord{
+		ID:          run.id,
+		Kind:        run.kind,
+		Source:      run.source,
+		ChatID:      run.chatID,
+		TopicID:     run.topicID,
+		StartedAt:   run.startedAt.UTC().Format(time.RFC3339),
+		FinishedAt:  finished.UTC().Format(time.RFC3339),
+		DurationSec: finished.Sub(run.startedAt).Seconds(),
+		Error:       run.err,
+	}
+	if run.queue != nil {
+		record.Sent, record.Bytes = run.queue.SentSince(run.startedAt)
+		record.Failed = failedSince(run.queue, run.startedAt)
+	} else if run.tally != nil {
+		run.tally.mu.Lock()
+		record.Sent, record.Failed, record.Bytes = run.tally.sent, run.tally.failed, run.tally.bytes
+		run.tally.mu.Unlock()
+	}
+
+	path, err := gui.HistoryPath()
+	if err == nil {
+		err = gui.AppendHistory(path, record)
+	}
+	if err != nil {
+		log.Printf("history not saved: %v", err)
+		return
+	}
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "history", record)
+	}
+}
+
+func failedSince(q *queue.Queue, since time.Time) int {
+	count := 0
+	for _, item := range q.RecentFailed(0) {
+		updatedAt, err := time.Parse(time.RFC3339Nano, item.UpdatedAt)
+		if err == nil && !updatedAt.Before(since) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Locale is the selected language and the frontend's strings in it, taken
+// from the catalog the CLI uses so both switch language together. The
+// strings take %s and %d in order, or %[n]s for the nth argument.
+type Locale struct {
+	Lang     string            `json:"lang"`
+	Messages map[string]string `json:"messages"`
+}
+
+func currentLocale() Locale {
+	return Locale{Lang: i18n.Lang(), Messages: i18n.Messages("ui.")}
+}
+
+// Locale returns the selected language and the frontend's strings.
+func (a *App) Locale() Locale {
+	return currentLocale()
+}
+
+// SetLanguage saves and selects the language of the window, the tray menu
+// and the messages runs post to Telegram, and returns the new locale.
+func (a *App) SetLanguage(lang string) (Locale, error) {
+	lang, err := i18n.Parse(lang)
+	if err != nil {
+		return Locale{}, err
+	}
+	if _, err := gui.UpdateSettings("", func(settings *gui.Settings) { settings.Language = lang }); err != nil {
+		return Locale{}, err
+	}
+	if err := i18n.SetLang(lang); err != nil {
+		return Locale{}, err
+	}
+	return currentLocale(), nil
+}
+
+// emitLocale tells the frontend the language changed outside it.
+func (a *App) emitLocale() {
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "locale", currentLocale())
+	}
+}
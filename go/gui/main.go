@@ -4,6 +4,8 @@ import (
 	"embed"
 	"log"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
@@ -14,16 +16,28 @@ var assets embed.FS
 
 func main() {
 	app := NewApp()
-	if err := wails.Run(&options.App{
-		Title:       "Telegram Upload Watcher",
-		Width:       1000,
-		Height:      900,
-		AssetServer: &assetserver.Options{Assets: assets},
-		OnStartup:   app.startup,
+	settings, err := gui.LoadSettings("")
+	if err != nil {
+		log.Printf("load settings failed: %v", err)
+		settings = gui.DefaultSettings()
+	}
+	if err := i18n.SetLang(settings.Language); err != nil {
+		log.Printf("load settings: %v", err)
+	}
+	app.window = settings.Window
+	appOptions := &options.App{
+		Title:             "Telegram Upload Watcher",
+		AssetServer:       &assetserver.Options{Assets: assets},
+		HideWindowOnClose: settings.MinimizeToTray,
+		OnStartup:         app.startup,
+		OnBeforeClose:     app.beforeClose,
+		OnShutdown:        app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
-	}); err != nil {
+	}
+	windowOptions(appOptions, settings)
+	if err := wails.Run(appOptions); err != nil {
 		log.Fatal(err)
 	}
 }
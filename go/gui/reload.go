@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const settingsPollInterval = 2 * time.Second
+
+func (a *App) watchSettingsFile(ctx context.Context) {
+	path, err := gui.SettingsPath()
+	if err != nil {
+		return
+	}
+	runcontrol.WatchFile(ctx, path, settingsPollInterval, a.reloadSettings)
+}
+
+// reloadSettings applies the language, the appearance and safe changes
+// from the settings file to running watches. Source, destination and queue changes are
+// reported and skipped.
+func (a *App) reloadSettings() {
+	next, err := gui.LoadSettings("")
+	if err != nil {
+		log.Printf("settings reload failed: %v", err)
+		return
+	}
+	previous := i18n.Lang()
+	if err := i18n.SetLang(next.Language); err != nil {
+		log.Printf("settings reload: %v", err)
+	}
+	if i18n.Lang() != previous {
+		a.emitLocale()
+	}
+	a.applyAppearance(next)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, run := range a.runs {
+		if run.kind != runKindWatch {
+			continue
+		}
+		merged, rejected := gui.MergeSafeSettings(run.settings, next)
+		if len(rejected) > 0 {
+			a.reportReloadLocked(run, fmt.Sprintf("settings change to %s needs a restart of this run", strings.Join(rejected, ", ")))
+		}
+		if reflect.DeepEqual(merged, run.settings) {
+			continue
+		}
+		watchCfg, sendCfg, notifyCfg, meta, err := watchRunConfigs(merged)
+		if err != nil {
+			a.reportReloadLocked(run, fmt.Sprintf("settings change not applied: %v", err))
+			continue
+		}
+		run.watchLive.Store(watchCfg)
+		sendCfg.ChatID = run.sendChatID
+		run.sendLive.Store(sendCfg)
+		run.notifyLive.Store(notifyCfg)
+		if err := run.queue.UpdateMeta(meta); err != nil {
+			a.reportReloadLocked(run, fmt.Sprintf("queue metadata update failed: %v", err))
+		}
+		run.settings = merged
+		log.Printf("run %s: applied settings change", run.id)
+	}
+}
+
+func (a *App) reportReloadLocked(run *runState, message string) {
+	log.Printf("run %s: %s", run.id, message)
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "run-error:"+run.id, message)
+	}
+}
@@ -3,49 +3,193 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/chatid"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/notify"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+const (
+	runKindWatch      = "watch"
+	runKindSendImages = "send-images"
+	runKindSendFiles  = "send-files"
+)
+
 type runState struct {
+	id        string
+	kind      string
+	startedAt time.Time
 	ctx       context.Context
 	cancel    context.CancelFunc
 	pauseGate *runcontrol.PauseGate
 	queue     *queue.Queue
+	queueFile string
 	paused    bool
+
+	// History record fields: what the run sent from where to where, and
+	// for one-off runs the tally they fill in and the error they ended with.
+	source  string
+	chatID  string
+	topicID *int
+	tally   *runTally
+	err     string
+
+	// Watch runs only: the settings they were started with, their chat
+	// resolved to a numeric ID and the live configs a settings reload
+	// updates.
+	settings   gui.Settings
+	sendChatID string
+	watchLive  *runcontrol.Live[watcher.Config]
+	sendLive   *runcontrol.Live[sender.Config]
+	notifyLive *runcontrol.Live[notify.Config]
 }
 
 type RunStatus struct {
-	Running bool   `json:"running"`
-	Paused  bool   `json:"paused"`
-	Error   string `json:"error,omitempty"`
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	StartedAt string `json:"started_at"`
+	Running   bool   `json:"running"`
+	Paused    bool   `json:"paused"`
+	Error     string `json:"error,omitempty"`
 }
 
-func (a *App) StartRun(bundle SettingsBundle) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	if a.run != nil {
-		return errors.New("run already active")
+func (r *runState) status() RunStatus {
+	return RunStatus{
+		ID:        r.id,
+		Kind:      r.kind,
+		StartedAt: r.startedAt.Format(time.RFC3339),
+		Running:   true,
+		Paused:    r.paused,
+	}
+}
+
+// newRunLocked registers a run under a fresh ID. Callers must hold a.mu.
+func (a *App) newRunLocked(kind string, q *queue.Queue, queueFile string, source string, settings gui.Settings) *runState {
+	if a.runs == nil {
+		a.runs = map[string]*runState{}
+	}
+	a.nextRunID++
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &runState{
+		id:        fmt.Sprintf("%s-%d", kind, a.nextRunID),
+		kind:      kind,
+		startedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+		pauseGate: runcontrol.NewPauseGate(),
+		queue:     q,
+		queueFile: queueFile,
+		source:    source,
+		chatID:    settings.ChatID,
+		topicID:   settings.TopicID,
 	}
+	if q == nil {
+		run.tally = &runTally{}
+	}
+	a.runs[run.id] = run
+	return run
+}
+
+func (a *App) StartRun(bundle SettingsBundle) (string, error) {
 	settings := bundle.Settings
 	if settings.ChatID == "" {
-		return errors.New("chat_id is required")
+		return "", errors.New("chat_id is required")
 	}
 	if settings.WatchDir == "" {
-		return errors.New("watch_dir is required")
+		return "", errors.New("watch_dir is required")
+	}
+	queueFile := settings.QueueFile
+	if queueFile == "" {
+		dir, err := statedir.Resolve("")
+		if err != nil {
+			return "", err
+		}
+		absWatchDir, err := filepath.Abs(settings.WatchDir)
+		if err != nil {
+			return "", err
+		}
+		queueFile = statedir.WatchQueuePath(dir, []string{absWatchDir}, settings.ChatID, settings.TopicID)
+	}
+
+	absQueueFile, err := filepath.Abs(queueFile)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	err = a.checkQueueFileLocked(queueFile, absQueueFile)
+	a.mu.Unlock()
+	if err != nil {
+		return "", err
 	}
-	if settings.QueueFile == "" {
-		settings.QueueFile = "queue.jsonl"
+
+	watchCfg, sendCfg, notifyCfg, meta, err := watchRunConfigs(settings)
+	if err != nil {
+		return "", err
 	}
+
+	client, err := buildClient(bundle.Telegram)
+	if err != nil {
+		return "", err
+	}
+	chatID, err := chatid.Resolve(a.starting, client, "", settings.ChatID)
+	if err != nil {
+		return "", err
+	}
+	sendCfg.ChatID = chatID
+
+	q, err := queue.New(absQueueFile, meta)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.starting.Err(); err != nil {
+		q.Close()
+		return "", err
+	}
+	if err := a.checkQueueFileLocked(queueFile, absQueueFile); err != nil {
+		q.Close()
+		return "", err
+	}
+	run := a.newRunLocked(runKindWatch, q, absQueueFile, settings.WatchDir, settings)
+	run.settings = settings
+	run.sendChatID = chatID
+	run.watchLive = runcontrol.NewLive(watchCfg)
+	run.sendLive = runcontrol.NewLive(sendCfg)
+	run.notifyLive = runcontrol.NewLive(notifyCfg)
+	a.emitRunStatusLocked(run.status())
+
+	go watcher.WatchLoopLive(run.ctx, run.watchLive, q, run.pauseGate)
+	go sender.LoopLive(run.ctx, run.sendLive, q, client, run.pauseGate, a.progressReporter(run.id))
+	go notify.LoopLive(run.ctx, run.notifyLive, q, client, chatID, settings.TopicID)
+	return run.id, nil
+}
+
+// checkQueueFileLocked fails when a run already uses the queue file.
+// Callers must hold a.mu.
+func (a *App) checkQueueFileLocked(queueFile string, absQueueFile string) error {
+	for _, run := range a.runs {
+		if run.queueFile == absQueueFile {
+			return fmt.Errorf("queue file %s is already used by run %s", queueFile, run.id)
+		}
+	}
+	return nil
+}
+
+func watchRunConfigs(settings gui.Settings) (watcher.Config, sender.Config, notify.Config, *queue.Meta, error) {
 	if settings.WithAll {
 		settings.WithImage = true
 		settings.WithVideo = true
@@ -57,7 +201,7 @@ func (a *App) StartRun(bundle SettingsBundle) error {
 
 	absWatchDir, err := filepath.Abs(settings.WatchDir)
 	if err != nil {
-		return err
+		return watcher.Config{}, sender.Config{}, notify.Config{}, nil, err
 	}
 	meta := &queue.Meta{
 		Params: queue.MetaParams{
@@ -75,38 +219,32 @@ func (a *App) StartRun(bundle SettingsBundle) error {
 		},
 	}
 
-	q, err := queue.New(settings.QueueFile, meta)
-	if err != nil {
-		return err
-	}
-
 	zipPasswords, err := gui.LoadZipPasswords(settings.ZipPasswords, settings.ZipPassFile)
 	if err != nil {
-		return err
-	}
-
-	client, err := buildClient(bundle.Telegram)
-	if err != nil {
-		return err
+		return watcher.Config{}, sender.Config{}, notify.Config{}, nil, err
 	}
 
+	unreadable := &fswalk.Unreadable{}
 	watchCfg := watcher.Config{
-		Root:          absWatchDir,
-		Recursive:     settings.Recursive,
-		IncludeGlobs:  settings.Include,
-		ExcludeGlobs:  settings.Exclude,
-		WithImage:     settings.WithImage,
-		WithVideo:     settings.WithVideo,
-		WithAudio:     settings.WithAudio,
-		WithAll:       settings.WithAll,
-		ScanInterval:  time.Duration(settings.ScanIntervalSec) * time.Second,
-		SettleSeconds: settings.SettleSeconds,
+		Root:           absWatchDir,
+		Recursive:      settings.Recursive,
+		IncludeGlobs:   settings.Include,
+		ExcludeGlobs:   settings.Exclude,
+		WithImage:      settings.WithImage,
+		WithVideo:      settings.WithVideo,
+		WithAudio:      settings.WithAudio,
+		WithAll:        settings.WithAll,
+		ScanInterval:   time.Duration(settings.ScanIntervalSec) * time.Second,
+		SettleSeconds:  settings.SettleSeconds,
+		FollowSymlinks: settings.FollowSymlinks,
+		IncludeHidden:  settings.IncludeHidden,
+		Unreadable:     unreadable,
 	}
 
 	sendCfg := sender.Config{
 		ChatID:        settings.ChatID,
 		TopicID:       settings.TopicID,
-		GroupSize:     settings.GroupSize,
+		GroupSize:     checkGroupSize(settings.GroupSize),
 		SendInterval:  time.Duration(settings.SendIntervalSec) * time.Second,
 		BatchDelay:    time.Duration(settings.BatchDelaySec) * time.Second,
 		PauseEvery:    settings.PauseEvery,
@@ -125,104 +263,164 @@ func (a *App) StartRun(bundle SettingsBundle) error {
 		Enabled:      settings.NotifyEnabled,
 		Interval:     time.Duration(settings.NotifyIntervalSec) * time.Second,
 		NotifyOnIdle: true,
+		Unreadable:   unreadable,
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	pauseGate := runcontrol.NewPauseGate()
-	a.run = &runState{
-		ctx:       ctx,
-		cancel:    cancel,
-		pauseGate: pauseGate,
-		queue:     q,
-		paused:    false,
-	}
-
-	runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: true})
-
-	go watcher.WatchLoopWithContext(ctx, watchCfg, q, pauseGate)
-	go sender.LoopWithContext(ctx, sendCfg, q, client, pauseGate, a.emitProgress)
-	if notifyCfg.Enabled {
-		go notify.LoopWithContext(ctx, notifyCfg, q, client, settings.ChatID, settings.TopicID)
-	}
-	return nil
+	return watchCfg, sendCfg, notifyCfg, meta, nil
 }
 
-func (a *App) StartSendImages(bundle SettingsBundle, req SendImagesRequest) error {
-	return a.startOneOff(bundle, func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client) error {
-		return sendImages(ctx, client, bundle, req, pause, a.emitProgress)
+func (a *App) StartSendImages(bundle SettingsBundle, req SendImagesRequest) (string, error) {
+	source := firstNonEmpty(req.ImageDir, req.ZipFile)
+	return a.startOneOff(runKindSendImages, bundle, source, func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client, report func(sender.ProgressUpdate), tally *runTally) error {
+		return sendImages(ctx, client, bundle, req, pause, report, tally)
 	})
 }
 
-func (a *App) StartSendFiles(bundle SettingsBundle, req SendFilesRequest) error {
-	return a.startOneOff(bundle, func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client) error {
-		return sendFiles(ctx, client, bundle, req, pause, a.emitProgress)
+func (a *App) StartSendFiles(bundle SettingsBundle, req SendFilesRequest) (string, error) {
+	source := firstNonEmpty(req.FilePath, req.DirPath, req.ZipFile)
+	return a.startOneOff(runKindSendFiles, bundle, source, func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client, report func(sender.ProgressUpdate), tally *runTally) error {
+		return sendFiles(ctx, client, bundle, req, pause, report, tally)
 	})
 }
 
-func (a *App) PauseRun() error {
+func (a *App) PauseRun(runID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.run == nil {
-		return errors.New("no active run")
-	}
-	if a.run.paused {
-		return nil
+	run, ok := a.runs[runID]
+	if !ok {
+		return fmt.Errorf("run %s is not active", runID)
 	}
-	a.run.paused = true
-	a.run.pauseGate.Pause()
-	runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: true, Paused: true})
+	a.pauseLocked(run)
 	return nil
 }
 
-func (a *App) ResumeRun() error {
+func (a *App) ResumeRun(runID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.run == nil {
-		return errors.New("no active run")
-	}
-	if !a.run.paused {
-		return nil
+	run, ok := a.runs[runID]
+	if !ok {
+		return fmt.Errorf("run %s is not active", runID)
 	}
-	a.run.paused = false
-	a.run.pauseGate.Resume()
-	runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: true, Paused: false})
+	a.resumeLocked(run)
 	return nil
 }
 
-func (a *App) StopRun() error {
+func (a *App) StopRun(runID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.run == nil {
+	run, ok := a.runs[runID]
+	if !ok {
 		return nil
 	}
-	a.run.pauseGate.Resume()
-	a.run.cancel()
-	a.run.queue.Close()
-	a.run = nil
-	runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: false})
+	a.stopLocked(run)
 	return nil
 }
 
-func (a *App) RunStatus() RunStatus {
+func (a *App) RunStatus(runID string) RunStatus {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.run == nil {
-		return RunStatus{Running: false}
+	run, ok := a.runs[runID]
+	if !ok {
+		return RunStatus{ID: runID, Running: false}
 	}
-	return RunStatus{Running: true, Paused: a.run.paused}
+	return run.status()
+}
+
+func (a *App) ListRuns() []RunStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.listRunsLocked()
 }
 
-func (a *App) QueueStats() map[string]int {
+func (a *App) QueueStats(runID string) map[string]int {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.run == nil || a.run.queue == nil {
+	run, ok := a.runs[runID]
+	if !ok || run.queue == nil {
 		return map[string]int{}
 	}
-	return a.run.queue.Stats()
+	return run.queue.Stats()
+}
+
+func (a *App) pauseAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, run := range a.runs {
+		a.pauseLocked(run)
+	}
+}
+
+func (a *App) resumeAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, run := range a.runs {
+		a.resumeLocked(run)
+	}
+}
+
+func (a *App) stopAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, run := range a.runs {
+		a.stopLocked(run)
+	}
 }
 
-func (a *App) emitProgress(update sender.ProgressUpdate) {
-	runtime.EventsEmit(a.ctx, "progress", update)
+func (a *App) pauseLocked(run *runState) {
+	if run.paused {
+		return
+	}
+	run.paused = true
+	run.pauseGate.Pause()
+	a.emitRunStatusLocked(run.status())
+}
+
+func (a *App) resumeLocked(run *runState) {
+	if !run.paused {
+		return
+	}
+	run.paused = false
+	run.pauseGate.Resume()
+	a.emitRunStatusLocked(run.status())
+}
+
+func (a *App) stopLocked(run *runState) {
+	run.pauseGate.Resume()
+	run.cancel()
+	a.recordHistoryLocked(run)
+	if run.queue != nil {
+		run.queue.Close()
+	}
+	delete(a.runs, run.id)
+	a.emitRunStatusLocked(RunStatus{ID: run.id, Kind: run.kind, Running: false})
+}
+
+func (a *App) listRunsLocked() []RunStatus {
+	list := make([]RunStatus, 0, len(a.runs))
+	for _, run := range a.runs {
+		list = append(list, run.status())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt < list[j].StartedAt || list[i].StartedAt == list[j].StartedAt && list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// emitRunStatusLocked publishes the per-run status on "run-status:<id>" and
+// the full run list on "runs". Callers must hold a.mu.
+func (a *App) emitRunStatusLocked(status RunStatus) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "run-status:"+status.ID, status)
+	runtime.EventsEmit(a.ctx, "runs", a.listRunsLocked())
+}
+
+func (a *App) progressReporter(runID string) func(sender.ProgressUpdate) {
+	return func(update sender.ProgressUpdate) {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "progress:"+runID, update)
+		}
+	}
 }
 
 func buildClient(cfg gui.TelegramConfig) (*telegram.Client, error) {
@@ -234,43 +432,43 @@ func buildClient(cfg gui.TelegramConfig) (*telegram.Client, error) {
 	return telegram.NewClient(urlPool, tokenPool), nil
 }
 
-type oneOffJob func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client) error
+type oneOffJob func(ctx context.Context, pause *runcontrol.PauseGate, client *telegram.Client, report func(sender.ProgressUpdate), tally *runTally) error
 
-func (a *App) startOneOff(bundle SettingsBundle, job oneOffJob) error {
-	a.mu.Lock()
-	if a.run != nil {
-		a.mu.Unlock()
-		return errors.New("run already active")
-	}
+func (a *App) startOneOff(kind string, bundle SettingsBundle, source string, job oneOffJob) (string, error) {
 	client, err := buildClient(bundle.Telegram)
 	if err != nil {
-		a.mu.Unlock()
-		return err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	pauseGate := runcontrol.NewPauseGate()
-	a.run = &runState{
-		ctx:       ctx,
-		cancel:    cancel,
-		pauseGate: pauseGate,
-		queue:     nil,
-		paused:    false,
+		return "", err
 	}
+	a.mu.Lock()
+	run := a.newRunLocked(kind, nil, "", source, bundle.Settings)
+	a.emitRunStatusLocked(run.status())
 	a.mu.Unlock()
 
-	runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: true})
-
 	go func() {
-		err := job(ctx, pauseGate, client)
+		err := job(run.ctx, run.pauseGate, client, a.progressReporter(run.id), run.tally)
 		if err != nil && !errors.Is(err, context.Canceled) {
-			runtime.EventsEmit(a.ctx, "run-error", err.Error())
+			a.noteTrayFailure()
+			if a.ctx != nil {
+				runtime.EventsEmit(a.ctx, "run-error:"+run.id, err.Error())
+			}
 		}
 		a.mu.Lock()
-		if a.run != nil && a.run.ctx == ctx {
-			a.run = nil
+		if err != nil && !errors.Is(err, context.Canceled) {
+			run.err = err.Error()
+		}
+		if current, ok := a.runs[run.id]; ok && current == run {
+			a.stopLocked(run)
 		}
 		a.mu.Unlock()
-		runtime.EventsEmit(a.ctx, "run-status", RunStatus{Running: false})
 	}()
-	return nil
+	return run.id, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
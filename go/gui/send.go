@@ -12,7 +12,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/chatid"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
 	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
@@ -55,10 +58,16 @@ func sendImages(
 	req SendImagesRequest,
 	pause *runcontrol.PauseGate,
 	report func(sender.ProgressUpdate),
+	tally *runTally,
 ) error {
 	if settings.Settings.ChatID == "" {
 		return errors.New("chat_id is required")
 	}
+	chatID, err := chatid.Resolve(ctx, client, "", settings.Settings.ChatID)
+	if err != nil {
+		return err
+	}
+	settings.Settings.ChatID = chatID
 	if req.ImageDir == "" && req.ZipFile == "" {
 		return errors.New("image_dir or zip_file is required")
 	}
@@ -70,9 +79,10 @@ func sendImages(
 	if groupSize <= 0 {
 		groupSize = 4
 	}
+	groupSize = checkGroupSize(groupSize)
 	items := []sendItem{}
 	if req.ImageDir != "" {
-		dirItems, err := collectImageItemsFromDir(req.ImageDir, settings.Settings.Include, settings.Settings.Exclude, req.EnableZip, zipPasswords)
+		dirItems, err := collectImageItemsFromDir(req.ImageDir, settings.Settings.Include, settings.Settings.Exclude, walkOptions(settings.Settings), req.EnableZip, zipPasswords)
 		if err != nil {
 			return err
 		}
@@ -102,7 +112,8 @@ func sendImages(
 	}
 
 	retry := telegram.RetryConfig{MaxRetries: 3, Delay: 3 * time.Second}
-	_ = client.SendMessage(settings.Settings.ChatID, fmt.Sprintf("Starting image upload: %d file(s)", len(items)), settings.Settings.TopicID, retry)
+	startID, _ := client.SendMessageID(ctx, settings.Settings.ChatID, i18n.T("gui.start", i18n.T("image"), len(items)), settings.Settings.TopicID, retry)
+	client = client.ThreadRun(startID)
 
 	avgPerFile := int64(0)
 	sent := 0
@@ -126,11 +137,13 @@ func sendImages(
 			data, filename, err := loadSendItem(item, zipPasswords)
 			if err != nil {
 				log.Printf("failed to load image: %v", err)
+				tally.add(false, 0)
 				continue
 			}
 			prepared, err := prepareImageMedia(data, filename, settings.Settings.MaxDimension, settings.Settings.MaxBytes, settings.Settings.PNGStartLevel)
 			if err != nil {
 				log.Printf("invalid image %s: %v", filename, err)
+				tally.add(false, 0)
 				continue
 			}
 			media = append(media, prepared)
@@ -138,8 +151,12 @@ func sendImages(
 		if len(media) == 0 {
 			continue
 		}
-		if err := client.SendMediaGroup(settings.Settings.ChatID, media, settings.Settings.TopicID, retry); err != nil {
-			log.Printf("send media group failed: %v", err)
+		_, errs := client.SendMediaGroupEach(ctx, settings.Settings.ChatID, media, settings.Settings.TopicID, retry)
+		for j, err := range errs {
+			if err != nil {
+				log.Printf("send %s failed: %v", media[j].Filename, err)
+			}
+			tally.add(err == nil, int64(len(media[j].Data)))
 		}
 		perFile := time.Since(startTime).Milliseconds()
 		if len(media) > 0 {
@@ -154,7 +171,7 @@ func sendImages(
 	}
 
 	reportProgress(report, items[len(items)-1], 0, len(items), sent, avgPerFile, &avgPerFile, "completed")
-	_ = client.SendMessage(settings.Settings.ChatID, fmt.Sprintf("Completed image upload (%d file(s))", len(items)), settings.Settings.TopicID, retry)
+	_ = client.SendMessage(ctx, settings.Settings.ChatID, i18n.T("gui.done", i18n.T("image"), len(items)), settings.Settings.TopicID, retry)
 	return nil
 }
 
@@ -165,10 +182,16 @@ func sendFiles(
 	req SendFilesRequest,
 	pause *runcontrol.PauseGate,
 	report func(sender.ProgressUpdate),
+	tally *runTally,
 ) error {
 	if settings.Settings.ChatID == "" {
 		return errors.New("chat_id is required")
 	}
+	chatID, err := chatid.Resolve(ctx, client, "", settings.Settings.ChatID)
+	if err != nil {
+		return err
+	}
+	settings.Settings.ChatID = chatID
 	if req.FilePath == "" && req.DirPath == "" && req.ZipFile == "" {
 		return errors.New("file_path, dir_path, or zip_file is required")
 	}
@@ -185,7 +208,7 @@ func sendFiles(
 		items = append(items, sendItem{sourceType: "file", path: req.FilePath})
 	}
 	if req.DirPath != "" {
-		dirItems, err := collectFileItemsFromDir(req.DirPath, sendType, settings.Settings.Include, settings.Settings.Exclude, req.EnableZip, zipPasswords)
+		dirItems, err := collectFileItemsFromDir(req.DirPath, sendType, settings.Settings.Include, settings.Settings.Exclude, walkOptions(settings.Settings), req.EnableZip, zipPasswords)
 		if err != nil {
 			return err
 		}
@@ -213,7 +236,8 @@ func sendFiles(
 
 	retry := telegram.RetryConfig{MaxRetries: 3, Delay: 3 * time.Second}
 	label := sendTypeLabel(sendType)
-	_ = client.SendMessage(settings.Settings.ChatID, fmt.Sprintf("Starting %s upload: %d file(s)", label, len(items)), settings.Settings.TopicID, retry)
+	startID, _ := client.SendMessageID(ctx, settings.Settings.ChatID, i18n.T("gui.start", i18n.T(label), len(items)), settings.Settings.TopicID, retry)
+	client = client.ThreadRun(startID)
 
 	avgPerFile := int64(0)
 	sent := 0
@@ -229,11 +253,14 @@ func sendFiles(
 		data, filename, err := loadSendItem(item, zipPasswords)
 		if err != nil {
 			log.Printf("failed to read file: %v", err)
+			tally.add(false, 0)
 			continue
 		}
-		if err := sendSingleFile(client, settings.Settings.ChatID, settings.Settings.TopicID, sendType, filename, data, retry); err != nil {
+		err = sendSingleFile(ctx, client, settings.Settings.ChatID, settings.Settings.TopicID, sendType, filename, data, retry)
+		if err != nil {
 			log.Printf("send failed: %v", err)
 		}
+		tally.add(err == nil, int64(len(data)))
 		perFile := time.Since(start).Milliseconds()
 		sent++
 		reportProgress(report, item, len(items)-sent, len(items), sent, perFile, &avgPerFile, "sending")
@@ -243,14 +270,14 @@ func sendFiles(
 	}
 
 	reportProgress(report, items[len(items)-1], 0, len(items), sent, avgPerFile, &avgPerFile, "completed")
-	_ = client.SendMessage(settings.Settings.ChatID, fmt.Sprintf("Completed %s upload (%d file(s))", label, len(items)), settings.Settings.TopicID, retry)
+	_ = client.SendMessage(ctx, settings.Settings.ChatID, i18n.T("gui.done", i18n.T(label), len(items)), settings.Settings.TopicID, retry)
 	return nil
 }
 
-func collectImageItemsFromDir(root string, include []string, exclude []string, enableZip bool, zipPasswords []string) ([]sendItem, error) {
+func collectImageItemsFromDir(root string, include []string, exclude []string, walk fswalk.Options, enableZip bool, zipPasswords []string) ([]sendItem, error) {
 	items := []sendItem{}
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := fswalk.Walk(root, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 		rel, err := filepath.Rel(root, path)
@@ -276,7 +303,7 @@ func collectImageItemsFromDir(root string, include []string, exclude []string, e
 		}
 		return nil
 	})
-	if err != nil {
+	if err := skipUnreadable(root, err); err != nil {
 		return nil, err
 	}
 	return items, nil
@@ -317,11 +344,11 @@ func collectImageItemsFromZip(zipPath string, include []string, exclude []string
 	return items, nil
 }
 
-func collectFileItemsFromDir(root string, sendType string, include []string, exclude []string, enableZip bool, zipPasswords []string) ([]sendItem, error) {
+func collectFileItemsFromDir(root string, sendType string, include []string, exclude []string, walk fswalk.Options, enableZip bool, zipPasswords []string) ([]sendItem, error) {
 	items := []sendItem{}
 	allowed := allowedExtsForType(sendType)
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := fswalk.Walk(root, walk, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
 			return nil
 		}
 		rel, err := filepath.Rel(root, path)
@@ -349,7 +376,7 @@ func collectFileItemsFromDir(root string, sendType string, include []string, exc
 		}
 		return nil
 	})
-	if err != nil {
+	if err := skipUnreadable(root, err); err != nil {
 		return nil, err
 	}
 	return items, nil
@@ -466,18 +493,20 @@ func sleepWithContext(ctx context.Context, d time.Duration) bool {
 	}
 }
 
-func sendSingleFile(client *telegram.Client, chatID string, topicID *int, sendType string, filename string, data []byte, retry telegram.RetryConfig) error {
+func sendSingleFile(ctx context.Context, client *telegram.Client, chatID string, topicID *int, sendType string, filename string, data []byte, retry telegram.RetryConfig) error {
 	file := telegram.MediaFile{Filename: filename, Data: data}
+	var err error
 	switch sendType {
 	case "file":
-		return client.SendDocument(chatID, file, topicID, retry)
+		_, err = client.SendDocument(ctx, chatID, file, topicID, retry)
 	case "video":
-		return client.SendVideo(chatID, file, topicID, retry)
+		_, err = client.SendVideo(ctx, chatID, file, topicID, retry)
 	case "audio":
-		return client.SendAudio(chatID, file, topicID, retry)
+		_, err = client.SendAudio(ctx, chatID, file, topicID, retry)
 	default:
-		return fmt.Errorf("unsupported send type: %s", sendType)
+		err = fmt.Errorf("unsupported send type: %s", sendType)
 	}
+	return err
 }
 
 func allowedExtsForType(sendType string) []string {
@@ -526,6 +555,24 @@ func matchesExclude(rel string, patterns []string) bool {
 	return false
 }
 
+// skipUnreadable logs the paths a walk of root could not read; the GUI
+// sends what it could read.
+func skipUnreadable(root string, err error) error {
+	var unreadable fswalk.Errors
+	if !errors.As(err, &unreadable) {
+		return err
+	}
+	for _, problem := range unreadable {
+		log.Printf("cannot read: %v", problem)
+	}
+	log.Printf("skipped %d unreadable path(s) in %s", len(unreadable), root)
+	return nil
+}
+
+func walkOptions(settings gui.Settings) fswalk.Options {
+	return fswalk.Options{FollowSymlinks: settings.FollowSymlinks, IncludeHidden: settings.IncludeHidden, IgnoreFile: fswalk.DefaultIgnoreFile}
+}
+
 func matchesInclude(rel string, patterns []string) bool {
 	if len(patterns) == 0 {
 		return true
@@ -570,3 +617,13 @@ func prepareImageMedia(data []byte, filename string, maxDimension int, maxBytes
 func maxInt() int {
 	return int(^uint(0) >> 1)
 }
+
+// checkGroupSize clamps an album size to Telegram's 2-10 limit and warns
+// when the configured value had to change.
+func checkGroupSize(size int) int {
+	clamped := telegram.ClampGroupSize(size)
+	if clamped != size {
+		log.Printf("warning: group size %d is outside Telegram's %d-%d album limit, using %d", size, telegram.MinMediaGroupSize, telegram.MaxMediaGroupSize, clamped)
+	}
+	return clamped
+}
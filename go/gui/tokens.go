@@ -0,0 +1,42 @@
+package main
+
+import "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/gui"
+
+type TokenStatus struct {
+	Index     int    `json:"index"`
+	Token     string `json:"token"`
+	Valid     bool   `json:"valid"`
+	BotID     int64  `json:"bot_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (a *App) ValidateTokens(cfg gui.TelegramConfig) ([]TokenStatus, error) {
+	client, err := buildClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]TokenStatus, 0, len(cfg.Tokens))
+	for index, token := range cfg.Tokens {
+		status := TokenStatus{Index: index, Token: maskToken(token)}
+		user, err := client.GetMe(cfg.APIURLs[index%len(cfg.APIURLs)], token)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Valid = true
+			status.BotID = user.ID
+			status.Username = user.Username
+			status.FirstName = user.FirstName
+		}
+		results = append(results, status)
+	}
+	return results, nil
+}
+
+func maskToken(token string) string {
+	if len(token) <= 10 {
+		return "***"
+	}
+	return token[:6] + "..." + token[len(token)-4:]
+}
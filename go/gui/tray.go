@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	goruntime "runtime"
+	"sync"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	trayTitle        = "Telegram Upload Watcher"
+	trayPollInterval = 2 * time.Second
+	trayIconSize     = 32
+)
+
+type trayState struct {
+	mu         sync.Mutex
+	end        func()
+	lastFailed map[*queue.Queue]int
+	unread     int
+	badged     bool
+	// lang is the language the menu is labelled in.
+	lang string
+}
+
+type trayMenu struct {
+	show   *systray.MenuItem
+	pause  *systray.MenuItem
+	resume *systray.MenuItem
+	quit   *systray.MenuItem
+}
+
+func (a *App) startTray() {
+	a.tray = &trayState{lastFailed: map[*queue.Queue]int{}}
+	start, end := systray.RunWithExternalLoop(a.onTrayReady, nil)
+	a.tray.end = end
+	start()
+}
+
+func (a *App) stopTray() {
+	if a.tray == nil || a.tray.end == nil {
+		return
+	}
+	a.tray.end()
+}
+
+func (a *App) onTrayReady() {
+	systray.SetIcon(trayIcon(false))
+	systray.SetTooltip(trayTitle)
+
+	menu := trayMenu{}
+	menu.show = systray.AddMenuItem(i18n.T("tray.show"), i18n.T("tray.show.tooltip"))
+	systray.AddSeparator()
+	menu.pause = systray.AddMenuItem(i18n.T("tray.pauseAll"), i18n.T("tray.pauseAll.tooltip"))
+	menu.resume = systray.AddMenuItem(i18n.T("tray.resumeAll"), i18n.T("tray.resumeAll.tooltip"))
+	systray.AddSeparator()
+	menu.quit = systray.AddMenuItem(i18n.T("tray.quit"), i18n.T("tray.quit.tooltip"))
+	menu.pause.Disable()
+	menu.resume.Disable()
+	a.tray.lang = i18n.Lang()
+
+	ticker := time.NewTicker(trayPollInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-menu.show.ClickedCh:
+				a.clearTrayFailures()
+				if a.ctx != nil {
+					runtime.WindowShow(a.ctx)
+				}
+			case <-menu.pause.ClickedCh:
+				a.pauseAll()
+			case <-menu.resume.ClickedCh:
+				a.resumeAll()
+			case <-menu.quit.ClickedCh:
+				a.stopAll()
+				if a.ctx != nil {
+					runtime.Quit(a.ctx)
+				}
+				return
+			case <-ticker.C:
+			}
+			a.refreshTray(menu)
+		}
+	}()
+}
+
+func (a *App) refreshTray(menu trayMenu) {
+	if lang := i18n.Lang(); lang != a.tray.lang {
+		a.tray.lang = lang
+		menu.label()
+	}
+
+	a.mu.Lock()
+	active := 0
+	paused := 0
+	failed := map[*queue.Queue]int{}
+	for _, run := range a.runs {
+		active++
+		if run.paused {
+			paused++
+		}
+		if run.queue != nil {
+			stats := run.queue.Stats()
+			failed[run.queue] = stats[queue.StatusFailed] + stats[queue.StatusFailedPermanent] + stats[queue.StatusSourceMissing]
+		}
+	}
+	a.mu.Unlock()
+
+	if active > paused {
+		menu.pause.Enable()
+	} else {
+		menu.pause.Disable()
+	}
+	if paused > 0 {
+		menu.resume.Enable()
+	} else {
+		menu.resume.Disable()
+	}
+
+	a.tray.mu.Lock()
+	for q, count := range failed {
+		last, seen := a.tray.lastFailed[q]
+		if seen && count > last {
+			a.tray.unread += count - last
+		}
+		if !seen || count > last {
+			a.tray.lastFailed[q] = count
+		}
+	}
+	for q := range a.tray.lastFailed {
+		if _, ok := failed[q]; !ok {
+			delete(a.tray.lastFailed, q)
+		}
+	}
+	unread := a.tray.unread
+	a.tray.mu.Unlock()
+
+	a.updateTrayBadge(unread, active, paused)
+}
+
+// label titles the menu items in the selected language.
+func (menu trayMenu) label() {
+	menu.show.SetTitle(i18n.T("tray.show"))
+	menu.show.SetTooltip(i18n.T("tray.show.tooltip"))
+	menu.pause.SetTitle(i18n.T("tray.pauseAll"))
+	menu.pause.SetTooltip(i18n.T("tray.pauseAll.tooltip"))
+	menu.resume.SetTitle(i18n.T("tray.resumeAll"))
+	menu.resume.SetTooltip(i18n.T("tray.resumeAll.tooltip"))
+	menu.quit.SetTitle(i18n.T("tray.quit"))
+	menu.quit.SetTooltip(i18n.T("tray.quit.tooltip"))
+}
+
+func (a *App) noteTrayFailure() {
+	if a.tray == nil {
+		return
+	}
+	a.tray.mu.Lock()
+	a.tray.unread++
+	a.tray.mu.Unlock()
+}
+
+func (a *App) clearTrayFailures() {
+	if a.tray == nil {
+		return
+	}
+	a.tray.mu.Lock()
+	a.tray.unread = 0
+	a.tray.mu.Unlock()
+}
+
+func (a *App) updateTrayBadge(unread int, active int, paused int) {
+	state := i18n.T("tray.idle")
+	if active > 0 && paused == active {
+		state = i18n.T("tray.paused", paused)
+	} else if active > 0 {
+		state = i18n.T("tray.running", active-paused)
+		if paused > 0 {
+			state += i18n.T("tray.alsoPaused", paused)
+		}
+	}
+	tooltip := fmt.Sprintf("%s (%s)", trayTitle, state)
+	if unread > 0 {
+		tooltip = fmt.Sprintf("%s (%s%s)", trayTitle, state, i18n.T("tray.newFailures", unread))
+	}
+	systray.SetTooltip(tooltip)
+
+	badged := unread > 0
+	a.tray.mu.Lock()
+	changed := a.tray.badged != badged
+	a.tray.badged = badged
+	a.tray.mu.Unlock()
+	if !changed {
+		return
+	}
+	systray.SetIcon(trayIcon(badged))
+	if badged {
+		systray.SetTitle(fmt.Sprintf("%d", unread))
+	} else {
+		systray.SetTitle("")
+	}
+}
+
+func trayIcon(badge bool) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, trayIconSize, trayIconSize))
+	blue := color.RGBA{R: 0x2a, G: 0xab, B: 0xee, A: 0xff}
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	red := color.RGBA{R: 0xe5, G: 0x3e, B: 0x3e, A: 0xff}
+	center := trayIconSize / 2
+	for y := 0; y < trayIconSize; y++ {
+		for x := 0; x < trayIconSize; x++ {
+			dx := x - center
+			dy := y - center
+			if dx*dx+dy*dy <= (center-1)*(center-1) {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	for y := 7; y <= 24; y++ {
+		for x := center - 2; x < center+2; x++ {
+			img.Set(x, y, white)
+		}
+	}
+	for y := 7; y <= 14; y++ {
+		spread := y - 7
+		for x := center - spread - 1; x <= center+spread; x++ {
+			img.Set(x, y, white)
+		}
+	}
+	if badge {
+		for y := 0; y < 12; y++ {
+			for x := trayIconSize - 12; x < trayIconSize; x++ {
+				dx := x - (trayIconSize - 6)
+				dy := y - 6
+				if dx*dx+dy*dy <= 25 {
+					img.Set(x, y, red)
+				}
+			}
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, img); err != nil {
+		return nil
+	}
+	if goruntime.GOOS == "windows" {
+		return wrapICO(buffer.Bytes(), trayIconSize)
+	}
+	return buffer.Bytes()
+}
+
+// wrapICO embeds a PNG image in a single-entry ICO container, which the
+// Windows tray API requires.
+func wrapICO(pngData []byte, size int) []byte {
+	buffer := &bytes.Buffer{}
+	_ = binary.Write(buffer, binary.LittleEndian, []uint16{0, 1, 1})
+	buffer.WriteByte(byte(size))
+	buffer.WriteByte(byte(size))
+	buffer.WriteByte(0)
+	buffer.WriteByte(0)
+	_ = binary.Write(buffer, binary.LittleEndian, []uint16{1, 32})
+	_ = binary.Write(buffer, binary.LittleEndian, []uint32{uint32(len(pngData)), 22})
+	buffer.Write(pngData)
+	return buffer.Bytes()
+}
@@ -0,0 +1,494 @@
+// Package api serves the daemon's HTTP control API: queue stats, item
+// listing and retries, pause and resume, send delays, immediate scans and
+// Bot API request latency, and the web dashboard built on it.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
+)
+
+// defaultItemLimit is how many items GET .../items returns without ?limit.
+const defaultItemLimit = 100
+
+// maxThroughputMinutes caps the window of GET .../throughput.
+const maxThroughputMinutes = 24 * 60
+
+//go:embed dashboard/index.html
+var dashboard embed.FS
+
+// Job is a running watch job as the API sees it.
+type Job struct {
+	Queue *queue.Queue
+	Send  *runcontrol.Live[sender.Config]
+	Watch []*runcontrol.Live[watcher.Config]
+	Scan  *runcontrol.Trigger
+}
+
+// Delays are a job's timings in seconds. Fields left out of a PATCH keep
+// their current value.
+type Delays struct {
+	ScanInterval *int `json:"scan_interval,omitempty"`
+	SendInterval *int `json:"send_interval,omitempty"`
+	BatchDelay   *int `json:"batch_delay,omitempty"`
+	PauseEvery   *int `json:"pause_every,omitempty"`
+	PauseSeconds *int `json:"pause_seconds,omitempty"`
+}
+
+type JobStatus struct {
+	Queue  map[string]int `json:"queue"`
+	Delays Delays         `json:"delays"`
+}
+
+type StatusResponse struct {
+	Paused bool `json:"paused"`
+	// Reloading is set while a config reload replaces the jobs; Jobs is
+	// empty until it is done.
+	Reloading bool                 `json:"reloading,omitempty"`
+	Jobs      map[string]JobStatus `json:"jobs"`
+}
+
+type ItemsResponse struct {
+	Total int          `json:"total"`
+	Items []queue.Item `json:"items"`
+}
+
+// ThroughputResponse holds the files and bytes sent per minute, oldest
+// minute first; the last bucket is the current, partial minute.
+type ThroughputResponse struct {
+	Start         time.Time `json:"start"`
+	BucketSeconds int       `json:"bucket_seconds"`
+	Files         []int     `json:"files"`
+	Bytes         []int64   `json:"bytes"`
+}
+
+// LatencyResponse holds the stats of the Bot API requests the daemon made,
+// per endpoint and per endpoint and method.
+type LatencyResponse struct {
+	Endpoints []telegram.RequestStats `json:"endpoints"`
+	Requests  []telegram.RequestStats `json:"requests"`
+}
+
+type RetryRequest struct {
+	IDs []string `json:"ids,omitempty"`
+}
+
+type RetryResponse struct {
+	Retried  int      `json:"retried"`
+	NotFound []string `json:"not_found,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Jobs returns the current jobs and a release func the request calls once
+// it is done with them; the jobs are not stopped before that. It returns
+// nil jobs while a reload replaces them.
+type Jobs func() (map[string]Job, func())
+
+// errReloading is returned with 503 for job requests during a reload.
+var errReloading = errors.New("jobs are reloading, try again shortly")
+
+// Server answers API requests for the jobs returned by jobs, which is
+// called once per request so a reload that replaces the jobs is picked up.
+type Server struct {
+	token string
+	pause *runcontrol.PauseGate
+	jobs  Jobs
+}
+
+func NewServer(token string, pause *runcontrol.PauseGate, jobs Jobs) *Server {
+	return &Server{token: token, pause: pause, jobs: jobs}
+}
+
+// Serve listens on addr until ctx is cancelled. With a token every request
+// must carry "Authorization: Bearer <token>".
+func Serve(ctx context.Context, addr string, token string, pause *runcontrol.PauseGate, jobs Jobs) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: NewServer(token, pause, jobs).Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler serves the API under /api/v1 and the dashboard at /. The
+// dashboard page holds no data, so only the API needs the token.
+func (s *Server) Handler() http.Handler {
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	apiMux.HandleFunc("POST /api/v1/pause", s.handlePause)
+	apiMux.HandleFunc("POST /api/v1/resume", s.handleResume)
+	apiMux.HandleFunc("GET /api/v1/latency", s.handleLatency)
+	apiMux.HandleFunc("GET /api/v1/jobs/{job}", s.handleJob)
+	apiMux.HandleFunc("GET /api/v1/jobs/{job}/items", s.handleItems)
+	apiMux.HandleFunc("GET /api/v1/jobs/{job}/errors", s.handleErrors)
+	apiMux.HandleFunc("GET /api/v1/jobs/{job}/throughput", s.handleThroughput)
+	apiMux.HandleFunc("POST /api/v1/jobs/{job}/retry", s.handleRetry)
+	apiMux.HandleFunc("GET /api/v1/jobs/{job}/delays", s.handleDelays)
+	apiMux.HandleFunc("PATCH /api/v1/jobs/{job}/delays", s.handleSetDelays)
+	apiMux.HandleFunc("POST /api/v1/jobs/{job}/scan", s.handleScan)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authorize(apiMux))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, dashboard, "dashboard/index.html")
+	})
+	return mux
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.pause.Pause()
+	log.Printf("paused via API")
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.pause.Resume()
+	log.Printf("resumed via API")
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// handleLatency reports the latency, outcomes and bytes of the Bot API
+// requests made since the daemon started.
+func (s *Server) handleLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LatencyResponse{Endpoints: telegram.EndpointStats(), Requests: telegram.RequestLatency()})
+}
+
+func (s *Server) status() StatusResponse {
+	jobs, release := s.jobs()
+	defer release()
+	response := StatusResponse{Paused: s.pause.IsPaused(), Reloading: jobs == nil, Jobs: map[string]JobStatus{}}
+	for name, job := range jobs {
+		response.Jobs[name] = jobStatus(job)
+	}
+	return response
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	writeJSON(w, http.StatusOK, jobStatus(job))
+}
+
+// handleItems lists a job's items in enqueue order. ?status takes a
+// comma-separated list of statuses; ?limit caps the result, 0 for all.
+func (s *Server) handleItems(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	limit, err := queryInt(r, "limit", defaultItemLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	statuses := map[string]bool{}
+	for _, status := range strings.Split(r.URL.Query().Get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			statuses[status] = true
+		}
+	}
+	items := []queue.Item{}
+	for _, item := range job.Queue.Items() {
+		if len(statuses) == 0 || statuses[item.Status] {
+			items = append(items, item)
+		}
+	}
+	queue.SortEnqueued(items)
+	response := ItemsResponse{Total: len(items), Items: items}
+	if limit > 0 && len(items) > limit {
+		response.Items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleErrors lists a job's failed items, most recent first. ?limit
+// defaults to 20.
+func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	limit, err := queryInt(r, "limit", 20)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	failed := job.Queue.RecentFailed(limit)
+	writeJSON(w, http.StatusOK, ItemsResponse{Total: len(failed), Items: failed})
+}
+
+// handleThroughput reports the files and bytes sent per minute over the
+// last ?minutes, 60 by default.
+func (s *Server) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	minutes, err := queryInt(r, "minutes", 60)
+	if err != nil || minutes < 1 || minutes > maxThroughputMinutes {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("minutes must be between 1 and %d", maxThroughputMinutes))
+		return
+	}
+	writeJSON(w, http.StatusOK, throughput(job.Queue.Items(), time.Now(), minutes))
+}
+
+// handleRetry queues failed items again: the given IDs, or every failed
+// item when the body names none.
+func (s *Server) handleRetry(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	var request RetryRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+	}
+	ids := request.IDs
+	if len(ids) == 0 {
+		for _, item := range job.Queue.RecentFailed(0) {
+			ids = append(ids, item.ID)
+		}
+	}
+	response := RetryResponse{}
+	for _, id := range ids {
+		retried, err := job.Queue.Retry(id)
+		if err != nil {
+			response.NotFound = append(response.NotFound, id)
+			continue
+		}
+		if retried {
+			response.Retried++
+		}
+	}
+	if response.Retried > 0 {
+		log.Printf("queued %d failed item(s) again via API", response.Retried)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleDelays(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	writeJSON(w, http.StatusOK, jobDelays(job))
+}
+
+// handleSetDelays changes a job's timings until the next config reload.
+func (s *Server) handleSetDelays(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	var delays Delays
+	if err := json.NewDecoder(r.Body).Decode(&delays); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := delays.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	seconds := func(value int) time.Duration { return time.Duration(value) * time.Second }
+	sendCfg := job.Send.Load()
+	if delays.SendInterval != nil {
+		sendCfg.SendInterval = seconds(*delays.SendInterval)
+	}
+	if delays.BatchDelay != nil {
+		sendCfg.BatchDelay = seconds(*delays.BatchDelay)
+	}
+	if delays.PauseEvery != nil {
+		sendCfg.PauseEvery = *delays.PauseEvery
+	}
+	if delays.PauseSeconds != nil {
+		sendCfg.PauseSeconds = seconds(*delays.PauseSeconds)
+	}
+	job.Send.Store(sendCfg)
+	if delays.ScanInterval != nil {
+		for _, live := range job.Watch {
+			watchCfg := live.Load()
+			watchCfg.ScanInterval = seconds(*delays.ScanInterval)
+			live.Store(watchCfg)
+		}
+	}
+	log.Printf("delays of job %s changed via API", r.PathValue("job"))
+	writeJSON(w, http.StatusOK, jobDelays(job))
+}
+
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	job, release, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	job.Scan.Fire()
+	writeJSON(w, http.StatusAccepted, map[string]bool{"ok": true})
+}
+
+// job looks up the job a request names. On success the caller must call
+// release once it is done with the job.
+func (s *Server) job(w http.ResponseWriter, r *http.Request) (Job, func(), bool) {
+	jobs, release := s.jobs()
+	if jobs == nil {
+		release()
+		writeError(w, http.StatusServiceUnavailable, errReloading)
+		return Job{}, nil, false
+	}
+	name := r.PathValue("job")
+	job, ok := jobs[name]
+	if !ok {
+		release()
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", name))
+		return Job{}, nil, false
+	}
+	return job, release, true
+}
+
+// queryInt returns the non-negative integer query parameter name, or
+// fallback when it is absent.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+// throughput buckets the items sent in the minutes before now by the
+// minute they were marked sent.
+func throughput(items []queue.Item, now time.Time, minutes int) ThroughputResponse {
+	end := now.Truncate(time.Minute).Add(time.Minute)
+	start := end.Add(-time.Duration(minutes) * time.Minute)
+	response := ThroughputResponse{
+		Start:         start.UTC(),
+		BucketSeconds: 60,
+		Files:         make([]int, minutes),
+		Bytes:         make([]int64, minutes),
+	}
+	for _, item := range items {
+		if item.Status != queue.StatusSent {
+			continue
+		}
+		sentAt, err := time.Parse(time.RFC3339Nano, item.UpdatedAt)
+		if err != nil || sentAt.Before(start) || !sentAt.Before(end) {
+			continue
+		}
+		bucket := int(sentAt.Sub(start) / time.Minute)
+		response.Files[bucket]++
+		response.Bytes[bucket] += item.Size
+	}
+	return response
+}
+
+func (d Delays) validate() error {
+	values := map[string]*int{
+		"scan_interval": d.ScanInterval,
+		"send_interval": d.SendInterval,
+		"batch_delay":   d.BatchDelay,
+		"pause_every":   d.PauseEvery,
+		"pause_seconds": d.PauseSeconds,
+	}
+	for name, value := range values {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must be >= 0", name)
+		}
+	}
+	if d.ScanInterval != nil && *d.ScanInterval < 1 {
+		return errors.New("scan_interval must be >= 1")
+	}
+	return nil
+}
+
+func jobStatus(job Job) JobStatus {
+	return JobStatus{Queue: job.Queue.Stats(), Delays: jobDelays(job)}
+}
+
+func jobDelays(job Job) Delays {
+	seconds := func(value time.Duration) *int {
+		n := int(value / time.Second)
+		return &n
+	}
+	sendCfg := job.Send.Load()
+	delays := Delays{
+		SendInterval: seconds(sendCfg.SendInterval),
+		BatchDelay:   seconds(sendCfg.BatchDelay),
+		PauseEvery:   &sendCfg.PauseEvery,
+		PauseSeconds: seconds(sendCfg.PauseSeconds),
+	}
+	if len(job.Watch) > 0 {
+		delays.ScanInterval = seconds(job.Watch[0].Load().ScanInterval)
+	}
+	return delays
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
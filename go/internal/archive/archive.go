@@ -0,0 +1,177 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
+)
+
+const (
+	FormatZip    = "zip"
+	FormatTarZst = "tar.zst"
+)
+
+// ParseFormat validates an archive format name.
+func ParseFormat(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", FormatZip:
+		return FormatZip, nil
+	case FormatTarZst, "tzst":
+		return FormatTarZst, nil
+	default:
+		return "", fmt.Errorf("invalid archive format %q: expected zip or tar.zst", value)
+	}
+}
+
+// Filename returns the archive name for dir, e.g. "photos.zip".
+func Filename(dir string, format string) string {
+	return filepath.Base(filepath.Clean(dir)) + "." + format
+}
+
+// Write packs files, which must live under dir, into w. Entries are stored
+// under the directory's own name so the archive extracts into one folder.
+// A password encrypts zip entries with traditional ZipCrypto, which every
+// unzip tool can open; tar.zst archives cannot be encrypted.
+func Write(w io.Writer, format string, dir string, files []string, password string) error {
+	root := filepath.Dir(filepath.Clean(dir))
+	switch format {
+	case FormatZip:
+		return writeZip(w, root, files, password)
+	case FormatTarZst:
+		if password != "" {
+			return fmt.Errorf("archive password needs the zip format")
+		}
+		return writeTarZst(w, root, files)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+func entryName(root string, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func writeZip(w io.Writer, root string, files []string, password string) error {
+	writer := zip.NewWriter(w)
+	for _, path := range files {
+		name, err := entryName(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+		if password == "" {
+			entry, err := writer.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if err := copyFile(entry, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeEncryptedEntry(writer, header, path, password); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeEncryptedEntry compresses one file in memory, encrypts it and stores
+// it raw, since archive/zip cannot encrypt.
+func writeEncryptedEntry(writer *zip.Writer, header *zip.FileHeader, path string, password string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	compressed := &bytes.Buffer{}
+	deflater, err := flate.NewWriter(compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := deflater.Write(data); err != nil {
+		return err
+	}
+	if err := deflater.Close(); err != nil {
+		return err
+	}
+	header.CRC32 = crc32.ChecksumIEEE(data)
+	encrypted, err := ziputil.EncryptZipCrypto(password, compressed.Bytes(), header.CRC32)
+	if err != nil {
+		return err
+	}
+	header.Flags |= 0x1
+	header.CompressedSize64 = uint64(len(encrypted))
+	header.UncompressedSize64 = uint64(len(data))
+	entry, err := writer.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(encrypted)
+	return err
+}
+
+func writeTarZst(w io.Writer, root string, files []string) error {
+	encoder, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	writer := tar.NewWriter(encoder)
+	for _, path := range files {
+		name, err := entryName(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(writer, path); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,99 @@
+// Package chatid resolves the chat references users give (@usernames,
+// t.me links) to numeric chat IDs and caches them in the state directory.
+package chatid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// maxAge is how long a resolved chat ID is trusted; usernames can move
+// to another chat.
+const maxAge = 7 * 24 * time.Hour
+
+type cachedID struct {
+	ID         int64     `json:"id"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+var cacheMu sync.Mutex
+
+// Resolve turns value into a numeric chat ID. @usernames and t.me links are
+// looked up once and cached as chat-ids.json in stateDir (the default state
+// directory when empty). When the lookup fails for a reason other than a
+// Bot API reply, an @username is used as given, which the Bot API accepts
+// for public chats.
+func Resolve(ctx context.Context, client *telegram.Client, stateDir string, value string) (string, error) {
+	ref, err := telegram.ParseChatRef(value)
+	if err != nil {
+		return "", err
+	}
+	if ref.Numeric() {
+		return ref.ID, nil
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	path := ""
+	if dir, err := statedir.Resolve(stateDir); err == nil {
+		path = filepath.Join(dir, "chat-ids.json")
+	}
+	cache := readCache(path)
+	if entry, ok := cache[ref.Key()]; ok && time.Since(entry.ResolvedAt) < maxAge {
+		return strconv.FormatInt(entry.ID, 10), nil
+	}
+	chat, err := client.ResolveChat(ctx, value)
+	if err != nil {
+		var apiErr *telegram.APIError
+		if ref.ID != "" && !errors.As(err, &apiErr) && ctx.Err() == nil {
+			log.Printf("could not resolve chat %s, using it as given: %v", value, err)
+			return ref.ID, nil
+		}
+		return "", err
+	}
+	log.Printf("resolved chat %s to %d (%s)", value, chat.ID, chat.DisplayName())
+	if path != "" {
+		cache[ref.Key()] = cachedID{ID: chat.ID, ResolvedAt: time.Now().UTC()}
+		if err := writeCache(path, cache); err != nil {
+			log.Printf("chat ID cache %s not saved: %v", path, err)
+		}
+	}
+	return strconv.FormatInt(chat.ID, 10), nil
+}
+
+func readCache(path string) map[string]cachedID {
+	cache := map[string]cachedID{}
+	if path == "" {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Printf("ignoring unreadable chat ID cache %s: %v", path, err)
+		return map[string]cachedID{}
+	}
+	return cache
+}
+
+func writeCache(path string, cache map[string]cachedID) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -12,6 +12,10 @@ func NormalizeAPIURL(url string) string {
 	if url == "" {
 		return ""
 	}
+	// mock:// selects the in-process Bot API of package mockapi.
+	if strings.HasPrefix(url, "mock://") {
+		return url
+	}
 	if !strings.HasPrefix(url, "https://") {
 		url = "https://" + url
 	}
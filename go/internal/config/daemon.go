@@ -0,0 +1,372 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
+	"gopkg.in/ini.v1"
+)
+
+type WatchJob struct {
+	Name            string
+	WatchDirs       []string
+	ChatID          string
+	TopicID         int
+	QueueFile       string
+	PruneSent       time.Duration
+	SendOrder       string
+	QueueFsync      bool
+	GlobalDedup     bool
+	Recursive       bool
+	WithImage       bool
+	WithVideo       bool
+	WithAudio       bool
+	WithAll         bool
+	Include         []string
+	Exclude         []string
+	ScanInterval    int
+	SendInterval    int
+	StatusInterval  int
+	SettleSeconds   int
+	ScanWorkers     int
+	ScanDirCache    bool
+	FollowSymlinks  bool
+	IncludeHidden   bool
+	Strict          bool
+	IgnoreFile      string
+	Quarantine      string
+	OnModified      string
+	Ordering        string
+	MetaCaptions    bool
+	Priority        int
+	GroupSize       int
+	GroupMaxBytes   int64
+	AlbumVideos     bool
+	AutoSplit       string
+	DailyLimitFiles int
+	DailyLimitBytes int64
+	QuotaTimezone   string
+	TopicMap        []string
+	VerifyTarget    bool
+	Spoiler         bool
+	ProtectContent  bool
+	Silent          bool
+	ReplyTo         int
+	TokenPinning    string
+	VideoPreset     string
+	Thumbnails      bool
+	RenameTemplate  string
+	LocalAPIFiles   bool
+	AlsoAsDocument  bool
+	BatchDelay      int
+	PauseEvery      int
+	PauseSeconds    int
+	MaxDimension    int
+	MaxBytes        int
+	PNGStartLevel   int
+	PHashDedup      bool
+	PHashDistance   int
+	Notify          bool
+	NotifyInterval  int
+	NotifyErrorOnly bool
+	DigestInterval  int
+	NotifySinks     []string
+	NotifySinkOnly  bool
+	NotifyMode      string
+	NotifyIdleMax   int
+	NotifyDailyAt   string
+	ZipPasswords    []string
+	ZipPassFile     string
+	MaxRetries      int
+	RetryDelay      int
+}
+
+type DaemonConfig struct {
+	APIURLs       []string
+	Tokens        []string
+	LogFormat     string
+	ControlSocket string
+	// APIListen, when set, serves the HTTP control API on this address;
+	// APIToken, when set, is required as a bearer token.
+	APIListen     string
+	APIToken      string
+	ResizeBackend string
+	// Watermark, when set, is drawn over every image of every job at
+	// WatermarkPos with WatermarkOpacity.
+	Watermark        string
+	WatermarkPos     string
+	WatermarkOpacity float64
+	// QualityGuard is the --quality-guard setting of every job.
+	QualityGuard string
+	TempDir      string
+	// Lang is the language of the messages posted to Telegram.
+	Lang string
+	// OTLPEndpoint and OTLPHeaders are the --otlp-endpoint and
+	// --otlp-header settings.
+	OTLPEndpoint string
+	OTLPHeaders  []string
+	// MemoryBudget is shared by the senders of all jobs; 0 is unlimited.
+	MemoryBudget int64
+	Jobs         []WatchJob
+}
+
+// jobSection resolves keys from a [Watch*] section, falling back to the
+// [Daemon] section so shared settings such as chat_id can be set once.
+type jobSection struct {
+	job      *ini.Section
+	defaults *ini.Section
+}
+
+func (s jobSection) key(name string) *ini.Key {
+	if s.job.HasKey(name) {
+		return s.job.Key(name)
+	}
+	return s.defaults.Key(name)
+}
+
+func (s jobSection) list(name string) []string {
+	values := []string{}
+	for _, entry := range strings.Split(s.key(name).String(), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			values = append(values, entry)
+		}
+	}
+	return values
+}
+
+func LoadDaemonConfig(path string) (*DaemonConfig, error) {
+	apiURLs, tokens, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	baseDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(value string) string {
+		if value == "" || filepath.IsAbs(value) {
+			return value
+		}
+		return filepath.Join(baseDir, value)
+	}
+
+	defaults := cfg.Section("Daemon")
+	daemon := &DaemonConfig{
+		APIURLs:       apiURLs,
+		Tokens:        tokens,
+		LogFormat:     defaults.Key("log_format").MustString("json"),
+		ControlSocket: resolve(defaults.Key("control_socket").MustString("daemon.sock")),
+		APIListen:     strings.TrimSpace(defaults.Key("api_listen").String()),
+		APIToken:      strings.TrimSpace(defaults.Key("api_token").String()),
+		ResizeBackend: strings.TrimSpace(defaults.Key("resize_backend").String()),
+		TempDir:       resolve(strings.TrimSpace(defaults.Key("temp_dir").String())),
+		Lang:          strings.TrimSpace(defaults.Key("lang").String()),
+		OTLPEndpoint:  strings.TrimSpace(defaults.Key("otlp_endpoint").String()),
+
+		Watermark:        resolve(strings.TrimSpace(defaults.Key("watermark").String())),
+		WatermarkPos:     strings.TrimSpace(defaults.Key("watermark_pos").String()),
+		WatermarkOpacity: defaults.Key("watermark_opacity").MustFloat64(0.5),
+		QualityGuard:     strings.TrimSpace(defaults.Key("quality_guard").String()),
+	}
+	if len(daemon.Tokens) == 0 {
+		return nil, fmt.Errorf("no bot token provided in %s", path)
+	}
+	if value := strings.TrimSpace(defaults.Key("memory_budget").String()); value != "" && value != "0" {
+		budget, err := splitter.ParseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory_budget: %w", err)
+		}
+		daemon.MemoryBudget = budget
+	}
+	for _, header := range strings.Split(defaults.Key("otlp_header").String(), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			daemon.OTLPHeaders = append(daemon.OTLPHeaders, header)
+		}
+	}
+
+	queueFiles := map[string]string{}
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), "Watch") {
+			continue
+		}
+		s := jobSection{job: section, defaults: defaults}
+		name := strings.TrimSpace(section.Key("name").MustString(section.Name()))
+		job := WatchJob{
+			Name:            name,
+			ChatID:          strings.TrimSpace(s.key("chat_id").String()),
+			TopicID:         s.key("topic_id").MustInt(0),
+			QueueFile:       resolve(s.job.Key("queue_file").MustString(name + ".queue.jsonl")),
+			QueueFsync:      s.key("queue_fsync").MustBool(false),
+			GlobalDedup:     s.key("global_dedup").MustBool(false),
+			Recursive:       s.key("recursive").MustBool(false),
+			WithImage:       s.key("with_image").MustBool(false),
+			WithVideo:       s.key("with_video").MustBool(false),
+			WithAudio:       s.key("with_audio").MustBool(false),
+			WithAll:         s.key("all").MustBool(false),
+			Include:         s.list("include"),
+			Exclude:         s.list("exclude"),
+			ScanInterval:    s.key("scan_interval").MustInt(30),
+			SendInterval:    s.key("send_interval").MustInt(30),
+			StatusInterval:  s.key("status_interval").MustInt(0),
+			SettleSeconds:   s.key("settle_seconds").MustInt(5),
+			ScanWorkers:     s.key("scan_workers").MustInt(1),
+			ScanDirCache:    s.key("scan_dir_cache").MustBool(false),
+			FollowSymlinks:  s.key("follow_symlinks").MustBool(false),
+			IncludeHidden:   s.key("include_hidden").MustBool(false),
+			Strict:          s.key("strict").MustBool(false),
+			IgnoreFile:      strings.TrimSpace(s.key("ignore_file").MustString(fswalk.DefaultIgnoreFile)),
+			Quarantine:      strings.TrimSpace(s.key("quarantine").String()),
+			OnModified:      s.key("on_modified").String(),
+			Ordering:        s.key("ordering").String(),
+			MetaCaptions:    s.key("metadata_captions").MustBool(false),
+			GroupSize:       s.key("group_size").MustInt(4),
+			GroupMaxBytes:   s.key("group_max_bytes").MustInt64(0),
+			AlbumVideos:     s.key("album_videos").MustBool(false),
+			AutoSplit:       strings.TrimSpace(s.key("auto_split").String()),
+			DailyLimitFiles: s.key("daily_limit_files").MustInt(0),
+			DailyLimitBytes: s.key("daily_limit_bytes").MustInt64(0),
+			QuotaTimezone:   strings.TrimSpace(s.key("quota_timezone").String()),
+			TopicMap:        s.list("topic_map"),
+			VerifyTarget:    s.key("verify_target").MustBool(false),
+			Spoiler:         s.key("spoiler").MustBool(false),
+			ProtectContent:  s.key("protect_content").MustBool(false),
+			Silent:          s.key("silent").MustBool(false),
+			ReplyTo:         s.key("reply_to").MustInt(0),
+			TokenPinning:    strings.TrimSpace(s.key("token_pinning").String()),
+			VideoPreset:     strings.TrimSpace(s.key("video_preset").String()),
+			Thumbnails:      s.key("thumbnails").MustBool(false),
+			RenameTemplate:  s.key("rename_template").String(),
+			LocalAPIFiles:   s.key("local_api_files").MustBool(false),
+			AlsoAsDocument:  s.key("also_as_document").MustBool(false),
+			BatchDelay:      s.key("batch_delay").MustInt(3),
+			PauseEvery:      s.key("pause_every").MustInt(0),
+			PauseSeconds:    s.key("pause_seconds").MustInt(0),
+			MaxDimension:    s.key("max_dimension").MustInt(2000),
+			MaxBytes:        s.key("max_bytes").MustInt(5 * 1024 * 1024),
+			PNGStartLevel:   s.key("png_start_level").MustInt(8),
+			PHashDedup:      s.key("phash_dedup").MustBool(false),
+			PHashDistance:   s.key("phash_distance").MustInt(4),
+			Notify:          s.key("notify").MustBool(false),
+			NotifyInterval:  s.key("notify_interval").MustInt(300),
+			NotifyErrorOnly: s.key("notify_on_error_only").MustBool(false),
+			DigestInterval:  s.key("notify_failure_interval").MustInt(300),
+			NotifySinks:     s.list("notify_sink"),
+			NotifySinkOnly:  s.key("notify_sink_only").MustBool(false),
+			NotifyMode:      s.key("notify_mode").String(),
+			NotifyIdleMax:   s.key("notify_idle_max").MustInt(86400),
+			NotifyDailyAt:   s.key("notify_daily_at").MustString("09:00"),
+			ZipPasswords:    s.list("zip_pass"),
+			ZipPassFile:     resolve(s.key("zip_pass_file").String()),
+			MaxRetries:      s.key("max_retries").MustInt(3),
+			RetryDelay:      s.key("retry_delay").MustInt(3),
+		}
+		priority, err := queue.ParsePriority(s.key("priority").String())
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %w", section.Name(), err)
+		}
+		job.Priority = priority
+		pruneSent, err := queue.ParseRetention(s.key("queue_prune_sent").String())
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: queue_prune_sent: %w", section.Name(), err)
+		}
+		job.PruneSent = pruneSent
+		sendOrder, err := queue.ParseOrder(s.key("send_order").String())
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %w", section.Name(), err)
+		}
+		job.SendOrder = sendOrder
+		for _, dir := range s.list("watch_dir") {
+			job.WatchDirs = append(job.WatchDirs, resolve(dir))
+		}
+		if job.ChatID == "" {
+			return nil, fmt.Errorf("[%s]: chat_id is required", section.Name())
+		}
+		if len(job.WatchDirs) == 0 {
+			return nil, fmt.Errorf("[%s]: watch_dir is required", section.Name())
+		}
+		if other, ok := queueFiles[job.QueueFile]; ok {
+			return nil, fmt.Errorf("[%s]: queue_file %s is already used by %s", section.Name(), job.QueueFile, other)
+		}
+		queueFiles[job.QueueFile] = job.Name
+		daemon.Jobs = append(daemon.Jobs, job)
+	}
+	if len(daemon.Jobs) == 0 {
+		return nil, fmt.Errorf("no [Watch*] sections found in %s", path)
+	}
+	return daemon, nil
+}
+
+func DaemonConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv("TELEGRAM_UPLOAD_WATCHER_CONFIG"); env != "" {
+		return env
+	}
+	return "config.ini"
+}
+
+// MergeSafeJobChanges applies next on top of current, except for the fields
+// that decide where files come from and go to. Those keep their current
+// values and their key names are returned so the caller can report them.
+func MergeSafeJobChanges(current WatchJob, next WatchJob) (WatchJob, []string) {
+	rejected := []string{}
+	if !reflect.DeepEqual(current.WatchDirs, next.WatchDirs) {
+		rejected = append(rejected, "watch_dir")
+		next.WatchDirs = current.WatchDirs
+	}
+	if current.ChatID != next.ChatID {
+		rejected = append(rejected, "chat_id")
+		next.ChatID = current.ChatID
+	}
+	if current.TopicID != next.TopicID {
+		rejected = append(rejected, "topic_id")
+		next.TopicID = current.TopicID
+	}
+	if !reflect.DeepEqual(current.TopicMap, next.TopicMap) {
+		rejected = append(rejected, "topic_map")
+		next.TopicMap = current.TopicMap
+	}
+	if current.QueueFile != next.QueueFile {
+		rejected = append(rejected, "queue_file")
+		next.QueueFile = current.QueueFile
+	}
+	if current.PruneSent != next.PruneSent {
+		rejected = append(rejected, "queue_prune_sent")
+		next.PruneSent = current.PruneSent
+	}
+	if current.GlobalDedup != next.GlobalDedup {
+		rejected = append(rejected, "global_dedup")
+		next.GlobalDedup = current.GlobalDedup
+	}
+	if current.Spoiler != next.Spoiler || current.ProtectContent != next.ProtectContent ||
+		current.Silent != next.Silent || current.ReplyTo != next.ReplyTo || current.TokenPinning != next.TokenPinning ||
+		current.VideoPreset != next.VideoPreset || current.Thumbnails != next.Thumbnails ||
+		current.RenameTemplate != next.RenameTemplate || current.LocalAPIFiles != next.LocalAPIFiles ||
+		current.AlsoAsDocument != next.AlsoAsDocument {
+		rejected = append(rejected, "spoiler/protect_content/silent/reply_to/token_pinning/video_preset/thumbnails/rename_template/local_api_files/also_as_document")
+		next.Spoiler = current.Spoiler
+		next.ProtectContent = current.ProtectContent
+		next.Silent = current.Silent
+		next.ReplyTo = current.ReplyTo
+		next.TokenPinning = current.TokenPinning
+		next.VideoPreset = current.VideoPreset
+		next.Thumbnails = current.Thumbnails
+		next.RenameTemplate = current.RenameTemplate
+		next.LocalAPIFiles = current.LocalAPIFiles
+		next.AlsoAsDocument = current.AlsoAsDocument
+	}
+	return next, rejected
+}
@@ -0,0 +1,297 @@
+package fswalk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Options controls how symlinks and hidden entries are treated.
+//
+// Symlinks to files are listed with the target's size and mtime. Symlinks to
+// directories are only descended with FollowSymlinks. A link that points
+// inside the walk root is skipped because its target is reached directly, and
+// a directory link back to a directory already on the current branch is
+// skipped as a cycle. Names starting with a dot are skipped unless
+// IncludeHidden is set. Entries that cannot be read are skipped and
+// reported, or stop the walk with Strict. With IgnoreFile set, a file of that
+// name in any directory excludes entries below it with gitignore patterns;
+// the file itself is never listed. Directories in Skip, absolute or relative
+// to the walk root, are left out.
+type Options struct {
+	FollowSymlinks bool
+	IncludeHidden  bool
+	Strict         bool
+	IgnoreFile     string
+	Skip           []string
+}
+
+// Errors lists the paths a walk could not read: unreadable directories,
+// entries that could not be stat'ed and broken symlinks.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d unreadable paths, first: %v", len(e), e[0])
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Unreadable keeps the number of unreadable paths found by the latest walk of
+// each root, so a long-running watcher can report them. A nil *Unreadable
+// ignores updates.
+type Unreadable struct {
+	mu    sync.Mutex
+	roots map[string]int
+}
+
+func (u *Unreadable) Set(root string, count int) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.roots == nil {
+		u.roots = map[string]int{}
+	}
+	u.roots[root] = count
+}
+
+func (u *Unreadable) Count() int {
+	if u == nil {
+		return 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	total := 0
+	for _, count := range u.roots {
+		total += count
+	}
+	return total
+}
+
+// Dir is a directory reached during a walk. It remembers the real paths of
+// the walk root and of its ancestors so followed links can be checked, and
+// the ignore rules of its ancestors.
+type Dir struct {
+	Path   string
+	root   string
+	chain  []string
+	ignore *ignoreRules
+}
+
+// Entry is one listed entry of a directory. Info describes the link target
+// for symlinks; Dir is set for directories.
+type Entry struct {
+	Path string
+	Name string
+	Info os.FileInfo
+	Dir  *Dir
+}
+
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+func NewRoot(path string) Dir {
+	real, err := realPath(path)
+	if err != nil {
+		real = path
+	}
+	if abs, err := filepath.Abs(real); err == nil {
+		real = abs
+	}
+	return Dir{Path: path, root: real, chain: []string{real}}
+}
+
+// realPath resolves links without the extended-length prefix, so real paths
+// compare equal however the walk root was spelled.
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(LongPath(path))
+	if err != nil {
+		return "", err
+	}
+	return ShortPath(real), nil
+}
+
+func (d Dir) real() string {
+	return d.chain[len(d.chain)-1]
+}
+
+func (d Dir) child(path string, real string) *Dir {
+	chain := make([]string, len(d.chain), len(d.chain)+1)
+	copy(chain, d.chain)
+	return &Dir{Path: path, root: d.root, chain: append(chain, real), ignore: d.ignore}
+}
+
+// Read lists the directory in name order, dropping hidden entries,
+// directory links and ignored entries that opts does not allow. Entries that
+// cannot be read, including an unreadable ignore file, are returned as
+// problems; err is set when the directory itself cannot be listed.
+func (d Dir) Read(opts Options) (entries []Entry, problems []error, err error) {
+	items, err := os.ReadDir(LongPath(d.Path))
+	if err != nil && len(items) == 0 {
+		return nil, nil, err
+	}
+	if err != nil {
+		// A partial listing: keep what was read.
+		problems = append(problems, err)
+	}
+	if opts.IgnoreFile != "" {
+		rules, ignoreErr := d.loadIgnore(opts.IgnoreFile)
+		if ignoreErr != nil {
+			problems = append(problems, ignoreErr)
+		}
+		d.ignore = rules
+	}
+	entries = make([]Entry, 0, len(items))
+	for _, item := range items {
+		name := item.Name()
+		if !opts.IncludeHidden && IsHidden(name) {
+			continue
+		}
+		if opts.IgnoreFile != "" && name == opts.IgnoreFile {
+			continue
+		}
+		path := filepath.Join(d.Path, name)
+		if item.Type()&os.ModeSymlink == 0 {
+			info, err := item.Info()
+			if err != nil {
+				problems = append(problems, err)
+				continue
+			}
+			entry := Entry{Path: path, Name: name, Info: info}
+			if info.IsDir() {
+				real := filepath.Join(d.real(), name)
+				if d.skipped(real, opts.Skip) {
+					continue
+				}
+				entry.Dir = d.child(path, real)
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		info, err := os.Stat(LongPath(path))
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if info.IsDir() && !opts.FollowSymlinks {
+			continue
+		}
+		target, err := realPath(path)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if within(target, d.root) {
+			continue
+		}
+		if !info.IsDir() {
+			entries = append(entries, Entry{Path: path, Name: name, Info: info})
+			continue
+		}
+		if d.onChain(target) || d.skipped(target, opts.Skip) {
+			continue
+		}
+		entries = append(entries, Entry{Path: path, Name: name, Info: info, Dir: d.child(path, target)})
+	}
+	if d.ignore != nil {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if !d.ignore.ignored(entry.Path, entry.Dir != nil) {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+	return entries, problems, nil
+}
+
+func (d Dir) onChain(real string) bool {
+	for _, ancestor := range d.chain {
+		if ancestor == real {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped reports whether the directory at real is one of skip.
+func (d Dir) skipped(real string, skip []string) bool {
+	for _, dir := range skip {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(d.root, dir)
+		}
+		if filepath.Clean(dir) == real {
+			return true
+		}
+	}
+	return false
+}
+
+func within(path string, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// Walk calls fn for every entry under root in the same depth-first lexical
+// order as filepath.WalkDir, with symlinks resolved according to opts.
+// Returning filepath.SkipDir for a directory skips it; any other error stops
+// the walk and is returned. Paths that cannot be read, including the root,
+// are skipped and returned together as Errors; with opts.Strict the walk
+// stops at the first one.
+func Walk(root string, opts Options, fn func(path string, info os.FileInfo) error) error {
+	var problems Errors
+	err := walkDir(NewRoot(root), opts, &problems, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		err = nil
+	}
+	if err == nil && len(problems) > 0 {
+		return problems
+	}
+	return err
+}
+
+func walkDir(dir Dir, opts Options, problems *Errors, fn func(path string, info os.FileInfo) error) error {
+	entries, readProblems, err := dir.Read(opts)
+	if err != nil {
+		readProblems = append(readProblems, err)
+	}
+	*problems = append(*problems, readProblems...)
+	if opts.Strict && len(*problems) > 0 {
+		return *problems
+	}
+	for _, entry := range entries {
+		err := fn(entry.Path, entry.Info)
+		if entry.Dir == nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err == filepath.SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := walkDir(*entry.Dir, opts, problems, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package fswalk
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultIgnoreFile is the per-directory ignore file read unless another
+// name is configured.
+const DefaultIgnoreFile = ".telegramignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules are the patterns of the ignore file in base, chained to those
+// of the directories above it.
+type ignoreRules struct {
+	base   string
+	rules  []ignoreRule
+	parent *ignoreRules
+}
+
+// loadIgnore returns the rules that apply inside d: d's own ignore file, if
+// it has one, on top of those inherited from its parents.
+func (d Dir) loadIgnore(name string) (*ignoreRules, error) {
+	data, err := os.ReadFile(LongPath(filepath.Join(d.Path, name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return d.ignore, nil
+	}
+	if err != nil {
+		return d.ignore, err
+	}
+	rules := parseIgnore(string(data))
+	if len(rules) == 0 {
+		return d.ignore, nil
+	}
+	return &ignoreRules{base: d.Path, rules: rules, parent: d.ignore}, nil
+}
+
+// ignored reports whether path is excluded. As in .gitignore, files deeper
+// in the tree override their parents and the last matching line wins, so a
+// "!" line can bring back what an earlier one excluded.
+func (r *ignoreRules) ignored(path string, isDir bool) bool {
+	levels := []*ignoreRules{}
+	for level := r; level != nil; level = level.parent {
+		levels = append(levels, level)
+	}
+	ignored := false
+	for i := len(levels) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(levels[i].base, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range levels[i].rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// parseIgnore reads gitignore syntax: comments, "!" to re-include, a
+// trailing "/" for directories only, patterns with a "/" anchored to the
+// file's directory and "**" across directories. Lines that do not compile
+// are dropped.
+func parseIgnore(data string) []ignoreRule {
+	rules := []ignoreRule{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		expr := "^(?:.*/)?" + globRegexp(line) + "$"
+		if strings.Contains(line, "/") {
+			expr = "^" + globRegexp(strings.TrimPrefix(line, "/")) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					// "**/" matches any number of directories, none included.
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+				b.WriteString(".*")
+				i++
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package fswalk
+
+// LongPath returns path unchanged; only Windows limits path length.
+func LongPath(path string) string {
+	return path
+}
+
+func ShortPath(path string) string {
+	return path
+}
@@ -0,0 +1,43 @@
+package fswalk
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath leaves room for an 8.3 file name under a directory, which is
+// where CreateDirectory and friends start failing without the \\?\ prefix.
+const maxShortPath = 248
+
+// LongPath returns path in a form Windows accepts beyond MAX_PATH: relative
+// paths are made absolute, and long ones get the extended-length prefix
+// (\\?\C:\... or \\?\UNC\server\share\...). Prefixed paths are returned as is.
+func LongPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	if !filepath.IsAbs(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		path = abs
+	}
+	if len(path) < maxShortPath {
+		return path
+	}
+	path = filepath.Clean(path)
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
+
+// ShortPath strips the extended-length prefix LongPath adds, for display and
+// for glob matching against user patterns.
+func ShortPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
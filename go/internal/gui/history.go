@@ -0,0 +1,142 @@
+package gui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/statedir"
+)
+
+const historyFileName = "gui-history.jsonl"
+
+// HistoryRecord summarises one finished GUI run.
+type HistoryRecord struct {
+	ID          string  `json:"id"`
+	Kind        string  `json:"kind"`
+	Source      string  `json:"source"`
+	ChatID      string  `json:"chat_id"`
+	TopicID     *int    `json:"topic_id,omitempty"`
+	StartedAt   string  `json:"started_at"`
+	FinishedAt  string  `json:"finished_at"`
+	DurationSec float64 `json:"duration_sec"`
+	Sent        int     `json:"sent"`
+	Failed      int     `json:"failed"`
+	Bytes       int64   `json:"bytes"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// DailyStats aggregates the runs that finished on one local day.
+type DailyStats struct {
+	Date        string  `json:"date"`
+	Runs        int     `json:"runs"`
+	Sent        int     `json:"sent"`
+	Failed      int     `json:"failed"`
+	Bytes       int64   `json:"bytes"`
+	SuccessRate float64 `json:"success_rate"`
+	AvgSpeed    float64 `json:"avg_speed"`
+}
+
+// HistoryPath returns the history file in the state directory; it is an
+// append-only log with one JSON record per line.
+func HistoryPath() (string, error) {
+	dir, err := statedir.Resolve("")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFileName), nil
+}
+
+func AppendHistory(path string, record HistoryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadHistory returns all records, newest first. A missing file is an empty
+// history; unreadable lines (e.g. a torn final write) are skipped.
+func LoadHistory(path string) ([]HistoryRecord, error) {
+	records := []HistoryRecord{}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].FinishedAt > records[j].FinishedAt
+	})
+	return records, nil
+}
+
+// SummarizeDaily buckets records into the last days local days ending at
+// now, oldest first, including days without runs.
+func SummarizeDaily(records []HistoryRecord, days int, now time.Time) []DailyStats {
+	if days <= 0 {
+		days = 14
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	stats := make([]DailyStats, days)
+	index := map[string]int{}
+	for i := range stats {
+		date := today.AddDate(0, 0, i-days+1).Format("2006-01-02")
+		stats[i].Date = date
+		index[date] = i
+	}
+	durations := make([]float64, days)
+	for _, record := range records {
+		finished, err := time.Parse(time.RFC3339, record.FinishedAt)
+		if err != nil {
+			continue
+		}
+		i, ok := index[finished.In(now.Location()).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		stats[i].Runs++
+		stats[i].Sent += record.Sent
+		stats[i].Failed += record.Failed
+		stats[i].Bytes += record.Bytes
+		durations[i] += record.DurationSec
+	}
+	for i := range stats {
+		if attempted := stats[i].Sent + stats[i].Failed; attempted > 0 {
+			stats[i].SuccessRate = float64(stats[i].Sent) / float64(attempted)
+		}
+		if durations[i] > 0 {
+			stats[i].AvgSpeed = float64(stats[i].Bytes) / durations[i]
+		}
+	}
+	return stats
+}
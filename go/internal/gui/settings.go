@@ -3,14 +3,37 @@ package gui
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/config"
 )
 
 const settingsFileName = "gui-settings.json"
 
+// Themes of the GUI window.
+const (
+	ThemeSystem = "system"
+	ThemeDark   = "dark"
+	ThemeLight  = "light"
+)
+
+// FontScale bounds; 1 is the default text size.
+const (
+	MinFontScale = 0.75
+	MaxFontScale = 2
+)
+
+// Window size used when none was saved, and the smallest one restored.
+const (
+	DefaultWindowWidth  = 1000
+	DefaultWindowHeight = 900
+	minWindowWidth      = 480
+	minWindowHeight     = 360
+)
+
 type Settings struct {
 	ConfigPath        string   `json:"config_path"`
 	ChatID            string   `json:"chat_id"`
@@ -24,6 +47,8 @@ type Settings struct {
 	WithAll           bool     `json:"with_all"`
 	Include           []string `json:"include,omitempty"`
 	Exclude           []string `json:"exclude,omitempty"`
+	FollowSymlinks    bool     `json:"follow_symlinks"`
+	IncludeHidden     bool     `json:"include_hidden"`
 	ZipPasswords      []string `json:"zip_passwords,omitempty"`
 	ZipPassFile       string   `json:"zip_pass_file"`
 	ScanIntervalSec   int      `json:"scan_interval_sec"`
@@ -38,6 +63,25 @@ type Settings struct {
 	MaxDimension      int      `json:"max_dimension"`
 	MaxBytes          int      `json:"max_bytes"`
 	PNGStartLevel     int      `json:"png_start_level"`
+	MinimizeToTray    bool     `json:"minimize_to_tray"`
+	// Language selects the messages posted to Telegram and the tray menu
+	// labels: en or zh-CN.
+	Language string `json:"language,omitempty"`
+	// Theme is system, dark or light, and FontScale multiplies the text
+	// size. Window is where the main window was when the GUI last closed.
+	Theme     string       `json:"theme,omitempty"`
+	FontScale float64      `json:"font_scale,omitempty"`
+	Window    *WindowState `json:"window,omitempty"`
+}
+
+// WindowState is the size and position of the main window. Width and
+// Height are those of the unmaximised window.
+type WindowState struct {
+	X         int  `json:"x"`
+	Y         int  `json:"y"`
+	Width     int  `json:"width"`
+	Height    int  `json:"height"`
+	Maximised bool `json:"maximised"`
 }
 
 type TelegramConfig struct {
@@ -47,7 +91,7 @@ type TelegramConfig struct {
 
 func DefaultSettings() Settings {
 	return Settings{
-		QueueFile:         "queue.jsonl",
+		QueueFile:         "",
 		WithImage:         true,
 		ScanIntervalSec:   30,
 		SendIntervalSec:   30,
@@ -61,6 +105,43 @@ func DefaultSettings() Settings {
 		MaxDimension:      2000,
 		MaxBytes:          5 * 1024 * 1024,
 		PNGStartLevel:     8,
+		MinimizeToTray:    true,
+		Theme:             ThemeSystem,
+		FontScale:         1,
+	}
+}
+
+// ParseTheme checks a theme name; empty is ThemeSystem.
+func ParseTheme(value string) (string, error) {
+	switch value {
+	case "", ThemeSystem:
+		return ThemeSystem, nil
+	case ThemeDark, ThemeLight:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid theme %q (use system, dark or light)", value)
+	}
+}
+
+// ClampFontScale keeps scale within MinFontScale and MaxFontScale; 0 is 1.
+func ClampFontScale(scale float64) float64 {
+	if scale == 0 {
+		return 1
+	}
+	return min(max(scale, MinFontScale), MaxFontScale)
+}
+
+// normalizeAppearance replaces appearance values a hand-edited or older
+// settings file may hold with ones the GUI can apply.
+func (s *Settings) normalizeAppearance() {
+	if theme, err := ParseTheme(s.Theme); err == nil {
+		s.Theme = theme
+	} else {
+		s.Theme = ThemeSystem
+	}
+	s.FontScale = ClampFontScale(s.FontScale)
+	if s.Window != nil && (s.Window.Width < minWindowWidth || s.Window.Height < minWindowHeight) {
+		s.Window = nil
 	}
 }
 
@@ -97,6 +178,7 @@ func LoadSettings(path string) (Settings, error) {
 	settings.Include = append([]string{}, settings.Include...)
 	settings.Exclude = append([]string{}, settings.Exclude...)
 	settings.ZipPasswords = append([]string{}, settings.ZipPasswords...)
+	settings.normalizeAppearance()
 	return settings, nil
 }
 
@@ -118,6 +200,19 @@ func SaveSettings(path string, settings Settings) error {
 	return os.WriteFile(path, data, 0o644)
 }
 
+// UpdateSettings loads the settings at path, applies update and saves
+// them, so one part of the settings changes without the frontend sending
+// the rest. It returns the saved settings.
+func UpdateSettings(path string, update func(*Settings)) (Settings, error) {
+	settings, err := LoadSettings(path)
+	if err != nil {
+		return Settings{}, err
+	}
+	update(&settings)
+	settings.normalizeAppearance()
+	return settings, SaveSettings(path, settings)
+}
+
 func LoadTelegramConfig(path string) (TelegramConfig, error) {
 	apiURLs, tokens, err := config.LoadConfig(path)
 	if err != nil {
@@ -129,3 +224,31 @@ func LoadTelegramConfig(path string) (TelegramConfig, error) {
 func SaveTelegramConfig(path string, cfg TelegramConfig) error {
 	return config.SaveConfig(path, cfg.APIURLs, cfg.Tokens)
 }
+
+// MergeSafeSettings applies next on top of current for a running watch,
+// keeping the fields that identify the run's source, destination and queue.
+// The JSON names of rejected fields are returned.
+func MergeSafeSettings(current Settings, next Settings) (Settings, []string) {
+	rejected := []string{}
+	if current.WatchDir != next.WatchDir {
+		rejected = append(rejected, "watch_dir")
+		next.WatchDir = current.WatchDir
+	}
+	if current.ChatID != next.ChatID {
+		rejected = append(rejected, "chat_id")
+		next.ChatID = current.ChatID
+	}
+	if !reflect.DeepEqual(current.TopicID, next.TopicID) {
+		rejected = append(rejected, "topic_id")
+		next.TopicID = current.TopicID
+	}
+	if current.QueueFile != next.QueueFile {
+		rejected = append(rejected, "queue_file")
+		next.QueueFile = current.QueueFile
+	}
+	if current.ConfigPath != next.ConfigPath {
+		rejected = append(rejected, "config_path")
+		next.ConfigPath = current.ConfigPath
+	}
+	return next, rejected
+}
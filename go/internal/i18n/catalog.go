@@ -0,0 +1,338 @@
+package i18n
+
+// catalogs maps each language to its messages. Formats take fmt verbs in
+// the order of the English text; run.start and run.done are text/template
+// sources with the fields of the run messages.
+var catalogs = map[string]map[string]string{
+	English: {
+		"run.start": "Starting {{.Kind}} upload from {{.Source}}: {{.Count}} file(s){{if .TotalBytesRaw}}, {{.TotalBytes}}, ETA ~{{.ETA}}{{end}} at {{.Time}}",
+		"run.done":  "Completed {{.Kind}} upload from {{.Source}} at {{.Time}} (elapsed {{.Elapsed}}, avg/file {{.AvgPerFile}}, total {{.Bytes}}, avg {{.Speed}}, sent {{.Sent}}, skipped {{.Skipped}}{{if .Unreadable}}, unreadable {{.Unreadable}}{{end}})",
+
+		"gui.start": "Starting %s upload: %d file(s)",
+		"gui.done":  "Completed %s upload (%d file(s))",
+
+		"notify.started":         "Watch started (elapsed %s)",
+		"notify.status":          "Watch status: elapsed %s, queued %d, sending %d, sent %d, failed %d",
+		"notify.failedPermanent": ", failed permanently %d",
+		"notify.sourceMissing":   ", source missing %d",
+		"notify.unreadable":      ", unreadable %d",
+		"notify.idle":            "Watch idle (elapsed %s)",
+		"notify.daily":           "Daily summary: sent %d file(s), %d bytes in the last %s; queued %d, failed %d",
+		"notify.quota":           "Daily quota reached: sent %d file(s), %d bytes today; paused until %s",
+		"notify.failures":        "Send failures: %d new, %d failed in total",
+		"notify.failureItem":     "- %s [%s, %d attempt(s)] %s",
+		"notify.failuresMore":    "... and %d more",
+
+		"tray.show":              "Show window",
+		"tray.show.tooltip":      "Show the main window",
+		"tray.pauseAll":          "Pause all",
+		"tray.pauseAll.tooltip":  "Pause all active runs",
+		"tray.resumeAll":         "Resume all",
+		"tray.resumeAll.tooltip": "Resume all paused runs",
+		"tray.quit":              "Quit",
+		"tray.quit.tooltip":      "Stop all active runs and quit",
+		"tray.idle":              "idle",
+		"tray.running":           "%d running",
+		"tray.paused":            "%d paused",
+		"tray.alsoPaused":        ", %d paused",
+		"tray.newFailures":       ", %d new failure(s)",
+
+		// ui.* are the GUI frontend's strings, sent to it by the Locale binding.
+		"ui.subtitle":              "Configure Telegram targets, switch modes, and track progress with per-file timing and ETA.",
+		"ui.mode":                  "Mode",
+		"ui.active":                "Active: %s",
+		"ui.tab.watch":             "Watch",
+		"ui.tab.sendImages":        "Send Images",
+		"ui.tab.sendFiles":         "Send Files",
+		"ui.tab.sendVideo":         "Send Video",
+		"ui.tab.sendAudio":         "Send Audio",
+		"ui.watchDir":              "Watch dir",
+		"ui.browse":                "Browse",
+		"ui.queueFile":             "Queue file",
+		"ui.queueFile.auto":        "Auto (per-target file in state dir)",
+		"ui.recursive":             "Recursive",
+		"ui.images":                "Images",
+		"ui.video":                 "Video",
+		"ui.audio":                 "Audio",
+		"ui.allFiles":              "All files",
+		"ui.followSymlinks":        "Follow symlinks",
+		"ui.hiddenFiles":           "Hidden files",
+		"ui.notify":                "Notify",
+		"ui.minimizeToTray":        "Minimize to tray",
+		"ui.imageDir":              "Image dir",
+		"ui.zipFile":               "Zip file",
+		"ui.groupSize":             "Group size",
+		"ui.startIndex":            "Start index",
+		"ui.endIndex":              "End index",
+		"ui.batchDelay":            "Batch delay",
+		"ui.enableZip":             "Enable zip scanning",
+		"ui.filePath":              "File path",
+		"ui.directory":             "Directory",
+		"ui.advanced":              "Advanced settings",
+		"ui.includeGlobs":          "Include globs",
+		"ui.excludeGlobs":          "Exclude globs",
+		"ui.zipPasswords":          "Zip passwords",
+		"ui.zipPassFile":           "Zip password file",
+		"ui.scanInterval":          "Scan interval",
+		"ui.sendInterval":          "Send interval",
+		"ui.settleSeconds":         "Settle seconds",
+		"ui.pauseEvery":            "Pause every",
+		"ui.pauseSeconds":          "Pause seconds",
+		"ui.notifyInterval":        "Notify interval",
+		"ui.language":              "Language",
+		"ui.theme":                 "Theme",
+		"ui.theme.system":          "System",
+		"ui.theme.dark":            "Dark",
+		"ui.theme.light":           "Light",
+		"ui.textSize":              "Text size",
+		"ui.maxDimension":          "Max dimension",
+		"ui.maxBytes":              "Max bytes",
+		"ui.pngLevel":              "PNG level",
+		"ui.configuration":         "Configuration",
+		"ui.settingsFile":          "Settings file: %s",
+		"ui.settingsFile.default":  "default",
+		"ui.save":                  "Save",
+		"ui.configPath":            "Config path",
+		"ui.apiURLs":               "API URLs",
+		"ui.botTokens":             "Bot tokens",
+		"ui.validateTokens":        "Validate tokens",
+		"ui.validating":            "Validating...",
+		"ui.chatID":                "Chat ID",
+		"ui.findChats":             "Find chats",
+		"ui.selectChat":            "Select a chat",
+		"ui.forum":                 ", forum",
+		"ui.topicID":               "Topic ID",
+		"ui.optional":              "Optional",
+		"ui.findTopics":            "Find topics",
+		"ui.noTopic":               "No topic",
+		"ui.runControls":           "Run controls",
+		"ui.activeMode":            "Active mode: %s",
+		"ui.startWatch":            "Start watch",
+		"ui.startSend":             "Start send",
+		"ui.idle":                  "Idle",
+		"ui.paused":                "Paused",
+		"ui.running":               "Running",
+		"ui.pause":                 "Pause",
+		"ui.continue":              "Continue",
+		"ui.stop":                  "Stop",
+		"ui.progress":              "Progress",
+		"ui.finished":              " (finished)",
+		"ui.completed":             "%d/%d completed",
+		"ui.remaining":             "Remaining: %d",
+		"ui.eta":                   "ETA %s",
+		"ui.currentFile":           "Current file",
+		"ui.perFileTime":           "Per-file time",
+		"ui.status":                "Status",
+		"ui.history":               "History",
+		"ui.historyTotals":         "Last %d days: %d sent, %d failed, %s",
+		"ui.refresh":               "Refresh",
+		"ui.chart.volume":          "Daily volume",
+		"ui.chart.successRate":     "Success rate",
+		"ui.chart.speed":           "Average speed",
+		"ui.noRuns":                "No finished runs yet",
+		"ui.col.finished":          "Finished",
+		"ui.col.run":               "Run",
+		"ui.col.source":            "Source",
+		"ui.col.destination":       "Destination",
+		"ui.col.sent":              "Sent",
+		"ui.col.failed":            "Failed",
+		"ui.col.size":              "Size",
+		"ui.col.duration":          "Duration",
+		"ui.pick.config":           "Select config file",
+		"ui.pick.watchDir":         "Select watch directory",
+		"ui.pick.queueFile":        "Select queue file",
+		"ui.pick.zipPassFile":      "Select zip password file",
+		"ui.pick.imageDir":         "Select image directory",
+		"ui.pick.imageZip":         "Select image zip",
+		"ui.pick.file":             "Select file",
+		"ui.pick.directory":        "Select directory",
+		"ui.pick.zipFile":          "Select zip file",
+		"ui.saved":                 "Saved settings.",
+		"ui.noChats":               "No chats found. Send a message in the chat (or add the bot) and try again.",
+		"ui.noTopics":              "No topics found. Post a message in the topic and try again.",
+		"ui.failed.dialog":         "Dialog failed: %s",
+		"ui.failed.load":           "Load failed: %s",
+		"ui.failed.loadConfig":     "Load config failed: %s",
+		"ui.failed.history":        "Load history failed: %s",
+		"ui.failed.findChats":      "Find chats failed: %s",
+		"ui.failed.findTopics":     "Find topics failed: %s",
+		"ui.failed.validateTokens": "Validate tokens failed: %s",
+		"ui.failed.save":           "Save failed: %s",
+		"ui.failed.start":          "Start failed: %s",
+		"ui.failed.pause":          "Pause failed: %s",
+		"ui.failed.resume":         "Resume failed: %s",
+		"ui.failed.stop":           "Stop failed: %s",
+		"ui.failed.language":       "Language change failed: %s",
+		"ui.failed.theme":          "Theme change failed: %s",
+		"ui.failed.textSize":       "Text size change failed: %s",
+	},
+	Chinese: {
+		"run.start": "开始上传{{.Kind}}：{{.Source}}，共 {{.Count}} 个文件{{if .TotalBytesRaw}}，{{.TotalBytes}}，预计 ~{{.ETA}}{{end}}，时间 {{.Time}}",
+		"run.done":  "{{.Kind}}上传完成：{{.Source}}，时间 {{.Time}}（耗时 {{.Elapsed}}，平均每个文件 {{.AvgPerFile}}，共 {{.Bytes}}，平均速度 {{.Speed}}，已发送 {{.Sent}}，已跳过 {{.Skipped}}{{if .Unreadable}}，无法读取 {{.Unreadable}}{{end}}）",
+
+		"gui.start": "开始上传%s：共 %d 个文件",
+		"gui.done":  "%s上传完成（共 %d 个文件）",
+
+		"notify.started":         "开始监控（已运行 %s）",
+		"notify.status":          "监控状态：已运行 %s，排队 %d，发送中 %d，已发送 %d，失败 %d",
+		"notify.failedPermanent": "，永久失败 %d",
+		"notify.sourceMissing":   "，源文件缺失 %d",
+		"notify.unreadable":      "，无法读取 %d",
+		"notify.idle":            "监控空闲（已运行 %s）",
+		"notify.daily":           "每日汇总：过去 %[3]s 内已发送 %[1]d 个文件，%[2]d 字节；排队 %[4]d，失败 %[5]d",
+		"notify.quota":           "已达每日配额：今日已发送 %d 个文件，%d 字节；暂停至 %s",
+		"notify.failures":        "发送失败：新增 %d 个，累计失败 %d 个",
+		"notify.failureItem":     "- %s [%s，%d 次尝试] %s",
+		"notify.failuresMore":    "……另有 %d 个",
+
+		"tray.show":              "显示窗口",
+		"tray.show.tooltip":      "显示主窗口",
+		"tray.pauseAll":          "全部暂停",
+		"tray.pauseAll.tooltip":  "暂停所有运行中的任务",
+		"tray.resumeAll":         "全部恢复",
+		"tray.resumeAll.tooltip": "恢复所有已暂停的任务",
+		"tray.quit":              "退出",
+		"tray.quit.tooltip":      "停止所有任务并退出",
+		"tray.idle":              "空闲",
+		"tray.running":           "%d 个运行中",
+		"tray.paused":            "%d 个已暂停",
+		"tray.alsoPaused":        "，%d 个已暂停",
+		"tray.newFailures":       "，%d 个新失败",
+
+		"ui.subtitle":              "配置 Telegram 目标、切换模式，并按文件查看耗时与预计剩余时间。",
+		"ui.mode":                  "模式",
+		"ui.active":                "当前：%s",
+		"ui.tab.watch":             "监控",
+		"ui.tab.sendImages":        "发送图片",
+		"ui.tab.sendFiles":         "发送文件",
+		"ui.tab.sendVideo":         "发送视频",
+		"ui.tab.sendAudio":         "发送音频",
+		"ui.watchDir":              "监控目录",
+		"ui.browse":                "浏览",
+		"ui.queueFile":             "队列文件",
+		"ui.queueFile.auto":        "自动（状态目录中按目标区分的文件）",
+		"ui.recursive":             "递归",
+		"ui.images":                "图片",
+		"ui.video":                 "视频",
+		"ui.audio":                 "音频",
+		"ui.allFiles":              "所有文件",
+		"ui.followSymlinks":        "跟随符号链接",
+		"ui.hiddenFiles":           "隐藏文件",
+		"ui.notify":                "通知",
+		"ui.minimizeToTray":        "最小化到托盘",
+		"ui.imageDir":              "图片目录",
+		"ui.zipFile":               "Zip 文件",
+		"ui.groupSize":             "分组大小",
+		"ui.startIndex":            "起始序号",
+		"ui.endIndex":              "结束序号",
+		"ui.batchDelay":            "批次间隔",
+		"ui.enableZip":             "扫描 zip 文件",
+		"ui.filePath":              "文件路径",
+		"ui.directory":             "目录",
+		"ui.advanced":              "高级设置",
+		"ui.includeGlobs":          "包含规则",
+		"ui.excludeGlobs":          "排除规则",
+		"ui.zipPasswords":          "Zip 密码",
+		"ui.zipPassFile":           "Zip 密码文件",
+		"ui.scanInterval":          "扫描间隔",
+		"ui.sendInterval":          "发送间隔",
+		"ui.settleSeconds":         "稳定等待秒数",
+		"ui.pauseEvery":            "每发送多少个后暂停",
+		"ui.pauseSeconds":          "暂停秒数",
+		"ui.notifyInterval":        "通知间隔",
+		"ui.language":              "语言",
+		"ui.theme":                 "主题",
+		"ui.theme.system":          "跟随系统",
+		"ui.theme.dark":            "深色",
+		"ui.theme.light":           "浅色",
+		"ui.textSize":              "文字大小",
+		"ui.maxDimension":          "最大边长",
+		"ui.maxBytes":              "最大字节数",
+		"ui.pngLevel":              "PNG 压缩级别",
+		"ui.configuration":         "配置",
+		"ui.settingsFile":          "设置文件：%s",
+		"ui.settingsFile.default":  "默认",
+		"ui.save":                  "保存",
+		"ui.configPath":            "配置文件路径",
+		"ui.apiURLs":               "API 地址",
+		"ui.botTokens":             "机器人令牌",
+		"ui.validateTokens":        "验证令牌",
+		"ui.validating":            "验证中...",
+		"ui.chatID":                "聊天 ID",
+		"ui.findChats":             "查找聊天",
+		"ui.selectChat":            "选择聊天",
+		"ui.forum":                 "，论坛",
+		"ui.topicID":               "话题 ID",
+		"ui.optional":              "可选",
+		"ui.findTopics":            "查找话题",
+		"ui.noTopic":               "无话题",
+		"ui.runControls":           "任务控制",
+		"ui.activeMode":            "当前模式：%s",
+		"ui.startWatch":            "开始监控",
+		"ui.startSend":             "开始发送",
+		"ui.idle":                  "空闲",
+		"ui.paused":                "已暂停",
+		"ui.running":               "运行中",
+		"ui.pause":                 "暂停",
+		"ui.continue":              "继续",
+		"ui.stop":                  "停止",
+		"ui.progress":              "进度",
+		"ui.finished":              "（已结束）",
+		"ui.completed":             "已完成 %d/%d",
+		"ui.remaining":             "剩余：%d",
+		"ui.eta":                   "预计剩余 %s",
+		"ui.currentFile":           "当前文件",
+		"ui.perFileTime":           "单文件耗时",
+		"ui.status":                "状态",
+		"ui.history":               "历史",
+		"ui.historyTotals":         "最近 %d 天：已发送 %d，失败 %d，%s",
+		"ui.refresh":               "刷新",
+		"ui.chart.volume":          "每日上传量",
+		"ui.chart.successRate":     "成功率",
+		"ui.chart.speed":           "平均速度",
+		"ui.noRuns":                "暂无已结束的任务",
+		"ui.col.finished":          "结束时间",
+		"ui.col.run":               "任务",
+		"ui.col.source":            "来源",
+		"ui.col.destination":       "目标",
+		"ui.col.sent":              "已发送",
+		"ui.col.failed":            "失败",
+		"ui.col.size":              "大小",
+		"ui.col.duration":          "耗时",
+		"ui.pick.config":           "选择配置文件",
+		"ui.pick.watchDir":         "选择监控目录",
+		"ui.pick.queueFile":        "选择队列文件",
+		"ui.pick.zipPassFile":      "选择 zip 密码文件",
+		"ui.pick.imageDir":         "选择图片目录",
+		"ui.pick.imageZip":         "选择图片 zip",
+		"ui.pick.file":             "选择文件",
+		"ui.pick.directory":        "选择目录",
+		"ui.pick.zipFile":          "选择 zip 文件",
+		"ui.saved":                 "设置已保存。",
+		"ui.noChats":               "未找到聊天。请先在聊天中发送一条消息（或添加机器人）后重试。",
+		"ui.noTopics":              "未找到话题。请先在话题中发送一条消息后重试。",
+		"ui.failed.dialog":         "打开对话框失败：%s",
+		"ui.failed.load":           "加载失败：%s",
+		"ui.failed.loadConfig":     "加载配置失败：%s",
+		"ui.failed.history":        "加载历史失败：%s",
+		"ui.failed.findChats":      "查找聊天失败：%s",
+		"ui.failed.findTopics":     "查找话题失败：%s",
+		"ui.failed.validateTokens": "验证令牌失败：%s",
+		"ui.failed.save":           "保存失败：%s",
+		"ui.failed.start":          "启动失败：%s",
+		"ui.failed.pause":          "暂停失败：%s",
+		"ui.failed.resume":         "继续失败：%s",
+		"ui.failed.stop":           "停止失败：%s",
+		"ui.failed.language":       "切换语言失败：%s",
+		"ui.failed.theme":          "切换主题失败：%s",
+		"ui.failed.textSize":       "修改文字大小失败：%s",
+
+		"image":   "图片",
+		"video":   "视频",
+		"audio":   "音频",
+		"file":    "文件",
+		"mixed":   "混合媒体",
+		"pdf":     "PDF",
+		"archive": "压缩包",
+	},
+}
@@ -0,0 +1,86 @@
+// Package i18n translates the messages the CLI, daemon and GUI post to
+// Telegram and show in their own interfaces. The language is process-wide,
+// like the resize backend, and selected once from --lang or the GUI
+// settings.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Languages.
+const (
+	English = "en"
+	Chinese = "zh-CN"
+)
+
+var Languages = []string{English, Chinese}
+
+var current atomic.Value
+
+// Parse returns the language named by value, accepting common spellings
+// such as zh, zh_CN and en-US. An empty value selects English.
+func Parse(value string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(value), "_", "-"))
+	if dot := strings.IndexByte(normalized, '.'); dot >= 0 {
+		normalized = normalized[:dot]
+	}
+	switch {
+	case normalized == "" || normalized == "en" || strings.HasPrefix(normalized, "en-"):
+		return English, nil
+	case normalized == "zh" || normalized == "zh-cn" || normalized == "zh-hans" || normalized == "zh-sg":
+		return Chinese, nil
+	}
+	return "", fmt.Errorf("unknown language %q (want %s)", value, strings.Join(Languages, ", "))
+}
+
+// SetLang selects the language T uses from now on.
+func SetLang(value string) error {
+	lang, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	current.Store(lang)
+	return nil
+}
+
+// Lang returns the selected language.
+func Lang() string {
+	if lang, ok := current.Load().(string); ok {
+		return lang
+	}
+	return English
+}
+
+// T returns the message key in the selected language, formatted with args
+// when there are any. Keys missing from a catalog fall back to English and
+// then to the key itself, so a plain word can serve as its own key.
+func T(key string, args ...any) string {
+	format, ok := catalogs[Lang()][key]
+	if !ok {
+		if format, ok = catalogs[English][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Messages returns the messages whose keys start with prefix in the
+// selected language, with English for those it lacks, for interfaces that
+// format them themselves such as the GUI frontend.
+func Messages(prefix string) map[string]string {
+	messages := map[string]string{}
+	for _, lang := range []string{English, Lang()} {
+		for key, format := range catalogs[lang] {
+			if strings.HasPrefix(key, prefix) {
+				messages[key] = format
+			}
+		}
+	}
+	return messages
+}
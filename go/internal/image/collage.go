@@ -0,0 +1,74 @@
+package imageutil
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/disintegration/imaging"
+)
+
+// CollageSize is the long side of a collage sheet; Telegram shows photos
+// up to 2560 pixels.
+const CollageSize = 2560
+
+const collageGap = 8
+
+var collageBackground = color.NRGBA{R: 24, G: 24, B: 27, A: 255}
+
+// Decode decodes an image file, converting HEIC first.
+func Decode(data []byte) (image.Image, error) {
+	if IsHEIC(data) {
+		converted, err := HEICToJPEG(data)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Collage lays images out row by row in a cols x rows grid, each scaled to
+// fit its cell and centred on a dark background. The sheet's long side is
+// CollageSize; images beyond the grid are ignored.
+func Collage(images []image.Image, cols int, rows int) image.Image {
+	cell := (CollageSize - collageGap*(max(cols, rows)+1)) / max(cols, rows)
+	width := cols*cell + (cols+1)*collageGap
+	height := rows*cell + (rows+1)*collageGap
+	sheet := imaging.New(width, height, collageBackground)
+	for idx, img := range images {
+		if idx >= cols*rows {
+			break
+		}
+		// Fit only shrinks; scale small images up to fill the cell too.
+		bounds := img.Bounds()
+		width, height := cell, bounds.Dy()*cell/max(bounds.Dx(), 1)
+		if height > cell {
+			width, height = bounds.Dx()*cell/max(bounds.Dy(), 1), cell
+		}
+		fitted := imaging.Resize(img, max(width, 1), max(height, 1), imaging.Lanczos)
+		bounds = fitted.Bounds()
+		x := collageGap + (idx%cols)*(cell+collageGap) + (cell-bounds.Dx())/2
+		y := collageGap + (idx/cols)*(cell+collageGap) + (cell-bounds.Dy())/2
+		sheet = imaging.Paste(sheet, fitted, image.Pt(x, y))
+	}
+	return sheet
+}
+
+// EncodeJPEG encodes img as a JPEG of at most maxBytes, lowering the
+// quality as needed (0 disables the limit).
+func EncodeJPEG(img image.Image, maxBytes int) ([]byte, error) {
+	for quality := 90; quality >= 30; quality -= 10 {
+		buffer := &bytes.Buffer{}
+		if err := jpeg.Encode(buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		if maxBytes <= 0 || buffer.Len() <= maxBytes {
+			return buffer.Bytes(), nil
+		}
+	}
+	return nil, errors.New("image does not fit the size limit")
+}
@@ -0,0 +1,99 @@
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+)
+
+// heicBrands are the HEVC ftyp brands of HEIF images, as written by iPhones
+// and most Android cameras. The generic mif1 brand is also used by AVIF.
+var heicBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx"}
+
+// IsHEIC reports whether data is a HEIC/HEIF image, from its ftyp box.
+func IsHEIC(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size < 16 || size > len(data) {
+		size = min(len(data), 64)
+	}
+	for offset := 8; offset+4 <= size; offset += 4 {
+		if offset == 12 {
+			// Minor version, not a brand.
+			continue
+		}
+		brand := string(data[offset : offset+4])
+		for _, known := range heicBrands {
+			if brand == known {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type heicConverter struct {
+	binary string
+	path   string
+	args   func(input string, output string) []string
+}
+
+// heicConverters are tried in order; each turns the input file into a JPEG
+// at the output path.
+var heicConverters = []heicConverter{
+	{binary: "heif-convert", args: func(input, output string) []string { return []string{"-q", "92", input, output} }},
+	{binary: "heif-dec", args: func(input, output string) []string { return []string{"-q", "92", input, output} }},
+	{binary: "magick", args: func(input, output string) []string { return []string{input, "-quality", "92", output} }},
+	{binary: "sips", args: func(input, output string) []string {
+		return []string{"-s", "format", "jpeg", "-s", "formatOptions", "92", input, "--out", output}
+	}},
+}
+
+var findHEICConverter = sync.OnceValues(func() (heicConverter, error) {
+	for _, converter := range heicConverters {
+		if path, err := exec.LookPath(converter.binary); err == nil {
+			converter.path = path
+			return converter, nil
+		}
+	}
+	return heicConverter{}, fmt.Errorf("HEIC conversion needs heif-convert (libheif), ImageMagick (magick) or sips in PATH")
+})
+
+// HEICToJPEG converts a HEIC/HEIF image to JPEG with an external converter.
+// Go has no HEVC decoder, so libheif, ImageMagick or macOS sips does the
+// decoding; the converters apply the EXIF rotation.
+func HEICToJPEG(data []byte) ([]byte, error) {
+	converter, err := findHEICConverter()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := tempdir.MkdirTemp("heic-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.heic")
+	output := filepath.Join(dir, "output.jpg")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, err
+	}
+	if out, err := exec.Command(converter.path, converter.args(input, output)...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", converter.binary, err, strings.TrimSpace(string(out)))
+	}
+	converted, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("%s produced no JPEG: %w", converter.binary, err)
+	}
+	if !bytes.HasPrefix(converted, []byte{0xff, 0xd8}) {
+		return nil, fmt.Errorf("%s produced no JPEG", converter.binary)
+	}
+	return converted, nil
+}
@@ -0,0 +1,42 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// DHash computes a 64-bit difference hash. Visually similar images (resized,
+// recompressed, burst shots) end up a small Hamming distance apart.
+func DHash(data []byte) (uint64, error) {
+	if IsHEIC(data) {
+		converted, err := HEICToJPEG(data)
+		if err != nil {
+			return 0, err
+		}
+		data = converted
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -2,6 +2,8 @@ package imageutil
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
@@ -12,49 +14,89 @@ import (
 	"github.com/disintegration/imaging"
 )
 
+// ErrInvalidImage wraps the error of an image that does not decode.
+var ErrInvalidImage = errors.New("invalid image")
+
 type Result struct {
 	Data     []byte
 	Filename string
+	// Document is set when the quality guard kept the original bytes,
+	// which are then sent as a document; Reason says why.
+	Document bool
+	Reason   string
 }
 
 func Prepare(data []byte, filename string, maxDimension int, maxBytes int, pngStartLevel int) (*Result, error) {
-	img, format, err := image.Decode(bytes.NewReader(data))
+	return PrepareWithBackend(data, filename, maxDimension, maxBytes, pngStartLevel, currentResizeBackend())
+}
+
+// PrepareWithBackend is Prepare with an explicit resize backend. Images
+// vipsthumbnail cannot shrink are resized with the fast backend instead.
+func PrepareWithBackend(data []byte, filename string, maxDimension int, maxBytes int, pngStartLevel int, backend string) (*Result, error) {
+	result, from, to, err := prepare(data, filename, maxDimension, maxBytes, pngStartLevel, backend)
 	if err != nil {
 		return nil, err
 	}
+	if reason := qualityGuard.Load().check(len(data), result, from, to); reason != "" {
+		return &Result{Data: data, Filename: filename, Document: true, Reason: reason}, nil
+	}
+	return result, nil
+}
+
+// prepare encodes the image and returns its dimensions before and after.
+func prepare(data []byte, filename string, maxDimension int, maxBytes int, pngStartLevel int, backend string) (*Result, image.Point, image.Point, error) {
+	if IsHEIC(data) {
+		converted, err := HEICToJPEG(data)
+		if err != nil {
+			return nil, image.Point{}, image.Point{}, err
+		}
+		data = converted
+		filename = ensureExt(filename, ".jpg")
+	}
+	var from image.Point
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		from = image.Pt(config.Width, config.Height)
+	}
+	if backend == ResizeVips {
+		if resized, err := vipsResize(data, maxDimension); err == nil {
+			data = resized
+		}
+		backend = ResizeFast
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Point{}, image.Point{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if from == (image.Point{}) {
+		from = img.Bounds().Size()
+	}
 
-	img = resizeIfNeeded(img, maxDimension)
+	img = ApplyWatermark(resizeIfNeeded(img, maxDimension, backend))
+	to := img.Bounds().Size()
 
 	encoded, outName, err := encodeOriginal(img, format, filename)
 	if err != nil {
-		return nil, err
+		return nil, image.Point{}, image.Point{}, err
 	}
 	if len(encoded) <= maxBytes {
-		return &Result{Data: encoded, Filename: outName}, nil
+		return &Result{Data: encoded, Filename: outName}, from, to, nil
 	}
 
 	pngBytes, _, err := compressPNGGready(img, maxBytes, pngStartLevel)
 	if err != nil {
-		return nil, err
+		return nil, image.Point{}, image.Point{}, err
 	}
-	return &Result{Data: pngBytes, Filename: toPNGName(filename)}, nil
+	return &Result{Data: pngBytes, Filename: toPNGName(filename)}, from, to, nil
 }
 
-func resizeIfNeeded(img image.Image, maxDimension int) image.Image {
+func resizeIfNeeded(img image.Image, maxDimension int, backend string) image.Image {
 	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-	if maxDimension <= 0 || max(width, height) <= maxDimension {
+	newW, newH, resize := fitSize(bounds.Dx(), bounds.Dy(), maxDimension)
+	if !resize {
 		return img
 	}
-	scale := float64(maxDimension) / float64(max(width, height))
-	newW := int(float64(width) * scale)
-	newH := int(float64(height) * scale)
-	if newW < 1 {
-		newW = 1
-	}
-	if newH < 1 {
-		newH = 1
+	if backend == ResizeFast {
+		return resizeFast(img, newW, newH)
 	}
 	return imaging.Resize(img, newW, newH, imaging.Lanczos)
 }
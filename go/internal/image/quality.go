@@ -0,0 +1,98 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Default quality guard thresholds, in percent.
+const (
+	DefaultGuardSize = 50
+	DefaultGuardDim  = 30
+)
+
+// QualityGuard makes Prepare keep an image's original bytes, to be sent as
+// a document, when fitting it to the photo limits would lose too much: a
+// lossy re-encode that shrinks it by more than Size percent, or a resize
+// that shortens its longer side by more than Dim percent. A zero threshold
+// turns that check off.
+type QualityGuard struct {
+	Size int
+	Dim  int
+}
+
+var qualityGuard atomic.Pointer[QualityGuard]
+
+// ParseQualityGuard reads a --quality-guard value: "off" or empty for none,
+// "on" for the default thresholds, or "size=N,dim=N" where a missing key
+// keeps its default.
+func ParseQualityGuard(value string) (*QualityGuard, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "off" {
+		return nil, nil
+	}
+	guard := &QualityGuard{Size: DefaultGuardSize, Dim: DefaultGuardDim}
+	if value == "on" {
+		return guard, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		key, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		percent, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(raw), "%"))
+		if !ok || err != nil || percent < 0 || percent > 99 {
+			return nil, fmt.Errorf("invalid quality guard %q (want on, off or size=N,dim=N with N from 0 to 99)", value)
+		}
+		switch strings.TrimSpace(key) {
+		case "size":
+			guard.Size = percent
+		case "dim":
+			guard.Dim = percent
+		default:
+			return nil, fmt.Errorf("unknown quality guard key %q (want size or dim)", key)
+		}
+	}
+	return guard, nil
+}
+
+func (g *QualityGuard) String() string {
+	return fmt.Sprintf("size=%d,dim=%d", g.Size, g.Dim)
+}
+
+// SetQualityGuard makes Prepare apply g from now on; nil turns it off.
+func SetQualityGuard(g *QualityGuard) {
+	qualityGuard.Store(g)
+}
+
+// check returns why sending out instead of the original loses too much, or
+// "" when it does not.
+func (g *QualityGuard) check(originalBytes int, out *Result, from image.Point, to image.Point) string {
+	if g == nil {
+		return ""
+	}
+	if g.Dim > 0 && max(from.X, from.Y) > 0 {
+		shrink := 100 - 100*max(to.X, to.Y)/max(from.X, from.Y)
+		if shrink > g.Dim {
+			return fmt.Sprintf("resizing it from %dx%d to %dx%d shrinks it by %d%%", from.X, from.Y, to.X, to.Y, shrink)
+		}
+	}
+	if g.Size > 0 && originalBytes > 0 && lossy(out.Filename) && len(out.Data) < originalBytes {
+		loss := 100 - 100*len(out.Data)/originalBytes
+		if loss > g.Size {
+			return fmt.Sprintf("re-encoding it loses %d%% of its size", loss)
+		}
+	}
+	return ""
+}
+
+// lossy reports whether Prepare encodes name with a lossy format; PNG
+// output is the same image however much smaller it gets.
+func lossy(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+)
+
+// Resize backends. Lanczos gives the sharpest result and is the slowest;
+// fast samples huge images down with nearest neighbour before a bilinear
+// pass; vips hands decoding and resizing to libvips' vipsthumbnail, which
+// shrinks JPEGs while decoding them.
+const (
+	ResizeLanczos = "lanczos"
+	ResizeFast    = "fast"
+	ResizeVips    = "vips"
+)
+
+var ResizeBackends = []string{ResizeLanczos, ResizeFast, ResizeVips}
+
+var resizeBackend atomic.Value
+
+var vipsthumbnailPath = sync.OnceValue(func() string { path, _ := exec.LookPath("vipsthumbnail"); return path })
+
+// CheckResizeBackend reports whether name is a known backend that can run
+// here.
+func CheckResizeBackend(name string) error {
+	switch name {
+	case ResizeLanczos, ResizeFast:
+		return nil
+	case ResizeVips:
+		if vipsthumbnailPath() == "" {
+			return fmt.Errorf("resize backend vips needs vipsthumbnail (libvips-tools) in PATH")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown resize backend %q (want %s)", name, strings.Join(ResizeBackends, ", "))
+}
+
+// SetResizeBackend selects the backend Prepare uses from now on; "" keeps
+// lanczos.
+func SetResizeBackend(name string) error {
+	if name == "" {
+		name = ResizeLanczos
+	}
+	if err := CheckResizeBackend(name); err != nil {
+		return err
+	}
+	resizeBackend.Store(name)
+	return nil
+}
+
+func currentResizeBackend() string {
+	if name, ok := resizeBackend.Load().(string); ok {
+		return name
+	}
+	return ResizeLanczos
+}
+
+// fitSize scales width x height to fit within maxDimension, or reports false
+// when it already does.
+func fitSize(width int, height int, maxDimension int) (int, int, bool) {
+	if maxDimension <= 0 || max(width, height) <= maxDimension {
+		return width, height, false
+	}
+	scale := float64(maxDimension) / float64(max(width, height))
+	newW := int(float64(width) * scale)
+	newH := int(float64(height) * scale)
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+	return newW, newH, true
+}
+
+// resizeFast samples img down to twice the target size with nearest
+// neighbour, which reads one source pixel per output pixel, then smooths
+// the rest of the way bilinearly.
+func resizeFast(img image.Image, width int, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() > 4*width && bounds.Dy() > 4*height {
+		img = imaging.Resize(img, 2*width, 2*height, imaging.NearestNeighbor)
+	}
+	return imaging.Resize(img, width, height, imaging.Linear)
+}
+
+// vipsResize shrinks JPEG and PNG data to fit within maxDimension with
+// vipsthumbnail, keeping the format. It returns data unchanged when the
+// image is small enough or in another format.
+func vipsResize(data []byte, maxDimension int) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if _, _, resize := fitSize(config.Width, config.Height, maxDimension); !resize {
+		return data, nil
+	}
+	ext := ""
+	switch format {
+	case "jpeg":
+		ext = ".jpg"
+	case "png":
+		ext = ".png"
+	default:
+		return data, nil
+	}
+	dir, err := tempdir.MkdirTemp("vips-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input"+ext)
+	output := filepath.Join(dir, "output"+ext)
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, err
+	}
+	size := fmt.Sprintf("%dx%d", maxDimension, maxDimension)
+	target := output
+	if format == "jpeg" {
+		target += "[Q=95]"
+	}
+	if out, err := exec.Command(vipsthumbnailPath(), input, "--size", size, "-o", target).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("vipsthumbnail failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
@@ -0,0 +1,43 @@
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/disintegration/imaging"
+)
+
+// Telegram's limits for the thumbnail of a document, video or audio upload.
+const (
+	ThumbnailMaxDimension = 320
+	ThumbnailMaxBytes     = 200 * 1024
+)
+
+// Thumbnail scales an image to fit 320x320 and encodes it as a JPEG under
+// 200 kB.
+func Thumbnail(data []byte) ([]byte, error) {
+	if IsHEIC(data) {
+		converted, err := HEICToJPEG(data)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img = imaging.Fit(img, ThumbnailMaxDimension, ThumbnailMaxDimension, imaging.Lanczos)
+	for quality := 85; quality >= 40; quality -= 15 {
+		buffer := &bytes.Buffer{}
+		if err := jpeg.Encode(buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		if buffer.Len() <= ThumbnailMaxBytes {
+			return buffer.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("thumbnail over %d bytes", ThumbnailMaxBytes)
+}
@@ -0,0 +1,102 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+)
+
+// Watermark positions: the four corners and the centre.
+const (
+	WatermarkTopLeft     = "tl"
+	WatermarkTopRight    = "tr"
+	WatermarkBottomLeft  = "bl"
+	WatermarkBottomRight = "br"
+	WatermarkCenter      = "center"
+)
+
+var WatermarkPositions = []string{WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter}
+
+// watermarkMaxWidth is the widest a watermark is drawn, as a share of the
+// image width; larger marks are scaled down.
+const watermarkMaxWidth = 0.25
+
+// Watermark is an image drawn over every image Prepare encodes.
+type Watermark struct {
+	Path     string
+	Position string
+	Opacity  float64
+	mark     image.Image
+}
+
+var watermark atomic.Pointer[Watermark]
+
+// LoadWatermark reads the watermark image at path (PNG keeps its
+// transparency) and checks the position and opacity (0-1].
+func LoadWatermark(path string, position string, opacity float64) (*Watermark, error) {
+	position = strings.ToLower(strings.TrimSpace(position))
+	if position == "" {
+		position = WatermarkBottomRight
+	}
+	known := false
+	for _, name := range WatermarkPositions {
+		known = known || name == position
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown watermark position %q (want %s)", position, strings.Join(WatermarkPositions, ", "))
+	}
+	if opacity <= 0 || opacity > 1 {
+		return nil, fmt.Errorf("watermark opacity must be above 0 and at most 1, got %g", opacity)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read watermark: %w", err)
+	}
+	mark, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode watermark %s: %w", path, err)
+	}
+	return &Watermark{Path: path, Position: position, Opacity: opacity, mark: mark}, nil
+}
+
+// SetWatermark makes Prepare draw w from now on; nil turns it off.
+func SetWatermark(w *Watermark) {
+	watermark.Store(w)
+}
+
+// WatermarkEnabled reports whether a watermark is set.
+func WatermarkEnabled() bool {
+	return watermark.Load() != nil
+}
+
+// ApplyWatermark draws the current watermark over img, or returns img
+// unchanged when none is set.
+func ApplyWatermark(img image.Image) image.Image {
+	w := watermark.Load()
+	if w == nil {
+		return img
+	}
+	bounds := img.Bounds()
+	mark := w.mark
+	if limit := int(float64(bounds.Dx()) * watermarkMaxWidth); mark.Bounds().Dx() > limit && limit > 0 {
+		mark = imaging.Resize(mark, limit, 0, imaging.Lanczos)
+	}
+	margin := min(bounds.Dx(), bounds.Dy()) / 50
+	size := mark.Bounds().Size()
+	x, y := margin, margin
+	switch w.Position {
+	case WatermarkTopRight:
+		x = bounds.Dx() - size.X - margin
+	case WatermarkBottomLeft:
+		y = bounds.Dy() - size.Y - margin
+	case WatermarkBottomRight:
+		x, y = bounds.Dx()-size.X-margin, bounds.Dy()-size.Y-margin
+	case WatermarkCenter:
+		x, y = (bounds.Dx()-size.X)/2, (bounds.Dy()-size.Y)/2
+	}
+	return imaging.Overlay(img, mark, image.Pt(x, y), w.Opacity)
+}
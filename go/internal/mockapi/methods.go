@@ -0,0 +1,224 @@
+package mockapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// upload is a file sent in a multipart request.
+type upload struct {
+	name string
+	data []byte
+}
+
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// mediaFields are the send methods that carry a file, with the parameter
+// holding it and the message field that describes it.
+var mediaFields = map[string]string{
+	"sendPhoto":    "photo",
+	"sendVideo":    "video",
+	"sendDocument": "document",
+	"sendAudio":    "audio",
+}
+
+func (s *Server) call(method string, params map[string]string, uploads map[string]upload) (any, *apiError) {
+	switch method {
+	case "getMe":
+		return map[string]any{"id": 1, "is_bot": true, "first_name": "Mock bot", "username": "mock_bot"}, nil
+	case "getChat":
+		chat, err := chatOf(params)
+		if err != nil {
+			return nil, err
+		}
+		return chat, nil
+	case "getChatMember":
+		userID, _ := strconv.ParseInt(params["user_id"], 10, 64)
+		return member(userID), nil
+	case "getChatAdministrators":
+		return []any{member(1)}, nil
+	case "getChatMemberCount":
+		return 1, nil
+	case "getUpdates":
+		return []any{}, nil
+	case "sendChatAction", "deleteMessage", "pinChatMessage":
+		return true, nil
+	case "getFile":
+		return s.getFile(params["file_id"])
+	case "sendMessage", "sendPoll", "sendLocation", "editMessageText", "editMessageCaption":
+		chat, err := chatOf(params)
+		if err != nil {
+			return nil, err
+		}
+		message := s.message(chat, params)
+		if id, convErr := strconv.Atoi(params["message_id"]); convErr == nil && strings.HasPrefix(method, "edit") {
+			message["message_id"] = id
+		}
+		return message, nil
+	case "sendMediaGroup":
+		return s.sendMediaGroup(params, uploads)
+	}
+	if field, ok := mediaFields[method]; ok {
+		chat, err := chatOf(params)
+		if err != nil {
+			return nil, err
+		}
+		file, err := s.storeFile(params[field], uploads[field])
+		if err != nil {
+			return nil, err
+		}
+		message := s.message(chat, params)
+		attach(message, field, file)
+		return message, nil
+	}
+	return nil, &apiError{fasthttp.StatusNotFound, "Not Found: method not found"}
+}
+
+func (s *Server) sendMediaGroup(params map[string]string, uploads map[string]upload) (any, *apiError) {
+	chat, err := chatOf(params)
+	if err != nil {
+		return nil, err
+	}
+	var media []struct {
+		Type  string `json:"type"`
+		Media string `json:"media"`
+	}
+	if jsonErr := json.Unmarshal([]byte(params["media"]), &media); jsonErr != nil {
+		return nil, &apiError{fasthttp.StatusBadRequest, "Bad Request: can't parse media JSON object"}
+	}
+	if len(media) < 2 || len(media) > 10 {
+		return nil, &apiError{fasthttp.StatusBadRequest, "Bad Request: wrong number of messages in the media group"}
+	}
+	messages := make([]map[string]any, 0, len(media))
+	for _, item := range media {
+		var source upload
+		if field, ok := strings.CutPrefix(item.Media, "attach://"); ok {
+			source = uploads[field]
+		}
+		file, err := s.storeFile(item.Media, source)
+		if err != nil {
+			return nil, err
+		}
+		message := s.message(chat, params)
+		attach(message, item.Type, file)
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (s *Server) getFile(fileID string) (any, *apiError) {
+	s.mu.Lock()
+	data, ok := s.files[fileID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, &apiError{fasthttp.StatusBadRequest, "Bad Request: file is too big or was not uploaded to the mock"}
+	}
+	return map[string]any{"file_id": fileID, "file_size": len(data), "file_path": "files/" + fileID}, nil
+}
+
+// storedFile describes a file a message carries.
+type storedFile struct {
+	id   string
+	size int
+}
+
+// storeFile keeps an uploaded file for getFile and returns its new file_id.
+// A file_id or URL sent instead of an upload is returned as it is.
+func (s *Server) storeFile(value string, source upload) (storedFile, *apiError) {
+	if source.data == nil {
+		if value == "" || strings.HasPrefix(value, "attach://") {
+			return storedFile{}, &apiError{fasthttp.StatusBadRequest, "Bad Request: there is no file in the request"}
+		}
+		return storedFile{id: value}, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextFile++
+	id := fmt.Sprintf("mock-file-%d", s.nextFile)
+	if len(source.data) <= maxStoredFile {
+		s.files[id] = source.data
+	}
+	return storedFile{id: id, size: len(source.data)}, nil
+}
+
+func attach(message map[string]any, kind string, file storedFile) {
+	ref := map[string]any{"file_id": file.id, "file_unique_id": file.id, "file_size": file.size}
+	if kind == "photo" {
+		message["photo"] = []any{ref}
+		return
+	}
+	message[kind] = ref
+}
+
+// message builds the reply to a send, numbering messages per chat.
+func (s *Server) message(chat map[string]any, params map[string]string) map[string]any {
+	chatID := chat["id"].(int64)
+	s.mu.Lock()
+	s.nextMessage[chatID]++
+	id := s.nextMessage[chatID]
+	s.mu.Unlock()
+	message := map[string]any{"message_id": id, "date": time.Now().Unix(), "chat": chat}
+	if thread, err := strconv.Atoi(params["message_thread_id"]); err == nil {
+		message["message_thread_id"] = thread
+		message["is_topic_message"] = true
+	}
+	if text := params["text"]; text != "" {
+		message["text"] = text
+	}
+	if caption := params["caption"]; caption != "" {
+		message["caption"] = caption
+	}
+	return message
+}
+
+// chatOf returns the chat named by the chat_id parameter. Numeric IDs are
+// taken as they are and usernames get a stable made-up ID; negative IDs are
+// forum supergroups, so every topic exists.
+func chatOf(params map[string]string) (map[string]any, *apiError) {
+	ref := strings.TrimSpace(params["chat_id"])
+	if ref == "" {
+		return nil, &apiError{fasthttp.StatusBadRequest, "Bad Request: chat_id is empty"}
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		if !strings.HasPrefix(ref, "@") {
+			return nil, &apiError{fasthttp.StatusBadRequest, "Bad Request: chat not found"}
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(strings.ToLower(ref)))
+		id = -1000000000000 - int64(hash.Sum32())
+	}
+	if id > 0 {
+		return map[string]any{"id": id, "type": "private", "first_name": "Mock user"}, nil
+	}
+	chat := map[string]any{"id": id, "type": "supergroup", "title": "Mock chat", "is_forum": true}
+	if strings.HasPrefix(ref, "@") {
+		chat["username"] = strings.TrimPrefix(ref, "@")
+	}
+	return chat, nil
+}
+
+func member(userID int64) map[string]any {
+	return map[string]any{
+		"user":              map[string]any{"id": userID, "is_bot": true, "first_name": "Mock bot", "username": "mock_bot"},
+		"status":            "administrator",
+		"can_post_messages": true,
+		"can_edit_messages": true,
+		"can_manage_topics": true,
+	}
+}
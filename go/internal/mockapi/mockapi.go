@@ -0,0 +1,230 @@
+// Package mockapi is an in-process stand-in for the Bot API, selected with
+// --api-url mock:// for end-to-end tests and offline demos. It answers the
+// methods the client uses, keeps uploaded files for getFile and can record
+// every request to a JSONL file (mock:///path/requests.jsonl).
+package mockapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// Scheme prefixes API URLs served by the mock.
+const Scheme = "mock://"
+
+// maxStoredFile is the largest upload kept for getFile, the cloud Bot API's
+// download limit.
+const maxStoredFile = 20 << 20
+
+var registry = struct {
+	sync.Mutex
+	byURL  map[string]*Server
+	byHost map[string]*Server
+}{byURL: map[string]*Server{}, byHost: map[string]*Server{}}
+
+// IsURL reports whether apiURL selects the mock.
+func IsURL(apiURL string) bool {
+	return strings.HasPrefix(apiURL, Scheme)
+}
+
+// Endpoint returns the HTTP base URL to use for apiURL: apiURL itself, or
+// for a mock URL the address of its server, started on first use. Clients
+// reach it through Dial.
+func Endpoint(apiURL string) string {
+	if !IsURL(apiURL) {
+		return apiURL
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	server, ok := registry.byURL[apiURL]
+	if !ok {
+		host := fmt.Sprintf("mock-%d.invalid", len(registry.byURL)+1)
+		server = newServer(strings.TrimPrefix(apiURL, Scheme))
+		registry.byURL[apiURL] = server
+		registry.byHost[host+":80"] = server
+		server.host = host
+		if server.record != "" {
+			log.Printf("using the in-process mock Bot API, recording requests to %s", server.record)
+		} else {
+			log.Printf("using the in-process mock Bot API")
+		}
+	}
+	return "http://" + server.host
+}
+
+// Dial connects to the mock server at addr. It reports false when addr is
+// not a mock server, for the caller to dial it normally.
+func Dial(addr string) (net.Conn, bool, error) {
+	registry.Lock()
+	server, ok := registry.byHost[addr]
+	registry.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+	conn, err := server.listener.Dial()
+	return conn, true, err
+}
+
+// Server is one mock Bot API with its own messages and files.
+type Server struct {
+	host     string
+	listener *fasthttputil.InmemoryListener
+	record   string
+
+	mu          sync.Mutex
+	nextMessage map[int64]int
+	files       map[string][]byte
+	nextFile    int
+	recordFile  *os.File
+}
+
+func newServer(record string) *Server {
+	server := &Server{
+		listener:    fasthttputil.NewInmemoryListener(),
+		record:      record,
+		nextMessage: map[int64]int{},
+		files:       map[string][]byte{},
+	}
+	go func() {
+		_ = fasthttp.Serve(server.listener, server.handle)
+	}()
+	return server
+}
+
+// request is one recorded call.
+type request struct {
+	Time   string            `json:"time"`
+	Method string            `json:"method"`
+	Token  string            `json:"token"`
+	Params map[string]string `json:"params,omitempty"`
+	Files  []recordedFile    `json:"files,omitempty"`
+}
+
+type recordedFile struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"`
+	Size     int    `json:"size"`
+}
+
+func (s *Server) recordRequest(entry request) {
+	if s.record == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recordFile == nil {
+		file, err := os.OpenFile(s.record, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Printf("mock Bot API: cannot record requests: %v", err)
+			s.record = ""
+			return
+		}
+		s.recordFile = file
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := s.recordFile.Write(append(data, '\n')); err != nil {
+		log.Printf("mock Bot API: recording request failed: %v", err)
+	}
+}
+
+func (s *Server) handle(ctx *fasthttp.RequestCtx) {
+	path := string(ctx.Path())
+	if rest, ok := strings.CutPrefix(path, "/file/bot"); ok {
+		s.serveFile(ctx, rest)
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "/bot")
+	token, method, found := strings.Cut(rest, "/")
+	if !ok || !found || token == "" {
+		writeError(ctx, fasthttp.StatusNotFound, "Not Found")
+		return
+	}
+
+	params := map[string]string{}
+	uploads := map[string]upload{}
+	entry := request{Time: time.Now().UTC().Format(time.RFC3339Nano), Method: method, Token: maskToken(token), Params: params}
+	if form, err := ctx.MultipartForm(); err == nil {
+		for key, values := range form.Value {
+			if len(values) > 0 {
+				params[key] = values[0]
+			}
+		}
+		for field, headers := range form.File {
+			if len(headers) == 0 {
+				continue
+			}
+			data, err := readUpload(headers[0])
+			if err != nil {
+				writeError(ctx, fasthttp.StatusBadRequest, "Bad Request: "+err.Error())
+				return
+			}
+			uploads[field] = upload{name: headers[0].Filename, data: data}
+			entry.Files = append(entry.Files, recordedFile{Field: field, Filename: headers[0].Filename, Size: len(data)})
+		}
+	} else {
+		ctx.PostArgs().VisitAll(func(key, value []byte) {
+			params[string(key)] = string(value)
+		})
+	}
+	s.recordRequest(entry)
+
+	result, err := s.call(method, params, uploads)
+	if err != nil {
+		writeError(ctx, err.code, err.description)
+		return
+	}
+	writeResult(ctx, result)
+}
+
+func (s *Server) serveFile(ctx *fasthttp.RequestCtx, rest string) {
+	_, filePath, _ := strings.Cut(rest, "/")
+	s.mu.Lock()
+	data, ok := s.files[strings.TrimPrefix(filePath, "files/")]
+	s.mu.Unlock()
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	ctx.SetBody(data)
+}
+
+type apiError struct {
+	code        int
+	description string
+}
+
+func writeResult(ctx *fasthttp.RequestCtx, result any) {
+	data, err := json.Marshal(map[string]any{"ok": true, "result": result})
+	if err != nil {
+		writeError(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.SetBody(data)
+}
+
+func writeError(ctx *fasthttp.RequestCtx, code int, description string) {
+	data, _ := json.Marshal(map[string]any{"ok": false, "error_code": code, "description": description})
+	ctx.SetStatusCode(code)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(data)
+}
+
+func maskToken(token string) string {
+	if id, _, ok := strings.Cut(token, ":"); ok {
+		return id + ":***"
+	}
+	return "***"
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+const (
+	digestItems         = 10
+	digestErrorLength   = 120
+	failureCheckSeconds = 15
+)
+
+var errorClasses = []struct {
+	class   string
+	matches []string
+}{
+	{"flood wait", []string{"too many requests", "retry after", "flood"}},
+	{"file too big", []string{"too large", "too big", "file is too", "entity too large"}},
+	{"bad image", []string{"photo_invalid", "image_process_failed", "photo_save_file_invalid", "image:", "decode", "unknown format"}},
+	{"source missing", []string{"no longer exists"}},
+	{"network", []string{"timeout", "deadline exceeded", "connection", "no such host", "eof", "reset by peer"}},
+}
+
+// ErrorClass buckets a failure message into a short class for digests.
+func ErrorClass(msg string) string {
+	lower := strings.ToLower(msg)
+	for _, entry := range errorClasses {
+		for _, match := range entry.matches {
+			if strings.Contains(lower, match) {
+				return entry.class
+			}
+		}
+	}
+	return "other"
+}
+
+// failureDigest sends the newest failed items with their error classes.
+func failureDigest(ctx context.Context, q *queue.Queue, targets Sink, total, added int) {
+	items := q.RecentFailed(digestItems)
+	lines := []string{i18n.T("notify.failures", added, total)}
+	for _, item := range items {
+		name := filepath.Base(item.Path)
+		if item.InnerPath != nil {
+			name = fmt.Sprintf("%s:%s", name, *item.InnerPath)
+		}
+		msg := ""
+		if item.Error != nil {
+			msg = *item.Error
+		}
+		if runes := []rune(msg); len(runes) > digestErrorLength {
+			msg = string(runes[:digestErrorLength]) + "..."
+		}
+		lines = append(lines, i18n.T("notify.failureItem", name, ErrorClass(msg), item.Attempts, msg))
+	}
+	if total > len(items) {
+		lines = append(lines, i18n.T("notify.failuresMore", total-len(items)))
+	}
+	_ = targets.Notify(ctx, Event{Kind: EventFailure, Text: strings.Join(lines, "\n")})
+}
@@ -5,14 +5,38 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
 )
 
+const disabledPollInterval = 5 * time.Second
+
 type Config struct {
 	Enabled      bool
 	Interval     time.Duration
 	NotifyOnIdle bool
+	// FailureInterval is the minimum gap between failure digests.
+	FailureInterval time.Duration
+	// ErrorOnly drops the start, status and idle messages and keeps only
+	// failure digests and quota notices.
+	ErrorOnly bool
+	// Sinks receive every event in addition to the Telegram chat, or
+	// instead of it when SinkOnly is set.
+	Sinks    []Sink
+	SinkOnly bool
+	// Unreadable is shared with the watchers; status messages include its
+	// count when it is non-zero.
+	Unreadable *fswalk.Unreadable
+	// Mode is ModeInterval, ModeChanges or ModeDaily; empty is
+	// ModeInterval. IdleMax caps the reminder gap of ModeChanges, zero
+	// turning reminders off, and DailyAt is the local time after midnight
+	// of the ModeDaily summary.
+	Mode    string
+	IdleMax time.Duration
+	DailyAt time.Duration
 }
 
 func Loop(cfg Config, q *queue.Queue, client *telegram.Client, chatID string, topicID *int) {
@@ -22,7 +46,7 @@ func Loop(cfg Config, q *queue.Queue, client *telegram.Client, chatID string, to
 
 	start := time.Now()
 	retry := telegram.RetryConfig{MaxRetries: 3, Delay: 3 * time.Second}
-	_ = client.SendMessage(chatID, fmt.Sprintf("Watch started (elapsed %s)", formatElapsed(0)), topicID, retry)
+	_ = client.SendMessage(context.Background(), chatID, i18n.T("notify.started", formatElapsed(0)), topicID, retry)
 
 	lastPending := -1
 	for {
@@ -30,10 +54,10 @@ func Loop(cfg Config, q *queue.Queue, client *telegram.Client, chatID string, to
 		elapsed := formatElapsed(time.Since(start))
 		stats := q.Stats()
 		pending := stats[queue.StatusQueued] + stats[queue.StatusFailed]
-		_ = client.SendMessage(
+		_ = client.SendMessage(context.Background(),
 			chatID,
-			fmt.Sprintf(
-				"Watch status: elapsed %s, queued %d, sending %d, sent %d, failed %d",
+			i18n.T(
+				"notify.status",
 				elapsed,
 				stats[queue.StatusQueued],
 				stats[queue.StatusSending],
@@ -46,7 +70,7 @@ func Loop(cfg Config, q *queue.Queue, client *telegram.Client, chatID string, to
 
 		if cfg.NotifyOnIdle {
 			if lastPending >= 0 && lastPending > 0 && pending == 0 {
-				_ = client.SendMessage(chatID, fmt.Sprintf("Watch idle (elapsed %s)", elapsed), topicID, retry)
+				_ = client.SendMessage(context.Background(), chatID, i18n.T("notify.idle", elapsed), topicID, retry)
 			}
 			lastPending = pending
 		}
@@ -57,42 +81,140 @@ func LoopWithContext(ctx context.Context, cfg Config, q *queue.Queue, client *te
 	if !cfg.Enabled {
 		return
 	}
+	LoopLive(ctx, runcontrol.NewLive(cfg), q, client, chatID, topicID)
+}
 
+// LoopLive keeps running while notifications are disabled so a reload can
+// turn them on or change the interval without restarting the watcher.
+// Failures are checked more often than the status interval; a digest goes
+// out when the failed count grows, at most once per FailureInterval.
+func LoopLive(ctx context.Context, live *runcontrol.Live[Config], q *queue.Queue, client *telegram.Client, chatID string, topicID *int) {
 	start := time.Now()
-	retry := telegram.RetryConfig{MaxRetries: 3, Delay: 3 * time.Second}
-	_ = client.SendMessage(chatID, fmt.Sprintf("Watch started (elapsed %s)", formatElapsed(0)), topicID, retry)
+	if cfg := live.Load(); cfg.Enabled && !cfg.ErrorOnly {
+		_ = cfg.Targets(client, chatID, topicID).Notify(ctx, Event{Kind: EventStart, Text: i18n.T("notify.started", formatElapsed(0))})
+	}
 
 	lastPending := -1
+	lastStatus := start
+	lastFailed := failedCount(q.Stats())
+	var lastDigest time.Time
+	// lastCounts and reminders track ModeChanges; lastSummary, summaryAt
+	// and nextSummary track ModeDaily.
+	lastCounts := countsOf(q.Stats(), live.Load())
+	reminders := 0
+	lastSummary := start
+	summaryAt := time.Duration(-1)
+	var nextSummary time.Time
 	for {
-		if !sleepWithContext(ctx, cfg.Interval) {
+		cfg := live.Load()
+		if !sleepWithContext(ctx, pollInterval(cfg)) {
 			return
 		}
-		elapsed := formatElapsed(time.Since(start))
+		cfg = live.Load()
 		stats := q.Stats()
-		pending := stats[queue.StatusQueued] + stats[queue.StatusFailed]
-		_ = client.SendMessage(
-			chatID,
-			fmt.Sprintf(
-				"Watch status: elapsed %s, queued %d, sending %d, sent %d, failed %d",
-				elapsed,
-				stats[queue.StatusQueued],
-				stats[queue.StatusSending],
-				stats[queue.StatusSent],
-				stats[queue.StatusFailed],
-			),
-			topicID,
-			retry,
-		)
+		failed := failedCount(stats)
+		if !cfg.Enabled {
+			lastPending = -1
+			lastFailed = failed
+			continue
+		}
+		targets := cfg.Targets(client, chatID, topicID)
+
+		// Retried items leave the failed state; lower the baseline so
+		// they count again if they fail again.
+		if failed < lastFailed {
+			lastFailed = failed
+		}
+		if failed > lastFailed && time.Since(lastDigest) >= cfg.FailureInterval {
+			failureDigest(ctx, q, targets, failed, failed-lastFailed)
+			lastFailed = failed
+			lastDigest = time.Now()
+		}
+
+		if cfg.ErrorOnly {
+			continue
+		}
+		counts := countsOf(stats, cfg)
+		if cfg.Mode == ModeDaily {
+			if summaryAt != cfg.DailyAt {
+				summaryAt = cfg.DailyAt
+				nextSummary = nextDaily(time.Now(), summaryAt)
+			}
+			if time.Now().Before(nextSummary) {
+				continue
+			}
+			files, size := q.SentSince(lastSummary)
+			text := i18n.T("notify.daily", files, size, formatElapsed(time.Since(lastSummary)), counts.queued, counts.failed) + counts.extras()
+			_ = targets.Notify(ctx, Event{Kind: EventStatus, Text: text})
+			lastSummary = time.Now()
+			nextSummary = nextDaily(lastSummary, summaryAt)
+			continue
+		}
+		summaryAt = -1
+
+		if time.Since(lastStatus) < statusInterval(cfg) {
+			continue
+		}
+		if cfg.Mode == ModeChanges {
+			if counts == lastCounts {
+				gap := idleGap(cfg, reminders)
+				if gap == 0 || time.Since(lastStatus) < gap {
+					continue
+				}
+				reminders++
+			} else {
+				reminders = 0
+			}
+		}
+		lastCounts = counts
+		lastStatus = time.Now()
+		elapsed := formatElapsed(time.Since(start))
+		pending := counts.queued + counts.failed
+		text := i18n.T(
+			"notify.status",
+			elapsed,
+			counts.queued,
+			counts.sending,
+			counts.sent,
+			counts.failed,
+		) + counts.extras()
+		_ = targets.Notify(ctx, Event{Kind: EventStatus, Text: text})
 
 		if cfg.NotifyOnIdle {
 			if lastPending >= 0 && lastPending > 0 && pending == 0 {
-				_ = client.SendMessage(chatID, fmt.Sprintf("Watch idle (elapsed %s)", elapsed), topicID, retry)
+				_ = targets.Notify(ctx, Event{Kind: EventIdle, Text: i18n.T("notify.idle", elapsed)})
 			}
 			lastPending = pending
 		}
 	}
 }
 
+func statusInterval(cfg Config) time.Duration {
+	if cfg.Interval <= 0 {
+		return disabledPollInterval
+	}
+	return cfg.Interval
+}
+
+func pollInterval(cfg Config) time.Duration {
+	if !cfg.Enabled {
+		return disabledPollInterval
+	}
+	interval := statusInterval(cfg)
+	if check := failureCheckSeconds * time.Second; check < interval {
+		return check
+	}
+	return interval
+}
+
+// QuotaReached tells the targets that the daily quota paused sending.
+func QuotaReached(ctx context.Context, targets Sink, files int, size int64, reset time.Time) {
+	_ = targets.Notify(ctx, Event{
+		Kind: EventQuota,
+		Text: i18n.T("notify.quota", files, size, reset.Format("2006-01-02 15:04 MST")),
+	})
+}
+
 func sleepWithContext(ctx context.Context, d time.Duration) bool {
 	if d <= 0 {
 		return true
@@ -114,3 +236,9 @@ func formatElapsed(duration time.Duration) string {
 	seconds := total % 60
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
 }
+
+// failedCount counts retryable and permanent failures and missing sources,
+// so a digest goes out for any of them.
+func failedCount(stats map[string]int) int {
+	return stats[queue.StatusFailed] + stats[queue.StatusFailedPermanent] + stats[queue.StatusSourceMissing]
+}
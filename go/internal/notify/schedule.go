@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/i18n"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// Status modes: when status messages go out.
+const (
+	// ModeInterval sends a status every Interval.
+	ModeInterval = "interval"
+	// ModeChanges sends a status at most every Interval and only when the
+	// counts moved since the last one. While they stay the same, a
+	// reminder goes out after twice the previous gap, up to IdleMax.
+	ModeChanges = "changes"
+	// ModeDaily replaces statuses with one summary a day at DailyAt.
+	ModeDaily = "daily"
+)
+
+// DefaultIdleMax caps the gap between reminders in ModeChanges.
+const DefaultIdleMax = 24 * time.Hour
+
+// ParseMode checks a --notify-mode value; empty is ModeInterval.
+func ParseMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "":
+		return ModeInterval, nil
+	case ModeInterval, ModeChanges, ModeDaily:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid notify mode %q (use interval, changes or daily)", value)
+	}
+}
+
+// ParseDailyAt reads a local time of day such as "09:00" and returns how
+// long after midnight it is.
+func ParseDailyAt(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid daily summary time %q (use HH:MM)", value)
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// nextDaily returns the first time after now that is at after midnight.
+func nextDaily(now time.Time, at time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(at)
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Add(at)
+	}
+	return next
+}
+
+// idleGap is how long ModeChanges waits after a status before reminding
+// that nothing moved, the reminders so far doubling it each time. Zero
+// means no reminders.
+func idleGap(cfg Config, reminders int) time.Duration {
+	if cfg.IdleMax <= 0 {
+		return 0
+	}
+	gap := statusInterval(cfg) * 2
+	for i := 0; i < reminders && gap < cfg.IdleMax; i++ {
+		gap *= 2
+	}
+	return min(gap, cfg.IdleMax)
+}
+
+// statusCounts are the numbers a status message reports, compared by
+// ModeChanges.
+type statusCounts struct {
+	queued, sending, sent, failed, permanent, missing, unreadable int
+}
+
+func countsOf(stats map[string]int, cfg Config) statusCounts {
+	return statusCounts{
+		queued:     stats[queue.StatusQueued],
+		sending:    stats[queue.StatusSending],
+		sent:       stats[queue.StatusSent],
+		failed:     stats[queue.StatusFailed],
+		permanent:  stats[queue.StatusFailedPermanent],
+		missing:    stats[queue.StatusSourceMissing],
+		unreadable: cfg.Unreadable.Count(),
+	}
+}
+
+// extras are the counts appended to status messages when non-zero.
+func (c statusCounts) extras() string {
+	text := ""
+	if c.permanent > 0 {
+		text += i18n.T("notify.failedPermanent", c.permanent)
+	}
+	if c.missing > 0 {
+		text += i18n.T("notify.sourceMissing", c.missing)
+	}
+	if c.unreadable > 0 {
+		text += i18n.T("notify.unreadable", c.unreadable)
+	}
+	return text
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+const (
+	EventStart   = "start"
+	EventStatus  = "status"
+	EventIdle    = "idle"
+	EventFailure = "failure"
+	EventQuota   = "quota"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	discordLimit   = 2000
+)
+
+type Event struct {
+	Kind string
+	Text string
+	Time time.Time
+}
+
+// Sink delivers notification events somewhere: the Telegram chat or an
+// external webhook.
+type Sink interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Sinks fans an event out to every sink; a failing sink is logged and does
+// not stop the others.
+type Sinks []Sink
+
+func (s Sinks) Notify(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, sink := range s {
+		if err := sink.Notify(ctx, event); err != nil {
+			log.Printf("notify %s: %v", event.Kind, err)
+		}
+	}
+	return nil
+}
+
+type telegramSink struct {
+	client  *telegram.Client
+	chatID  string
+	topicID *int
+}
+
+func (t telegramSink) Notify(ctx context.Context, event Event) error {
+	retry := telegram.RetryConfig{MaxRetries: 3, Delay: 3 * time.Second}
+	return t.client.SendMessage(ctx, t.chatID, event.Text, t.topicID, retry)
+}
+
+// webhookSink POSTs events as JSON; format picks the payload shape.
+type webhookSink struct {
+	format string
+	url    string
+}
+
+func (w webhookSink) Notify(ctx context.Context, event Event) error {
+	var payload any
+	switch w.format {
+	case "slack":
+		payload = map[string]string{"text": event.Text}
+	case "discord":
+		text := event.Text
+		if runes := []rune(text); len(runes) > discordLimit {
+			text = string(runes[:discordLimit-3]) + "..."
+		}
+		payload = map[string]string{"content": text}
+	default:
+		payload = map[string]string{
+			"event": event.Kind,
+			"text":  event.Text,
+			"time":  event.Time.UTC().Format(time.RFC3339),
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(w.url)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	req.SetBody(body)
+
+	timeout := webhookTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if err := fasthttp.DoTimeout(req, resp, timeout); err != nil {
+		return fmt.Errorf("%s sink: %w", w.format, err)
+	}
+	if status := resp.StatusCode(); status < 200 || status >= 300 {
+		return fmt.Errorf("%s sink: HTTP %d", w.format, status)
+	}
+	return nil
+}
+
+// ParseSinks parses --notify-sink values of the form KIND:URL, where KIND is
+// webhook, slack or discord.
+func ParseSinks(values []string) ([]Sink, error) {
+	sinks := []Sink{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		kind, url, ok := strings.Cut(value, ":")
+		kind = strings.ToLower(kind)
+		if !ok || (kind != "webhook" && kind != "slack" && kind != "discord") {
+			return nil, fmt.Errorf("invalid notify sink %q (use webhook:URL, slack:URL or discord:URL)", value)
+		}
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("invalid notify sink %q: URL must start with http:// or https://", value)
+		}
+		sinks = append(sinks, webhookSink{format: kind, url: url})
+	}
+	return sinks, nil
+}
+
+// Targets returns where cfg sends events: the Telegram chat unless SinkOnly
+// is set, plus every configured sink.
+func (cfg Config) Targets(client *telegram.Client, chatID string, topicID *int) Sinks {
+	targets := Sinks{}
+	if !cfg.SinkOnly || len(cfg.Sinks) == 0 {
+		targets = append(targets, telegramSink{client: client, chatID: chatID, topicID: topicID})
+	}
+	return append(targets, cfg.Sinks...)
+}
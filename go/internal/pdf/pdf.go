@@ -0,0 +1,94 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page is one rendered page image.
+type Page struct {
+	Number int
+	Path   string
+}
+
+// renderer runs an external PDF rasterizer; Go has no PDF renderer in its
+// standard library and the pure-Go ones cannot handle scanned documents
+// reliably.
+type renderer struct {
+	binary string
+	args   func(input string, prefix string, dpi int, first int, last int) []string
+}
+
+// renderers are tried in order. Both name their output <prefix>-<page>.<ext>
+// with the page number counted from the start of the document.
+var renderers = []renderer{
+	{binary: "pdftoppm", args: func(input, prefix string, dpi, first, last int) []string {
+		args := []string{"-r", strconv.Itoa(dpi), "-jpeg", "-jpegopt", "quality=90"}
+		if first > 0 {
+			args = append(args, "-f", strconv.Itoa(first))
+		}
+		if last > 0 {
+			args = append(args, "-l", strconv.Itoa(last))
+		}
+		return append(args, input, prefix)
+	}},
+	{binary: "mutool", args: func(input, prefix string, dpi, first, last int) []string {
+		pages := "1-N"
+		if first > 0 || last > 0 {
+			pages = fmt.Sprintf("%d-", max(first, 1))
+			if last > 0 {
+				pages += strconv.Itoa(last)
+			} else {
+				pages += "N"
+			}
+		}
+		return []string{"draw", "-q", "-r", strconv.Itoa(dpi), "-o", prefix + "-%d.png", input, pages}
+	}},
+}
+
+// Rasterize renders pages first through last (1-based; 0 means the first or
+// last page of the document) of the PDF at path into images in dir, using
+// pdftoppm (poppler) or mutool (MuPDF). Pages are returned in order.
+func Rasterize(ctx context.Context, path string, dpi int, first int, last int, dir string) ([]Page, error) {
+	var tool *renderer
+	binary := ""
+	for i := range renderers {
+		if found, err := exec.LookPath(renderers[i].binary); err == nil {
+			tool = &renderers[i]
+			binary = found
+			break
+		}
+	}
+	if tool == nil {
+		return nil, fmt.Errorf("rendering PDF pages needs pdftoppm (poppler) or mutool (MuPDF) in PATH")
+	}
+	prefix := filepath.Join(dir, "page")
+	output, err := exec.CommandContext(ctx, binary, tool.args(path, prefix, dpi, first, last)...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", tool.binary, err, strings.TrimSpace(string(output)))
+	}
+
+	paths, err := filepath.Glob(prefix + "-*")
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]Page, 0, len(paths))
+	for _, rendered := range paths {
+		name := strings.TrimSuffix(filepath.Base(rendered), filepath.Ext(rendered))
+		number, err := strconv.Atoi(strings.TrimPrefix(name, "page-"))
+		if err != nil {
+			continue
+		}
+		pages = append(pages, Page{Number: number, Path: rendered})
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%s rendered no pages from %s", tool.binary, filepath.Base(path))
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Number < pages[j].Number })
+	return pages, nil
+}
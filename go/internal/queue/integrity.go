@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Every line written by this package ends with a "line_crc" member: the
+// CRC-32 of the line without it. Lines stay valid JSON, so older readers
+// ignore it; lines without one are accepted unchecked.
+const lineCRCPrefix = `,"line_crc":"`
+
+// lineCRCLen is the length of `,"line_crc":"xxxxxxxx"}`.
+const lineCRCLen = len(lineCRCPrefix) + 8 + 2
+
+func encodeLine(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[len(data)-1] != '}' {
+		return append(data, '\n'), nil
+	}
+	sum := crc32.ChecksumIEEE(data)
+	line := make([]byte, 0, len(data)+lineCRCLen)
+	line = append(line, data[:len(data)-1]...)
+	line = fmt.Appendf(line, `%s%08x"}`, lineCRCPrefix, sum)
+	return append(line, '\n'), nil
+}
+
+// lineIntact reports whether line, without its newline, matches its
+// line_crc. Lines without one are intact.
+func lineIntact(line []byte) bool {
+	if len(line) < lineCRCLen+1 {
+		return true
+	}
+	tail := line[len(line)-lineCRCLen:]
+	if !bytes.HasPrefix(tail, []byte(lineCRCPrefix)) || !bytes.HasSuffix(tail, []byte(`"}`)) {
+		return true
+	}
+	want, err := strconv.ParseUint(string(tail[len(lineCRCPrefix):len(lineCRCPrefix)+8]), 16, 32)
+	if err != nil {
+		return false
+	}
+	data := make([]byte, 0, len(line)-lineCRCLen+1)
+	data = append(data, line[:len(line)-lineCRCLen]...)
+	data = append(data, '}')
+	return crc32.ChecksumIEEE(data) == uint32(want)
+}
+
+// LineProblem is a queue file line that cannot be used.
+type LineProblem struct {
+	Line   int
+	Reason string
+}
+
+// CheckReport is the result of Check or Repair.
+type CheckReport struct {
+	Lines     int
+	Items     int
+	MetaFound bool
+	Problems  []LineProblem
+}
+
+// Check reads the queue file at path and reports the lines the loader
+// skips: truncated or unparsable JSON, checksum mismatches and items
+// without an id or fingerprint.
+func Check(path string) (*CheckReport, error) {
+	report, _, err := checkFile(path)
+	return report, err
+}
+
+// Repair rewrites the queue file at path without the lines Check reports,
+// keeping every other line as it is. The original is kept as path.bak. The
+// queue must not be in use while it runs.
+func Repair(path string) (*CheckReport, error) {
+	report, good, err := checkFile(path)
+	if err != nil || len(report.Problems) == 0 {
+		return report, err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileSync(path+".bak", original); err != nil {
+		return nil, err
+	}
+	tmpPath := path + ".tmp"
+	if err := writeFileSync(tmpPath, good); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkFile returns the report and the intact lines of the file at path.
+func checkFile(path string) (*CheckReport, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	report := &CheckReport{}
+	ids := map[string]struct{}{}
+	var good bytes.Buffer
+	reader := bufio.NewReader(file)
+	for {
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, nil, readErr
+		}
+		if len(raw) == 0 {
+			break
+		}
+		report.Lines++
+		line := bytes.TrimSpace(raw)
+		reason := ""
+		switch {
+		case len(line) == 0:
+		case raw[len(raw)-1] != '\n':
+			reason = "truncated final line"
+		case !json.Valid(line):
+			reason = "invalid JSON"
+		case !lineIntact(line):
+			reason = "checksum mismatch"
+		case report.Lines == 1:
+			if _, ok, _ := parseMeta(string(line)); ok {
+				report.MetaFound = true
+				break
+			}
+			reason = itemProblem(line, ids)
+		default:
+			reason = itemProblem(line, ids)
+		}
+		if reason != "" {
+			report.Problems = append(report.Problems, LineProblem{Line: report.Lines, Reason: reason})
+		} else if len(line) > 0 {
+			good.Write(line)
+			good.WriteByte('\n')
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	report.Items = len(ids)
+	return report, good.Bytes(), nil
+}
+
+func itemProblem(line []byte, ids map[string]struct{}) string {
+	var item Item
+	if err := json.Unmarshal(line, &item); err != nil {
+		return "not a queue item"
+	}
+	if item.ID == "" || item.Fingerprint == "" {
+		return "item without id or fingerprint"
+	}
+	ids[item.ID] = struct{}{}
+	return ""
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
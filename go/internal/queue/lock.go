@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockedError is returned by New when another process holds the queue.
+type LockedError struct {
+	Path string
+	PID  int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("queue %s is in use by PID %d", e.Path, e.PID)
+	}
+	return fmt.Sprintf("queue %s is in use by another process", e.Path)
+}
+
+// acquireLock takes an advisory lock on path.lock, which holds the owner's
+// PID, so two processes never send from the same queue. The lock goes with
+// the process, so a crash leaves nothing to clean up. With force a held
+// lock is logged and ignored, and no lock is returned.
+func acquireLock(path string, force bool) (*os.File, error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLock(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock %s: %w", lockPath, err)
+	}
+	if !locked {
+		data, _ := os.ReadFile(lockPath)
+		file.Close()
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		lockedErr := &LockedError{Path: path, PID: pid}
+		if force {
+			log.Printf("%v; opening it anyway", lockedErr)
+			return nil, nil
+		}
+		return nil, lockedErr
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return file, nil
+}
+
+func releaseLock(file *os.File) {
+	if file == nil {
+		return
+	}
+	unlock(file)
+	file.Close()
+}
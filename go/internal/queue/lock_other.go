@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+
+package queue
+
+import "os"
+
+// Other platforms have no advisory locks; queues are not protected there.
+func tryLock(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
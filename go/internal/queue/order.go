@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Send orders for pending items of the same priority.
+const (
+	OrderOldest   = "oldest"
+	OrderNewest   = "newest"
+	OrderLargest  = "largest"
+	OrderSmallest = "smallest"
+)
+
+func ParseOrder(value string) (string, error) {
+	switch order := strings.ToLower(strings.TrimSpace(value)); order {
+	case "":
+		return OrderOldest, nil
+	case OrderOldest, OrderNewest, OrderLargest, OrderSmallest:
+		return order, nil
+	}
+	return "", fmt.Errorf("invalid send order %q (use oldest, newest, largest or smallest)", value)
+}
+
+// SetOrder sets how Pending sorts items of the same priority; an empty
+// order sends the oldest first.
+func (q *Queue) SetOrder(order string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.order = order
+}
+
+// Order returns the order set with SetOrder.
+func (q *Queue) Order() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.order
+}
+
+// EnqueuedTime parses EnqueuedAt. Go writes it with a Z suffix and
+// trimmed fractional seconds and the Python version with +00:00, so the
+// strings do not sort by time. It is zero when the field does not parse.
+func (item *Item) EnqueuedTime() time.Time {
+	parsed, err := time.Parse(time.RFC3339Nano, item.EnqueuedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+// Less reports whether a is sent before b: higher priority first, then by
+// order, then oldest first.
+func Less(a, b *Item, order string) bool {
+	return lessAt(a, b, a.EnqueuedTime(), b.EnqueuedTime(), order)
+}
+
+func lessAt(a, b *Item, aTime, bTime time.Time, order string) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	switch order {
+	case OrderNewest:
+		if !aTime.Equal(bTime) {
+			return aTime.After(bTime)
+		}
+	case OrderLargest:
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	case OrderSmallest:
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	}
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return a.ID < b.ID
+}
+
+// sortPending orders items as Less does, parsing each enqueue time once.
+func sortPending(items []*Item, order string) {
+	times := make(map[*Item]time.Time, len(items))
+	for _, item := range items {
+		times[item] = item.EnqueuedTime()
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return lessAt(items[i], items[j], times[items[i]], times[items[j]], order)
+	})
+}
+
+// SortEnqueued orders items oldest first by parsed enqueue time, then by
+// ID.
+func SortEnqueued(items []Item) {
+	times := make([]time.Time, len(items))
+	for i := range items {
+		times[i] = items[i].EnqueuedTime()
+	}
+	sort.Sort(enqueuedOrder{items, times})
+}
+
+type enqueuedOrder struct {
+	items []Item
+	times []time.Time
+}
+
+func (o enqueuedOrder) Len() int { return len(o.items) }
+
+func (o enqueuedOrder) Less(i, j int) bool {
+	if !o.times[i].Equal(o.times[j]) {
+		return o.times[i].Before(o.times[j])
+	}
+	return o.items[i].ID < o.items[j].ID
+}
+
+func (o enqueuedOrder) Swap(i, j int) {
+	o.items[i], o.items[j] = o.items[j], o.items[i]
+	o.times[i], o.times[j] = o.times[j], o.times[i]
+}
@@ -2,10 +2,14 @@ package queue
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -13,7 +17,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sentindex"
 )
 
 const (
@@ -21,9 +28,20 @@ const (
 	StatusSending = "sending"
 	StatusSent    = "sent"
 	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	// StatusFailedPermanent marks items Telegram rejected for good (chat
+	// not found, bot blocked, file too big); they are not retried.
+	StatusFailedPermanent = "failed_permanent"
+	// StatusSourceMissing marks items whose file was deleted before it
+	// was sent; they are not retried.
+	StatusSourceMissing = "source_missing"
 
 	MetaType    = "queue_meta"
 	MetaVersion = 1
+
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
 )
 
 var pendingStatuses = map[string]bool{
@@ -112,12 +130,34 @@ type Item struct {
 	MTimeNS           *int64  `json:"mtime_ns,omitempty"`
 	CRC               *uint32 `json:"crc,omitempty"`
 	SendType          string  `json:"send_type,omitempty"`
+	Priority          int     `json:"priority,omitempty"`
+	TopicID           *int    `json:"topic_id,omitempty"`
 	Fingerprint       string  `json:"fingerprint"`
-	Status            string  `json:"status"`
-	EnqueuedAt        string  `json:"enqueued_at"`
-	UpdatedAt         string  `json:"updated_at"`
-	Attempts          int     `json:"attempts"`
-	Error             *string `json:"error,omitempty"`
+	// FingerprintVersion is the scheme Fingerprint was built with; see
+	// FingerprintVersion.
+	FingerprintVersion int    `json:"fingerprint_version,omitempty"`
+	PHash              string `json:"phash,omitempty"`
+	// ContentHash is the SHA-256 of the file, set when a sent index is in use.
+	ContentHash string  `json:"content_hash,omitempty"`
+	Status      string  `json:"status"`
+	EnqueuedAt  string  `json:"enqueued_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	Attempts    int     `json:"attempts"`
+	Error       *string `json:"error,omitempty"`
+	// MessageID and FileID locate the sent file in the chat; they are set
+	// by MarkSent for files delivered as one message.
+	MessageID int    `json:"message_id,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+	// Quarantined is where the file of a failed_permanent item was moved.
+	Quarantined string `json:"quarantined,omitempty"`
+}
+
+// Folder is the directory the item's file is in, or the zip holding it.
+func (item *Item) Folder() string {
+	if item.SourceType == "zip" {
+		return item.Path
+	}
+	return filepath.Dir(item.Path)
 }
 
 type Queue struct {
@@ -126,35 +166,147 @@ type Queue struct {
 	items            map[string]*Item
 	fingerprintIndex map[string]string
 	sourceIndex      map[string]struct{}
-	appendCh         chan *Item
+	appendCh         chan Item
 	closeCh          chan struct{}
+	rewriteCh        chan rewriteRequest
+	flushCh          chan chan error
+	writerDone       chan struct{}
 	meta             *Meta
+	fsync            atomic.Bool
 	metaChecked      bool
 	metaFound        bool
+	// offset is the end of the last complete line read from the file; Sync
+	// picks up lines appended after it by other processes.
+	offset int64
+	// corrupt counts the lines load skipped.
+	corrupt int
+	// fileMeta is the metadata line of the file, read even when meta is nil.
+	fileMeta *Meta
+	// lock is held until the writer stops; nil when forced or shared.
+	lock *os.File
+	// shared queues add items next to the owner; see NewShared.
+	shared bool
+	// sentIndex, when set, skips content already sent to sentChat.
+	sentIndex *sentindex.Index
+	sentChat  string
+	// order is how Pending sorts items of the same priority; see SetOrder.
+	order string
+	// writeErr is the last write failure the writer is retrying.
+	writeMu  sync.Mutex
+	writeErr error
 }
 
+const (
+	appendBuffer    = 4096
+	closeAttempts   = 3
+	maxWriteBackoff = 30 * time.Second
+)
+
+var errWriterStopped = errors.New("queue writer is not running")
+
+// New opens or creates the queue file at path and locks it against other
+// processes; a queue held elsewhere fails with a *LockedError.
 func New(path string, meta *Meta) (*Queue, error) {
+	return open(path, meta, openLocked)
+}
+
+// NewForced is New that opens the queue even when another process holds
+// it, for file systems whose locks outlive their owner.
+func NewForced(path string, meta *Meta) (*Queue, error) {
+	return open(path, meta, openForced)
+}
+
+// NewShared opens the queue file at path to add items while another process
+// sends from it. It takes no lock, leaves items marked as sending alone and
+// reopens the file for every write, so a compaction by the sender does not
+// strand its appends.
+func NewShared(path string, meta *Meta) (*Queue, error) {
+	return open(path, meta, openShared)
+}
+
+type openMode int
+
+const (
+	openLocked openMode = iota
+	openForced
+	openShared
+)
+
+func open(path string, meta *Meta, mode openMode) (*Queue, error) {
+	var lock *os.File
+	if mode != openShared {
+		var err error
+		if lock, err = acquireLock(path, mode == openForced); err != nil {
+			return nil, err
+		}
+	}
 	q := &Queue{
+		lock:             lock,
+		shared:           mode == openShared,
 		path:             path,
 		items:            map[string]*Item{},
 		fingerprintIndex: map[string]string{},
 		sourceIndex:      map[string]struct{}{},
-		appendCh:         make(chan *Item, 4096),
+		appendCh:         make(chan Item, appendBuffer),
 		closeCh:          make(chan struct{}),
+		rewriteCh:        make(chan rewriteRequest),
+		flushCh:          make(chan chan error),
+		writerDone:       make(chan struct{}),
 		meta:             normalizeMeta(meta),
 	}
 	if err := q.load(); err != nil {
+		releaseLock(lock)
 		return nil, err
 	}
 	if q.meta != nil && !q.metaChecked {
 		if err := q.writeMeta(); err != nil {
+			releaseLock(lock)
 			return nil, err
 		}
 	}
-	go q.writerLoop()
+	if err := q.terminateTail(); err != nil {
+		releaseLock(lock)
+		return nil, err
+	}
+	file, err := openAppend(q.path)
+	if err != nil {
+		releaseLock(lock)
+		return nil, err
+	}
+	go q.writerLoop(file)
+	if q.shared {
+		return q, nil
+	}
+	if interrupted := q.recoverInterrupted(); interrupted > 0 {
+		log.Printf("queue %s: %d item(s) were being sent when the last run stopped; queued them again", q.path, interrupted)
+	}
 	return q, nil
 }
 
+// recoverInterrupted queues the items a previous run left in the sending
+// status, which it stopped before Telegram acknowledged. Items it did
+// acknowledge were marked sent as each album or item went through, so only
+// the missing members of an album are sent again.
+func (q *Queue) recoverInterrupted() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := 0
+	for _, item := range q.items {
+		if item.Status != StatusSending {
+			continue
+		}
+		msg := "interrupted while sending"
+		item.Status = StatusQueued
+		item.UpdatedAt = nowUTC()
+		item.Error = &msg
+		if err := q.push(*item); err != nil {
+			break
+		}
+		count++
+	}
+	return count
+}
+
 func buildID() (string, error) {
 	buf := make([]byte, 16)
 	if _, err := rand.Read(buf); err != nil {
@@ -228,6 +380,48 @@ func metaMatches(expected *Meta, actual *Meta) bool {
 	return reflect.DeepEqual(normalizeMeta(expected), normalizeMeta(actual))
 }
 
+// ParsePriority maps low/normal/high to a priority level.
+func ParsePriority(value string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	default:
+		return 0, fmt.Errorf("invalid priority %q (use low, normal or high)", value)
+	}
+}
+
+// ParseRetention parses how long sent items are kept, such as "30d", "12h"
+// or "0" to keep them forever. It must be at least a day, so the daily
+// quota still sees every item sent today.
+func ParseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	var retention time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %q (use e.g. 30d or 36h)", value)
+		}
+		retention = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %q (use e.g. 30d or 36h)", value)
+		}
+		retention = parsed
+	}
+	if retention < 24*time.Hour {
+		return 0, fmt.Errorf("retention %q is shorter than a day", value)
+	}
+	return retention, nil
+}
+
 func BuildFingerprint(sourceType, path string, innerPath *string, size int64, mtimeNS *int64, crc *uint32) string {
 	parts := []string{sourceType, path, strconv64(size)}
 	if innerPath != nil && *innerPath != "" {
@@ -264,13 +458,20 @@ func (q *Queue) load() error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	buffer := make([]byte, 0, 1024*1024)
-	scanner.Buffer(buffer, 1024*1024)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	reader := bufio.NewReader(file)
+	for {
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return readErr
+		}
+		if len(raw) > 0 && raw[len(raw)-1] == '\n' {
+			q.offset += int64(len(raw))
+		}
+		line := strings.TrimSpace(string(raw))
 		if line == "" {
+			if readErr != nil {
+				break
+			}
 			continue
 		}
 		if !q.metaChecked {
@@ -284,6 +485,7 @@ func (q *Queue) load() error {
 			}
 			if ok {
 				q.metaFound = true
+				q.fileMeta = meta
 				if q.meta != nil && !metaMatches(q.meta, meta) {
 					return errors.New("queue metadata does not match current run parameters")
 				}
@@ -294,16 +496,197 @@ func (q *Queue) load() error {
 			}
 		}
 		var item Item
-		if err := json.Unmarshal([]byte(line), &item); err != nil {
+		if !lineIntact([]byte(line)) {
+			q.corrupt++
+		} else if err := json.Unmarshal([]byte(line), &item); err != nil {
+			q.corrupt++
+		} else if item.ID != "" {
+			q.items[item.ID] = &item
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	q.rebuildIndexes()
+	if q.corrupt > 0 {
+		log.Printf("queue %s: skipped %d corrupt line(s); run `queue fsck --queue-file %s`", q.path, q.corrupt, q.path)
+	}
+	if stale := q.StaleItems(); stale > 0 {
+		log.Printf("queue %s: %d item(s) have fingerprints from an older version; run `queue upgrade --queue-file %s`", q.path, stale, q.path)
+	}
+	return nil
+}
+
+// terminateTail ends a final line cut short by a crash, so the next append
+// starts on a line of its own instead of extending the broken one.
+func (q *Queue) terminateTail() error {
+	info, err := os.Stat(q.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() <= q.offset {
+		return nil
+	}
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+	q.offset = info.Size() + 1
+	return nil
+}
+
+// ReadItems returns the items of the queue file at path without opening it
+// for writing, so it works while another process holds the queue.
+func ReadItems(path string) ([]Item, error) {
+	q := &Queue{
+		path:             path,
+		items:            map[string]*Item{},
+		fingerprintIndex: map[string]string{},
+		sourceIndex:      map[string]struct{}{},
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q.Items(), nil
+}
+
+// Sync loads items that other processes (such as `queue add`) appended to
+// the file since it was last read. Items already known by ID or fingerprint
+// are ignored, so the queue's own writes are skipped as well.
+func (q *Queue) Sync() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.syncLocked()
+}
+
+func (q *Queue) syncLocked() (int, error) {
+	file, err := os.Open(q.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() == q.offset {
+		return 0, nil
+	}
+	if info.Size() < q.offset {
+		q.offset = 0
+	}
+	if _, err := file.Seek(q.offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	reader := bufio.NewReader(file)
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if err != nil {
+			// Stop at a partial line; it is read again once complete.
+			break
+		}
+		q.offset += int64(len(raw))
+		var item Item
+		if !lineIntact(bytes.TrimSpace(raw)) {
 			continue
 		}
-		if item.ID == "" {
+		if err := json.Unmarshal(raw, &item); err != nil || item.ID == "" || item.Fingerprint == "" {
+			continue
+		}
+		if _, ok := q.items[item.ID]; ok {
+			continue
+		}
+		if _, ok := q.fingerprintIndex[item.Fingerprint]; ok {
 			continue
 		}
 		q.items[item.ID] = &item
+		q.fingerprintIndex[item.Fingerprint] = item.ID
+		q.sourceIndex[item.SourceType+":"+item.SourceFingerprint] = struct{}{}
+		added++
 	}
-	q.rebuildIndexes()
-	return scanner.Err()
+	return added, nil
+}
+
+// AppendItems adds items to an existing queue file without taking it over,
+// so a process consuming the queue picks them up via Sync. Items whose
+// fingerprint is already in the file are skipped. Items without a status
+// are queued. It returns the number of items appended.
+func AppendItems(path string, items []Item) (int, error) {
+	existing := &Queue{
+		path:             path,
+		items:            map[string]*Item{},
+		fingerprintIndex: map[string]string{},
+		sourceIndex:      map[string]struct{}{},
+	}
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	if err := existing.load(); err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	added := 0
+	for _, item := range items {
+		if item.Fingerprint == "" {
+			return 0, errors.New("missing fingerprint")
+		}
+		if _, ok := existing.fingerprintIndex[item.Fingerprint]; ok {
+			continue
+		}
+		id, err := buildID()
+		if err != nil {
+			return 0, err
+		}
+		now := nowUTC()
+		item.ID = id
+		if item.Status == "" {
+			item.Status = StatusQueued
+		}
+		item.EnqueuedAt = now
+		item.UpdatedAt = now
+		item.Attempts = 0
+		item.FingerprintVersion = FingerprintVersion
+		existing.fingerprintIndex[item.Fingerprint] = id
+		line, err := encodeLine(item)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(line)
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	// A single append keeps the lines intact next to the owner's writes.
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	return added, nil
 }
 
 func (q *Queue) rebuildIndexes() {
@@ -311,6 +694,11 @@ func (q *Queue) rebuildIndexes() {
 	q.sourceIndex = map[string]struct{}{}
 	for id, item := range q.items {
 		q.fingerprintIndex[item.Fingerprint] = id
+		if item.Stale() {
+			// Files are fingerprinted with the current scheme, so an item
+			// not upgraded yet must still match them.
+			q.fingerprintIndex[item.CurrentFingerprint()] = id
+		}
 		key := item.SourceType + ":" + item.SourceFingerprint
 		q.sourceIndex[key] = struct{}{}
 	}
@@ -336,36 +724,125 @@ func (q *Queue) writeMeta() error {
 	if _, err := file.Write(append(data, '\n')); err != nil {
 		return err
 	}
+	q.offset = int64(len(data) + 1)
 	q.metaChecked = true
 	q.metaFound = true
+	q.fileMeta = q.meta
 	return nil
 }
 
-func (q *Queue) writerLoop() {
-	file, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
+// rewriteRequest asks the writer to replace the file with meta followed by
+// items, a snapshot taken under q.mu so that the writer never needs it.
+type rewriteRequest struct {
+	meta  *Meta
+	items []Item
+	done  chan rewriteResult
+}
+
+type rewriteResult struct {
+	written int64
+	err     error
+}
+
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// writerLoop appends queued records to file in batches. A failed write is
+// retried with backoff, reopening the file, until it succeeds; meanwhile
+// appendCh fills up and callers block instead of losing records. Once Close
+// is called it gives up after closeAttempts.
+func (q *Queue) writerLoop(file *os.File) {
+	defer close(q.writerDone)
+	defer releaseLock(q.lock)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	batch := []*Item{}
-	flush := func() {
-		if len(batch) == 0 {
-			return
+	batch := []Item{}
+	// partial is set after a failed write, which may have left part of a
+	// line behind; the retry starts with a newline to end it.
+	partial := false
+	write := func() error {
+		if file == nil {
+			reopened, err := openAppend(q.path)
+			if err != nil {
+				return err
+			}
+			file = reopened
+		}
+		// Write the batch with one append so lines from other writers
+		// (`queue add`) never interleave with ours.
+		var buf bytes.Buffer
+		if partial {
+			buf.WriteByte('\n')
 		}
 		for _, item := range batch {
-			data, err := json.Marshal(item)
+			line, err := encodeLine(item)
 			if err != nil {
 				continue
 			}
-			writer.Write(data)
-			writer.WriteByte('\n')
+			buf.Write(line)
+		}
+		if _, err := file.Write(buf.Bytes()); err != nil {
+			partial = true
+			return err
+		}
+		partial = false
+		if q.fsync.Load() {
+			if err := file.Sync(); err != nil {
+				return err
+			}
+		}
+		if q.shared {
+			err := file.Close()
+			file = nil
+			return err
+		}
+		return nil
+	}
+	flush := func(closing bool) {
+		if len(batch) == 0 {
+			return
+		}
+		delay := time.Second
+		for attempt := 1; ; attempt++ {
+			err := write()
+			q.setWriteErr(err)
+			if err == nil {
+				batch = batch[:0]
+				return
+			}
+			if file != nil {
+				file.Close()
+				file = nil
+			}
+			if closing && attempt >= closeAttempts {
+				log.Printf("queue %s: write failed: %v; %d record(s) lost", q.path, err, len(batch))
+				batch = batch[:0]
+				return
+			}
+			log.Printf("queue %s: write failed: %v; retrying in %s", q.path, err, delay)
+			if closing {
+				time.Sleep(delay)
+			} else {
+				select {
+				case <-time.After(delay):
+				case <-q.closeCh:
+					closing = true
+				}
+			}
+			delay = min(delay*2, maxWriteBackoff)
+		}
+	}
+	drain := func() {
+		for pending := len(q.appendCh); pending > 0; pending-- {
+			batch = append(batch, <-q.appendCh)
 		}
-		writer.Flush()
-		batch = batch[:0]
 	}
 
 	for {
@@ -373,19 +850,200 @@ func (q *Queue) writerLoop() {
 		case item := <-q.appendCh:
 			batch = append(batch, item)
 			if len(batch) >= 128 {
-				flush()
+				flush(false)
 			}
 		case <-ticker.C:
-			flush()
+			flush(false)
+		case request := <-q.rewriteCh:
+			drain()
+			flush(false)
+			if file != nil {
+				file.Close()
+				file = nil
+			}
+			written, err := q.rewrite(request.meta, request.items)
+			request.done <- rewriteResult{written: written, err: err}
+		case done := <-q.flushCh:
+			drain()
+			flush(false)
+			done <- q.WriteErr()
 		case <-q.closeCh:
-			flush()
+			drain()
+			flush(true)
 			return
 		}
 	}
 }
 
+func (q *Queue) setWriteErr(err error) {
+	q.writeMu.Lock()
+	q.writeErr = err
+	q.writeMu.Unlock()
+}
+
+// WriteErr returns the error of the last failed write while the writer is
+// still retrying it, or nil once writes succeed again.
+func (q *Queue) WriteErr() error {
+	q.writeMu.Lock()
+	defer q.writeMu.Unlock()
+	return q.writeErr
+}
+
+// push hands a record to the writer. It blocks while the writer is behind,
+// and fails once the writer has stopped.
+func (q *Queue) push(item Item) error {
+	select {
+	case <-q.closeCh:
+		return errWriterStopped
+	default:
+	}
+	select {
+	case q.appendCh <- item:
+		return nil
+	case <-q.writerDone:
+		return errWriterStopped
+	}
+}
+
+// rewrite replaces the queue file with the given metadata header followed by
+// items and returns the size of the new file. Only the writer goroutine may
+// call it.
+func (q *Queue) rewrite(meta *Meta, items []Item) (int64, error) {
+	tmpPath := q.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	written := int64(0)
+	if meta != nil {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+		writer.Write(append(data, '\n'))
+		written += int64(len(data) + 1)
+	}
+	for _, item := range items {
+		line, err := encodeLine(item)
+		if err != nil {
+			continue
+		}
+		writer.Write(line)
+		written += int64(len(line))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	// The rename must not replace the queue with a file still in the page
+	// cache.
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// UpdateMeta replaces the metadata header so that a restart with the new
+// parameters matches the queue file.
+func (q *Queue) UpdateMeta(meta *Meta) error {
+	meta = normalizeMeta(meta)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if metaMatches(q.meta, meta) {
+		return nil
+	}
+	_, err := q.rewriteLocked(meta, time.Time{})
+	return err
+}
+
+// Compact rewrites the queue file with one line per item, dropping the
+// superseded status lines. Sent and source_missing items last updated
+// before pruneSentBefore, when it is set, are removed; their files are no
+// longer recognised as sent. It returns how many items were removed.
+func (q *Queue) Compact(pruneSentBefore time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rewriteLocked(q.meta, pruneSentBefore)
+}
+
+// rewriteLocked has the writer rewrite the file with meta and the current
+// state of every item, leaving out sent and source_missing items last
+// updated before pruneSentBefore when it is set. It returns how many items
+// were pruned. q.mu stays held until the writer is done, so no record
+// pushed after the snapshot can be lost with the old file.
+func (q *Queue) rewriteLocked(meta *Meta, pruneSentBefore time.Time) (int, error) {
+	if _, err := q.syncLocked(); err != nil {
+		return 0, err
+	}
+	pruned := []string{}
+	items := make([]Item, 0, len(q.items))
+	for id, item := range q.items {
+		if !pruneSentBefore.IsZero() && (item.Status == StatusSent || item.Status == StatusSourceMissing) {
+			updatedAt, err := time.Parse(time.RFC3339Nano, item.UpdatedAt)
+			if err == nil && updatedAt.Before(pruneSentBefore) {
+				pruned = append(pruned, id)
+				continue
+			}
+		}
+		items = append(items, *item)
+	}
+	SortEnqueued(items)
+
+	request := rewriteRequest{meta: meta, items: items, done: make(chan rewriteResult, 1)}
+	var result rewriteResult
+	select {
+	case q.rewriteCh <- request:
+		result = <-request.done
+	case <-q.writerDone:
+		return 0, errWriterStopped
+	}
+	if result.err != nil {
+		return 0, result.err
+	}
+	for _, id := range pruned {
+		delete(q.items, id)
+	}
+	if len(pruned) > 0 {
+		q.rebuildIndexes()
+	}
+	q.meta = meta
+	q.fileMeta = meta
+	q.offset = result.written
+	return len(pruned), nil
+}
+
+// SetFsync makes the writer fsync the file after every batch, so a power
+// loss cannot lose or truncate lines it already reported written.
+func (q *Queue) SetFsync(enabled bool) {
+	q.fsync.Store(enabled)
+}
+
+// Flush writes the records pushed so far instead of waiting for the next
+// batch, fsyncing them when SetFsync is on. Senders call it once Telegram
+// acknowledges a send, so a crash right after cannot send it again.
+func (q *Queue) Flush() error {
+	done := make(chan error, 1)
+	select {
+	case q.flushCh <- done:
+		return <-done
+	case <-q.writerDone:
+		return errWriterStopped
+	}
+}
+
+// Close flushes pending writes, stops the writer and releases the lock.
 func (q *Queue) Close() {
 	close(q.closeCh)
+	<-q.writerDone
 }
 
 func (q *Queue) HasFingerprint(fingerprint string) bool {
@@ -403,12 +1061,14 @@ func (q *Queue) HasSourceFingerprint(sourceType, sourceFingerprint string) bool
 }
 
 func (q *Queue) Enqueue(item Item) (*Item, error) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
 	if item.Fingerprint == "" {
 		return nil, errors.New("missing fingerprint")
 	}
+	skipReason := q.checkSent(&item)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	if _, exists := q.fingerprintIndex[item.Fingerprint]; exists {
 		return nil, nil
 	}
@@ -423,12 +1083,18 @@ func (q *Queue) Enqueue(item Item) (*Item, error) {
 	item.EnqueuedAt = now
 	item.UpdatedAt = now
 	item.Attempts = 0
+	item.FingerprintVersion = FingerprintVersion
+	if skipReason != "" {
+		item.Status = StatusSkipped
+		item.Error = &skipReason
+	}
 
+	if err := q.push(item); err != nil {
+		return nil, err
+	}
 	q.items[item.ID] = &item
 	q.fingerprintIndex[item.Fingerprint] = item.ID
 	q.sourceIndex[item.SourceType+":"+item.SourceFingerprint] = struct{}{}
-
-	q.appendCh <- &item
 	return &item, nil
 }
 
@@ -449,8 +1115,242 @@ func (q *Queue) UpdateStatusWithAttempts(id string, status string, errMsg *strin
 	item.Status = status
 	item.UpdatedAt = nowUTC()
 	item.Error = errMsg
-	q.appendCh <- item
-	return nil
+	if status == StatusSent {
+		q.recordSent(item)
+	}
+	return q.push(*item)
+}
+
+// Retry queues a failed item again, permanent failures included, with its
+// attempts reset. It reports false when the item has not failed.
+func (q *Queue) Retry(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return false, errors.New("queue item not found")
+	}
+	if item.Status != StatusFailed && item.Status != StatusFailedPermanent {
+		return false, nil
+	}
+	item.Status = StatusQueued
+	item.Attempts = 0
+	item.UpdatedAt = nowUTC()
+	item.Error = nil
+	return true, q.push(*item)
+}
+
+// MarkSourceMissing marks a queued, sending or failed item source_missing.
+// It reports false when the item is in any other state.
+func (q *Queue) MarkSourceMissing(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return false, errors.New("queue item not found")
+	}
+	if item.Status != StatusQueued && item.Status != StatusSending && item.Status != StatusFailed {
+		return false, nil
+	}
+	msg := "source file no longer exists"
+	item.Status = StatusSourceMissing
+	item.UpdatedAt = nowUTC()
+	item.Error = &msg
+	return true, q.push(*item)
+}
+
+// MarkQuarantined records that the file of a failed_permanent item was
+// moved to path. It reports false, changing nothing, for other items.
+func (q *Queue) MarkQuarantined(id string, path string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return false, errors.New("queue item not found")
+	}
+	if item.Status != StatusFailedPermanent || item.Quarantined != "" {
+		return false, nil
+	}
+	item.Quarantined = path
+	item.UpdatedAt = nowUTC()
+	return true, q.push(*item)
+}
+
+// MarkSent marks an item sent and records the message and file_id that
+// carry it, so the file can be downloaded again later.
+func (q *Queue) MarkSent(id string, messageID int, fileID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return errors.New("queue item not found")
+	}
+	item.Status = StatusSent
+	item.UpdatedAt = nowUTC()
+	item.Error = nil
+	item.MessageID = messageID
+	item.FileID = fileID
+	q.recordSent(item)
+	return q.push(*item)
+}
+
+// UpdateSource re-fingerprints a file item whose size or mtime changed
+// after it was enqueued, so the watcher does not enqueue the new version
+// again.
+func (q *Queue) UpdateSource(id string, size int64, mtimeNS int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return errors.New("queue item not found")
+	}
+	if q.fingerprintIndex[item.Fingerprint] == id {
+		delete(q.fingerprintIndex, item.Fingerprint)
+	}
+	item.Size = size
+	item.MTimeNS = &mtimeNS
+	item.Fingerprint = item.CurrentFingerprint()
+	item.FingerprintVersion = FingerprintVersion
+	item.SourceFingerprint = BuildSourceFingerprint(item.SourcePath, size, item.MTimeNS)
+	item.UpdatedAt = nowUTC()
+	q.fingerprintIndex[item.Fingerprint] = id
+	q.sourceIndex[item.SourceType+":"+item.SourceFingerprint] = struct{}{}
+	return q.push(*item)
+}
+
+// SupersedeSource records sourceFingerprint as the current version of the
+// source at sourcePath. Queued and failed items of an older version whose
+// fingerprint is in current move to the new version; the others are
+// skipped, since what they point to is gone. Sent items are left alone.
+func (q *Queue) SupersedeSource(sourceType, sourcePath, sourceFingerprint string, current map[string]bool) (kept int, skipped int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sourceIndex[sourceType+":"+sourceFingerprint] = struct{}{}
+	const msg = "source changed after enqueue; entry is not in the new version"
+	for _, item := range q.items {
+		if item.SourceType != sourceType || item.SourcePath != sourcePath || item.SourceFingerprint == sourceFingerprint {
+			continue
+		}
+		if item.Status != StatusQueued && item.Status != StatusFailed {
+			continue
+		}
+		item.UpdatedAt = nowUTC()
+		if current[item.Fingerprint] {
+			item.SourceFingerprint = sourceFingerprint
+			kept++
+		} else {
+			reason := msg
+			item.Status = StatusSkipped
+			item.Error = &reason
+			skipped++
+		}
+		if pushErr := q.push(*item); pushErr != nil {
+			err = pushErr
+		}
+	}
+	return kept, skipped, err
+}
+
+// SetPHash records the perceptual hash of an image item.
+func (q *Queue) SetPHash(id string, phash string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return errors.New("queue item not found")
+	}
+	item.PHash = phash
+	item.UpdatedAt = nowUTC()
+	return q.push(*item)
+}
+
+// SentPHashes returns item ID to perceptual hash for every sent item that
+// has one.
+func (q *Queue) SentPHashes() map[string]string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	hashes := map[string]string{}
+	for _, item := range q.items {
+		if item.Status == StatusSent && item.PHash != "" {
+			hashes[item.ID] = item.PHash
+		}
+	}
+	return hashes
+}
+
+// SentSince returns the number and total size of items marked sent at or
+// after since.
+func (q *Queue) SentSince(since time.Time) (int, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	files := 0
+	size := int64(0)
+	for _, item := range q.items {
+		if item.Status != StatusSent {
+			continue
+		}
+		updatedAt, err := time.Parse(time.RFC3339Nano, item.UpdatedAt)
+		if err != nil || updatedAt.Before(since) {
+			continue
+		}
+		files++
+		size += item.Size
+	}
+	return files, size
+}
+
+// FileMeta returns the metadata line of the queue file, or nil when it has
+// none. Queues opened without metadata report the file's as well.
+func (q *Queue) FileMeta() *Meta {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.fileMeta
+}
+
+// Item returns a copy of the item with id.
+func (q *Queue) Item(id string) (Item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	if !ok {
+		return Item{}, false
+	}
+	return *item, true
+}
+
+// Items returns copies of every item in the queue.
+func (q *Queue) Items() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]Item, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+	return items
+}
+
+// RecentFailed returns copies of up to limit failed items, permanent
+// failures and missing sources included, most recently failed first.
+func (q *Queue) RecentFailed(limit int) []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	failed := []Item{}
+	for _, item := range q.items {
+		if item.Status == StatusFailed || item.Status == StatusFailedPermanent || item.Status == StatusSourceMissing {
+			failed = append(failed, *item)
+		}
+	}
+	updatedAt := func(item Item) time.Time {
+		parsed, _ := time.Parse(time.RFC3339Nano, item.UpdatedAt)
+		return parsed
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return updatedAt(failed[i]).After(updatedAt(failed[j]))
+	})
+	if limit > 0 && len(failed) > limit {
+		return failed[:limit]
+	}
+	return failed
 }
 
 func (q *Queue) Pending(limit int) []*Item {
@@ -462,15 +1362,21 @@ func (q *Queue) Pending(limit int) []*Item {
 			pending = append(pending, item)
 		}
 	}
-	sort.Slice(pending, func(i, j int) bool {
-		return pending[i].EnqueuedAt < pending[j].EnqueuedAt
-	})
+	sortPending(pending, q.order)
 	if limit > 0 && len(pending) > limit {
 		return pending[:limit]
 	}
 	return pending
 }
 
+// IsPending reports whether the item is still waiting to be sent.
+func (q *Queue) IsPending(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[id]
+	return ok && pendingStatuses[item.Status]
+}
+
 func (q *Queue) PendingWithAttempts(limit int, maxAttempts int) []*Item {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -484,9 +1390,7 @@ func (q *Queue) PendingWithAttempts(limit int, maxAttempts int) []*Item {
 		}
 		pending = append(pending, item)
 	}
-	sort.Slice(pending, func(i, j int) bool {
-		return pending[i].EnqueuedAt < pending[j].EnqueuedAt
-	})
+	sortPending(pending, q.order)
 	if limit > 0 && len(pending) > limit {
 		return pending[:limit]
 	}
@@ -497,10 +1401,13 @@ func (q *Queue) Stats() map[string]int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	counts := map[string]int{
-		StatusQueued:  0,
-		StatusSending: 0,
-		StatusSent:    0,
-		StatusFailed:  0,
+		StatusQueued:          0,
+		StatusSending:         0,
+		StatusSent:            0,
+		StatusFailed:          0,
+		StatusSkipped:         0,
+		StatusFailedPermanent: 0,
+		StatusSourceMissing:   0,
 	}
 	for _, item := range q.items {
 		if _, ok := counts[item.Status]; ok {
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sentindex"
+)
+
+// SetSentIndex makes Enqueue skip items whose content index records as
+// sent to chatID already, and records items of this queue once sent.
+func (q *Queue) SetSentIndex(index *sentindex.Index, chatID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sentIndex = index
+	q.sentChat = chatID
+}
+
+// checkSent hashes a new item and returns why it should be skipped, or ""
+// when its content has not been sent to the chat. Hashing happens outside
+// the queue lock.
+func (q *Queue) checkSent(item *Item) string {
+	q.mu.Lock()
+	index, chatID := q.sentIndex, q.sentChat
+	_, exists := q.fingerprintIndex[item.Fingerprint]
+	q.mu.Unlock()
+	if index == nil || exists {
+		return ""
+	}
+	if item.ContentHash == "" {
+		var hash string
+		var err error
+		if item.SourceType == "zip" && item.InnerPath != nil {
+			hash, err = sentindex.HashZipEntry(item.Path, *item.InnerPath)
+		} else {
+			hash, err = sentindex.HashFile(item.Path)
+		}
+		if err != nil {
+			log.Printf("Sent index: cannot hash %s: %v", describeItem(item), err)
+			return ""
+		}
+		item.ContentHash = hash
+	}
+	entry, ok := index.Lookup(chatID, item.ContentHash)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("already sent to chat %s as %s at %s", chatID, entry.Path, entry.SentAt)
+}
+
+// recordSent adds a sent item to the sent index. Callers hold q.mu.
+func (q *Queue) recordSent(item *Item) {
+	if q.sentIndex == nil || item.ContentHash == "" {
+		return
+	}
+	entry := sentindex.Entry{
+		ChatID:    q.sentChat,
+		SHA256:    item.ContentHash,
+		Size:      item.Size,
+		Path:      item.Path,
+		MessageID: item.MessageID,
+	}
+	if item.InnerPath != nil {
+		entry.InnerPath = *item.InnerPath
+	}
+	if err := q.sentIndex.Record(entry); err != nil {
+		log.Printf("Sent index: cannot record %s: %v", describeItem(item), err)
+	}
+}
+
+func describeItem(item *Item) string {
+	if item.InnerPath != nil {
+		return item.Path + ":" + *item.InnerPath
+	}
+	return item.Path
+}
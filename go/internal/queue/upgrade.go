@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"os"
+	"time"
+)
+
+// FingerprintVersion is the scheme BuildFingerprint implements. Items
+// record the version their fingerprint was built with; items written
+// before versioning, including those of the Python tool, are version 1.
+// A change to BuildFingerprint must bump it and keep CurrentFingerprint
+// able to rebuild the new fingerprint from the fields an item stores.
+const FingerprintVersion = 1
+
+// fingerprintVersion is the scheme of the item's fingerprint.
+func (item *Item) fingerprintVersion() int {
+	if item.FingerprintVersion == 0 {
+		return 1
+	}
+	return item.FingerprintVersion
+}
+
+// Stale reports whether the item's fingerprint was built with an older
+// scheme than BuildFingerprint's.
+func (item *Item) Stale() bool {
+	return item.fingerprintVersion() < FingerprintVersion
+}
+
+// CurrentFingerprint rebuilds the item's fingerprint with the current
+// scheme from its source, path, size, mtime and CRC.
+func (item *Item) CurrentFingerprint() string {
+	return BuildFingerprint(item.SourceType, item.Path, item.InnerPath, item.Size, item.MTimeNS, item.CRC)
+}
+
+// UpgradeReport is the result of UpgradeFingerprints.
+type UpgradeReport struct {
+	Items int
+	// Upgraded counts the items that were on an older scheme, and Changed
+	// those of them whose fingerprint is different under the current one.
+	Upgraded int
+	Changed  int
+}
+
+// StaleItems counts the items whose fingerprint uses an older scheme.
+func (q *Queue) StaleItems() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stale := 0
+	for _, item := range q.items {
+		if item.Stale() {
+			stale++
+		}
+	}
+	return stale
+}
+
+// UpgradeFingerprints rebuilds the fingerprints of items on an older scheme
+// with the current one and rewrites the queue file, keeping the original as
+// path.bak, so sent files are still recognised after BuildFingerprint
+// changes. With dryRun it only reports what it would change.
+func (q *Queue) UpgradeFingerprints(dryRun bool) (UpgradeReport, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	report := UpgradeReport{Items: len(q.items)}
+	for _, item := range q.items {
+		if !item.Stale() {
+			continue
+		}
+		report.Upgraded++
+		fingerprint := item.CurrentFingerprint()
+		if fingerprint != item.Fingerprint {
+			report.Changed++
+		}
+		if dryRun {
+			continue
+		}
+		item.Fingerprint = fingerprint
+		item.FingerprintVersion = FingerprintVersion
+	}
+	if !dryRun && report.Upgraded > 0 {
+		q.rebuildIndexes()
+	}
+	if dryRun || report.Upgraded == 0 {
+		return report, nil
+	}
+
+	original, err := os.ReadFile(q.path)
+	if err != nil {
+		return report, err
+	}
+	if err := writeFileSync(q.path+".bak", original); err != nil {
+		return report, err
+	}
+	_, err = q.rewriteLocked(q.fileMeta, time.Time{})
+	return report, err
+}
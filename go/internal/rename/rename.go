@@ -0,0 +1,186 @@
+// Package rename gives uploaded files names rendered from a template such
+// as "{index:04d}_{basename}", so files from messy camera folders arrive
+// with clean sequential names.
+package rename
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// Variables lists the placeholders a template may use.
+var Variables = []string{"index", "basename", "ext", "dir", "date", "hash"}
+
+var placeholder = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+var indexFormat = regexp.MustCompile(`^0?\d*d$`)
+
+// Template is a parsed --rename-template. Placeholders:
+//
+//	{index}    position of the file in the run, from 1; {index:04d} pads it
+//	{basename} original file name without its extension
+//	{ext}      extension of the uploaded file, with the dot
+//	{dir}      name of the folder (or zip) the file came from
+//	{date}     modification date, 2006-01-02; {date:20060102} sets the Go layout
+//	{hash}     first 8 hex digits of the uploaded file's SHA-256; {hash:12} sets the length
+//
+// The extension is appended when the template has no {ext}.
+type Template struct {
+	raw    string
+	hasExt bool
+}
+
+func Parse(raw string) (*Template, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("empty rename template")
+	}
+	tmpl := &Template{raw: raw}
+	for _, match := range placeholder.FindAllStringSubmatch(raw, -1) {
+		name, spec := match[1], match[2]
+		switch name {
+		case "index":
+			if spec != "" && !indexFormat.MatchString(spec) {
+				return nil, fmt.Errorf("invalid rename template: {index:%s} wants a width such as 04d", spec)
+			}
+		case "hash":
+			if spec != "" {
+				if n, err := strconv.Atoi(spec); err != nil || n < 1 || n > 64 {
+					return nil, fmt.Errorf("invalid rename template: {hash:%s} wants a length of 1-64", spec)
+				}
+			}
+		case "ext":
+			tmpl.hasExt = true
+		case "basename", "dir", "date":
+		default:
+			return nil, fmt.Errorf("invalid rename template: unknown variable {%s} (want %s)", name, strings.Join(Variables, ", "))
+		}
+	}
+	return tmpl, nil
+}
+
+// Vars are the values one file's name is rendered from.
+type Vars struct {
+	Index   int
+	Name    string
+	Dir     string
+	ModTime time.Time
+	// Hash is the hex SHA-256 of the uploaded file.
+	Hash string
+}
+
+// Render returns the file name for vars. Path separators in the values
+// become underscores.
+func (t *Template) Render(vars Vars) string {
+	ext := filepath.Ext(vars.Name)
+	name := placeholder.ReplaceAllStringFunc(t.raw, func(token string) string {
+		match := placeholder.FindStringSubmatch(token)
+		spec := match[2]
+		switch match[1] {
+		case "index":
+			if spec == "" {
+				spec = "d"
+			}
+			return fmt.Sprintf("%"+spec, vars.Index)
+		case "basename":
+			return strings.TrimSuffix(vars.Name, ext)
+		case "ext":
+			return ext
+		case "dir":
+			return vars.Dir
+		case "date":
+			if spec == "" {
+				spec = "2006-01-02"
+			}
+			return vars.ModTime.Format(spec)
+		case "hash":
+			length := 8
+			if spec != "" {
+				length, _ = strconv.Atoi(spec)
+			}
+			return vars.Hash[:min(length, len(vars.Hash))]
+		}
+		return token
+	})
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if !t.hasExt {
+		name += ext
+	}
+	return name
+}
+
+// Renamer numbers the files of one run in the order they are first sent.
+// A file sent again, e.g. after a failed album, keeps its name.
+type Renamer struct {
+	tmpl  *Template
+	mu    sync.Mutex
+	next  int
+	names map[string]string
+}
+
+func NewRenamer(tmpl *Template) *Renamer {
+	return &Renamer{tmpl: tmpl, next: 1, names: map[string]string{}}
+}
+
+// Hook parses raw and returns a fresh Renamer's hook for
+// telegram.SendOptions.Rename; an empty template returns nil.
+func Hook(raw string) (func(telegram.MediaFile) string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	tmpl, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return NewRenamer(tmpl).Rename, nil
+}
+
+// Rename is a telegram.SendOptions.Rename hook.
+func (r *Renamer) Rename(file telegram.MediaFile) string {
+	key := file.Source + "\x00" + file.Filename
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+	vars := Vars{Index: r.next, Name: file.Filename, ModTime: time.Now(), Hash: hashFile(file)}
+	if info, err := os.Stat(file.Source); err == nil {
+		vars.ModTime = info.ModTime()
+	}
+	if strings.EqualFold(filepath.Ext(file.Source), ".zip") {
+		vars.Dir = strings.TrimSuffix(filepath.Base(file.Source), filepath.Ext(file.Source))
+	} else {
+		vars.Dir = filepath.Base(filepath.Dir(file.Source))
+	}
+	r.next++
+	name := r.tmpl.Render(vars)
+	r.names[key] = name
+	return name
+}
+
+func hashFile(file telegram.MediaFile) string {
+	hash := sha256.New()
+	if file.Data == nil && file.Path != "" {
+		source, err := os.Open(file.Path)
+		if err != nil {
+			return ""
+		}
+		defer source.Close()
+		if _, err := io.Copy(hash, source); err != nil {
+			return ""
+		}
+	} else {
+		hash.Write(file.Data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
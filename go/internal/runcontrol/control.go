@@ -0,0 +1,111 @@
+package runcontrol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+const controlTimeout = 5 * time.Second
+
+type ControlRequest struct {
+	Command string `json:"command"`
+}
+
+type ControlResponse struct {
+	OK     bool                      `json:"ok"`
+	Error  string                    `json:"error,omitempty"`
+	Paused bool                      `json:"paused"`
+	Queues map[string]map[string]int `json:"queues,omitempty"`
+	// Latency holds the request stats of each API endpoint used so far.
+	Latency []telegram.RequestStats `json:"latency,omitempty"`
+}
+
+// ServeControl accepts pause, resume and status commands on a unix socket
+// until ctx is cancelled. stats reports queue counts keyed by queue name.
+// Unix sockets are also available on Windows 10 and later.
+func ServeControl(ctx context.Context, path string, gate *PauseGate, stats func() map[string]map[string]int) error {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another process", path)
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	os.Chmod(path, 0o600)
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	defer os.Remove(path)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go handleControl(conn, gate, stats)
+	}
+}
+
+func handleControl(conn net.Conn, gate *PauseGate, stats func() map[string]map[string]int) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	var request ControlRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&request); err != nil {
+		json.NewEncoder(conn).Encode(ControlResponse{Error: err.Error()})
+		return
+	}
+	response := ControlResponse{OK: true}
+	switch request.Command {
+	case "pause":
+		gate.Pause()
+		log.Printf("paused via control socket")
+	case "resume":
+		gate.Resume()
+		log.Printf("resumed via control socket")
+	case "status":
+	default:
+		response = ControlResponse{Error: fmt.Sprintf("unknown command %q", request.Command)}
+	}
+	response.Paused = gate.IsPaused()
+	if stats != nil {
+		response.Queues = stats()
+	}
+	response.Latency = telegram.EndpointStats()
+	json.NewEncoder(conn).Encode(response)
+}
+
+// SendControl sends one command to a control socket and returns the reply.
+func SendControl(path string, command string) (*ControlResponse, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	if err := json.NewEncoder(conn).Encode(ControlRequest{Command: command}); err != nil {
+		return nil, err
+	}
+	var response ControlResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, err
+	}
+	if !response.OK {
+		return &response, errors.New(response.Error)
+	}
+	return &response, nil
+}
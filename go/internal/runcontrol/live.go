@@ -0,0 +1,62 @@
+package runcontrol
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Live holds a value that loops re-read on every iteration, so a reload can
+// swap settings without restarting them.
+type Live[T any] struct {
+	mu    sync.RWMutex
+	value T
+}
+
+func NewLive[T any](value T) *Live[T] {
+	return &Live[T]{value: value}
+}
+
+func (l *Live[T]) Load() T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.value
+}
+
+func (l *Live[T]) Store(value T) {
+	l.mu.Lock()
+	l.value = value
+	l.mu.Unlock()
+}
+
+// WatchFile polls path and calls onChange whenever its size or modification
+// time changes, until ctx is cancelled.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	stamp := func() (int64, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return -1, -1
+		}
+		return info.Size(), info.ModTime().UnixNano()
+	}
+	lastSize, lastMTime := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		size, mtime := stamp()
+		if size < 0 || (size == lastSize && mtime == lastMTime) {
+			continue
+		}
+		lastSize, lastMTime = size, mtime
+		onChange()
+	}
+}
@@ -36,7 +36,15 @@ func (p *PauseGate) IsPaused() bool {
 	return p.paused
 }
 
+// Wait blocks while the gate is paused. It returns false once ctx is done,
+// including when ctx is cancelled during the pause.
 func (p *PauseGate) Wait(ctx context.Context) bool {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	})
+	defer stop()
 	p.mu.Lock()
 	for p.paused {
 		if ctx.Err() != nil {
@@ -0,0 +1,28 @@
+package runcontrol
+
+// Trigger wakes a loop waiting for its next iteration. Firing it while the
+// loop is busy makes the next wait return at once; repeated fires collapse
+// into one.
+type Trigger struct {
+	ch chan struct{}
+}
+
+func NewTrigger() *Trigger {
+	return &Trigger{ch: make(chan struct{}, 1)}
+}
+
+func (t *Trigger) Fire() {
+	select {
+	case t.ch <- struct{}{}:
+	default:
+	}
+}
+
+// C returns the channel that receives a value when the trigger fires. It is
+// nil, and never ready, for a nil trigger.
+func (t *Trigger) C() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.ch
+}
@@ -0,0 +1,71 @@
+package sender
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+const maxCaptionRunes = 1024
+
+// metadataCaption describes where an item came from: its path relative to
+// the watch directory that contains it (archive.zip:inner/path for zip
+// entries), its size and its modification time, so a backup channel can be
+// restored into the original tree. It is empty unless MetadataCaptions is set.
+func metadataCaption(cfg Config, item *queue.Item) string {
+	if !cfg.MetadataCaptions {
+		return ""
+	}
+	name := filepath.ToSlash(relativeToRoot(item.Path, cfg.CaptionRoots))
+	if item.SourceType == "zip" && item.InnerPath != nil {
+		name += ":" + *item.InnerPath
+	}
+	details := []string{formatSize(item.Size)}
+	if item.MTimeNS != nil {
+		details = append(details, time.Unix(0, *item.MTimeNS).Format("2006-01-02 15:04:05 -0700"))
+	}
+	detail := strings.Join(details, " · ")
+	// Telegram rejects captions over 1024 characters; keep the end of a
+	// very long path, which names the file.
+	if limit := maxCaptionRunes - len([]rune(detail)) - 2; len([]rune(name)) > limit {
+		runes := []rune(name)
+		name = "…" + string(runes[len(runes)-limit+1:])
+	}
+	return name + "\n" + detail
+}
+
+// relativeToRoot returns path relative to the deepest root containing it, or
+// the base name when no root does.
+func relativeToRoot(path string, roots []string) string {
+	best := ""
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best == "" || len(rel) < len(best) {
+			best = rel
+		}
+	}
+	if best == "" || best == "." {
+		return filepath.Base(path)
+	}
+	return best
+}
+
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	value := float64(size)
+	idx := 0
+	for value >= 1024 && idx < len(units)-1 {
+		value /= 1024
+		idx++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[idx])
+}
@@ -0,0 +1,72 @@
+package sender
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// phashIndex holds the perceptual hashes of images that were sent or are
+// being sent, keyed by queue item ID.
+type phashIndex struct {
+	hashes map[string]uint64
+}
+
+func loadPHashIndex(q *queue.Queue) *phashIndex {
+	index := &phashIndex{hashes: map[string]uint64{}}
+	for id, value := range q.SentPHashes() {
+		if hash, err := strconv.ParseUint(value, 16, 64); err == nil {
+			index.hashes[id] = hash
+		}
+	}
+	return index
+}
+
+// match returns the ID of an indexed image within maxDistance of hash.
+func (p *phashIndex) match(id string, hash uint64, maxDistance int) (string, bool) {
+	for otherID, other := range p.hashes {
+		if otherID == id {
+			continue
+		}
+		if imageutil.HammingDistance(hash, other) <= maxDistance {
+			return otherID, true
+		}
+	}
+	return "", false
+}
+
+func (p *phashIndex) add(id string, hash uint64) {
+	p.hashes[id] = hash
+}
+
+func (p *phashIndex) remove(id string) {
+	delete(p.hashes, id)
+}
+
+// checkDuplicate hashes an image item and marks it skipped when it looks like
+// an image that was already sent. It reports whether the item was skipped.
+func checkDuplicate(cfg Config, q *queue.Queue, index *phashIndex, item *queue.Item, data []byte) bool {
+	if index == nil {
+		return false
+	}
+	hash, err := imageutil.DHash(data)
+	if err != nil {
+		return false
+	}
+	if otherID, ok := index.match(item.ID, hash, cfg.PHashDistance); ok {
+		msg := fmt.Sprintf("near-duplicate of %s", otherID)
+		log.Printf("skipping %s: %s", displayName(item), msg)
+		if err := q.UpdateStatus(item.ID, queue.StatusSkipped, &msg); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		return true
+	}
+	if err := q.SetPHash(item.ID, fmt.Sprintf("%016x", hash)); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+	index.add(item.ID, hash)
+	return false
+}
@@ -0,0 +1,145 @@
+package sender
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
+)
+
+// MemoryBudget caps the bytes senders hold at once: file contents, decoded
+// images and prepared album items. One budget may be shared by several
+// senders, as the daemon does for its jobs. A nil budget is unlimited.
+type MemoryBudget struct {
+	limit int64
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{}
+}
+
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &MemoryBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire reserves n bytes, at most the whole budget, and returns how many
+// it reserved. Without wait it fails at once when the budget is short;
+// otherwise it waits until other holders release enough or ctx is done.
+func (b *MemoryBudget) acquire(ctx context.Context, n int64, wait bool) (int64, bool) {
+	if b == nil || n <= 0 {
+		return 0, true
+	}
+	n = min(n, b.limit)
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return n, true
+		}
+		freed := b.freed
+		b.mu.Unlock()
+		if !wait {
+			return 0, false
+		}
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case <-freed:
+		}
+	}
+}
+
+func (b *MemoryBudget) release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used = max(b.used-n, 0)
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// streams reports whether a file of size bytes is sent from disk instead of
+// memory: anything from constants.StreamMinBytes or over a quarter of the
+// budget.
+func (b *MemoryBudget) streams(size int64) bool {
+	return size >= constants.StreamMinBytes || (b != nil && size > b.limit/4)
+}
+
+// decodedSize estimates the memory an image takes once decoded, from its
+// header: four bytes per pixel.
+func decodedSize(data []byte) int64 {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return int64(config.Width) * int64(config.Height) * 4
+}
+
+// streamItem returns item as a file streamed from disk. Zip entries are
+// extracted to a temporary file first, which cleanup removes; encrypted
+// entries cannot be streamed and report false.
+func streamItem(item *queue.Item) (telegram.MediaFile, func(), bool, error) {
+	if item.SourceType == "file" {
+		return telegram.MediaFile{Filename: filepath.Base(item.Path), Path: item.Path, Size: item.Size}, func() {}, true, nil
+	}
+	if item.SourceType != "zip" || item.InnerPath == nil {
+		return telegram.MediaFile{}, nil, false, nil
+	}
+	archive, err := zip.OpenReader(item.Path)
+	if err != nil {
+		return telegram.MediaFile{}, nil, false, err
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if filepath.ToSlash(file.Name) != filepath.ToSlash(*item.InnerPath) {
+			continue
+		}
+		if ziputil.IsEncrypted(file) {
+			return telegram.MediaFile{}, nil, false, nil
+		}
+		path, err := extractTemp(file)
+		if err != nil {
+			return telegram.MediaFile{}, nil, false, err
+		}
+		media := telegram.MediaFile{Filename: filepath.Base(file.Name), Path: path, Size: int64(file.UncompressedSize64)}
+		return media, func() { os.Remove(path) }, true, nil
+	}
+	return telegram.MediaFile{}, nil, false, os.ErrNotExist
+}
+
+func extractTemp(file *zip.File) (string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	out, err := tempdir.CreateTemp("zip-*" + filepath.Ext(file.Name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
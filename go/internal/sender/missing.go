@@ -0,0 +1,48 @@
+package sender
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// CheckSource stats the file behind item just before it is read and marks
+// the item source_missing when the file is gone. It reports whether the
+// item should still be sent; other stat errors are left to the read.
+func CheckSource(q *queue.Queue, item *queue.Item) bool {
+	if _, err := os.Stat(item.Path); !errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	log.Printf("%s no longer exists, not sending it", item.Path)
+	if _, err := q.MarkSourceMissing(item.ID); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+	return false
+}
+
+// SweepMissing marks queued and failed items whose file no longer exists
+// source_missing, so they stop being retried, and returns how many it
+// marked.
+func SweepMissing(q *queue.Queue) int {
+	marked := 0
+	for _, item := range q.Items() {
+		if item.Status != queue.StatusQueued && item.Status != queue.StatusFailed {
+			continue
+		}
+		if _, err := os.Stat(item.Path); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		ok, err := q.MarkSourceMissing(item.ID)
+		if err != nil {
+			log.Printf("queue update failed: %v", err)
+			continue
+		}
+		if ok {
+			marked++
+		}
+	}
+	return marked
+}
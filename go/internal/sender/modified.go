@@ -0,0 +1,77 @@
+package sender
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// Policies for a file that changed between enqueue and send.
+const (
+	// ModifiedUpdate re-fingerprints the item and sends the current content.
+	ModifiedUpdate = "update"
+	// ModifiedResend skips the item; the watcher enqueues the new version
+	// as a fresh item once it has settled.
+	ModifiedResend = "resend"
+	// ModifiedSkip skips the item and records the new fingerprint so the
+	// new version is not sent either.
+	ModifiedSkip = "skip"
+)
+
+func ParseModifiedPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return ModifiedUpdate, nil
+	case ModifiedUpdate, ModifiedResend, ModifiedSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid on-modified policy %q (use update, resend or skip)", value)
+}
+
+// checkModified re-stats a file item just before it is read and applies the
+// configured policy when its size or mtime no longer match the queue. It
+// reports whether the item should still be sent. Missing files are left to
+// CheckSource.
+func checkModified(cfg Config, q *queue.Queue, item *queue.Item) bool {
+	if item.SourceType != "file" || item.MTimeNS == nil {
+		return true
+	}
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return true
+	}
+	size := info.Size()
+	mtimeNS := info.ModTime().UnixNano()
+	if size == item.Size && mtimeNS == *item.MTimeNS {
+		return true
+	}
+
+	switch cfg.ModifiedPolicy {
+	case ModifiedResend:
+		log.Printf("%s changed after enqueue, leaving it for the watcher to re-enqueue", item.Path)
+		msg := "changed after enqueue; re-enqueued by the watcher once settled"
+		if err := q.UpdateStatus(item.ID, queue.StatusSkipped, &msg); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		return false
+	case ModifiedSkip:
+		log.Printf("%s changed after enqueue, skipping it", item.Path)
+		if err := q.UpdateSource(item.ID, size, mtimeNS); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		msg := "changed after enqueue; skipped"
+		if err := q.UpdateStatus(item.ID, queue.StatusSkipped, &msg); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		return false
+	default:
+		log.Printf("%s changed after enqueue, sending the current version", item.Path)
+		if err := q.UpdateSource(item.ID, size, mtimeNS); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		return true
+	}
+}
@@ -0,0 +1,26 @@
+package sender
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ordering guarantees between media groups.
+const (
+	// OrderingRelaxed moves on past a failed group; it is retried in a later
+	// pass, so it may land after groups queued behind it.
+	OrderingRelaxed = "relaxed"
+	// OrderingStrict sends nothing queued after a failed group until the
+	// group is sent or fails permanently.
+	OrderingStrict = "strict"
+)
+
+func ParseOrdering(value string) (string, error) {
+	switch ordering := strings.ToLower(strings.TrimSpace(value)); ordering {
+	case "":
+		return OrderingRelaxed, nil
+	case OrderingRelaxed, OrderingStrict:
+		return ordering, nil
+	}
+	return "", fmt.Errorf("invalid ordering %q (use strict or relaxed)", value)
+}
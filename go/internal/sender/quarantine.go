@@ -0,0 +1,157 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// Permanent reports whether err means the item can never be sent as it
+// is: Telegram rejected it for good or the image does not decode.
+func Permanent(err error) bool {
+	return telegram.IsPermanent(err) || errors.Is(err, imageutil.ErrInvalidImage)
+}
+
+// QuarantineDir returns the quarantine folder for files under root: dir
+// itself when absolute, otherwise dir inside root.
+func QuarantineDir(dir string, root string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(root, dir)
+}
+
+// QuarantineFailed moves the files of failed_permanent items not moved yet
+// into the quarantine folder dir, keeping their path relative to the
+// deepest of roots that holds them, and writes the error next to each as
+// NAME.error.txt. A relative dir is resolved inside that root, or next to
+// the file when no root holds it. Files inside zips stay where they are.
+// It returns how many files it moved.
+func QuarantineFailed(q *queue.Queue, dir string, roots []string) int {
+	if dir == "" {
+		return 0
+	}
+	moved := 0
+	for _, item := range q.Items() {
+		if quarantineItem(q, item, dir, roots) {
+			moved++
+		}
+	}
+	return moved
+}
+
+// quarantineBatch is QuarantineFailed for the items of one batch.
+func quarantineBatch(cfg Config, q *queue.Queue, batch []*queue.Item) {
+	if cfg.Quarantine == "" {
+		return
+	}
+	for _, sent := range batch {
+		if item, ok := q.Item(sent.ID); ok {
+			quarantineItem(q, item, cfg.Quarantine, cfg.CaptionRoots)
+		}
+	}
+}
+
+func quarantineItem(q *queue.Queue, item queue.Item, dir string, roots []string) bool {
+	if item.Status != queue.StatusFailedPermanent || item.Quarantined != "" || item.SourceType != "file" {
+		return false
+	}
+	root := filepath.Dir(item.Path)
+	rel := filepath.Base(item.Path)
+	if deepest := deepestRoot(item.Path, roots); deepest != "" {
+		root = deepest
+		rel, _ = filepath.Rel(deepest, item.Path)
+	}
+	dest, err := quarantineFile(item, QuarantineDir(dir, root), rel)
+	if err != nil {
+		log.Printf("cannot quarantine %s: %v", item.Path, err)
+		return false
+	}
+	if _, err := q.MarkQuarantined(item.ID, dest); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+	log.Printf("moved %s to %s after a permanent failure", item.Path, dest)
+	return true
+}
+
+// deepestRoot returns the deepest of roots that holds path, or "".
+func deepestRoot(path string, roots []string) string {
+	best := ""
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
+
+// quarantineFile moves the item's file to rel inside dir, under a free name,
+// and writes its error note. It returns the new path.
+func quarantineFile(item queue.Item, dir string, rel string) (string, error) {
+	dest := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(dest); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		dest = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	if err := moveFile(item.Path, dest); err != nil {
+		return "", err
+	}
+	reason := "unknown error"
+	if item.Error != nil {
+		reason = *item.Error
+	}
+	note := fmt.Sprintf("source: %s\nfailed: %s\nattempts: %d\nqueue item: %s\nerror: %s\n",
+		item.Path, item.UpdatedAt, item.Attempts, item.ID, reason)
+	if err := os.WriteFile(dest+".error.txt", []byte(note), 0o644); err != nil {
+		log.Printf("cannot write error note for %s: %v", dest, err)
+	}
+	return dest, nil
+}
+
+// moveFile renames src to dest, copying it when they are on different
+// filesystems.
+func moveFile(src string, dest string) error {
+	err := os.Rename(src, dest)
+	if err == nil {
+		return nil
+	}
+	in, openErr := os.Open(src)
+	if openErr != nil {
+		return err
+	}
+	defer in.Close()
+	out, createErr := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if createErr != nil {
+		return err
+	}
+	if _, copyErr := io.Copy(out, in); copyErr != nil {
+		out.Close()
+		os.Remove(dest)
+		return copyErr
+	}
+	if closeErr := out.Close(); closeErr != nil {
+		os.Remove(dest)
+		return closeErr
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,61 @@
+package sender
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// Quota caps how many files and bytes are sent per calendar day. Usage is
+// counted from the queue's sent items, so it survives restarts.
+type Quota struct {
+	Files    int   // 0 disables
+	Bytes    int64 // 0 disables
+	Location *time.Location
+}
+
+// LoadQuotaLocation resolves a --quota-timezone value; empty means local time.
+func LoadQuotaLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quota timezone %q: %w", name, err)
+	}
+	return location, nil
+}
+
+func (qt Quota) enabled() bool {
+	return qt.Files > 0 || qt.Bytes > 0
+}
+
+// window returns the start of the quota day containing now and the
+// following midnight.
+func (qt Quota) window(now time.Time) (time.Time, time.Time) {
+	location := qt.Location
+	if location == nil {
+		location = time.Local
+	}
+	local := now.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// reached reports whether today's usage across queues hits a limit, along
+// with the usage and the time the quota resets.
+func (qt Quota) reached(queues []*queue.Queue, now time.Time) (bool, int, int64, time.Time) {
+	if !qt.enabled() {
+		return false, 0, 0, time.Time{}
+	}
+	start, reset := qt.window(now)
+	files, size := 0, int64(0)
+	for _, q := range queues {
+		sentFiles, sentBytes := q.SentSince(start)
+		files += sentFiles
+		size += sentBytes
+	}
+	full := (qt.Files > 0 && files >= qt.Files) || (qt.Bytes > 0 && size >= qt.Bytes)
+	return full, files, size, reset
+}
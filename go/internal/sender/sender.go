@@ -2,24 +2,33 @@ package sender
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/notify"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/splitter"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tracing"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/ziputil"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
 )
 
 type Config struct {
 	ChatID        string
 	TopicID       *int
 	GroupSize     int
+	GroupMaxBytes int64 // prepared bytes per media group, 0 disables
 	SendInterval  time.Duration
 	BatchDelay    time.Duration
 	PauseEvery    int
@@ -29,56 +38,42 @@ type Config struct {
 	PNGStartLevel int
 	Retry         telegram.RetryConfig
 	ZipPasswords  []string
+	// PHashDedup skips images within PHashDistance bits of an image that
+	// was already sent from the same queue.
+	PHashDedup    bool
+	PHashDistance int
+	// AlbumVideos batches small videos into albums with images.
+	AlbumVideos bool
+	// AutoSplit sends files larger than its part size as archive volumes.
+	AutoSplit splitter.Spec
+	// DailyQuota pauses sending until midnight once a day's limit is hit;
+	// Notify, when enabled, posts a message when that happens.
+	DailyQuota Quota
+	Notify     notify.Config
+	// ModifiedPolicy handles files changed since they were enqueued:
+	// ModifiedUpdate (default), ModifiedResend or ModifiedSkip.
+	ModifiedPolicy string
+	// Ordering is OrderingRelaxed (default) or OrderingStrict, which holds
+	// later items back until a failed group has been sent.
+	Ordering string
+	// MetadataCaptions captions documents and videos with their path
+	// relative to CaptionRoots, size and mtime.
+	MetadataCaptions bool
+	CaptionRoots     []string
+	// StatusInterval, when set, logs the queue depth, send rate and time
+	// to drain every interval, prefixed with StatusName.
+	StatusInterval time.Duration
+	StatusName     string
+	// Memory, when set, limits the bytes held while loading and preparing
+	// files; files over a quarter of it are streamed from disk.
+	Memory *MemoryBudget
+	// Quarantine, when set, is where files of failed_permanent items are
+	// moved; see QuarantineFailed. CaptionRoots are their roots.
+	Quarantine string
 }
 
 func Loop(cfg Config, q *queue.Queue, client *telegram.Client) {
-	sentSincePause := 0
-	for {
-		pending := q.Pending(0)
-		if len(pending) == 0 {
-			time.Sleep(cfg.SendInterval)
-			continue
-		}
-
-		for i := 0; i < len(pending); {
-			item := pending[i]
-			sendType := item.SendType
-			if sendType == "" {
-				sendType = "image"
-			}
-
-			sent := 0
-			if sendType == "image" {
-				group := []*queue.Item{}
-				for i < len(pending) && len(group) < cfg.GroupSize {
-					current := pending[i]
-					currentType := current.SendType
-					if currentType == "" {
-						currentType = "image"
-					}
-					if currentType != "image" {
-						break
-					}
-					group = append(group, current)
-					i++
-				}
-				sent = sendImageGroup(cfg, q, client, group)
-			} else {
-				sent = sendSingle(cfg, q, client, item, sendType)
-				i++
-			}
-			sentSincePause += sent
-			time.Sleep(cfg.BatchDelay)
-
-			if cfg.PauseEvery > 0 && sentSincePause >= cfg.PauseEvery && cfg.PauseSeconds > 0 {
-				log.Printf("pausing sender for %s after %d images", cfg.PauseSeconds, sentSincePause)
-				time.Sleep(cfg.PauseSeconds)
-				sentSincePause = 0
-			}
-		}
-
-		time.Sleep(cfg.SendInterval)
-	}
+	LoopWithContext(context.Background(), cfg, q, client, nil, nil)
 }
 
 type ProgressUpdate struct {
@@ -100,15 +95,76 @@ func LoopWithContext(
 	client *telegram.Client,
 	pause *runcontrol.PauseGate,
 	report ProgressReporter,
+) {
+	LoopLive(ctx, runcontrol.NewLive(cfg), q, client, pause, report)
+}
+
+// LoopLive re-reads the config before every batch so delays, group size and
+// image limits can be changed while the loop runs.
+func LoopLive(
+	ctx context.Context,
+	live *runcontrol.Live[Config],
+	q *queue.Queue,
+	client *telegram.Client,
+	pause *runcontrol.PauseGate,
+	report ProgressReporter,
+) {
+	LoopSources(ctx, live, []Source{{Queue: q}}, client, pause, report)
+}
+
+// Source is one queue consumed by LoopSources. A non-empty ChatID sends the
+// queue's items there, to TopicID, instead of the config's chat; Name
+// labels its status lines.
+type Source struct {
+	Queue   *queue.Queue
+	ChatID  string
+	TopicID *int
+	Name    string
+}
+
+func (src Source) config(cfg Config) Config {
+	if src.ChatID != "" {
+		cfg.ChatID = src.ChatID
+		cfg.TopicID = src.TopicID
+	}
+	return cfg
+}
+
+// LoopSources is LoopLive over several queues at once. Each batch comes
+// from the queue whose next item goes first by priority and then enqueue
+// time, so one sender drains queues filled by other processes or hosts in
+// a single order. Albums never mix queues; the daily quota counts the sends
+// of all of them.
+func LoopSources(
+	ctx context.Context,
+	live *runcontrol.Live[Config],
+	sources []Source,
+	client *telegram.Client,
+	pause *runcontrol.PauseGate,
+	report ProgressReporter,
 ) {
 	sentSincePause := 0
 	var avgPerFileMS int64
+	dedup := map[*queue.Queue]*phashIndex{}
+	quotaNotified := time.Time{}
+	queues := make([]*queue.Queue, 0, len(sources))
+	for _, src := range sources {
+		queues = append(queues, src.Queue)
+		go statusLoop(ctx, live, src.Queue, src.Name, src.ChatID, pause)
+		cfg := live.Load()
+		QuarantineFailed(src.Queue, cfg.Quarantine, cfg.CaptionRoots)
+	}
 	for {
 		if pause != nil && !pause.Wait(ctx) {
 			return
 		}
-		pending := q.Pending(0)
-		if len(pending) == 0 {
+		cfg := live.Load()
+		pendingFiles := 0
+		for _, q := range queues {
+			syncQueue(q)
+			pendingFiles += len(q.Pending(0))
+		}
+		if pendingFiles == 0 {
 			if report != nil {
 				report(ProgressUpdate{Status: "idle"})
 			}
@@ -118,48 +174,95 @@ func LoopWithContext(
 			continue
 		}
 
-		for i := 0; i < len(pending); {
+		// One pass tries every pending item at most once. The queues are
+		// re-read before each batch so higher-priority items enqueued in the
+		// meantime go next instead of waiting behind the backlog.
+		attempted := make([]map[string]bool, len(sources))
+		for i := range attempted {
+			attempted[i] = map[string]bool{}
+		}
+		for {
 			if pause != nil && !pause.Wait(ctx) {
 				return
 			}
-			item := pending[i]
-			sendType := item.SendType
-			if sendType == "" {
-				sendType = "image"
+			cfg = live.Load()
+			for _, q := range queues {
+				syncQueue(q)
+			}
+			index, pending := nextSource(sources, attempted)
+			if index < 0 {
+				break
+			}
+			if full, files, size, reset := cfg.DailyQuota.reached(queues, time.Now()); full {
+				if !quotaNotified.Equal(reset) {
+					quotaNotified = reset
+					log.Printf("daily quota reached (%d file(s), %d bytes), pausing until %s", files, size, reset.Format(time.RFC3339))
+					if cfg.Notify.Enabled {
+						notify.QuotaReached(ctx, cfg.Notify.Targets(client, cfg.ChatID, cfg.TopicID), files, size, reset)
+					}
+				}
+				if report != nil {
+					report(ProgressUpdate{Status: "quota"})
+				}
+				// Re-check every send interval so a reload that raises
+				// the limits takes effect before midnight.
+				wait := min(time.Until(reset), max(cfg.SendInterval, time.Second))
+				if !sleepWithContext(ctx, wait) {
+					return
+				}
+				continue
+			}
+			src := sources[index]
+			q := src.Queue
+			sendCfg := src.config(cfg)
+			if !cfg.PHashDedup {
+				clear(dedup)
+			} else if dedup[q] == nil {
+				dedup[q] = loadPHashIndex(q)
 			}
+			item := pending[0]
+			sendType := itemSendType(item)
 
 			start := time.Now()
+			// Each batch is a trace of its own, as the loop never ends.
+			batchCtx, span := tracing.Start(ctx, "send batch")
+			if src.Name != "" {
+				span.Set("queue.name", src.Name)
+			}
 			sent := 0
 			perFileMS := int64(0)
-			if sendType == "image" {
+			batch := []*queue.Item{item}
+			if albumItem(cfg, item) {
 				group := []*queue.Item{}
-				for i < len(pending) && len(group) < cfg.GroupSize {
-					current := pending[i]
-					currentType := current.SendType
-					if currentType == "" {
-						currentType = "image"
-					}
-					if currentType != "image" {
+				for _, current := range pending {
+					if len(group) >= telegram.ClampGroupSize(cfg.GroupSize) || !albumItem(cfg, current) || current.Priority != item.Priority || !sameTopic(current, item) {
 						break
 					}
 					group = append(group, current)
-					i++
-				}
-				sent = sendImageGroup(cfg, q, client, group)
-				if len(group) > 0 {
-					perFileMS = time.Since(start).Milliseconds() / int64(len(group))
-					reportProgress(report, group[len(group)-1], q, perFileMS, &avgPerFileMS, "sending")
+					attempted[index][current.ID] = true
 				}
+				batch = group
+				sent = sendImageGroup(batchCtx, sendCfg, q, client, group, dedup[q])
+				perFileMS = time.Since(start).Milliseconds() / int64(len(group))
+				reportProgress(report, group[len(group)-1], q, perFileMS, &avgPerFileMS, "sending")
 			} else {
-				sent = sendSingle(cfg, q, client, item, sendType)
+				attempted[index][item.ID] = true
+				sent = sendSingle(batchCtx, sendCfg, q, client, item, sendType)
 				perFileMS = time.Since(start).Milliseconds()
 				reportProgress(report, item, q, perFileMS, &avgPerFileMS, "sending")
-				i++
 			}
 			sentSincePause += sent
+			quarantineBatch(cfg, q, batch)
+			traceBatch(span, q, batch, sent)
 			if !sleepWithContext(ctx, cfg.BatchDelay) {
 				return
 			}
+			if held := heldItem(cfg, q, batch); held != nil {
+				// End the pass: the next one starts with the held item
+				// again, before anything queued after it.
+				log.Printf("strict ordering: holding later items until %s is sent", displayName(held))
+				break
+			}
 
 			if cfg.PauseEvery > 0 && sentSincePause >= cfg.PauseEvery && cfg.PauseSeconds > 0 {
 				log.Printf("pausing sender for %s after %d images", cfg.PauseSeconds, sentSincePause)
@@ -176,6 +279,113 @@ func LoopWithContext(
 	}
 }
 
+// traceBatch ends the span of a batch with its size, how many of its items
+// were sent and the most queue attempts any of them took.
+func traceBatch(span *tracing.Span, q *queue.Queue, batch []*queue.Item, sent int) {
+	size := int64(0)
+	attempts := 0
+	for _, item := range batch {
+		size += item.Size
+		if current, ok := q.Item(item.ID); ok {
+			attempts = max(attempts, current.Attempts)
+		}
+	}
+	span.Set("batch.items", len(batch))
+	span.Set("batch.bytes", size)
+	span.Set("batch.sent", sent)
+	span.Set("queue.attempts", attempts)
+	span.End()
+}
+
+// heldItem returns the first item of a batch that strict ordering must
+// retry before the rest of the queue, or nil.
+func heldItem(cfg Config, q *queue.Queue, batch []*queue.Item) *queue.Item {
+	if cfg.Ordering != OrderingStrict {
+		return nil
+	}
+	for _, item := range batch {
+		if q.IsPending(item.ID) {
+			return item
+		}
+	}
+	return nil
+}
+
+// syncQueue picks up items added to the queue file by other processes.
+func syncQueue(q *queue.Queue) {
+	if added, err := q.Sync(); err != nil {
+		log.Printf("queue sync failed: %v", err)
+	} else if added > 0 {
+		log.Printf("picked up %d item(s) added to the queue file", added)
+	}
+}
+
+// nextPending returns pending items in send order, skipping those already
+// tried in the current pass.
+func nextPending(q *queue.Queue, attempted map[string]bool) []*queue.Item {
+	pending := []*queue.Item{}
+	for _, item := range q.Pending(0) {
+		if !attempted[item.ID] {
+			pending = append(pending, item)
+		}
+	}
+	return pending
+}
+
+// nextSource returns the index of the source whose next pending item goes
+// first, by priority and then the queues' send order, with that source's
+// pending items in send order; -1 once every source is done for the pass.
+func nextSource(sources []Source, attempted []map[string]bool) (int, []*queue.Item) {
+	best := -1
+	var bestPending []*queue.Item
+	for i, src := range sources {
+		pending := nextPending(src.Queue, attempted[i])
+		if len(pending) == 0 {
+			continue
+		}
+		if best < 0 || queue.Less(pending[0], bestPending[0], src.Queue.Order()) {
+			best = i
+			bestPending = pending
+		}
+	}
+	return best, bestPending
+}
+
+// albumItem reports whether an item can go in a media group: images, and
+// small videos when AlbumVideos is set.
+func albumItem(cfg Config, item *queue.Item) bool {
+	switch itemSendType(item) {
+	case "image":
+		return true
+	case "video":
+		return cfg.AlbumVideos && item.Size <= constants.AlbumVideoMaxBytes
+	}
+	return false
+}
+
+// itemTopic returns the topic stamped on an item by the watcher's topic
+// map, falling back to the configured topic.
+func itemTopic(cfg Config, item *queue.Item) *int {
+	if item.TopicID != nil {
+		return item.TopicID
+	}
+	return cfg.TopicID
+}
+
+func sameTopic(a *queue.Item, b *queue.Item) bool {
+	if a.TopicID == nil || b.TopicID == nil {
+		return a.TopicID == b.TopicID
+	}
+	return *a.TopicID == *b.TopicID
+}
+
+func itemSendType(item *queue.Item) string {
+	if item.SendType == "" {
+		return "image"
+	}
+	return item.SendType
+}
+
 func reportProgress(report ProgressReporter, item *queue.Item, q *queue.Queue, perFileMS int64, avg *int64, status string) {
 	if report == nil || item == nil {
 		return
@@ -223,13 +433,55 @@ func markFailed(q *queue.Queue, item *queue.Item, err error) {
 	if item == nil {
 		return
 	}
+	var floodWait *telegram.ErrFloodWait
+	var unauthorized *telegram.ErrUnauthorized
+	if errors.As(err, &floodWait) || errors.As(err, &unauthorized) {
+		// A rate limit or a rejected token says nothing about the item: the
+		// flood pause or another token handles the next attempt.
+		log.Printf("requeued %s without counting an attempt: %v", item.Path, err)
+		requeue(q, item)
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) && !CheckSource(q, item) {
+		return
+	}
 	msg := err.Error()
 	attempts := item.Attempts + 1
-	if updateErr := q.UpdateStatusWithAttempts(item.ID, queue.StatusFailed, &msg, &attempts); updateErr != nil {
+	status := queue.StatusFailed
+	if Permanent(err) {
+		status = queue.StatusFailedPermanent
+		log.Printf("permanent failure, not retrying %s: %v", item.Path, err)
+	}
+	if updateErr := q.UpdateStatusWithAttempts(item.ID, status, &msg, &attempts); updateErr != nil {
 		log.Printf("queue update failed: %v", updateErr)
 	}
 }
 
+// markSent records the message and file_id of a file sent as one message.
+func markSent(q *queue.Queue, item *queue.Item, result telegram.Result) {
+	if len(result.MessageIDs) != 1 {
+		if err := q.UpdateStatus(item.ID, queue.StatusSent, nil); err != nil {
+			log.Printf("queue update failed: %v", err)
+		}
+		return
+	}
+	fileID := ""
+	if len(result.FileIDs) == 1 {
+		fileID = result.FileIDs[0]
+	}
+	if err := q.MarkSent(item.ID, result.MessageIDs[0], fileID); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+}
+
+// requeue puts an item interrupted by cancellation back in the queue
+// without counting an attempt.
+func requeue(q *queue.Queue, item *queue.Item) {
+	if err := q.UpdateStatus(item.ID, queue.StatusQueued, nil); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+}
+
 func sleepWithContext(ctx context.Context, d time.Duration) bool {
 	if d <= 0 {
 		return true
@@ -244,25 +496,80 @@ func sleepWithContext(ctx context.Context, d time.Duration) bool {
 	}
 }
 
-func sendImageGroup(cfg Config, q *queue.Queue, client *telegram.Client, items []*queue.Item) int {
+func sendImageGroup(ctx context.Context, cfg Config, q *queue.Queue, client *telegram.Client, items []*queue.Item, dedup *phashIndex) int {
+	client = client.PinFolder(items[0].Folder())
 	mediaFiles := []telegram.MediaFile{}
 	itemRefs := []*queue.Item{}
+	// held is what the prepared album items keep reserved of the memory
+	// budget until the album is sent.
+	held := int64(0)
+	defer func() { cfg.Memory.release(held) }()
 
 	for _, item := range items {
+		// Under a memory budget the album closes early rather than wait
+		// for memory while holding some: the rest stay queued.
+		reserved, ok := cfg.Memory.acquire(ctx, item.Size, len(mediaFiles) == 0)
+		if !ok {
+			break
+		}
 		if err := q.UpdateStatus(item.ID, queue.StatusSending, nil); err != nil {
+			cfg.Memory.release(reserved)
+			continue
+		}
+		if !CheckSource(q, item) || !checkModified(cfg, q, item) {
+			cfg.Memory.release(reserved)
 			continue
 		}
 		data, filename, err := loadItem(item, cfg.ZipPasswords)
 		if err != nil {
+			cfg.Memory.release(reserved)
 			markFailed(q, item, err)
 			continue
 		}
+		if itemSendType(item) == "video" {
+			held += reserved
+			mediaFiles = append(mediaFiles, telegram.MediaFile{Filename: filename, Data: data, Type: telegram.MediaVideo, Caption: metadataCaption(cfg, item), Source: item.Path})
+			itemRefs = append(itemRefs, item)
+			continue
+		}
+		if checkDuplicate(cfg, q, dedup, item, data) {
+			cfg.Memory.release(reserved)
+			continue
+		}
+		decoded, ok := cfg.Memory.acquire(ctx, decodedSize(data), len(mediaFiles) == 0)
+		if !ok {
+			cfg.Memory.release(reserved)
+			if dedup != nil {
+				dedup.remove(item.ID)
+			}
+			requeue(q, item)
+			break
+		}
 		result, err := imageutil.Prepare(data, filename, cfg.MaxDimension, cfg.MaxBytes, cfg.PNGStartLevel)
+		reserved += decoded
 		if err != nil {
+			cfg.Memory.release(reserved)
+			if dedup != nil {
+				dedup.remove(item.ID)
+			}
 			markFailed(q, item, err)
 			continue
 		}
-		mediaFiles = append(mediaFiles, telegram.MediaFile{Filename: result.Filename, Data: result.Data})
+		prepared := telegram.MediaFile{Filename: result.Filename, Data: result.Data, Source: item.Path}
+		if result.Document {
+			log.Printf("%s: %s, sending the original as a document", filename, result.Reason)
+			prepared.Type = telegram.MediaDocument
+		}
+		prepared = client.WithOriginal(prepared, data, filename)
+		// An original kept for --also-as-document stays in memory too.
+		size := len(result.Data)
+		if prepared.Original != nil {
+			size += len(data)
+		}
+		keep := min(int64(size), reserved)
+		cfg.Memory.release(reserved - keep)
+		held += keep
+		mediaFiles = append(mediaFiles, prepared)
 		itemRefs = append(itemRefs, item)
 	}
 
@@ -270,49 +577,153 @@ func sendImageGroup(cfg Config, q *queue.Queue, client *telegram.Client, items [
 		return 0
 	}
 
-	if err := client.SendMediaGroup(cfg.ChatID, mediaFiles, cfg.TopicID, cfg.Retry); err != nil {
-		for _, item := range itemRefs {
-			markFailed(q, item, err)
+	// Split by byte budget so one oversized album does not fail every item;
+	// a failed album is retried item by item to isolate a bad file.
+	sent := 0
+	offset := 0
+	for i, chunk := range telegram.SplitMediaGroup(mediaFiles, cfg.GroupMaxBytes) {
+		refs := itemRefs[offset : offset+len(chunk)]
+		if i > 0 && !sleepWithContext(ctx, cfg.BatchDelay) {
+			for _, item := range itemRefs[offset:] {
+				if dedup != nil {
+					dedup.remove(item.ID)
+				}
+				requeue(q, item)
+			}
+			break
+		}
+		offset += len(chunk)
+		_, errs := client.SendMediaGroupEachFunc(ctx, cfg.ChatID, chunk, itemTopic(cfg, refs[0]), cfg.Retry, func(first int, results []telegram.Result) {
+			for j, result := range results {
+				markSent(q, refs[first+j], result)
+			}
+			if err := q.Flush(); err != nil {
+				log.Printf("queue flush failed: %v", err)
+			}
+		})
+		for j, item := range refs {
+			if errs[j] == nil {
+				sent++
+				continue
+			}
+			if dedup != nil {
+				dedup.remove(item.ID)
+			}
+			if ctx.Err() != nil {
+				requeue(q, item)
+			} else {
+				markFailed(q, item, errs[j])
+			}
 		}
-		return 0
-	}
-
-	for _, item := range itemRefs {
-		q.UpdateStatus(item.ID, queue.StatusSent, nil)
 	}
-	return len(itemRefs)
+	return sent
 }
 
-func sendSingle(cfg Config, q *queue.Queue, client *telegram.Client, item *queue.Item, sendType string) int {
+func sendSingle(ctx context.Context, cfg Config, q *queue.Queue, client *telegram.Client, item *queue.Item, sendType string) int {
+	client = client.PinFolder(item.Folder())
 	if err := q.UpdateStatus(item.ID, queue.StatusSending, nil); err != nil {
 		return 0
 	}
-	data, filename, err := loadItem(item, cfg.ZipPasswords)
-	if err != nil {
-		markFailed(q, item, err)
+	if !CheckSource(q, item) || !checkModified(cfg, q, item) {
 		return 0
 	}
+	if item.SourceType == "file" && cfg.AutoSplit.Needed(item.Size) {
+		return sendSplit(ctx, cfg, q, client, item)
+	}
+	var file telegram.MediaFile
+	streamed := false
+	if cfg.Memory.streams(item.Size) {
+		var cleanup func()
+		var err error
+		file, cleanup, streamed, err = streamItem(item)
+		if err != nil {
+			markFailed(q, item, err)
+			return 0
+		}
+		if streamed {
+			defer cleanup()
+		}
+	}
+	if !streamed {
+		reserved, ok := cfg.Memory.acquire(ctx, item.Size, true)
+		if !ok {
+			requeue(q, item)
+			return 0
+		}
+		defer cfg.Memory.release(reserved)
+		data, filename, err := loadItem(item, cfg.ZipPasswords)
+		if err != nil {
+			markFailed(q, item, err)
+			return 0
+		}
+		file = telegram.MediaFile{Filename: filename, Data: data}
+	}
+	file.Caption = metadataCaption(cfg, item)
+	file.Source = item.Path
 
+	var result telegram.Result
 	var sendErr error
-	file := telegram.MediaFile{Filename: filename, Data: data}
-	switch sendType {
-	case "file":
-		sendErr = client.SendDocument(cfg.ChatID, file, cfg.TopicID, cfg.Retry)
-	case "video":
-		sendErr = client.SendVideo(cfg.ChatID, file, cfg.TopicID, cfg.Retry)
-	case "audio":
-		sendErr = client.SendAudio(cfg.ChatID, file, cfg.TopicID, cfg.Retry)
+	switch {
+	case cfg.AutoSplit.Needed(file.Len()):
+		sendErr = sendSplitFile(ctx, cfg, client, item, file)
+	case sendType == "file":
+		result, sendErr = client.SendDocument(ctx, cfg.ChatID, file, itemTopic(cfg, item), cfg.Retry)
+	case sendType == "video":
+		result, sendErr = client.SendVideo(ctx, cfg.ChatID, file, itemTopic(cfg, item), cfg.Retry)
+	case sendType == "audio":
+		result, sendErr = client.SendAudio(ctx, cfg.ChatID, file, itemTopic(cfg, item), cfg.Retry)
 	default:
 		sendErr = fmt.Errorf("unsupported send type: %s", sendType)
 	}
 	if sendErr != nil {
+		if ctx.Err() != nil {
+			requeue(q, item)
+			return 0
+		}
 		markFailed(q, item, sendErr)
 		return 0
 	}
-	q.UpdateStatus(item.ID, queue.StatusSent, nil)
+	markSent(q, item, result)
 	return 1
 }
 
+// sendSplit streams an oversized file into archive volumes and sends them
+// without loading the whole file into memory.
+func sendSplit(ctx context.Context, cfg Config, q *queue.Queue, client *telegram.Client, item *queue.Item) int {
+	file, err := os.Open(item.Path)
+	if err != nil {
+		markFailed(q, item, err)
+		return 0
+	}
+	defer file.Close()
+	if err := splitter.Send(ctx, client, cfg.ChatID, itemTopic(cfg, item), cfg.Retry, cfg.AutoSplit, filepath.Base(item.Path), item.Size, file); err != nil {
+		if ctx.Err() != nil {
+			requeue(q, item)
+			return 0
+		}
+		markFailed(q, item, err)
+		return 0
+	}
+	if err := q.UpdateStatus(item.ID, queue.StatusSent, nil); err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+	return 1
+}
+
+// sendSplitFile sends a loaded or streamed file as archive volumes.
+func sendSplitFile(ctx context.Context, cfg Config, client *telegram.Client, item *queue.Item, file telegram.MediaFile) error {
+	var reader io.Reader = bytes.NewReader(file.Data)
+	if file.Data == nil && file.Path != "" {
+		source, err := os.Open(file.Path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		reader = source
+	}
+	return splitter.Send(ctx, client, cfg.ChatID, itemTopic(cfg, item), cfg.Retry, cfg.AutoSplit, file.Filename, file.Len(), reader)
+}
+
 func loadItem(item *queue.Item, zipPasswords []string) ([]byte, string, error) {
 	switch item.SourceType {
 	case "file":
@@ -0,0 +1,102 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// rateWindow is how far back the send rate in status lines looks.
+const rateWindow = 15 * time.Minute
+
+// statusLoop logs a status line every StatusInterval: the queue depth, the
+// recent send rate and when the backlog would drain at that rate. It reads
+// the config each time, so a reload can turn it on or off. A non-empty name
+// follows StatusName in the prefix. The line ends with the messages sent to
+// the chat (chatID, or the config's) over the last minute and day.
+func statusLoop(ctx context.Context, live *runcontrol.Live[Config], q *queue.Queue, name string, chatID string, pause *runcontrol.PauseGate) {
+	start := time.Now()
+	for {
+		interval := live.Load().StatusInterval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		if !sleepWithContext(ctx, interval) {
+			return
+		}
+		cfg := live.Load()
+		if cfg.StatusInterval <= 0 {
+			continue
+		}
+		line := statusLine(q, start, time.Now(), pause != nil && pause.IsPaused())
+		chat := chatID
+		if chat == "" {
+			chat = cfg.ChatID
+		}
+		if chat != "" {
+			line += "; " + usageLine(chat)
+		}
+		if prefix := strings.TrimSpace(cfg.StatusName + " " + name); prefix != "" {
+			line = prefix + ": " + line
+		}
+		log.Print(line)
+	}
+}
+
+func statusLine(q *queue.Queue, start time.Time, now time.Time, paused bool) string {
+	stats := q.Stats()
+	pendingFiles := 0
+	pendingBytes := int64(0)
+	for _, item := range q.Pending(0) {
+		pendingFiles++
+		pendingBytes += item.Size
+	}
+	since := now.Add(-rateWindow)
+	if since.Before(start) {
+		since = start
+	}
+	window := now.Sub(since)
+	sentFiles, sentBytes := q.SentSince(since)
+
+	parts := []string{fmt.Sprintf(
+		"status: pending %d (%s), sending %d, sent %d, failed %d",
+		pendingFiles, formatSize(pendingBytes), stats[queue.StatusSending], stats[queue.StatusSent], stats[queue.StatusFailed],
+	)}
+	if permanent := stats[queue.StatusFailedPermanent]; permanent > 0 {
+		parts[0] += fmt.Sprintf(", failed permanently %d", permanent)
+	}
+	if missing := stats[queue.StatusSourceMissing]; missing > 0 {
+		parts[0] += fmt.Sprintf(", source missing %d", missing)
+	}
+	minutes := window.Minutes()
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("rate %.1f files/min, %s/min over %s",
+			float64(sentFiles)/minutes, formatSize(int64(float64(sentBytes)/minutes)), window.Round(time.Second)))
+	}
+	switch {
+	case paused:
+		parts = append(parts, "paused")
+	case pendingFiles == 0:
+		parts = append(parts, "idle")
+	case sentFiles == 0:
+		parts = append(parts, "ETA unknown")
+	default:
+		eta := time.Duration(float64(window) * float64(pendingFiles) / float64(sentFiles))
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// usageLine reports the requests sent to chatID in this process against
+// Telegram's per-bot limit for the chat.
+func usageLine(chatID string) string {
+	minute, day := telegram.ChatUsage(chatID)
+	return fmt.Sprintf("chat %s: %d message(s) in the last minute (limit %d/min per bot), %d in 24h",
+		chatID, minute, telegram.ChatLimit(chatID), day)
+}
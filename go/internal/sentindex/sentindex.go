@@ -0,0 +1,206 @@
+// Package sentindex records the content hash of every file sent to a chat
+// in one file shared by all queues and runs, so a fresh queue over an
+// overlapping folder does not send the same files again.
+package sentindex
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileName is the index file in the state directory.
+const FileName = "sent-index.jsonl"
+
+// Entry is one file sent to a chat.
+type Entry struct {
+	ChatID    string `json:"chat_id"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Path      string `json:"path"`
+	InnerPath string `json:"inner_path,omitempty"`
+	MessageID int    `json:"message_id,omitempty"`
+	SentAt    string `json:"sent_at"`
+}
+
+// Index is an append-only JSONL file of entries. Several processes may
+// append to the same file; each lookup first reads what others added.
+type Index struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Entry
+	offset  int64
+}
+
+var (
+	openMu  sync.Mutex
+	indexes = map[string]*Index{}
+)
+
+// Open returns the index at path, creating the file when needed. Opening
+// the same path again returns the same index.
+func Open(path string) (*Index, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	openMu.Lock()
+	defer openMu.Unlock()
+	if index, ok := indexes[abs]; ok {
+		return index, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(abs, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	index := &Index{path: abs, entries: map[string]Entry{}}
+	index.mu.Lock()
+	err = index.refresh()
+	index.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	indexes[abs] = index
+	return index, nil
+}
+
+func (ix *Index) Path() string {
+	return ix.path
+}
+
+// Lookup returns the entry of content hash sha sent to chatID.
+func (ix *Index) Lookup(chatID string, sha string) (Entry, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	_ = ix.refresh()
+	entry, ok := ix.entries[key(chatID, sha)]
+	return entry, ok
+}
+
+// Record appends entry unless its content is already recorded for the chat.
+func (ix *Index) Record(entry Entry) error {
+	if entry.ChatID == "" || entry.SHA256 == "" {
+		return errors.New("sent index entry needs a chat and a hash")
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	_ = ix.refresh()
+	if _, ok := ix.entries[key(entry.ChatID, entry.SHA256)]; ok {
+		return nil
+	}
+	if entry.SentAt == "" {
+		entry.SentAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(ix.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	ix.entries[key(entry.ChatID, entry.SHA256)] = entry
+	return nil
+}
+
+// refresh reads the complete lines appended since the last read.
+func (ix *Index) refresh() error {
+	file, err := os.Open(ix.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < ix.offset {
+		// The file was replaced; read it again from the start.
+		ix.entries = map[string]Entry{}
+		ix.offset = 0
+	}
+	if info.Size() == ix.offset {
+		return nil
+	}
+	if _, err := file.Seek(ix.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without its newline is still being written.
+			return nil
+		}
+		ix.offset += int64(len(line))
+		var entry Entry
+		if json.Unmarshal(bytes.TrimSpace(line), &entry) != nil || entry.ChatID == "" || entry.SHA256 == "" {
+			continue
+		}
+		ix.entries[key(entry.ChatID, entry.SHA256)] = entry
+	}
+}
+
+func key(chatID string, sha string) string {
+	return chatID + "\x00" + sha
+}
+
+// HashFile returns the SHA-256 of the file at path.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// HashZipEntry returns the SHA-256 of the entry name in the zip at path.
+// Encrypted entries cannot be read without their password and fail.
+func HashZipEntry(path string, name string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if filepath.ToSlash(file.Name) != filepath.ToSlash(name) {
+			continue
+		}
+		if file.Flags&0x1 != 0 {
+			return "", errors.New("encrypted zip entry")
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, reader); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	return "", os.ErrNotExist
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func label(cfg Config) string {
+	if strings.Contains(cfg.Name, ".") {
+		return cfg.Name
+	}
+	return "com.github.nerdneilsfield." + cfg.Name
+}
+
+func plistPath(cfg Config) (string, error) {
+	if !cfg.User {
+		return filepath.Join("/Library/LaunchDaemons", label(cfg)+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label(cfg)+".plist"), nil
+}
+
+func logPath(cfg Config) string {
+	if !cfg.User {
+		return filepath.Join("/Library/Logs", cfg.Name+".log")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), cfg.Name+".log")
+	}
+	return filepath.Join(home, "Library", "Logs", cfg.Name+".log")
+}
+
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(xml.Header)
+	buffer.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buffer.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	writeKey(buffer, "Label", label(cfg))
+	buffer.WriteString("  <key>ProgramArguments</key>\n  <array>\n")
+	for _, arg := range append([]string{cfg.Executable}, cfg.Args...) {
+		buffer.WriteString("    <string>" + xmlEscape(arg) + "</string>\n")
+	}
+	buffer.WriteString("  </array>\n")
+	writeKey(buffer, "WorkingDirectory", cfg.WorkingDir)
+	buffer.WriteString("  <key>RunAtLoad</key>\n  <true/>\n")
+	buffer.WriteString("  <key>KeepAlive</key>\n  <dict>\n    <key>SuccessfulExit</key>\n    <false/>\n  </dict>\n")
+	writeKey(buffer, "StandardOutPath", logPath(cfg))
+	writeKey(buffer, "StandardErrorPath", logPath(cfg))
+	buffer.WriteString("</dict>\n</plist>\n")
+	return buffer.String(), nil
+}
+
+func Install(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	plist, err := Render(cfg)
+	if err != nil {
+		return "", err
+	}
+	path, err := plistPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(plist), 0o644); err != nil {
+		return "", err
+	}
+	return path, launchctl("load", "-w", path)
+}
+
+func Uninstall(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	path, err := plistPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return path, fmt.Errorf("service %s is not installed: %w", cfg.Name, err)
+	}
+	_ = launchctl("unload", "-w", path)
+	return path, os.Remove(path)
+}
+
+func QueryStatus(cfg Config) (Status, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return Status{}, err
+	}
+	path, err := plistPath(cfg)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{Path: path}
+	if _, err := os.Stat(path); err != nil {
+		return status, nil
+	}
+	status.Installed = true
+	output, err := exec.Command("launchctl", "list", label(cfg)).Output()
+	if err != nil {
+		status.Detail = "not loaded"
+		return status, nil
+	}
+	status.Detail = "loaded"
+	status.Running = strings.Contains(string(output), `"PID" =`)
+	if status.Running {
+		status.Detail = "running"
+	}
+	return status, nil
+}
+
+func Run(name string, run func() error) error {
+	return run()
+}
+
+func launchctl(args ...string) error {
+	output, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func writeKey(buffer *bytes.Buffer, key string, value string) {
+	buffer.WriteString("  <key>" + key + "</key>\n  <string>" + xmlEscape(value) + "</string>\n")
+}
+
+func xmlEscape(value string) string {
+	buffer := &bytes.Buffer{}
+	_ = xml.EscapeText(buffer, []byte(value))
+	return buffer.String()
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const DefaultName = "telegram-upload-watcher"
+
+type Config struct {
+	Name        string
+	Description string
+	Executable  string
+	Args        []string
+	WorkingDir  string
+	User        bool
+}
+
+type Status struct {
+	Installed bool
+	Running   bool
+	Path      string
+	Detail    string
+}
+
+// pathFlags lists watch flags whose values are file system paths. They are
+// made absolute at install time because services start in a different
+// working directory.
+var pathFlags = map[string]bool{
+	"--config":        true,
+	"--watch-dir":     true,
+	"--queue-file":    true,
+	"--zip-pass-file": true,
+	"--watermark":     true,
+}
+
+func AbsoluteArgs(args []string) ([]string, error) {
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if name, value, ok := strings.Cut(arg, "="); ok && pathFlags[name] {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, name+"="+abs)
+			continue
+		}
+		result = append(result, arg)
+		if pathFlags[arg] && i+1 < len(args) {
+			abs, err := filepath.Abs(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, abs)
+			i++
+		}
+	}
+	return result, nil
+}
+
+func (c Config) normalize() (Config, error) {
+	if c.Name == "" {
+		c.Name = DefaultName
+	}
+	if strings.ContainsAny(c.Name, `/\ `) {
+		return c, fmt.Errorf("invalid service name %q", c.Name)
+	}
+	if c.Description == "" {
+		c.Description = "Telegram upload watcher (" + c.Name + ")"
+	}
+	if c.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return c, err
+		}
+		c.Executable = exe
+	}
+	if resolved, err := filepath.EvalSymlinks(c.Executable); err == nil {
+		c.Executable = resolved
+	}
+	if c.WorkingDir == "" {
+		c.WorkingDir = filepath.Dir(c.Executable)
+	}
+	return c, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func unitPath(cfg Config) (string, error) {
+	if !cfg.User {
+		return filepath.Join("/etc/systemd/system", cfg.Name+".service"), nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", cfg.Name+".service"), nil
+}
+
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	execStart := []string{systemdQuote(cfg.Executable)}
+	for _, arg := range cfg.Args {
+		execStart = append(execStart, systemdQuote(arg))
+	}
+	wantedBy := "multi-user.target"
+	if cfg.User {
+		wantedBy = "default.target"
+	}
+	buffer := &bytes.Buffer{}
+	fmt.Fprintln(buffer, "[Unit]")
+	fmt.Fprintf(buffer, "Description=%s\n", cfg.Description)
+	fmt.Fprintln(buffer, "After=network-online.target")
+	fmt.Fprintln(buffer, "Wants=network-online.target")
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "[Service]")
+	fmt.Fprintln(buffer, "Type=simple")
+	fmt.Fprintf(buffer, "ExecStart=%s\n", strings.Join(execStart, " "))
+	// WorkingDirectory takes the path as is, spaces included, and rejects
+	// quotes; only specifiers need escaping.
+	fmt.Fprintf(buffer, "WorkingDirectory=%s\n", strings.ReplaceAll(cfg.WorkingDir, "%", "%%"))
+	fmt.Fprintln(buffer, "Restart=on-failure")
+	fmt.Fprintln(buffer, "RestartSec=10")
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "[Install]")
+	fmt.Fprintf(buffer, "WantedBy=%s\n", wantedBy)
+	return buffer.String(), nil
+}
+
+func Install(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	unit, err := Render(cfg)
+	if err != nil {
+		return "", err
+	}
+	path, err := unitPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return "", err
+	}
+	if err := systemctl(cfg, "daemon-reload"); err != nil {
+		return path, err
+	}
+	return path, systemctl(cfg, "enable", "--now", cfg.Name+".service")
+}
+
+func Uninstall(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	path, err := unitPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return path, fmt.Errorf("service %s is not installed: %w", cfg.Name, err)
+	}
+	_ = systemctl(cfg, "disable", "--now", cfg.Name+".service")
+	if err := os.Remove(path); err != nil {
+		return path, err
+	}
+	return path, systemctl(cfg, "daemon-reload")
+}
+
+func QueryStatus(cfg Config) (Status, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return Status{}, err
+	}
+	path, err := unitPath(cfg)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{Path: path}
+	if _, err := os.Stat(path); err != nil {
+		return status, nil
+	}
+	status.Installed = true
+	args := []string{"is-active", cfg.Name + ".service"}
+	if cfg.User {
+		args = append([]string{"--user"}, args...)
+	}
+	output, _ := exec.Command("systemctl", args...).Output()
+	status.Detail = strings.TrimSpace(string(output))
+	status.Running = status.Detail == "active"
+	return status, nil
+}
+
+func Run(name string, run func() error) error {
+	return run()
+}
+
+func systemctl(cfg Config, args ...string) error {
+	if cfg.User {
+		args = append([]string{"--user"}, args...)
+	}
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// systemdQuote quotes a single ExecStart word, escaping the specifier and
+// variable expansion characters systemd would otherwise interpret.
+func systemdQuote(value string) string {
+	value = strings.ReplaceAll(value, "%", "%%")
+	value = strings.ReplaceAll(value, "$", "$$")
+	if value != "" && !strings.ContainsAny(value, " \t\"'\\;") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,28 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func Render(cfg Config) (string, error) {
+	return "", fmt.Errorf("service management is not supported on %s", runtime.GOOS)
+}
+
+func Install(cfg Config) (string, error) {
+	return "", fmt.Errorf("service management is not supported on %s", runtime.GOOS)
+}
+
+func Uninstall(cfg Config) (string, error) {
+	return "", fmt.Errorf("service management is not supported on %s", runtime.GOOS)
+}
+
+func QueryStatus(cfg Config) (Status, error) {
+	return Status{}, fmt.Errorf("service management is not supported on %s", runtime.GOOS)
+}
+
+func Run(name string, run func() error) error {
+	return run()
+}
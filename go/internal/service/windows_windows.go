@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Render returns the command line the service control manager will run.
+// Windows services must answer the SCM, so the wrapped command is started via
+// the hidden "service run" subcommand.
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	parts := []string{syscall.EscapeArg(cfg.Executable)}
+	for _, arg := range cfg.Args {
+		parts = append(parts, syscall.EscapeArg(arg))
+	}
+	return strings.Join(parts, " ") + "\n", nil
+}
+
+func Install(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	if cfg.User {
+		return "", errors.New("per-user services are not supported on Windows")
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer manager.Disconnect()
+	if existing, err := manager.OpenService(cfg.Name); err == nil {
+		existing.Close()
+		return "", fmt.Errorf("service %s already exists", cfg.Name)
+	}
+	service, err := manager.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName: cfg.Name,
+		Description: cfg.Description,
+		StartType:   mgr.StartAutomatic,
+	}, cfg.Args...)
+	if err != nil {
+		return "", err
+	}
+	defer service.Close()
+	return cfg.Name, service.Start()
+}
+
+func Uninstall(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer manager.Disconnect()
+	service, err := manager.OpenService(cfg.Name)
+	if err != nil {
+		return cfg.Name, fmt.Errorf("service %s is not installed: %w", cfg.Name, err)
+	}
+	defer service.Close()
+	if status, err := service.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(10 * time.Second)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			if status, err = service.Query(); err != nil {
+				break
+			}
+		}
+	}
+	return cfg.Name, service.Delete()
+}
+
+func QueryStatus(cfg Config) (Status, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return Status{}, err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return Status{}, err
+	}
+	defer manager.Disconnect()
+	status := Status{Path: cfg.Name}
+	service, err := manager.OpenService(cfg.Name)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+			return status, nil
+		}
+		return status, err
+	}
+	defer service.Close()
+	status.Installed = true
+	state, err := service.Query()
+	if err != nil {
+		return status, err
+	}
+	status.Running = state.State == svc.Running
+	status.Detail = stateName(state.State)
+	return status, nil
+}
+
+// Run executes run under the service control manager when started as a
+// Windows service, and directly otherwise.
+func Run(name string, run func() error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return run()
+	}
+	return svc.Run(name, &handler{run: run})
+}
+
+type handler struct {
+	run func() error
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run()
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
+
+func stateName(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "start pending"
+	case svc.StopPending:
+		return "stop pending"
+	case svc.Running:
+		return "running"
+	case svc.ContinuePending:
+		return "continue pending"
+	case svc.PausePending:
+		return "pause pending"
+	case svc.Paused:
+		return "paused"
+	default:
+		return fmt.Sprintf("state %d", state)
+	}
+}
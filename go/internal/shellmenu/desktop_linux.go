@@ -0,0 +1,111 @@
+package shellmenu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// files returns the Nautilus script that runs the send and the Nemo action
+// and Dolphin service menu calling it.
+func files(cfg Config) ([]menuFile, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	script := filepath.Join(dataDir, "nautilus", "scripts", cfg.Label)
+	exec := desktopQuote(script) + " %F"
+	nemo := "[Nemo Action]\n" +
+		"Name=" + cfg.Label + "\n" +
+		"Comment=Send the selection with telegram-send-go\n" +
+		"Exec=" + exec + "\n" +
+		"Icon-Name=document-send\n" +
+		"Selection=notnone\n" +
+		"Extensions=any;\n"
+	dolphin := "[Desktop Entry]\n" +
+		"Type=Service\n" +
+		"MimeType=all/all;\n" +
+		"X-KDE-ServiceTypes=KonqPopupMenu/Plugin\n" +
+		"Actions=send\n" +
+		"\n" +
+		"[Desktop Action send]\n" +
+		"Name=" + cfg.Label + "\n" +
+		"Icon=document-send\n" +
+		"Exec=" + exec + "\n"
+	return []menuFile{
+		{path: script, content: shellScript(cfg), mode: 0o755},
+		{path: filepath.Join(dataDir, "nemo", "actions", slug(cfg.Label)+".nemo_action"), content: nemo, mode: 0o644},
+		{path: filepath.Join(dataDir, "kio", "servicemenus", slug(cfg.Label)+".desktop"), content: dolphin, mode: 0o755},
+	}, nil
+}
+
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	entries, err := files(cfg)
+	if err != nil {
+		return "", err
+	}
+	return renderFiles(entries), nil
+}
+
+func Install(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := files(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return writeFiles(entries)
+}
+
+func Uninstall(cfg Config) ([]string, error) {
+	paths, err := Installed(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("the menu entry is not installed")
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// Installed returns the files of the menu entry that exist.
+func Installed(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := files(cfg)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.path)
+	}
+	return existing(paths), nil
+}
+
+// desktopQuote quotes an Exec argument of a desktop entry.
+func desktopQuote(value string) string {
+	if !strings.ContainsAny(value, " \t\"'\\`$<>~|&;*?#()%") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", "$", `\\$`, "%", "%%")
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,113 @@
+package shellmenu
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// classes are the registry classes the verb is added to: every file type and
+// folders. Explorer starts one command per selected item.
+var classes = []string{`*`, `Directory`}
+
+func verbKey(class string, cfg Config) string {
+	return `Software\Classes\` + class + `\shell\` + slug(cfg.Label)
+}
+
+// command runs the executable through cmd.exe so the console window stays
+// open when the send fails.
+func command(cfg Config) string {
+	parts := []string{syscall.EscapeArg(cfg.Executable)}
+	for _, arg := range cfg.Args {
+		parts = append(parts, syscall.EscapeArg(arg))
+	}
+	parts = append(parts, `"%1"`)
+	return `cmd.exe /s /c "` + strings.Join(parts, " ") + ` || pause"`
+}
+
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, class := range classes {
+		fmt.Fprintf(&b, "[HKEY_CURRENT_USER\\%s]\n@=%s\nIcon=%s\n", verbKey(class, cfg), cfg.Label, cfg.Executable)
+		fmt.Fprintf(&b, "[HKEY_CURRENT_USER\\%s\\command]\n@=%s\n\n", verbKey(class, cfg), command(cfg))
+	}
+	return b.String(), nil
+}
+
+func Install(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, class := range classes {
+		path := verbKey(class, cfg)
+		if err := setValues(path, map[string]string{"": cfg.Label, "Icon": cfg.Executable}); err != nil {
+			return paths, err
+		}
+		if err := setValues(path+`\command`, map[string]string{"": command(cfg)}); err != nil {
+			return paths, err
+		}
+		paths = append(paths, `HKCU\`+path)
+	}
+	return paths, nil
+}
+
+func Uninstall(cfg Config) ([]string, error) {
+	paths, err := Installed(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("the menu entry is not installed")
+	}
+	for _, path := range paths {
+		path = strings.TrimPrefix(path, `HKCU\`)
+		if err := registry.DeleteKey(registry.CURRENT_USER, path+`\command`); err != nil && !errors.Is(err, registry.ErrNotExist) {
+			return paths, err
+		}
+		if err := registry.DeleteKey(registry.CURRENT_USER, path); err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// Installed returns the registry keys of the verb that exist.
+func Installed(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, class := range classes {
+		key, err := registry.OpenKey(registry.CURRENT_USER, verbKey(class, cfg), registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		key.Close()
+		paths = append(paths, `HKCU\`+verbKey(class, cfg))
+	}
+	return paths, nil
+}
+
+func setValues(path string, values map[string]string) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	for name, value := range values {
+		if err := key.SetStringValue(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
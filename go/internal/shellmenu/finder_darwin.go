@@ -0,0 +1,220 @@
+package shellmenu
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const workflowInfo = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>NSServices</key>
+  <array>
+    <dict>
+      <key>NSMenuItem</key>
+      <dict>
+        <key>default</key>
+        <string>{{LABEL}}</string>
+      </dict>
+      <key>NSMessage</key>
+      <string>runWorkflowAsService</string>
+      <key>NSRequiredContext</key>
+      <dict>
+        <key>NSApplicationIdentifier</key>
+        <string>com.apple.finder</string>
+      </dict>
+      <key>NSSendFileTypes</key>
+      <array>
+        <string>public.item</string>
+      </array>
+    </dict>
+  </array>
+</dict>
+</plist>
+`
+
+// workflowDocument is an Automator Quick Action with one Run Shell Script
+// action that receives the selected Finder items as arguments.
+const workflowDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>AMApplicationBuild</key>
+  <string>523</string>
+  <key>AMApplicationVersion</key>
+  <string>2.10</string>
+  <key>AMDocumentVersion</key>
+  <string>2</string>
+  <key>actions</key>
+  <array>
+    <dict>
+      <key>action</key>
+      <dict>
+        <key>AMAccepts</key>
+        <dict>
+          <key>Container</key>
+          <string>List</string>
+          <key>Optional</key>
+          <true/>
+          <key>Types</key>
+          <array>
+            <string>com.apple.cocoa.path</string>
+          </array>
+        </dict>
+        <key>AMActionVersion</key>
+        <string>2.0.3</string>
+        <key>AMApplication</key>
+        <array>
+          <string>Automator</string>
+        </array>
+        <key>AMProvides</key>
+        <dict>
+          <key>Container</key>
+          <string>List</string>
+          <key>Types</key>
+          <array>
+            <string>com.apple.cocoa.string</string>
+          </array>
+        </dict>
+        <key>ActionBundlePath</key>
+        <string>/System/Library/Automator/Run Shell Script.action</string>
+        <key>ActionName</key>
+        <string>Run Shell Script</string>
+        <key>ActionParameters</key>
+        <dict>
+          <key>COMMAND_STRING</key>
+          <string>{{SCRIPT}}</string>
+          <key>CheckedForUserDefaultShell</key>
+          <true/>
+          <key>inputMethod</key>
+          <integer>1</integer>
+          <key>shell</key>
+          <string>/bin/sh</string>
+          <key>source</key>
+          <string></string>
+        </dict>
+        <key>BundleIdentifier</key>
+        <string>com.apple.RunShellScript</string>
+        <key>CFBundleVersion</key>
+        <string>2.0.3</string>
+        <key>CanShowSelectedItemsWhenRun</key>
+        <false/>
+        <key>CanShowWhenRun</key>
+        <true/>
+        <key>Category</key>
+        <array>
+          <string>AMCategoryUtilities</string>
+        </array>
+        <key>Class Name</key>
+        <string>RunShellScriptAction</string>
+        <key>InputUUID</key>
+        <string>8E1F5A0C-6D1B-4B0E-9A55-1C7A1E0B6F01</string>
+        <key>OutputUUID</key>
+        <string>8E1F5A0C-6D1B-4B0E-9A55-1C7A1E0B6F02</string>
+        <key>UUID</key>
+        <string>8E1F5A0C-6D1B-4B0E-9A55-1C7A1E0B6F03</string>
+      </dict>
+      <key>isViewVisible</key>
+      <integer>1</integer>
+    </dict>
+  </array>
+  <key>workflowMetaData</key>
+  <dict>
+    <key>serviceInputTypeIdentifier</key>
+    <string>com.apple.Automator.fileSystemObject</string>
+    <key>serviceOutputTypeIdentifier</key>
+    <string>com.apple.Automator.nothing</string>
+    <key>serviceProcessesInput</key>
+    <integer>0</integer>
+    <key>workflowTypeIdentifier</key>
+    <string>com.apple.Automator.servicesMenu</string>
+  </dict>
+</dict>
+</plist>
+`
+
+func workflowPath(cfg Config) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Services", cfg.Label+".workflow"), nil
+}
+
+// files returns the Info.plist and document of the Quick Action bundle.
+func files(cfg Config) ([]menuFile, error) {
+	bundle, err := workflowPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	info := bytes.ReplaceAll([]byte(workflowInfo), []byte("{{LABEL}}"), []byte(xmlEscape(cfg.Label)))
+	// The shebang line of shellScript is ignored; Automator runs the
+	// script with the shell set above.
+	document := bytes.ReplaceAll([]byte(workflowDocument), []byte("{{SCRIPT}}"), []byte(xmlEscape(shellScript(cfg))))
+	return []menuFile{
+		{path: filepath.Join(bundle, "Contents", "Info.plist"), content: string(info), mode: 0o644},
+		{path: filepath.Join(bundle, "Contents", "document.wflow"), content: string(document), mode: 0o644},
+	}, nil
+}
+
+func Render(cfg Config) (string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return "", err
+	}
+	entries, err := files(cfg)
+	if err != nil {
+		return "", err
+	}
+	return renderFiles(entries), nil
+}
+
+func Install(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := files(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writeFiles(entries); err != nil {
+		return nil, err
+	}
+	bundle, err := workflowPath(cfg)
+	return []string{bundle}, err
+}
+
+func Uninstall(cfg Config) ([]string, error) {
+	paths, err := Installed(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("the menu entry is not installed")
+	}
+	return paths, os.RemoveAll(paths[0])
+}
+
+// Installed returns the Quick Action bundle when it exists.
+func Installed(cfg Config) ([]string, error) {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := workflowPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return existing([]string{bundle}), nil
+}
+
+func xmlEscape(value string) string {
+	buffer := &bytes.Buffer{}
+	_ = xml.EscapeText(buffer, []byte(value))
+	return buffer.String()
+}
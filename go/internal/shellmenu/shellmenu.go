@@ -0,0 +1,131 @@
+// Package shellmenu adds a "Send to Telegram" entry to the file manager's
+// context menu: Explorer on Windows, a Finder Quick Action on macOS and
+// Nautilus, Nemo and Dolphin on Linux. The entry runs the executable with
+// fixed arguments followed by the selected paths.
+package shellmenu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const DefaultLabel = "Send to Telegram"
+
+type Config struct {
+	// Label is the menu entry text; it also names the files or registry
+	// keys created for the entry.
+	Label      string
+	Executable string
+	// Args come before the selected paths.
+	Args []string
+	// LogFile collects the output of sends started from the menu, which
+	// the file managers on Linux and macOS discard.
+	LogFile string
+}
+
+func (c Config) normalize() (Config, error) {
+	if c.Label == "" {
+		c.Label = DefaultLabel
+	}
+	if strings.ContainsAny(c.Label, `/\`) {
+		return c, fmt.Errorf("invalid menu label %q", c.Label)
+	}
+	if c.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return c, err
+		}
+		c.Executable = exe
+	}
+	if resolved, err := filepath.EvalSymlinks(c.Executable); err == nil {
+		c.Executable = resolved
+	}
+	return c, nil
+}
+
+// slug turns the label into a file or key name: "Send to Telegram" becomes
+// "send-to-telegram".
+func slug(label string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(label) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		return "telegram-upload-watcher"
+	}
+	return name
+}
+
+// shellScript returns a POSIX sh script running the command with the
+// selected paths, appending its output to the log file and raising a
+// desktop notification when the send fails.
+func shellScript(cfg Config) string {
+	words := []string{shQuote(cfg.Executable)}
+	for _, arg := range cfg.Args {
+		words = append(words, shQuote(arg))
+	}
+	command := strings.Join(words, " ") + ` "$@"`
+	if cfg.LogFile != "" {
+		command += " >>" + shQuote(cfg.LogFile) + " 2>&1"
+	}
+	return "#!/bin/sh\n" +
+		"# " + cfg.Label + ": written by telegram-send-go integrate-shell.\n" +
+		command + " || notify-send " + shQuote(cfg.Label) + " " + shQuote("Sending failed; see "+cfg.LogFile) + " 2>/dev/null\n"
+}
+
+func shQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\"'\\$`!*?[]{}()<>|&;#~") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// menuFile is one file making up the menu entry on Linux and macOS.
+type menuFile struct {
+	path    string
+	content string
+	mode    os.FileMode
+}
+
+func renderFiles(files []menuFile) string {
+	var b strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&b, "# %s\n%s\n", file.path, file.content)
+	}
+	return b.String()
+}
+
+func writeFiles(files []menuFile) ([]string, error) {
+	paths := []string{}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0o755); err != nil {
+			return paths, err
+		}
+		if err := os.WriteFile(file.path, []byte(file.content), file.mode); err != nil {
+			return paths, err
+		}
+		paths = append(paths, file.path)
+	}
+	return paths, nil
+}
+
+// existing returns the paths that exist.
+func existing(paths []string) []string {
+	found := []string{}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	return found
+}
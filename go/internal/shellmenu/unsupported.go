@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package shellmenu
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func Render(cfg Config) (string, error) {
+	return "", fmt.Errorf("context menu integration is not supported on %s", runtime.GOOS)
+}
+
+func Install(cfg Config) ([]string, error) {
+	return nil, fmt.Errorf("context menu integration is not supported on %s", runtime.GOOS)
+}
+
+func Uninstall(cfg Config) ([]string, error) {
+	return nil, fmt.Errorf("context menu integration is not supported on %s", runtime.GOOS)
+}
+
+func Installed(cfg Config) ([]string, error) {
+	return nil, fmt.Errorf("context menu integration is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,280 @@
+package splitter
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+)
+
+const (
+	FormatZip      = "zip"
+	FormatSevenZip = "7z"
+)
+
+// Spec is a parsed --auto-split value such as "zip:1900MB". The zero Spec
+// disables splitting.
+type Spec struct {
+	Format   string
+	PartSize int64
+}
+
+// ParseSpec parses "<zip|7z>:<size>", where size takes an optional KB, MB
+// or GB suffix (powers of 1024). An empty value disables splitting.
+func ParseSpec(value string) (Spec, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Spec{}, nil
+	}
+	format, sizeText, ok := strings.Cut(value, ":")
+	if !ok {
+		return Spec{}, fmt.Errorf("invalid auto-split %q: expected <zip|7z>:<size>, e.g. zip:1900MB", value)
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != FormatZip && format != FormatSevenZip {
+		return Spec{}, fmt.Errorf("invalid auto-split format %q: expected zip or 7z", format)
+	}
+	size, err := ParseSize(sizeText)
+	if err != nil {
+		return Spec{}, fmt.Errorf("invalid auto-split size: %w", err)
+	}
+	if size < 1024*1024 {
+		return Spec{}, fmt.Errorf("invalid auto-split size %q: must be at least 1MB", sizeText)
+	}
+	return Spec{Format: format, PartSize: size}, nil
+}
+
+// ParseSize parses a byte count such as "1900MB", "2GB" or "512000".
+func ParseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return number * multiplier, nil
+}
+
+// Enabled reports whether files over PartSize should be split.
+func (s Spec) Enabled() bool {
+	return s.Format != "" && s.PartSize > 0
+}
+
+// Needed reports whether a file of size bytes must be split.
+func (s Spec) Needed(size int64) bool {
+	return s.Enabled() && size > s.PartSize
+}
+
+func (s Spec) String() string {
+	return fmt.Sprintf("%s:%dMB", s.Format, s.PartSize>>20)
+}
+
+// Split writes name, read from src, as numbered volumes (name.zip.001, ...)
+// of at most PartSize bytes in dir and returns the volume paths in order.
+// Zip volumes are written by streaming; 7z volumes need the 7z binary.
+func Split(spec Spec, name string, src io.Reader, dir string) ([]string, error) {
+	switch spec.Format {
+	case FormatZip:
+		return splitZip(spec, name, src, dir)
+	case FormatSevenZip:
+		return splitSevenZip(spec, name, src, dir)
+	default:
+		return nil, fmt.Errorf("unsupported auto-split format: %s", spec.Format)
+	}
+}
+
+func splitZip(spec Spec, name string, src io.Reader, dir string) ([]string, error) {
+	volumes := &volumeWriter{base: filepath.Join(dir, name+".zip"), partSize: spec.PartSize}
+	archive := zip.NewWriter(volumes)
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err == nil {
+		_, err = io.Copy(entry, src)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if closeErr := volumes.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return volumes.paths, nil
+}
+
+func splitSevenZip(spec Spec, name string, src io.Reader, dir string) ([]string, error) {
+	binary := ""
+	for _, candidate := range []string{"7z", "7za", "7zz"} {
+		if path, err := exec.LookPath(candidate); err == nil {
+			binary = path
+			break
+		}
+	}
+	if binary == "" {
+		return nil, fmt.Errorf("auto-split 7z needs the 7z binary in PATH")
+	}
+	inputDir := filepath.Join(dir, "input")
+	if err := os.MkdirAll(inputDir, 0o755); err != nil {
+		return nil, err
+	}
+	input := filepath.Join(inputDir, name)
+	if err := writeFile(input, src); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(inputDir)
+
+	archive := filepath.Join(dir, name+".7z")
+	args := []string{"a", "-y", "-mx=0", fmt.Sprintf("-v%db", spec.PartSize), archive, input}
+	if output, err := exec.Command(binary, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("7z failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	paths, err := filepath.Glob(archive + ".[0-9][0-9][0-9]")
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("7z produced no volumes for %s", name)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func writeFile(path string, src io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// volumeWriter spreads writes over base.001, base.002, ... rolling over to
+// a new file every partSize bytes.
+type volumeWriter struct {
+	base     string
+	partSize int64
+	paths    []string
+	current  *os.File
+	written  int64
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.current == nil || w.written == w.partSize {
+			if err := w.next(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if room := w.partSize - w.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := w.current.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *volumeWriter) next() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s.%03d", w.base, len(w.paths)+1)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w.paths = append(w.paths, path)
+	w.current = file
+	w.written = 0
+	return nil
+}
+
+func (w *volumeWriter) Close() error {
+	if w.current == nil {
+		return nil
+	}
+	err := w.current.Close()
+	w.current = nil
+	return err
+}
+
+// Send splits name into volumes in a temporary directory, posts a manifest
+// message listing the parts and how to rejoin them, then uploads the parts
+// in order as documents. The volumes are removed afterwards.
+func Send(ctx context.Context, client *telegram.Client, chatID string, topicID *int, retry telegram.RetryConfig, spec Spec, name string, size int64, src io.Reader) error {
+	dir, err := tempdir.MkdirTemp("split-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := Split(spec, name, src, dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	manifest := fmt.Sprintf(
+		"Split upload: %s (%d bytes) as %d %s part(s) of up to %s\nParts: %s\nRejoin: 7z x %s",
+		name,
+		size,
+		len(paths),
+		spec.Format,
+		spec.String(),
+		strings.Join(names, ", "),
+		names[0],
+	)
+	if spec.Format == FormatZip {
+		manifest += fmt.Sprintf(" (or cat %s.zip.* > %s.zip)", name, name)
+	}
+	if err := client.SendMessage(ctx, chatID, manifest, topicID, retry); err != nil {
+		return err
+	}
+	for idx, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		file := telegram.MediaFile{Filename: names[idx], Path: path, Size: info.Size()}
+		if _, err := client.SendDocument(ctx, chatID, file, topicID, retry); err != nil {
+			return fmt.Errorf("send part %d/%d of %s: %w", idx+1, len(paths), name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package statedir
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const appName = "telegram-upload-watcher"
+
+// Default returns $XDG_STATE_HOME/telegram-upload-watcher, falling back to
+// ~/.local/state on Unix and the local app data directory on Windows.
+func Default() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, appName, "state"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", appName), nil
+}
+
+func Resolve(override string) (string, error) {
+	dir := override
+	if dir == "" {
+		defaultDir, err := Default()
+		if err != nil {
+			return "", err
+		}
+		dir = defaultDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// WatchQueuePath returns a queue file named after the watch target, so the
+// same target always resumes the same queue regardless of the working
+// directory, and different targets never share one.
+func WatchQueuePath(stateDir string, watchDirs []string, chatID string, topicID *int) string {
+	dirs := append([]string{}, watchDirs...)
+	sort.Strings(dirs)
+	hash := sha256.New()
+	for _, dir := range dirs {
+		fmt.Fprintf(hash, "dir:%s\n", dir)
+	}
+	fmt.Fprintf(hash, "chat:%s\n", chatID)
+	if topicID != nil {
+		fmt.Fprintf(hash, "topic:%d\n", *topicID)
+	}
+	label := "watch"
+	if len(dirs) > 0 {
+		label = slug(filepath.Base(dirs[0]))
+	}
+	name := fmt.Sprintf("watch-%s-%x.jsonl", label, hash.Sum(nil)[:6])
+	return filepath.Join(stateDir, "queues", name)
+}
+
+func slug(value string) string {
+	builder := strings.Builder{}
+	for _, r := range strings.ToLower(value) {
+		if builder.Len() >= 32 {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+		case builder.Len() > 0 && !strings.HasSuffix(builder.String(), "-"):
+			builder.WriteRune('-')
+		}
+	}
+	result := strings.Trim(builder.String(), "-")
+	if result == "" {
+		return "root"
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// ChatMember is a user's membership in a chat. The rights are only set for
+// administrators, and the send rights for restricted members.
+type ChatMember struct {
+	User               *User  `json:"user,omitempty"`
+	Status             string `json:"status"`
+	CustomTitle        string `json:"custom_title,omitempty"`
+	CanPostMessages    *bool  `json:"can_post_messages,omitempty"`
+	CanSendMessages    *bool  `json:"can_send_messages,omitempty"`
+	CanEditMessages    *bool  `json:"can_edit_messages,omitempty"`
+	CanDeleteMessages  *bool  `json:"can_delete_messages,omitempty"`
+	CanPinMessages     *bool  `json:"can_pin_messages,omitempty"`
+	CanManageTopics    *bool  `json:"can_manage_topics,omitempty"`
+	CanInviteUsers     *bool  `json:"can_invite_users,omitempty"`
+	CanRestrictMembers *bool  `json:"can_restrict_members,omitempty"`
+	CanPromoteMembers  *bool  `json:"can_promote_members,omitempty"`
+	CanChangeInfo      *bool  `json:"can_change_info,omitempty"`
+}
+
+// Rights lists the rights the member holds, by their Bot API name without
+// the can_ prefix.
+func (m ChatMember) Rights() []string {
+	rights := []string{}
+	for _, right := range []struct {
+		name  string
+		value *bool
+	}{
+		{"post_messages", m.CanPostMessages},
+		{"send_messages", m.CanSendMessages},
+		{"edit_messages", m.CanEditMessages},
+		{"delete_messages", m.CanDeleteMessages},
+		{"pin_messages", m.CanPinMessages},
+		{"manage_topics", m.CanManageTopics},
+		{"invite_users", m.CanInviteUsers},
+		{"restrict_members", m.CanRestrictMembers},
+		{"promote_members", m.CanPromoteMembers},
+		{"change_info", m.CanChangeInfo},
+	} {
+		if right.value != nil && *right.value {
+			rights = append(rights, right.name)
+		}
+	}
+	return rights
+}
+
+// BotMembership is one pool token's bot and its membership in a chat; Err
+// is set when either could not be read.
+type BotMembership struct {
+	Token  string
+	Bot    *User
+	Member *ChatMember
+	Err    error
+}
+
+// GetChatContext is GetChat with a context.
+func (c *Client) GetChatContext(ctx context.Context, chatID string) (*Chat, error) {
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	result, err := c.doTokenRequest(ctx, c.urlPool.Get(), c.tokenPool.Get(), "/getChat", form)
+	if err != nil {
+		return nil, err
+	}
+	var chat Chat
+	if err := json.Unmarshal(result, &chat); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// GetChatMemberCount returns how many members chatID has.
+func (c *Client) GetChatMemberCount(ctx context.Context, chatID string) (int, error) {
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	result, err := c.doTokenRequest(ctx, c.urlPool.Get(), c.tokenPool.Get(), "/getChatMemberCount", form)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	if err := json.Unmarshal(result, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetChatAdministrators lists the administrators of chatID. Telegram
+// leaves out bots other than the one asking.
+func (c *Client) GetChatAdministrators(ctx context.Context, chatID string) ([]ChatMember, error) {
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	result, err := c.doTokenRequest(ctx, c.urlPool.Get(), c.tokenPool.Get(), "/getChatAdministrators", form)
+	if err != nil {
+		return nil, err
+	}
+	var admins []ChatMember
+	if err := json.Unmarshal(result, &admins); err != nil {
+		return nil, err
+	}
+	return admins, nil
+}
+
+// BotMemberships reads, for every token in the pool, which bot it belongs
+// to and that bot's status and rights in chatID.
+func (c *Client) BotMemberships(ctx context.Context, chatID string) []BotMembership {
+	memberships := []BotMembership{}
+	for _, token := range c.tokenPool.All() {
+		membership := BotMembership{Token: token}
+		apiURL := c.urlPool.Get()
+		membership.Bot, membership.Err = c.getMe(ctx, apiURL, token)
+		if membership.Err == nil {
+			form := url.Values{}
+			form.Set("chat_id", chatID)
+			form.Set("user_id", strconv.FormatInt(membership.Bot.ID, 10))
+			var result json.RawMessage
+			result, membership.Err = c.doTokenRequest(ctx, apiURL, token, "/getChatMember", form)
+			if membership.Err == nil {
+				membership.Member = &ChatMember{}
+				membership.Err = json.Unmarshal(result, membership.Member)
+			}
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships
+}
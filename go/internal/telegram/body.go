@@ -0,0 +1,40 @@
+package telegram
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// requestBody is the payload of one API request: data, or for a streamed
+// upload data, then the file at path read from disk, then tail. Each
+// attempt reopens the file, so retries need no copy of it in memory.
+type requestBody struct {
+	data []byte
+	path string
+	tail []byte
+}
+
+func bytesBody(data []byte) requestBody {
+	return requestBody{data: data}
+}
+
+// open returns a reader over the body and its length; close releases the
+// file of a streamed body.
+func (b requestBody) open() (io.Reader, func(), int, error) {
+	if b.path == "" {
+		return bytes.NewReader(b.data), func() {}, len(b.data), nil
+	}
+	file, err := os.Open(b.path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	size := len(b.data) + int(info.Size()) + len(b.tail)
+	reader := io.MultiReader(bytes.NewReader(b.data), io.LimitReader(file, info.Size()), bytes.NewReader(b.tail))
+	return reader, func() { file.Close() }, size, nil
+}
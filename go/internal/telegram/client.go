@@ -2,23 +2,88 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"mime/multipart"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/mockapi"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tracing"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpproxy"
 )
 
+const urlProbeTimeout = 15 * time.Second
+
 type Client struct {
 	urlPool   *URLPool
 	tokenPool *TokenPool
 	client    *fasthttp.Client
+	options   SendOptions
+	// pin, when set, selects the token by hash instead of load (PinToken).
+	pin string
+}
+
+// SendOptions are applied to every message the client sends.
+type SendOptions struct {
+	// Spoiler blurs photos and videos until tapped (has_spoiler).
+	Spoiler bool
+	// ProtectContent blocks forwarding and saving (protect_content).
+	ProtectContent bool
+	// Silent delivers without a notification (disable_notification).
+	Silent bool
+	// ReplyTo sends everything as a reply to this message ID.
+	ReplyTo int
+	// ReplyToStart makes ThreadRun switch ReplyTo to a run's start message.
+	ReplyToStart bool
+	// TokenPinning keeps related sends on one token: TokenPinningGroup or
+	// TokenPinningFolder. Empty or TokenPinningOff balances per request.
+	TokenPinning string
+	// PrepareVideo, when set, may rewrite a video before SendVideo uploads
+	// it, e.g. to transcode it.
+	PrepareVideo VideoHook
+	// Thumbnail, when set, makes a thumbnail for documents, videos and
+	// audio sent without one; nil means none.
+	Thumbnail ThumbnailHook
+	// Rename, when set, returns the upload name of files that have a
+	// Source; an empty result keeps Filename.
+	Rename func(file MediaFile) string
+	// Sandbox, when set, is a test chat that receives every send and edit
+	// instead of the chat passed in; each redirected send is logged.
+	Sandbox string
+	// LocalFiles passes files streamed from disk to a local Bot API server
+	// (telegram-bot-api --local) as file:// paths, so it reads them itself
+	// and nothing is uploaded over the network.
+	LocalFiles bool
+	// AlsoAsDocument sends the Original of every photo again as a document
+	// right after the photo or its album, with the same caption.
+	AlsoAsDocument bool
+}
+
+// VideoHook returns the video to upload; asDocument sends it with
+// sendDocument instead of sendVideo.
+type VideoHook func(ctx context.Context, file MediaFile) (prepared MediaFile, asDocument bool, err error)
+
+// ThumbnailHook returns a JPEG thumbnail for file sent as kind ("document",
+// "video" or "audio"), or nil.
+type ThumbnailHook func(ctx context.Context, kind string, file MediaFile) []byte
+
+// WithSendOptions returns a client sharing c's pools and connections that
+// applies opts to every send.
+func (c *Client) WithSendOptions(opts SendOptions) *Client {
+	clone := *c
+	clone.options = opts
+	return &clone
 }
 
 type RetryConfig struct {
@@ -27,17 +92,42 @@ type RetryConfig struct {
 }
 
 type apiResponse struct {
-	Ok          bool   `json:"ok"`
-	Description string `json:"description"`
+	Ok          bool            `json:"ok"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
 	Parameters  struct {
 		RetryAfter int `json:"retry_after"`
 	} `json:"parameters"`
 }
 
+func (r *apiResponse) outcome() string {
+	switch {
+	case r.Ok:
+		return OutcomeOK
+	case r.ErrorCode == 429:
+		return OutcomeFloodWait
+	}
+	return OutcomeAPIError
+}
+
+func (r *apiResponse) err() error {
+	apiErr := &APIError{Code: r.ErrorCode, Description: r.Description, RetryAfter: r.Parameters.RetryAfter}
+	return apiErr.classify()
+}
+
 func NewClient(urlPool *URLPool, tokenPool *TokenPool) *Client {
 	client := &fasthttp.Client{}
-	if proxy := getProxyFromEnv(); proxy != "" {
-		client.Dial = fasthttpproxy.FasthttpHTTPDialerTimeout(proxy, 15*time.Second)
+	dial := fasthttp.Dial
+	if proxy := ProxyFromEnv(); proxy != "" {
+		dial = fasthttpproxy.FasthttpHTTPDialerTimeout(proxy, 15*time.Second)
+	}
+	// mock:// URLs are served in-process; see Endpoint in package mockapi.
+	client.Dial = func(addr string) (net.Conn, error) {
+		if conn, ok, err := mockapi.Dial(addr); ok {
+			return conn, err
+		}
+		return dial(addr)
 	}
 	return &Client{
 		urlPool:   urlPool,
@@ -46,7 +136,20 @@ func NewClient(urlPool *URLPool, tokenPool *TokenPool) *Client {
 	}
 }
 
-func getProxyFromEnv() string {
+// ThreadRun returns a client whose sends reply to messageID, the "Starting
+// upload" message of a run, when ReplyToStart is set; otherwise it returns c.
+func (c *Client) ThreadRun(messageID int) *Client {
+	if !c.options.ReplyToStart || messageID == 0 {
+		return c
+	}
+	opts := c.options
+	opts.ReplyTo = messageID
+	return c.WithSendOptions(opts)
+}
+
+// ProxyFromEnv returns the proxy from https_proxy/HTTPS_PROXY as
+// [user:pass@]host:port, or "" when none is set.
+func ProxyFromEnv() string {
 	proxy := os.Getenv("https_proxy")
 	if proxy == "" {
 		proxy = os.Getenv("HTTPS_PROXY")
@@ -66,163 +169,752 @@ func getProxyFromEnv() string {
 	return proxy
 }
 
-func (c *Client) TestToken(apiURL string, token string) bool {
-	if apiURL == "" || token == "" {
-		return false
-	}
-	url := apiURL + "/bot" + token + "/getMe"
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+type User struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+}
 
-	req.SetRequestURI(url)
-	req.Header.SetMethod("GET")
-	if err := c.client.Do(req, resp); err != nil {
-		return false
+// TokenCount is the number of bot tokens the client sends with.
+func (c *Client) TokenCount() int {
+	return len(c.tokenPool.All())
+}
+
+func (c *Client) GetMe(apiURL string, token string) (*User, error) {
+	return c.getMe(context.Background(), apiURL, token)
+}
+
+func (c *Client) getMe(ctx context.Context, apiURL string, token string) (*User, error) {
+	result, err := c.doTokenRequest(ctx, apiURL, token, "/getMe", url.Values{})
+	if err != nil {
+		return nil, err
 	}
-	var parsed apiResponse
-	if err := json.Unmarshal(resp.Body(), &parsed); err != nil {
-		return false
+	var user User
+	if err := json.Unmarshal(result, &user); err != nil {
+		return nil, err
 	}
-	return parsed.Ok
+	return &user, nil
 }
 
-func (c *Client) SendMessage(chatID string, text string, topicID *int, retry RetryConfig) error {
-	form := url.Values{}
-	form.Set("chat_id", chatID)
-	form.Set("text", text)
-	if topicID != nil {
-		form.Set("message_thread_id", fmt.Sprintf("%d", *topicID))
+// GetMeContext is GetMe bounded by ctx.
+func (c *Client) GetMeContext(ctx context.Context, apiURL string, token string) (*User, error) {
+	return c.getMe(ctx, apiURL, token)
+}
+
+// Ping checks that apiURL answers Bot API requests and returns the round
+// trip time. Any API reply counts, so a rejected token does not fail it.
+func (c *Client) Ping(ctx context.Context, apiURL string, token string) (time.Duration, error) {
+	start := time.Now()
+	if _, err := c.post(ctx, apiURL, token, "/getMe", requestBody{}, "application/x-www-form-urlencoded"); err != nil {
+		return 0, err
 	}
-	return c.doRequest("/sendMessage", []byte(form.Encode()), "application/x-www-form-urlencoded", retry)
+	return time.Since(start), nil
+}
+
+func (c *Client) TestToken(apiURL string, token string) bool {
+	_, err := c.GetMe(apiURL, token)
+	return err == nil
+}
+
+func (c *Client) SendMessage(ctx context.Context, chatID string, text string, topicID *int, retry RetryConfig) error {
+	_, err := c.SendMessageID(ctx, chatID, text, topicID, retry)
+	return err
+}
+
+// SendMessageID sends a text message and returns its message ID.
+func (c *Client) SendMessageID(ctx context.Context, chatID string, text string, topicID *int, retry RetryConfig) (int, error) {
+	return c.SendMessageButtons(ctx, chatID, text, nil, topicID, retry)
+}
+
+const (
+	MediaPhoto = "photo"
+	MediaVideo = "video"
+	// MediaDocument albums hold documents only; they cannot be mixed with
+	// photos or videos.
+	MediaDocument = "document"
+
+	// Telegram albums hold 2-10 items.
+	MinMediaGroupSize = 2
+	MaxMediaGroupSize = 10
+)
+
+// ClampGroupSize limits a configured album size to what Telegram accepts.
+func ClampGroupSize(size int) int {
+	if size < MinMediaGroupSize {
+		return MinMediaGroupSize
+	}
+	if size > MaxMediaGroupSize {
+		return MaxMediaGroupSize
+	}
+	return size
 }
 
 type MediaFile struct {
 	Filename string
 	Data     []byte
+	// Path, when Data is nil, is a file streamed from disk during the
+	// upload instead of being held in memory; Size is its size. Temporary
+	// files are removed once the upload is done.
+	Path      string
+	Size      int64
+	Temporary bool
+	// Type is the album item type for SendMediaGroup (default MediaPhoto).
+	Type string
+	// Caption is sent with the file when set.
+	Caption string
+	// Thumb is a JPEG thumbnail (at most 320x320, 200 kB) for documents,
+	// videos and audio.
+	Thumb []byte
+	// Source is the file on disk (or the zip holding it) this upload came
+	// from; only files with a Source are renamed by SendOptions.Rename.
+	Source string
+	// Original is the untouched file a photo was prepared from, set by
+	// WithOriginal.
+	Original *MediaFile
+}
+
+// WithOriginal returns photo with data, named filename, as its Original when
+// AlsoAsDocument is set, and photo unchanged otherwise.
+func (c *Client) WithOriginal(photo MediaFile, data []byte, filename string) MediaFile {
+	if c.options.AlsoAsDocument && isPhoto(photo) {
+		photo.Original = &MediaFile{Filename: filename, Data: data}
+	}
+	return photo
+}
+
+func isPhoto(file MediaFile) bool {
+	return file.Type == "" || file.Type == MediaPhoto
+}
+
+// sendOriginals sends the originals of photos just sent as documents, in
+// the same order and with the same captions. The photos are already
+// delivered and their messages are what the caller records, so a failure
+// is only logged.
+func (c *Client) sendOriginals(ctx context.Context, chatID string, media []MediaFile, topicID *int, retry RetryConfig) {
+	if !c.options.AlsoAsDocument {
+		return
+	}
+	originals := []MediaFile{}
+	for _, file := range media {
+		if file.Original == nil || !isPhoto(file) {
+			continue
+		}
+		original := *file.Original
+		original.Type = MediaDocument
+		original.Caption = file.Caption
+		original.Source = file.Source
+		originals = append(originals, original)
+	}
+	if len(originals) == 0 {
+		return
+	}
+	if _, err := c.SendMediaGroup(ctx, chatID, originals, topicID, retry); err != nil {
+		log.Printf("sending %d original(s) as documents failed: %v", len(originals), err)
+	}
+}
+
+// uploadName is the file name sent for file.
+func (c *Client) uploadName(file MediaFile) string {
+	if c.options.Rename == nil || file.Source == "" {
+		return file.Filename
+	}
+	if name := c.options.Rename(file); name != "" {
+		return name
+	}
+	return file.Filename
 }
 
-func (c *Client) SendMediaGroup(chatID string, media []MediaFile, topicID *int, retry RetryConfig) error {
+// localFileURI returns the file:// URI of a file streamed from disk when
+// LocalFiles is set. Files whose upload name differs from their name on
+// disk, e.g. renamed or extracted to a temporary file, are uploaded.
+func (c *Client) localFileURI(file MediaFile) (string, bool) {
+	if !c.options.LocalFiles || !file.streamed() || filepath.Base(file.Path) != c.uploadName(file) {
+		return "", false
+	}
+	abs, err := filepath.Abs(file.Path)
+	if err != nil {
+		return "", false
+	}
+	// The server takes the path as is, without URL escaping.
+	return "file://" + abs, true
+}
+
+// Len is the size of the file in bytes.
+func (f MediaFile) Len() int64 {
+	if f.streamed() {
+		return f.Size
+	}
+	return int64(len(f.Data))
+}
+
+// mediaBytes is the total size of media.
+func mediaBytes(media []MediaFile) int64 {
+	var total int64
+	for _, file := range media {
+		total += file.Len()
+	}
+	return total
+}
+
+func (f MediaFile) streamed() bool {
+	return f.Data == nil && f.Path != ""
+}
+
+// SplitMediaGroup splits files into consecutive groups whose combined size
+// stays within maxBytes. A file larger than maxBytes goes in a group of its
+// own; maxBytes <= 0 keeps everything in one group.
+func SplitMediaGroup(files []MediaFile, maxBytes int64) [][]MediaFile {
+	if len(files) == 0 {
+		return nil
+	}
+	if maxBytes <= 0 {
+		return [][]MediaFile{files}
+	}
+	groups := [][]MediaFile{}
+	start := 0
+	total := int64(0)
+	for i, file := range files {
+		size := file.Len()
+		if i > start && total+size > maxBytes {
+			groups = append(groups, files[start:i])
+			start = i
+			total = 0
+		}
+		total += size
+	}
+	return append(groups, files[start:])
+}
+
+// albumRuns splits media where it switches between documents and photos or
+// videos, which Telegram does not mix in one album.
+func albumRuns(media []MediaFile) [][]MediaFile {
+	runs := [][]MediaFile{}
+	start := 0
+	for i := 1; i < len(media); i++ {
+		if (media[i].Type == MediaDocument) != (media[start].Type == MediaDocument) {
+			runs = append(runs, media[start:i])
+			start = i
+		}
+	}
+	return append(runs, media[start:])
+}
+
+// SendMediaGroup sends photos and videos, or documents, as one album.
+// Telegram albums need 2-10 items, so a group of one goes through the
+// single-file method of its type and a larger group is split into several
+// albums, as is a group mixing documents with photos or videos. The result
+// lists the messages of all albums in order.
+func (c *Client) SendMediaGroup(ctx context.Context, chatID string, media []MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	chatID, topicID = c.sandbox(fmt.Sprintf("album of %d", len(media)), chatID, topicID)
+	c = c.pinGroup(chatID, media)
+	if len(media) == 1 {
+		return c.sendOne(ctx, chatID, media[0], topicID, retry)
+	}
+	if runs := albumRuns(media); len(runs) > 1 {
+		var total Result
+		for _, run := range runs {
+			result, err := c.SendMediaGroup(ctx, chatID, run, topicID, retry)
+			total.add(result)
+			if err != nil {
+				return total, err
+			}
+		}
+		return total, nil
+	}
+	if len(media) > MaxMediaGroupSize {
+		var total Result
+		for start := 0; start < len(media); start += MaxMediaGroupSize {
+			end := min(start+MaxMediaGroupSize, len(media))
+			result, err := c.SendMediaGroup(ctx, chatID, media[start:end], topicID, retry)
+			total.add(result)
+			if err != nil {
+				return total, err
+			}
+		}
+		return total, nil
+	}
+	ctx, span := tracing.Start(ctx, "sendMediaGroup")
+	defer span.End()
+	span.Set("telegram.chat_id", chatID)
+	span.Set("media.count", len(media))
+	span.Set("media.bytes", mediaBytes(media))
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	writer.WriteField("chat_id", chatID)
 	if topicID != nil {
 		writer.WriteField("message_thread_id", fmt.Sprintf("%d", *topicID))
 	}
+	if c.options.ProtectContent {
+		writer.WriteField("protect_content", "true")
+	}
+	if c.options.Silent {
+		writer.WriteField("disable_notification", "true")
+	}
+	if c.options.ReplyTo != 0 {
+		writer.WriteField("reply_to_message_id", strconv.Itoa(c.options.ReplyTo))
+		writer.WriteField("allow_sending_without_reply", "true")
+	}
 
-	mediaItems := []map[string]string{}
+	mediaItems := []map[string]any{}
 	for idx, file := range media {
 		field := fmt.Sprintf("file%d", idx)
-		part, err := writer.CreateFormFile(field, file.Filename)
+		part, err := writer.CreateFormFile(field, c.uploadName(file))
 		if err != nil {
-			return err
+			return Result{}, err
 		}
 		if _, err := part.Write(file.Data); err != nil {
-			return err
+			return Result{}, err
 		}
-		mediaItems = append(mediaItems, map[string]string{
-			"type":  "photo",
+		mediaType := file.Type
+		if mediaType == "" {
+			mediaType = MediaPhoto
+		}
+		item := map[string]any{
+			"type":  mediaType,
 			"media": "attach://" + field,
-		})
+		}
+		if c.options.Spoiler && mediaType != MediaDocument {
+			item["has_spoiler"] = true
+		}
+		if file.Caption != "" {
+			item["caption"] = file.Caption
+		}
+		mediaItems = append(mediaItems, item)
 	}
 
 	payload, err := json.Marshal(mediaItems)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 	writer.WriteField("media", string(payload))
 	writer.Close()
 
-	return c.doRequest("/sendMediaGroup", body.Bytes(), writer.FormDataContentType(), retry)
+	raw, err := c.doRequest(ctx, chatID, "/sendMediaGroup", bytesBody(body.Bytes()), writer.FormDataContentType(), retry)
+	if err != nil {
+		return Result{}, err
+	}
+	var messages []sentMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return Result{}, err
+	}
+	c.sendOriginals(ctx, chatID, media, topicID, retry)
+	return resultOf(messages...), nil
+}
+
+// SendMediaGroupEach sends media as one album and, when the album fails,
+// retries each item on its own so a single bad file does not fail the rest.
+// It returns one result and one error per item; the error is nil for items
+// that were delivered.
+func (c *Client) SendMediaGroupEach(ctx context.Context, chatID string, media []MediaFile, topicID *int, retry RetryConfig) ([]Result, []error) {
+	return c.SendMediaGroupEachFunc(ctx, chatID, media, topicID, retry, nil)
+}
+
+// SendMediaGroupEachFunc is SendMediaGroupEach that calls delivered as soon
+// as Telegram acknowledges part of media: once per album and once per item
+// sent on its own, with the index of the first item and one result per
+// item. Callers record those items right away, so a crash later in the
+// call does not send them again.
+func (c *Client) SendMediaGroupEachFunc(ctx context.Context, chatID string, media []MediaFile, topicID *int, retry RetryConfig, delivered func(first int, results []Result)) ([]Result, []error) {
+	c = c.pinGroup(chatID, media)
+	results := make([]Result, len(media))
+	errs := make([]error, len(media))
+	if delivered == nil {
+		delivered = func(int, []Result) {}
+	}
+	if runs := albumRuns(media); len(runs) > 1 {
+		start := 0
+		for _, run := range runs {
+			first := start
+			runResults, runErrs := c.SendMediaGroupEachFunc(ctx, chatID, run, topicID, retry, func(i int, runResults []Result) {
+				delivered(first+i, runResults)
+			})
+			copy(results[start:], runResults)
+			copy(errs[start:], runErrs)
+			start += len(run)
+		}
+		return results, errs
+	}
+	if len(media) > MaxMediaGroupSize {
+		for start := 0; start < len(media); start += MaxMediaGroupSize {
+			end := min(start+MaxMediaGroupSize, len(media))
+			chunkResults, chunkErrs := c.SendMediaGroupEachFunc(ctx, chatID, media[start:end], topicID, retry, func(first int, chunkResults []Result) {
+				delivered(start+first, chunkResults)
+			})
+			copy(results[start:end], chunkResults)
+			copy(errs[start:end], chunkErrs)
+		}
+		return results, errs
+	}
+	result, err := c.SendMediaGroup(ctx, chatID, media, topicID, retry)
+	if err == nil {
+		for i := range results {
+			results[i] = result.item(i)
+		}
+		delivered(0, results)
+		return results, errs
+	}
+	if len(media) == 1 || ctx.Err() != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return results, errs
+	}
+	log.Printf("media group failed, sending %d item(s) individually: %v", len(media), err)
+	for i, file := range media {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		results[i], errs[i] = c.sendOne(ctx, chatID, file, topicID, retry)
+		if errs[i] == nil {
+			delivered(i, results[i:i+1])
+		}
+	}
+	return results, errs
 }
 
-func (c *Client) SendDocument(chatID string, file MediaFile, topicID *int, retry RetryConfig) error {
-	return c.sendFile("/sendDocument", "document", chatID, file, topicID, retry)
+// sendOne sends a single album item with the method matching its type.
+func (c *Client) sendOne(ctx context.Context, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	switch file.Type {
+	case MediaVideo:
+		return c.SendVideo(ctx, chatID, file, topicID, retry)
+	case MediaDocument:
+		return c.SendDocument(ctx, chatID, file, topicID, retry)
+	}
+	result, err := c.SendPhoto(ctx, chatID, file, topicID, retry)
+	if err != nil {
+		return result, err
+	}
+	c.sendOriginals(ctx, chatID, []MediaFile{file}, topicID, retry)
+	return result, nil
 }
 
-func (c *Client) SendVideo(chatID string, file MediaFile, topicID *int, retry RetryConfig) error {
-	return c.sendFile("/sendVideo", "video", chatID, file, topicID, retry)
+func (c *Client) SendPhoto(ctx context.Context, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	return c.sendFile(ctx, "/sendPhoto", "photo", chatID, file, topicID, retry)
 }
 
-func (c *Client) SendAudio(chatID string, file MediaFile, topicID *int, retry RetryConfig) error {
-	return c.sendFile("/sendAudio", "audio", chatID, file, topicID, retry)
+func (c *Client) SendDocument(ctx context.Context, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	return c.sendFile(ctx, "/sendDocument", "document", chatID, file, topicID, retry)
 }
 
-func (c *Client) sendFile(path string, fieldName string, chatID string, file MediaFile, topicID *int, retry RetryConfig) error {
+func (c *Client) SendVideo(ctx context.Context, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	if c.options.PrepareVideo != nil {
+		prepared, asDocument, err := c.options.PrepareVideo(ctx, file)
+		if err != nil {
+			return Result{}, err
+		}
+		if prepared.Temporary && prepared.Path != file.Path {
+			defer os.Remove(prepared.Path)
+		}
+		if asDocument {
+			return c.SendDocument(ctx, chatID, prepared, topicID, retry)
+		}
+		file = prepared
+	}
+	return c.sendFile(ctx, "/sendVideo", "video", chatID, file, topicID, retry)
+}
+
+func (c *Client) SendAudio(ctx context.Context, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	return c.sendFile(ctx, "/sendAudio", "audio", chatID, file, topicID, retry)
+}
+
+func (c *Client) sendFile(ctx context.Context, path string, fieldName string, chatID string, file MediaFile, topicID *int, retry RetryConfig) (Result, error) {
+	chatID, topicID = c.sandbox(path+" "+file.Filename, chatID, topicID)
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(path, "/"))
+	defer span.End()
+	span.Set("telegram.chat_id", chatID)
+	span.Set("file.name", file.Filename)
+	span.Set("file.size", file.Len())
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	writer.WriteField("chat_id", chatID)
 	if topicID != nil {
 		writer.WriteField("message_thread_id", fmt.Sprintf("%d", *topicID))
 	}
+	if c.options.ProtectContent {
+		writer.WriteField("protect_content", "true")
+	}
+	if c.options.Silent {
+		writer.WriteField("disable_notification", "true")
+	}
+	if c.options.ReplyTo != 0 {
+		writer.WriteField("reply_to_message_id", strconv.Itoa(c.options.ReplyTo))
+		writer.WriteField("allow_sending_without_reply", "true")
+	}
+	if c.options.Spoiler && (fieldName == "photo" || fieldName == "video") {
+		writer.WriteField("has_spoiler", "true")
+	}
+	if file.Caption != "" {
+		writer.WriteField("caption", file.Caption)
+	}
 
-	part, err := writer.CreateFormFile(fieldName, file.Filename)
-	if err != nil {
-		return err
+	payload := requestBody{}
+	uri, local := c.localFileURI(file)
+	streamed := file.streamed() && !local
+	if local {
+		writer.WriteField(fieldName, uri)
+	} else if part, err := writer.CreateFormFile(fieldName, c.uploadName(file)); err != nil {
+		return Result{}, err
+	} else if streamed {
+		// The file goes between what was written so far and the rest.
+		payload.data = bytes.Clone(body.Bytes())
+		payload.path = file.Path
+		body.Reset()
+	} else if _, err := part.Write(file.Data); err != nil {
+		return Result{}, err
 	}
-	if _, err := part.Write(file.Data); err != nil {
-		return err
+	if file.Thumb == nil && c.options.Thumbnail != nil && fieldName != "photo" {
+		file.Thumb = c.options.Thumbnail(ctx, fieldName, file)
+	}
+	if len(file.Thumb) > 0 && fieldName != "photo" {
+		part, err := writer.CreateFormFile("thumbnail", "thumbnail.jpg")
+		if err != nil {
+			return Result{}, err
+		}
+		if _, err := part.Write(file.Thumb); err != nil {
+			return Result{}, err
+		}
 	}
 	writer.Close()
+	if streamed {
+		payload.tail = body.Bytes()
+	} else {
+		payload.data = body.Bytes()
+	}
 
-	return c.doRequest(path, body.Bytes(), writer.FormDataContentType(), retry)
+	raw, err := c.doRequest(ctx, chatID, path, payload, writer.FormDataContentType(), retry)
+	if err != nil {
+		return Result{}, err
+	}
+	var message sentMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return Result{}, err
+	}
+	return resultOf(message), nil
 }
 
-func (c *Client) doRequest(path string, body []byte, contentType string, retry RetryConfig) error {
+// doRequest retries failed calls; ctx cancellation aborts the current
+// attempt (including an upload in progress) and any wait between attempts.
+// Every attempt first waits out a retry_after pause of chatID.
+func (c *Client) doRequest(ctx context.Context, chatID string, path string, body requestBody, contentType string, retry RetryConfig) (json.RawMessage, error) {
 	if retry.MaxRetries <= 0 {
 		retry.MaxRetries = 1
 	}
+	// Send methods start a span named after their method with the sizes of
+	// what they send; other calls get a span of their own.
+	span := tracing.FromContext(ctx)
+	if method := strings.TrimPrefix(path, "/"); span.Name() != method {
+		ctx, span = tracing.StartChild(ctx, method)
+		defer span.End()
+	}
 	for attempt := 1; attempt <= retry.MaxRetries; attempt++ {
-		err := c.doRequestOnce(path, body, contentType)
+		span.Set("telegram.attempts", attempt)
+		if !flood.wait(ctx, chatID) {
+			return nil, traceFailure(span, ctx.Err())
+		}
+		result, err := c.doRequestOnce(ctx, chatID, path, body, contentType)
 		if err == nil {
-			return nil
+			return result, nil
 		}
-		if attempt == retry.MaxRetries {
-			return err
+		if ctx.Err() != nil {
+			return nil, traceFailure(span, ctx.Err())
 		}
-		time.Sleep(retry.Delay)
+		if attempt == retry.MaxRetries || IsPermanent(err) {
+			return nil, traceFailure(span, err)
+		}
+		if !sleepContext(ctx, retry.Delay) {
+			return nil, traceFailure(span, ctx.Err())
+		}
+	}
+	return nil, nil
+}
+
+// traceFailure records on span why a send gave up and returns err.
+func traceFailure(span *tracing.Span, err error) error {
+	span.SetError(err)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		span.Set("telegram.error_code", apiErr.Code)
 	}
-	return nil
+	if class := ErrorClass(err); class != "" {
+		span.Set("telegram.error_class", class)
+	}
+	return err
 }
 
-func (c *Client) doRequestOnce(path string, body []byte, contentType string) error {
+func (c *Client) doRequestOnce(ctx context.Context, chatID string, path string, body requestBody, contentType string) (json.RawMessage, error) {
 	apiURL := c.urlPool.Get()
-	token := c.tokenPool.Get()
+	token := c.token()
 	if apiURL == "" || token == "" {
-		return fmt.Errorf("no available api url or token")
+		return nil, fmt.Errorf("no available api url or token")
 	}
 	defer c.urlPool.Increment(apiURL)
+	c.probeURLs()
+
+	started := time.Now()
+	parsed, err := c.post(ctx, apiURL, token, path, body, contentType)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.urlPool.ReportFailure(apiURL)
+		}
+		return nil, err
+	}
+	c.urlPool.ReportSuccess(apiURL, time.Since(started))
+	if parsed.Ok {
+		c.tokenPool.Increment(token)
+		usage.record(chatID, time.Now())
+		return parsed.Result, nil
+	}
+	if parsed.Parameters.RetryAfter > 0 {
+		flood.pause(chatID, time.Duration(parsed.Parameters.RetryAfter)*time.Second)
+	}
+	if parsed.Description != "" {
+		log.Printf("telegram error: %s", parsed.Description)
+	}
+	// Only a rejected token is dropped; other errors (a bad file, a wrong
+	// chat) say nothing about the token and must not disable it.
+	if parsed.ErrorCode == 401 || parsed.ErrorCode == 404 {
+		c.tokenPool.Remove(token)
+	}
+	return nil, parsed.err()
+}
 
-	url := apiURL + "/bot" + token + path
+// probeURLs checks ejected API URLs in the background; any API response
+// (even an error for the token) proves the endpoint is reachable again.
+func (c *Client) probeURLs() {
+	for _, apiURL := range c.urlPool.ProbeCandidates() {
+		go func(apiURL string) {
+			ctx, cancel := context.WithTimeout(context.Background(), urlProbeTimeout)
+			defer cancel()
+			started := time.Now()
+			if _, err := c.post(ctx, apiURL, c.tokenPool.Get(), "/getMe", requestBody{}, "application/x-www-form-urlencoded"); err != nil {
+				c.urlPool.ReportFailure(apiURL)
+				return
+			}
+			c.urlPool.ReportSuccess(apiURL, time.Since(started))
+		}(apiURL)
+	}
+}
+
+func (c *Client) doTokenRequest(ctx context.Context, apiURL string, token string, path string, form url.Values) (json.RawMessage, error) {
+	if apiURL == "" || token == "" {
+		return nil, fmt.Errorf("api url and token are required")
+	}
+	parsed, err := c.post(ctx, apiURL, token, path, bytesBody([]byte(form.Encode())), "application/x-www-form-urlencoded")
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Ok {
+		return nil, parsed.err()
+	}
+	return parsed.Result, nil
+}
+
+// post sends one request. fasthttp has no context support, so the body is
+// streamed through a reader that fails once ctx is done (aborting an upload
+// mid-way) and the call returns as soon as ctx is cancelled; a context
+// deadline is passed on via DoDeadline.
+func (c *Client) post(ctx context.Context, apiURL string, token string, path string, body requestBody, contentType string) (*apiResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reader, closeBody, size, err := body.open()
+	if err != nil {
+		return nil, err
+	}
+	url := mockapi.Endpoint(apiURL) + "/bot" + token + path
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+	release := func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+		closeBody()
+	}
 
 	req.SetRequestURI(url)
 	req.Header.SetMethod("POST")
 	req.Header.SetContentType(contentType)
-	req.SetBodyRaw(body)
+	req.SetBodyStream(&contextReader{ctx: ctx, r: reader}, size)
 
-	if err := c.client.Do(req, resp); err != nil {
-		return err
+	method := strings.TrimPrefix(path, "/")
+	_, span := tracing.StartRequest(ctx, "POST "+method)
+	span.Set("server.address", apiURL)
+	span.Set("http.request.body.size", int64(size))
+	started := time.Now()
+	// record ends the attempt for the latency stats and the trace.
+	record := func(received int64, outcome string, err error) {
+		latency.record(apiURL, method, time.Since(started), int64(size), received, outcome)
+		span.Set("http.response.body.size", received)
+		span.Set("telegram.outcome", outcome)
+		span.SetError(err)
+		span.End()
 	}
+	done := make(chan error, 1)
+	go func() {
+		if deadline, ok := ctx.Deadline(); ok {
+			done <- c.client.DoDeadline(req, resp, deadline)
+			return
+		}
+		done <- c.client.Do(req, resp)
+	}()
 
-	var parsed apiResponse
-	if err := json.Unmarshal(resp.Body(), &parsed); err != nil {
-		return err
+	select {
+	case err := <-done:
+		defer release()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				record(0, OutcomeCanceled, ctxErr)
+				return nil, ctxErr
+			}
+			record(0, OutcomeNetwork, err)
+			return nil, err
+		}
+		span.Set("http.response.status_code", resp.StatusCode())
+		var parsed apiResponse
+		if err := json.Unmarshal(resp.Body(), &parsed); err != nil {
+			record(int64(len(resp.Body())), OutcomeNetwork, err)
+			return nil, err
+		}
+		var apiErr error
+		if !parsed.Ok {
+			span.Set("telegram.error_code", parsed.ErrorCode)
+			apiErr = parsed.err()
+		}
+		record(int64(len(resp.Body())), parsed.outcome(), apiErr)
+		return &parsed, nil
+	case <-ctx.Done():
+		record(0, OutcomeCanceled, ctx.Err())
+		go func() {
+			<-done
+			release()
+		}()
+		return nil, ctx.Err()
 	}
-	if parsed.Ok {
-		c.tokenPool.Increment(token)
-		return nil
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
 	}
-	if parsed.Parameters.RetryAfter > 0 {
-		time.Sleep(time.Duration(parsed.Parameters.RetryAfter) * time.Second)
+	return r.r.Read(p)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
 	}
-	if parsed.Description != "" {
-		log.Printf("telegram error: %s", parsed.Description)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
-	c.tokenPool.Remove(token)
-	return fmt.Errorf("telegram request failed: %s", parsed.Description)
 }
@@ -0,0 +1,208 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+type Chat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
+	First    string `json:"first_name,omitempty"`
+	Last     string `json:"last_name,omitempty"`
+	IsForum  bool   `json:"is_forum,omitempty"`
+	// Description and InviteLink are only filled in by getChat; the
+	// invite link only for chats where the bot is an administrator.
+	Description string `json:"description,omitempty"`
+	InviteLink  string `json:"invite_link,omitempty"`
+}
+
+func (c Chat) DisplayName() string {
+	switch {
+	case c.Title != "":
+		return c.Title
+	case c.Username != "":
+		return "@" + c.Username
+	case c.First != "" || c.Last != "":
+		if c.Last == "" {
+			return c.First
+		}
+		return c.First + " " + c.Last
+	default:
+		return strconv.FormatInt(c.ID, 10)
+	}
+}
+
+type ForumTopic struct {
+	ThreadID int    `json:"message_thread_id"`
+	Name     string `json:"name"`
+}
+
+type forumTopicEvent struct {
+	Name string `json:"name"`
+}
+
+type Message struct {
+	MessageID         int              `json:"message_id"`
+	MessageThreadID   int              `json:"message_thread_id,omitempty"`
+	IsTopicMessage    bool             `json:"is_topic_message,omitempty"`
+	Chat              Chat             `json:"chat"`
+	ReplyToMessage    *Message         `json:"reply_to_message,omitempty"`
+	ForumTopicCreated *forumTopicEvent `json:"forum_topic_created,omitempty"`
+	ForumTopicEdited  *forumTopicEvent `json:"forum_topic_edited,omitempty"`
+}
+
+type chatMemberUpdated struct {
+	Chat Chat `json:"chat"`
+}
+
+type Update struct {
+	UpdateID          int                `json:"update_id"`
+	Message           *Message           `json:"message,omitempty"`
+	EditedMessage     *Message           `json:"edited_message,omitempty"`
+	ChannelPost       *Message           `json:"channel_post,omitempty"`
+	EditedChannelPost *Message           `json:"edited_channel_post,omitempty"`
+	MyChatMember      *chatMemberUpdated `json:"my_chat_member,omitempty"`
+}
+
+func (u Update) messages() []*Message {
+	messages := []*Message{}
+	for _, msg := range []*Message{u.Message, u.EditedMessage, u.ChannelPost, u.EditedChannelPost} {
+		if msg != nil {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func (c *Client) GetUpdates(apiURL string, token string) ([]Update, error) {
+	result, err := c.doTokenRequest(context.Background(), apiURL, token, "/getUpdates", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	var updates []Update
+	if err := json.Unmarshal(result, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+func (c *Client) GetChat(chatID string) (*Chat, error) {
+	return c.GetChatContext(context.Background(), chatID)
+}
+
+// DiscoverChats lists the chats seen in the pending updates of every bot in
+// the token pool, refreshed with getChat. Telegram has no "list my chats"
+// method, so only chats that produced an update in the last 24 hours are
+// returned.
+func (c *Client) DiscoverChats() ([]Chat, error) {
+	chats := map[int64]Chat{}
+	owners := map[int64]string{}
+	var lastErr error
+	for _, token := range c.tokenPool.All() {
+		updates, err := c.GetUpdates(c.urlPool.Get(), token)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, update := range updates {
+			found := []Chat{}
+			if update.MyChatMember != nil {
+				found = append(found, update.MyChatMember.Chat)
+			}
+			for _, msg := range update.messages() {
+				found = append(found, msg.Chat)
+			}
+			for _, chat := range found {
+				chats[chat.ID] = chat
+				owners[chat.ID] = token
+			}
+		}
+	}
+	if len(chats) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	list := make([]Chat, 0, len(chats))
+	for id, chat := range chats {
+		form := url.Values{}
+		form.Set("chat_id", strconv.FormatInt(id, 10))
+		if result, err := c.doTokenRequest(context.Background(), c.urlPool.Get(), owners[id], "/getChat", form); err == nil {
+			var fresh Chat
+			if json.Unmarshal(result, &fresh) == nil && fresh.ID != 0 {
+				chat = fresh
+			}
+		}
+		list = append(list, chat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DisplayName() < list[j].DisplayName()
+	})
+	return list, nil
+}
+
+// DiscoverTopics lists forum topics of chatID seen in pending updates. Topic
+// names come from forum_topic_created/edited service messages, which Telegram
+// also attaches as reply_to_message of ordinary topic messages.
+func (c *Client) DiscoverTopics(chatID string) ([]ForumTopic, error) {
+	topics := map[int]string{}
+	var lastErr error
+	for _, token := range c.tokenPool.All() {
+		updates, err := c.GetUpdates(c.urlPool.Get(), token)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, update := range updates {
+			for _, msg := range update.messages() {
+				if !chatMatches(msg.Chat, chatID) {
+					continue
+				}
+				collectTopic(topics, msg)
+				if msg.ReplyToMessage != nil {
+					collectTopic(topics, msg.ReplyToMessage)
+				}
+			}
+		}
+	}
+	if len(topics) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	list := make([]ForumTopic, 0, len(topics))
+	for threadID, name := range topics {
+		if name == "" {
+			name = fmt.Sprintf("Topic %d", threadID)
+		}
+		list = append(list, ForumTopic{ThreadID: threadID, Name: name})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ThreadID < list[j].ThreadID
+	})
+	return list, nil
+}
+
+func collectTopic(topics map[int]string, msg *Message) {
+	if msg.MessageThreadID == 0 || !msg.IsTopicMessage && msg.ForumTopicCreated == nil {
+		return
+	}
+	name := topics[msg.MessageThreadID]
+	if msg.ForumTopicCreated != nil {
+		name = msg.ForumTopicCreated.Name
+	}
+	if msg.ForumTopicEdited != nil && msg.ForumTopicEdited.Name != "" {
+		name = msg.ForumTopicEdited.Name
+	}
+	topics[msg.MessageThreadID] = name
+}
+
+func chatMatches(chat Chat, chatID string) bool {
+	if strconv.FormatInt(chat.ID, 10) == chatID {
+		return true
+	}
+	return chat.Username != "" && "@"+chat.Username == chatID
+}
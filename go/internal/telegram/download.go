@@ -0,0 +1,163 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/mockapi"
+	"github.com/valyala/fasthttp"
+)
+
+// RemoteFile is the reply of getFile. With a local Bot API server (--local)
+// FilePath is an absolute path on the server's disk.
+type RemoteFile struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size"`
+	FilePath string `json:"file_path"`
+}
+
+// Download saves the file with fileID at dest and returns its size. It is
+// written to dest.part first, so dest only appears once complete. A file_id
+// is only valid for the bot that received it, so every token is tried until
+// one resolves it. The cloud Bot API serves files of at most 20 MB.
+func (c *Client) Download(ctx context.Context, fileID string, dest string, retry RetryConfig) (int64, error) {
+	if retry.MaxRetries <= 0 {
+		retry.MaxRetries = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= retry.MaxRetries; attempt++ {
+		size, err := c.downloadTo(ctx, fileID, dest)
+		if err == nil {
+			return size, nil
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		lastErr = err
+		var badRequest *ErrBadRequest
+		if errors.As(err, &badRequest) || IsPermanent(err) {
+			break
+		}
+		if attempt < retry.MaxRetries && !sleepContext(ctx, retry.Delay) {
+			return 0, ctx.Err()
+		}
+	}
+	return 0, lastErr
+}
+
+func (c *Client) downloadTo(ctx context.Context, fileID string, dest string) (int64, error) {
+	partPath := dest + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return 0, err
+	}
+	size, err := c.downloadOnce(ctx, fileID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partPath, dest)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return 0, err
+	}
+	return size, nil
+}
+
+func (c *Client) downloadOnce(ctx context.Context, fileID string, w io.Writer) (int64, error) {
+	apiURL := c.urlPool.Get()
+	tokens := c.tokenPool.All()
+	if apiURL == "" || len(tokens) == 0 {
+		return 0, fmt.Errorf("no available api url or token")
+	}
+	form := url.Values{}
+	form.Set("file_id", fileID)
+	var lastErr error
+	for _, token := range tokens {
+		result, err := c.doTokenRequest(ctx, apiURL, token, "/getFile", form)
+		if err != nil {
+			// A file_id from another bot is a bad request for this one.
+			var badRequest *ErrBadRequest
+			if errors.As(err, &badRequest) {
+				lastErr = err
+				continue
+			}
+			return 0, err
+		}
+		var remote RemoteFile
+		if err := json.Unmarshal(result, &remote); err != nil {
+			return 0, err
+		}
+		if remote.FilePath == "" {
+			return 0, fmt.Errorf("getFile returned no file_path for %s", fileID)
+		}
+		if filepath.IsAbs(remote.FilePath) {
+			return copyLocalFile(remote.FilePath, w)
+		}
+		return c.get(ctx, apiURL, mockapi.Endpoint(apiURL)+"/file/bot"+token+"/"+remote.FilePath, w)
+	}
+	return 0, lastErr
+}
+
+func copyLocalFile(path string, w io.Writer) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.Copy(w, file)
+}
+
+// get downloads fileURL of apiURL into w, returning early when ctx is done
+// like post. Downloads count as method "file" in the latency stats.
+func (c *Client) get(ctx context.Context, apiURL string, fileURL string, w io.Writer) (int64, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	release := func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}
+	req.SetRequestURI(fileURL)
+	req.Header.SetMethod("GET")
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		if deadline, ok := ctx.Deadline(); ok {
+			done <- c.client.DoDeadline(req, resp, deadline)
+			return
+		}
+		done <- c.client.Do(req, resp)
+	}()
+
+	select {
+	case err := <-done:
+		defer release()
+		if err != nil {
+			latency.record(apiURL, "file", time.Since(started), 0, 0, OutcomeNetwork)
+			return 0, err
+		}
+		if resp.StatusCode() != fasthttp.StatusOK {
+			latency.record(apiURL, "file", time.Since(started), 0, int64(len(resp.Body())), OutcomeAPIError)
+			return 0, fmt.Errorf("file download failed: HTTP %d", resp.StatusCode())
+		}
+		latency.record(apiURL, "file", time.Since(started), 0, int64(len(resp.Body())), OutcomeOK)
+		n, err := w.Write(resp.Body())
+		return int64(n), err
+	case <-ctx.Done():
+		latency.record(apiURL, "file", time.Since(started), 0, 0, OutcomeCanceled)
+		go func() {
+			<-done
+			release()
+		}()
+		return 0, ctx.Err()
+	}
+}
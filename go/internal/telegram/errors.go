@@ -0,0 +1,130 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIError is a Bot API reply with ok=false.
+type APIError struct {
+	Code        int
+	Description string
+	RetryAfter  int
+}
+
+func (e *APIError) Error() string {
+	return "telegram request failed: " + e.Description
+}
+
+// permanentDescriptions are error descriptions that will not change on a
+// retry: the chat is gone or closed to the bot, or the file is rejected.
+var permanentDescriptions = []string{
+	"chat not found",
+	"bot was blocked",
+	"bot was kicked",
+	"bot is not a member",
+	"user is deactivated",
+	"have no rights to send",
+	"not enough rights",
+	"message thread not found",
+	"file is too big",
+	"request entity too large",
+	"photo_invalid_dimensions",
+	"image_process_failed",
+	"message is not modified",
+	"message to edit not found",
+	"message can't be edited",
+}
+
+// Permanent reports whether retrying the same request cannot succeed.
+// Rejected tokens (401/404) are not permanent: the token is dropped and
+// another one may still send.
+func (e *APIError) Permanent() bool {
+	switch e.Code {
+	case 403, 413:
+		return true
+	case 401, 404, 429:
+		return false
+	}
+	description := strings.ToLower(e.Description)
+	for _, text := range permanentDescriptions {
+		if strings.Contains(description, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrFloodWait is a 429 reply; sends to the chat are paused for RetryAfter.
+type ErrFloodWait struct {
+	*APIError
+	RetryAfter time.Duration
+}
+
+func (e *ErrFloodWait) Unwrap() error { return e.APIError }
+
+// ErrTooBig is a reply rejecting a file over Telegram's size limit.
+type ErrTooBig struct{ *APIError }
+
+func (e *ErrTooBig) Unwrap() error { return e.APIError }
+
+// ErrUnauthorized is a 401/404 reply: the token was rejected and has been
+// taken out of the pool.
+type ErrUnauthorized struct{ *APIError }
+
+func (e *ErrUnauthorized) Unwrap() error { return e.APIError }
+
+// ErrBadRequest is any other 400 reply; Description says what was wrong.
+type ErrBadRequest struct{ *APIError }
+
+func (e *ErrBadRequest) Unwrap() error { return e.APIError }
+
+// classify wraps e in the most specific error type for its reply.
+func (e *APIError) classify() error {
+	description := strings.ToLower(e.Description)
+	switch {
+	case e.Code == 429:
+		return &ErrFloodWait{APIError: e, RetryAfter: time.Duration(e.RetryAfter) * time.Second}
+	case e.Code == 413 || strings.Contains(description, "file is too big") || strings.Contains(description, "request entity too large"):
+		return &ErrTooBig{e}
+	case e.Code == 401 || e.Code == 404:
+		return &ErrUnauthorized{e}
+	case e.Code == 400:
+		return &ErrBadRequest{e}
+	}
+	return e
+}
+
+// ErrorClass names the kind of a send error for summaries: flood_wait,
+// too_big, unauthorized, bad_request or api, and "" for errors that did not
+// come from the Bot API (network, local files).
+func ErrorClass(err error) string {
+	var (
+		floodWait    *ErrFloodWait
+		tooBig       *ErrTooBig
+		unauthorized *ErrUnauthorized
+		badRequest   *ErrBadRequest
+		apiErr       *APIError
+	)
+	switch {
+	case errors.As(err, &floodWait):
+		return "flood_wait"
+	case errors.As(err, &tooBig):
+		return "too_big"
+	case errors.As(err, &unauthorized):
+		return "unauthorized"
+	case errors.As(err, &badRequest):
+		return "bad_request"
+	case errors.As(err, &apiErr):
+		return "api"
+	}
+	return ""
+}
+
+// IsPermanent reports whether err is, or wraps, an APIError that retrying
+// cannot fix.
+func IsPermanent(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Permanent()
+}
@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// floodControl records Telegram's retry_after per chat. It is shared by every
+// client in the process, so a 429 seen by one worker or token pauses all
+// sends to that chat instead of only the failing request.
+type floodControl struct {
+	mu       sync.Mutex
+	until    map[string]time.Time
+	watchers map[int]func(chatID string, wait time.Duration)
+	nextID   int
+}
+
+var flood = &floodControl{
+	until:    map[string]time.Time{},
+	watchers: map[int]func(chatID string, wait time.Duration){},
+}
+
+func (f *floodControl) pause(chatID string, wait time.Duration) {
+	until := time.Now().Add(wait)
+	f.mu.Lock()
+	if !until.After(f.until[chatID]) {
+		f.mu.Unlock()
+		return
+	}
+	f.until[chatID] = until
+	watchers := make([]func(string, time.Duration), 0, len(f.watchers))
+	for _, fn := range f.watchers {
+		watchers = append(watchers, fn)
+	}
+	f.mu.Unlock()
+
+	log.Printf("flood control: Telegram asked to retry after %s; pausing all sends to chat %s", wait, chatID)
+	for _, fn := range watchers {
+		fn(chatID, wait)
+	}
+}
+
+func (f *floodControl) remaining(chatID string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	until, ok := f.until[chatID]
+	if !ok {
+		return 0
+	}
+	left := time.Until(until)
+	if left <= 0 {
+		delete(f.until, chatID)
+		return 0
+	}
+	return left
+}
+
+// wait blocks until sends to chatID are allowed again; it returns false if
+// ctx ends first.
+func (f *floodControl) wait(ctx context.Context, chatID string) bool {
+	for {
+		left := f.remaining(chatID)
+		if left <= 0 {
+			return true
+		}
+		if !sleepContext(ctx, left) {
+			return false
+		}
+	}
+}
+
+// FloodWait returns how much longer sends to chatID are paused by a
+// retry_after, or 0.
+func FloodWait(chatID string) time.Duration {
+	return flood.remaining(chatID)
+}
+
+// WatchFlood calls fn whenever a retry_after pauses sends to a chat. The
+// returned function stops the calls.
+func WatchFlood(fn func(chatID string, wait time.Duration)) func() {
+	flood.mu.Lock()
+	defer flood.mu.Unlock()
+	id := flood.nextID
+	flood.nextID++
+	flood.watchers[id] = fn
+	return func() {
+		flood.mu.Lock()
+		defer flood.mu.Unlock()
+		delete(flood.watchers, id)
+	}
+}
@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many recent durations are kept per endpoint and
+// method for percentiles.
+const latencySamples = 1024
+
+// Request outcomes counted by RequestStats.
+const (
+	OutcomeOK        = "ok"
+	OutcomeAPIError  = "api_error"
+	OutcomeFloodWait = "flood_wait"
+	OutcomeNetwork   = "network_error"
+	OutcomeCanceled  = "canceled"
+)
+
+type requestKey struct {
+	endpoint string
+	method   string
+}
+
+type requestCounters struct {
+	requests      int64
+	outcomes      map[string]int64
+	bytesSent     int64
+	bytesReceived int64
+	// busy is the time spent in requests that succeeded, for throughput.
+	busy    time.Duration
+	max     time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// requestLatency records every request the clients of the process make,
+// like usage does for chats.
+type requestLatency struct {
+	mu    sync.Mutex
+	stats map[requestKey]*requestCounters
+}
+
+var latency = &requestLatency{stats: map[requestKey]*requestCounters{}}
+
+func (l *requestLatency) record(endpoint string, method string, took time.Duration, sent int64, received int64, outcome string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := requestKey{endpoint: endpoint, method: method}
+	counters, ok := l.stats[key]
+	if !ok {
+		counters = &requestCounters{outcomes: map[string]int64{}}
+		l.stats[key] = counters
+	}
+	counters.requests++
+	counters.outcomes[outcome]++
+	counters.bytesSent += sent
+	counters.bytesReceived += received
+	if outcome == OutcomeOK {
+		counters.busy += took
+	}
+	counters.max = max(counters.max, took)
+	if len(counters.samples) < latencySamples {
+		counters.samples = append(counters.samples, took)
+	} else {
+		counters.samples[counters.next] = took
+		counters.next = (counters.next + 1) % latencySamples
+	}
+}
+
+// RequestStats summarises the requests made to one endpoint, for one method
+// or, from EndpointStats, for all of them. Percentiles cover the most
+// recent requests; Throughput is the bytes sent per second of successful
+// requests.
+type RequestStats struct {
+	Endpoint      string           `json:"endpoint"`
+	Method        string           `json:"method,omitempty"`
+	Requests      int64            `json:"requests"`
+	Outcomes      map[string]int64 `json:"outcomes"`
+	BytesSent     int64            `json:"bytes_sent"`
+	BytesReceived int64            `json:"bytes_received"`
+	Throughput    float64          `json:"throughput_bytes_per_second"`
+	P50           time.Duration    `json:"p50_ns"`
+	P90           time.Duration    `json:"p90_ns"`
+	P99           time.Duration    `json:"p99_ns"`
+	Max           time.Duration    `json:"max_ns"`
+}
+
+// Failures counts the requests that did not succeed.
+func (s RequestStats) Failures() int64 {
+	return s.Requests - s.Outcomes[OutcomeOK]
+}
+
+// RequestLatency returns the stats of every endpoint and method used in
+// this process, sorted by endpoint and method.
+func RequestLatency() []RequestStats {
+	return latency.snapshot(false)
+}
+
+// EndpointStats returns the stats of every endpoint used in this process
+// over all methods, sorted by endpoint.
+func EndpointStats() []RequestStats {
+	return latency.snapshot(true)
+}
+
+func (l *requestLatency) snapshot(byEndpoint bool) []RequestStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	type merged struct {
+		stats   RequestStats
+		busy    time.Duration
+		samples []time.Duration
+	}
+	groups := map[requestKey]*merged{}
+	for key, counters := range l.stats {
+		if byEndpoint {
+			key.method = ""
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &merged{stats: RequestStats{Endpoint: key.endpoint, Method: key.method, Outcomes: map[string]int64{}}}
+			groups[key] = group
+		}
+		group.stats.Requests += counters.requests
+		group.stats.BytesSent += counters.bytesSent
+		group.stats.BytesReceived += counters.bytesReceived
+		group.stats.Max = max(group.stats.Max, counters.max)
+		for outcome, count := range counters.outcomes {
+			group.stats.Outcomes[outcome] += count
+		}
+		group.busy += counters.busy
+		group.samples = append(group.samples, counters.samples...)
+	}
+	result := make([]RequestStats, 0, len(groups))
+	for _, group := range groups {
+		stats := group.stats
+		if group.busy > 0 {
+			stats.Throughput = float64(stats.BytesSent) / group.busy.Seconds()
+		}
+		sort.Slice(group.samples, func(i, j int) bool { return group.samples[i] < group.samples[j] })
+		stats.P50 = percentile(group.samples, 50)
+		stats.P90 = percentile(group.samples, 90)
+		stats.P99 = percentile(group.samples, 99)
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Endpoint != result[j].Endpoint {
+			return result[i].Endpoint < result[j].Endpoint
+		}
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
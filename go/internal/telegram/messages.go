@@ -0,0 +1,199 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Telegram polls have 2-10 options.
+const (
+	MinPollOptions = 2
+	MaxPollOptions = 10
+)
+
+// Poll is a poll for SendPoll. Telegram makes polls anonymous unless told
+// otherwise.
+type Poll struct {
+	Question        string
+	Options         []string
+	Anonymous       bool
+	MultipleAnswers bool
+}
+
+// Location is a point for SendLocation. LivePeriod, in seconds, makes it a
+// live location that can be updated for that long (60-86400).
+type Location struct {
+	Latitude   float64
+	Longitude  float64
+	LivePeriod int
+}
+
+// InlineButton is a button under a message that opens URL or, with
+// CallbackData, reports a press to the bot.
+type InlineButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+// InlineKeyboard is rows of buttons attached to a message.
+type InlineKeyboard [][]InlineButton
+
+// ParseInlineKeyboard reads a keyboard given as JSON rows of buttons, like
+// [[{"text":"Open","url":"https://example.com"}]]. Every button needs a
+// text and either a url or callback_data.
+func ParseInlineKeyboard(value string) (InlineKeyboard, error) {
+	var keyboard InlineKeyboard
+	if err := json.Unmarshal([]byte(value), &keyboard); err != nil {
+		return nil, fmt.Errorf("buttons must be JSON rows of buttons: %w", err)
+	}
+	if len(keyboard) == 0 {
+		return nil, errors.New("buttons has no rows")
+	}
+	for i, row := range keyboard {
+		if len(row) == 0 {
+			return nil, fmt.Errorf("buttons row %d is empty", i+1)
+		}
+		for _, button := range row {
+			if button.Text == "" {
+				return nil, fmt.Errorf("a button in row %d has no text", i+1)
+			}
+			if (button.URL == "") == (button.CallbackData == "") {
+				return nil, fmt.Errorf("button %q needs either a url or callback_data", button.Text)
+			}
+		}
+	}
+	return keyboard, nil
+}
+
+// SendMessageButtons sends a text message with buttons under it, when
+// buttons is not empty, and returns its message ID.
+func (c *Client) SendMessageButtons(ctx context.Context, chatID string, text string, buttons InlineKeyboard, topicID *int, retry RetryConfig) (int, error) {
+	chatID, topicID = c.sandbox("/sendMessage", chatID, topicID)
+	form := c.messageForm(chatID, topicID)
+	form.Set("text", text)
+	if err := setButtons(form, buttons); err != nil {
+		return 0, err
+	}
+	return c.sendForm(ctx, chatID, "/sendMessage", form, retry)
+}
+
+// EditMessageText replaces the text of message messageID, and its buttons
+// when buttons is not empty. Setting the text it already has succeeds.
+func (c *Client) EditMessageText(ctx context.Context, chatID string, messageID int, text string, buttons InlineKeyboard, retry RetryConfig) error {
+	form := url.Values{}
+	form.Set("text", text)
+	return c.editMessage(ctx, chatID, messageID, "/editMessageText", form, buttons, retry)
+}
+
+// EditMessageCaption replaces the caption of media message messageID, and
+// its buttons when buttons is not empty. An empty caption removes it.
+func (c *Client) EditMessageCaption(ctx context.Context, chatID string, messageID int, caption string, buttons InlineKeyboard, retry RetryConfig) error {
+	form := url.Values{}
+	form.Set("caption", caption)
+	return c.editMessage(ctx, chatID, messageID, "/editMessageCaption", form, buttons, retry)
+}
+
+func (c *Client) editMessage(ctx context.Context, chatID string, messageID int, method string, form url.Values, buttons InlineKeyboard, retry RetryConfig) error {
+	chatID, _ = c.sandbox("", chatID, nil)
+	form.Set("chat_id", chatID)
+	form.Set("message_id", strconv.Itoa(messageID))
+	if err := setButtons(form, buttons); err != nil {
+		return err
+	}
+	_, err := c.doRequest(ctx, chatID, method, bytesBody([]byte(form.Encode())), "application/x-www-form-urlencoded", retry)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && strings.Contains(strings.ToLower(apiErr.Description), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// SendPoll posts a poll and returns its message ID.
+func (c *Client) SendPoll(ctx context.Context, chatID string, poll Poll, topicID *int, retry RetryConfig) (int, error) {
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return 0, fmt.Errorf("a poll needs %d-%d options, got %d", MinPollOptions, MaxPollOptions, len(poll.Options))
+	}
+	chatID, topicID = c.sandbox("/sendPoll", chatID, topicID)
+	options, err := json.Marshal(poll.Options)
+	if err != nil {
+		return 0, err
+	}
+	form := c.messageForm(chatID, topicID)
+	form.Set("question", poll.Question)
+	form.Set("options", string(options))
+	form.Set("is_anonymous", strconv.FormatBool(poll.Anonymous))
+	if poll.MultipleAnswers {
+		form.Set("allows_multiple_answers", "true")
+	}
+	return c.sendForm(ctx, chatID, "/sendPoll", form, retry)
+}
+
+// SendLocation posts a map point and returns its message ID.
+func (c *Client) SendLocation(ctx context.Context, chatID string, location Location, topicID *int, retry RetryConfig) (int, error) {
+	if location.Latitude < -90 || location.Latitude > 90 || location.Longitude < -180 || location.Longitude > 180 {
+		return 0, fmt.Errorf("location %g,%g is out of range", location.Latitude, location.Longitude)
+	}
+	chatID, topicID = c.sandbox("/sendLocation", chatID, topicID)
+	form := c.messageForm(chatID, topicID)
+	form.Set("latitude", strconv.FormatFloat(location.Latitude, 'f', -1, 64))
+	form.Set("longitude", strconv.FormatFloat(location.Longitude, 'f', -1, 64))
+	if location.LivePeriod > 0 {
+		form.Set("live_period", strconv.Itoa(location.LivePeriod))
+	}
+	return c.sendForm(ctx, chatID, "/sendLocation", form, retry)
+}
+
+// setButtons attaches buttons to form as its reply_markup.
+func setButtons(form url.Values, buttons InlineKeyboard) error {
+	if len(buttons) == 0 {
+		return nil
+	}
+	markup, err := json.Marshal(map[string]InlineKeyboard{"inline_keyboard": buttons})
+	if err != nil {
+		return err
+	}
+	form.Set("reply_markup", string(markup))
+	return nil
+}
+
+// messageForm starts the form of a non-file message with the chat, topic
+// and the client's send options.
+func (c *Client) messageForm(chatID string, topicID *int) url.Values {
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	if topicID != nil {
+		form.Set("message_thread_id", fmt.Sprintf("%d", *topicID))
+	}
+	if c.options.ProtectContent {
+		form.Set("protect_content", "true")
+	}
+	if c.options.Silent {
+		form.Set("disable_notification", "true")
+	}
+	if c.options.ReplyTo != 0 {
+		form.Set("reply_to_message_id", strconv.Itoa(c.options.ReplyTo))
+		form.Set("allow_sending_without_reply", "true")
+	}
+	return form
+}
+
+// sendForm posts form to method and returns the ID of the message sent.
+func (c *Client) sendForm(ctx context.Context, chatID string, method string, form url.Values, retry RetryConfig) (int, error) {
+	result, err := c.doRequest(ctx, chatID, method, bytesBody([]byte(form.Encode())), "application/x-www-form-urlencoded", retry)
+	if err != nil {
+		return 0, err
+	}
+	var message struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := json.Unmarshal(result, &message); err != nil {
+		return 0, err
+	}
+	return message.MessageID, nil
+}
@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Token pinning modes for SendOptions.TokenPinning. With several tokens the
+// pool normally picks the least used one per request, so the items of an
+// album retry or of one folder can come from different bots and interleave.
+const (
+	TokenPinningOff = "off"
+	// TokenPinningGroup sends each album, including its per-item fallback,
+	// through one token.
+	TokenPinningGroup = "group"
+	// TokenPinningFolder sends everything from one source folder or zip
+	// through one token; callers mark folders with PinFolder.
+	TokenPinningFolder = "folder"
+)
+
+func ParseTokenPinning(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "":
+		return TokenPinningOff, nil
+	case TokenPinningOff, TokenPinningGroup, TokenPinningFolder:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid token pinning %q (use off, group or folder)", value)
+}
+
+// Pick returns the token key hashes to, so the same key keeps using the same
+// token while the pool is unchanged. Keys spread evenly over the tokens.
+func (p *TokenPool) Pick(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return p.tokens[hash.Sum32()%uint32(len(p.tokens))]
+}
+
+// PinToken returns a client sharing c's pools that sends every request
+// through the token key hashes to. An empty key returns c.
+func (c *Client) PinToken(key string) *Client {
+	if key == "" || c.pin == key {
+		return c
+	}
+	clone := *c
+	clone.pin = key
+	return &clone
+}
+
+// PinFolder pins the token to folder when folder pinning is enabled and
+// returns c otherwise.
+func (c *Client) PinFolder(folder string) *Client {
+	if c.options.TokenPinning != TokenPinningFolder {
+		return c
+	}
+	return c.PinToken("folder:" + folder)
+}
+
+// pinGroup pins an album to one token when group pinning is enabled and no
+// folder pin is set.
+func (c *Client) pinGroup(chatID string, media []MediaFile) *Client {
+	if c.options.TokenPinning != TokenPinningGroup || c.pin != "" || len(media) == 0 {
+		return c
+	}
+	return c.PinToken("group:" + chatID + "/" + media[0].Filename)
+}
+
+// token returns the token for the next request.
+func (c *Client) token() string {
+	if c.pin != "" {
+		return c.tokenPool.Pick(c.pin)
+	}
+	return c.tokenPool.Get()
+}
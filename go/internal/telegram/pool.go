@@ -1,17 +1,37 @@
 package telegram
 
 import (
+	"log"
 	"math/rand"
 	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	urlFailureThreshold = 3
+	urlEjectBase        = 30 * time.Second
+	urlEjectMax         = 10 * time.Minute
+)
+
+// urlHealth tracks one API endpoint. After urlFailureThreshold consecutive
+// failures the endpoint is ejected; once the ejection expires it is probed
+// and restored on success, or ejected again for twice as long.
+type urlHealth struct {
+	failures     int
+	latency      time.Duration
+	ejections    int
+	ejectedUntil time.Time
+	probing      bool
+}
+
 type URLPool struct {
-	mu     sync.Mutex
-	urls   []string
-	counts map[string]int
-	rng    *rand.Rand
+	mu        sync.Mutex
+	urls      []string
+	counts    map[string]int
+	health    map[string]*urlHealth
+	preferred []string
+	rng       *rand.Rand
 }
 
 func NewURLPool(urls []string) *URLPool {
@@ -25,19 +45,54 @@ func NewURLPool(urls []string) *URLPool {
 	return &URLPool{
 		urls:   normalized,
 		counts: map[string]int{},
+		health: map[string]*urlHealth{},
 		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// SetPreferred sets URLs that are used, in order, whenever they are healthy.
+// Preferred URLs missing from the pool are added.
+func (p *URLPool) SetPreferred(urls []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.preferred = nil
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		p.preferred = append(p.preferred, url)
+		found := false
+		for _, entry := range p.urls {
+			if entry == url {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.urls = append(p.urls, url)
+		}
+	}
+}
+
 func (p *URLPool) Get() string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if len(p.urls) == 0 {
 		return ""
 	}
+	for _, url := range p.preferred {
+		if p.healthyLocked(url) {
+			return url
+		}
+	}
+
 	min := int(^uint(0) >> 1)
 	candidates := []string{}
 	for _, url := range p.urls {
+		if !p.healthyLocked(url) {
+			continue
+		}
 		count := p.counts[url]
 		if count < min {
 			min = count
@@ -46,7 +101,44 @@ func (p *URLPool) Get() string {
 			candidates = append(candidates, url)
 		}
 	}
-	return candidates[p.rng.Intn(len(candidates))]
+	if len(candidates) == 0 {
+		// Every endpoint is ejected; use the one closest to recovery rather
+		// than failing outright.
+		best := p.urls[0]
+		for _, url := range p.urls[1:] {
+			if p.health[url].ejectedUntil.Before(p.health[best].ejectedUntil) {
+				best = url
+			}
+		}
+		return best
+	}
+	return p.fastestLocked(candidates)
+}
+
+func (p *URLPool) healthyLocked(url string) bool {
+	health := p.health[url]
+	return health == nil || health.ejectedUntil.IsZero()
+}
+
+// fastestLocked picks the lowest-latency candidate; endpoints without a
+// measurement yet are picked at random first.
+func (p *URLPool) fastestLocked(candidates []string) string {
+	unmeasured := []string{}
+	best := ""
+	for _, url := range candidates {
+		health := p.health[url]
+		if health == nil || health.latency == 0 {
+			unmeasured = append(unmeasured, url)
+			continue
+		}
+		if best == "" || health.latency < p.health[best].latency {
+			best = url
+		}
+	}
+	if len(unmeasured) > 0 {
+		return unmeasured[p.rng.Intn(len(unmeasured))]
+	}
+	return best
 }
 
 func (p *URLPool) Increment(url string) {
@@ -58,6 +150,78 @@ func (p *URLPool) Increment(url string) {
 	p.counts[url] = p.counts[url] + 1
 }
 
+// ReportSuccess records a completed round trip and restores an ejected URL.
+func (p *URLPool) ReportSuccess(url string, latency time.Duration) {
+	if url == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health := p.healthLocked(url)
+	if !health.ejectedUntil.IsZero() {
+		log.Printf("api url %s recovered", url)
+	}
+	health.failures = 0
+	health.ejections = 0
+	health.ejectedUntil = time.Time{}
+	health.probing = false
+	if health.latency == 0 {
+		health.latency = latency
+	} else {
+		health.latency = (health.latency*7 + latency) / 8
+	}
+}
+
+// ReportFailure records a transport-level failure (connection error or a
+// non-API response) and ejects the URL after repeated failures.
+func (p *URLPool) ReportFailure(url string) {
+	if url == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health := p.healthLocked(url)
+	health.failures++
+	health.probing = false
+	if health.failures < urlFailureThreshold && health.ejections == 0 {
+		return
+	}
+	eject := urlEjectBase << health.ejections
+	if eject > urlEjectMax || eject <= 0 {
+		eject = urlEjectMax
+	}
+	health.ejections++
+	health.ejectedUntil = time.Now().Add(eject)
+	log.Printf("api url %s ejected for %s after %d failure(s)", url, eject, health.failures)
+}
+
+// ProbeCandidates returns ejected URLs whose ejection has expired and marks
+// them as being probed.
+func (p *URLPool) ProbeCandidates() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	urls := []string{}
+	for _, url := range p.urls {
+		health := p.health[url]
+		if health == nil || health.ejectedUntil.IsZero() || health.probing || now.Before(health.ejectedUntil) {
+			continue
+		}
+		health.probing = true
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+func (p *URLPool) healthLocked(url string) *urlHealth {
+	health := p.health[url]
+	if health == nil {
+		health = &urlHealth{}
+		p.health[url] = health
+	}
+	return health
+}
+
 func (p *URLPool) Remove(url string) {
 	if url == "" {
 		return
@@ -71,6 +235,7 @@ func (p *URLPool) Remove(url string) {
 		}
 	}
 	delete(p.counts, url)
+	delete(p.health, url)
 	p.urls = filtered
 }
 
@@ -116,6 +281,12 @@ func (p *TokenPool) Get() string {
 	return candidates[p.rng.Intn(len(candidates))]
 }
 
+func (p *TokenPool) All() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.tokens...)
+}
+
 func (p *TokenPool) Increment(token string) {
 	if token == "" {
 		return
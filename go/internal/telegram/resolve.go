@@ -0,0 +1,139 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ChatRef is a chat as a user may give it: a numeric ID, an @username, a
+// t.me link to a public chat or message, a t.me/c/ link to a private one,
+// or an invite link.
+type ChatRef struct {
+	// ID is the form the Bot API takes, a numeric ID or @username; it is
+	// empty for invite links.
+	ID string
+	// Invite is the hash of an invite link.
+	Invite string
+}
+
+// Numeric reports whether the reference is already a numeric chat ID.
+func (r ChatRef) Numeric() bool {
+	_, err := strconv.ParseInt(r.ID, 10, 64)
+	return err == nil
+}
+
+// Key identifies the reference for caching.
+func (r ChatRef) Key() string {
+	if r.Invite != "" {
+		return "invite:" + r.Invite
+	}
+	return strings.ToLower(r.ID)
+}
+
+// ParseChatRef reads value as a chat reference.
+func ParseChatRef(value string) (ChatRef, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ChatRef{}, errors.New("empty chat ID")
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ChatRef{ID: value}, nil
+	}
+	if strings.HasPrefix(value, "@") {
+		return ChatRef{ID: value}, nil
+	}
+	if strings.HasPrefix(value, "tg://") {
+		parsed, err := url.Parse(value)
+		if err == nil && parsed.Host == "resolve" && parsed.Query().Get("domain") != "" {
+			return ChatRef{ID: "@" + parsed.Query().Get("domain")}, nil
+		}
+		if err == nil && parsed.Host == "join" && parsed.Query().Get("invite") != "" {
+			return ChatRef{Invite: parsed.Query().Get("invite")}, nil
+		}
+		return ChatRef{}, fmt.Errorf("unsupported chat link %s", value)
+	}
+	link := value
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || !isTelegramHost(parsed.Host) {
+		return ChatRef{}, fmt.Errorf("chat ID %q is not a numeric ID, @username or t.me link", value)
+	}
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+	case strings.HasPrefix(parts[0], "+"):
+		return ChatRef{Invite: strings.TrimPrefix(parts[0], "+")}, nil
+	case parts[0] == "joinchat" && len(parts) > 1:
+		return ChatRef{Invite: parts[1]}, nil
+	case parts[0] == "c" && len(parts) > 1:
+		// t.me/c/<id>/<message> links name private supergroups and
+		// channels by their ID without the -100 prefix.
+		if _, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+			return ChatRef{ID: "-100" + parts[1]}, nil
+		}
+	case parts[0] == "s" && len(parts) > 1:
+		return ChatRef{ID: "@" + parts[1]}, nil
+	default:
+		return ChatRef{ID: "@" + parts[0]}, nil
+	}
+	return ChatRef{}, fmt.Errorf("chat link %s names no chat", value)
+}
+
+func isTelegramHost(host string) bool {
+	switch strings.ToLower(strings.TrimPrefix(host, "www.")) {
+	case "t.me", "telegram.me", "telegram.dog":
+		return true
+	}
+	return false
+}
+
+// ResolveChat looks up the chat value refers to. Invite links cannot be
+// looked up directly; they are matched against the invite links of the
+// chats seen in the bots' recent updates.
+func (c *Client) ResolveChat(ctx context.Context, value string) (*Chat, error) {
+	ref, err := ParseChatRef(value)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Invite != "" {
+		return c.resolveInvite(ref.Invite, value)
+	}
+	chat, err := c.GetChatContext(ctx, ref.ID)
+	if err == nil {
+		return chat, nil
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return nil, err
+	}
+	description := strings.ToLower(apiErr.Description)
+	switch {
+	case apiErr.Code == 403 || strings.Contains(description, "not a member") || strings.Contains(description, "kicked"):
+		return nil, fmt.Errorf("the bot is not a member of %s; add it to the chat: %w", value, err)
+	case strings.Contains(description, "chat not found"):
+		return nil, fmt.Errorf("chat %s not found: check the ID or username; private chats and groups without a username only resolve once the bot is a member: %w", value, err)
+	}
+	return nil, err
+}
+
+func (c *Client) resolveInvite(hash string, value string) (*Chat, error) {
+	chats, err := c.DiscoverChats()
+	if err != nil {
+		return nil, fmt.Errorf("resolve invite link %s: %w", value, err)
+	}
+	for _, chat := range chats {
+		if chat.InviteLink == "" {
+			continue
+		}
+		if ref, err := ParseChatRef(chat.InviteLink); err == nil && ref.Invite == hash {
+			return &chat, nil
+		}
+	}
+	return nil, fmt.Errorf("no chat the bot is in has invite link %s; bots cannot join by invite link, so add the bot to the chat, post a message there and retry, or use the chat's numeric ID", value)
+}
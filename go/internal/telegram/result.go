@@ -0,0 +1,64 @@
+package telegram
+
+// Result describes what a send delivered: one message per file, in order.
+type Result struct {
+	MessageIDs []int
+	// FileIDs are Telegram's file_id of each uploaded file; they can be
+	// passed to getFile to download the content again.
+	FileIDs []string
+}
+
+func (r *Result) add(other Result) {
+	r.MessageIDs = append(r.MessageIDs, other.MessageIDs...)
+	r.FileIDs = append(r.FileIDs, other.FileIDs...)
+}
+
+// item returns the part of an album result that belongs to its i-th file.
+func (r Result) item(i int) Result {
+	var item Result
+	if i < len(r.MessageIDs) {
+		item.MessageIDs = []int{r.MessageIDs[i]}
+	}
+	if i < len(r.FileIDs) {
+		item.FileIDs = []string{r.FileIDs[i]}
+	}
+	return item
+}
+
+type fileRef struct {
+	FileID string `json:"file_id"`
+}
+
+// sentMessage is the part of a Message the client reads back.
+type sentMessage struct {
+	MessageID int       `json:"message_id"`
+	Photo     []fileRef `json:"photo"`
+	Video     *fileRef  `json:"video"`
+	Document  *fileRef  `json:"document"`
+	Audio     *fileRef  `json:"audio"`
+}
+
+// fileID returns the uploaded file's ID; for photos that is the largest
+// size, which Telegram lists last.
+func (m sentMessage) fileID() string {
+	switch {
+	case len(m.Photo) > 0:
+		return m.Photo[len(m.Photo)-1].FileID
+	case m.Video != nil:
+		return m.Video.FileID
+	case m.Document != nil:
+		return m.Document.FileID
+	case m.Audio != nil:
+		return m.Audio.FileID
+	}
+	return ""
+}
+
+func resultOf(messages ...sentMessage) Result {
+	var result Result
+	for _, message := range messages {
+		result.MessageIDs = append(result.MessageIDs, message.MessageID)
+		result.FileIDs = append(result.FileIDs, message.fileID())
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// sandbox redirects a send for chatID and topicID to SendOptions.Sandbox,
+// logging the target it would have reached. Topics belong to the real chat
+// and are dropped. Without a sandbox, or for a send already redirected, it
+// returns its arguments.
+func (c *Client) sandbox(method string, chatID string, topicID *int) (string, *int) {
+	if c.options.Sandbox == "" || chatID == c.options.Sandbox {
+		return chatID, topicID
+	}
+	if method != "" {
+		target := chatID
+		if topicID != nil {
+			target += fmt.Sprintf(" topic %d", *topicID)
+		}
+		log.Printf("sandbox: %s for chat %s sent to chat %s", strings.TrimPrefix(method, "/"), target, c.options.Sandbox)
+	}
+	return c.options.Sandbox, nil
+}
@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupMessagesPerMinute is about how many messages one bot may post to
+	// a group or channel per minute before Telegram answers 429.
+	GroupMessagesPerMinute = 20
+	// PrivateMessagesPerMinute is the same for a private chat (about one
+	// message per second).
+	PrivateMessagesPerMinute = 60
+)
+
+// ChatLimit returns the messages per minute one bot may send to chatID.
+// Negative IDs and @usernames are groups and channels.
+func ChatLimit(chatID string) int {
+	if strings.HasPrefix(chatID, "-") || strings.HasPrefix(chatID, "@") {
+		return GroupMessagesPerMinute
+	}
+	return PrivateMessagesPerMinute
+}
+
+// chatUsage remembers when each request to a chat succeeded over the last
+// day. It is shared by every client in the process, like floodControl. An
+// album is one request, which is how Telegram's per-chat limits count it.
+type chatUsage struct {
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+var usage = &chatUsage{sent: map[string][]time.Time{}}
+
+func (u *chatUsage) record(chatID string, at time.Time) {
+	if chatID == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	times := u.sent[chatID]
+	cutoff := at.Add(-24 * time.Hour)
+	drop := 0
+	for drop < len(times) && times[drop].Before(cutoff) {
+		drop++
+	}
+	u.sent[chatID] = append(times[drop:], at)
+}
+
+func (u *chatUsage) counts(chatID string, now time.Time) (int, int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	minute, day := 0, 0
+	for _, at := range u.sent[chatID] {
+		if now.Sub(at) <= 24*time.Hour {
+			day++
+		}
+		if now.Sub(at) <= time.Minute {
+			minute++
+		}
+	}
+	return minute, day
+}
+
+// ChatUsage returns how many requests to chatID succeeded in this process
+// over the last minute and the last 24 hours.
+func ChatUsage(chatID string) (int, int) {
+	return usage.counts(chatID, time.Now())
+}
@@ -0,0 +1,98 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// VerifyTarget checks, for every token in the pool, that chatID exists, the
+// bot may post there and topicID (if set) is a valid forum topic. It returns
+// an error describing every problem found so a misconfigured run fails
+// before any upload starts.
+func (c *Client) VerifyTarget(ctx context.Context, chatID string, topicID *int) error {
+	chatID, topicID = c.sandbox("", chatID, topicID)
+	var problems []error
+	for _, token := range c.tokenPool.All() {
+		if err := c.verifyTargetForToken(ctx, token, chatID, topicID); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func (c *Client) verifyTargetForToken(ctx context.Context, token string, chatID string, topicID *int) error {
+	apiURL := c.urlPool.Get()
+	bot, err := c.getMe(ctx, apiURL, token)
+	if err != nil {
+		return fmt.Errorf("token %s: getMe failed (token rejected?): %w", MaskToken(token), err)
+	}
+	name := "@" + bot.Username
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	result, err := c.doTokenRequest(ctx, apiURL, token, "/getChat", form)
+	if err != nil {
+		return fmt.Errorf("bot %s: chat %s not found or the bot is not a member; add the bot to the chat or fix --chat-id: %w", name, chatID, err)
+	}
+	var chat Chat
+	if err := json.Unmarshal(result, &chat); err != nil {
+		return err
+	}
+
+	form.Set("user_id", strconv.FormatInt(bot.ID, 10))
+	result, err = c.doTokenRequest(ctx, apiURL, token, "/getChatMember", form)
+	if err != nil {
+		return fmt.Errorf("bot %s: cannot read its membership in %s: %w", name, chat.DisplayName(), err)
+	}
+	var member ChatMember
+	if err := json.Unmarshal(result, &member); err != nil {
+		return err
+	}
+	switch {
+	case member.Status == "left" || member.Status == "kicked":
+		return fmt.Errorf("bot %s is not a member of %s (status %s); add it to the chat", name, chat.DisplayName(), member.Status)
+	case chat.Type == "channel" && member.Status != "creator" &&
+		(member.Status != "administrator" || member.CanPostMessages == nil || !*member.CanPostMessages):
+		return fmt.Errorf("bot %s cannot post in channel %s; make it an administrator with the post messages right", name, chat.DisplayName())
+	case member.Status == "restricted" && member.CanSendMessages != nil && !*member.CanSendMessages:
+		return fmt.Errorf("bot %s is restricted from sending messages in %s", name, chat.DisplayName())
+	}
+
+	if topicID == nil {
+		return nil
+	}
+	if !chat.IsForum {
+		return fmt.Errorf("%s has no topics but --topic-id %d was given; drop --topic-id or enable topics", chat.DisplayName(), *topicID)
+	}
+	// The Bot API cannot look up a topic directly; a chat action sent to the
+	// thread fails for unknown topics and posts nothing visible.
+	action := url.Values{}
+	action.Set("chat_id", chatID)
+	action.Set("message_thread_id", strconv.Itoa(*topicID))
+	action.Set("action", "typing")
+	if _, err := c.doTokenRequest(ctx, apiURL, token, "/sendChatAction", action); err != nil {
+		msg := fmt.Sprintf("topic %d not found in %s", *topicID, chat.DisplayName())
+		if topics, derr := c.DiscoverTopics(chatID); derr == nil && len(topics) > 0 {
+			known := make([]string, 0, len(topics))
+			for _, topic := range topics {
+				known = append(known, fmt.Sprintf("%d (%s)", topic.ThreadID, topic.Name))
+			}
+			msg += "; recently seen topics: " + strings.Join(known, ", ")
+		}
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	return nil
+}
+
+// MaskToken keeps the bot ID part of a token for error messages.
+func MaskToken(token string) string {
+	if id, _, ok := strings.Cut(token, ":"); ok {
+		return id + ":***"
+	}
+	return "***"
+}
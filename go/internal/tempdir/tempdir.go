@@ -0,0 +1,77 @@
+// Package tempdir places the temporary files of a run: prepared payloads
+// such as transcoded videos and archive volumes, extracted zip entries and
+// the scratch space of external converters.
+package tempdir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Prefix starts the name of every temporary file and directory created
+// here, so leftovers of an interrupted run can be recognised.
+const Prefix = "telegram-upload-"
+
+// staleAge is how old a leftover must be before Set removes it; a run that
+// is still using a file touches it far more recently.
+const staleAge = 24 * time.Hour
+
+var dir atomic.Value
+
+// Set makes path the directory for temporary files, creating it, and removes
+// leftovers older than a day from it. An empty path selects the system
+// temporary directory.
+func Set(path string) error {
+	if path == "" {
+		dir.Store("")
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(abs, 0o700); err != nil {
+		return err
+	}
+	dir.Store(abs)
+	sweep(abs, time.Now().Add(-staleAge))
+	return nil
+}
+
+// Dir returns the directory for temporary files.
+func Dir() string {
+	if path, _ := dir.Load().(string); path != "" {
+		return path
+	}
+	return os.TempDir()
+}
+
+// MkdirTemp creates a directory named Prefix+pattern in Dir.
+func MkdirTemp(pattern string) (string, error) {
+	return os.MkdirTemp(Dir(), Prefix+pattern)
+}
+
+// CreateTemp creates a file named Prefix+pattern in Dir.
+func CreateTemp(pattern string) (*os.File, error) {
+	return os.CreateTemp(Dir(), Prefix+pattern)
+}
+
+func sweep(path string, before time.Time) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), Prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(before) {
+			continue
+		}
+		os.RemoveAll(filepath.Join(path, entry.Name()))
+	}
+}
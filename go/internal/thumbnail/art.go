@@ -0,0 +1,140 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// albumArt returns the cover picture embedded in an MP3 (ID3v2.3/2.4 APIC)
+// or FLAC (PICTURE block) file, or nil.
+func albumArt(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return id3Picture(data)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return flacPicture(data)
+	}
+	return nil
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func id3Picture(data []byte) []byte {
+	if len(data) < 10 {
+		return nil
+	}
+	version := data[3]
+	if version != 3 && version != 4 {
+		return nil
+	}
+	end := min(10+syncsafe(data[6:10]), len(data))
+	offset := 10
+	if data[5]&0x40 != 0 && offset+4 <= end {
+		// Skip the extended header.
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		if version == 4 {
+			size = syncsafe(data[offset:])
+		} else {
+			size += 4
+		}
+		offset += size
+	}
+	for offset+10 <= end {
+		id := string(data[offset : offset+4])
+		if id[0] == 0 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[offset+4:]))
+		if version == 4 {
+			size = syncsafe(data[offset+4:])
+		}
+		body := offset + 10
+		if size <= 0 || body+size > end {
+			break
+		}
+		if id == "APIC" {
+			if picture := apicData(data[body : body+size]); picture != nil {
+				return picture
+			}
+		}
+		offset = body + size
+	}
+	return nil
+}
+
+// apicData skips the APIC header: text encoding, MIME type, picture type and
+// description.
+func apicData(frame []byte) []byte {
+	if len(frame) < 4 {
+		return nil
+	}
+	encoding := frame[0]
+	mimeEnd := bytes.IndexByte(frame[1:], 0)
+	if mimeEnd < 0 {
+		return nil
+	}
+	rest := frame[1+mimeEnd+1:]
+	if len(rest) < 1 {
+		return nil
+	}
+	rest = rest[1:] // picture type
+	if encoding == 1 || encoding == 2 {
+		// UTF-16 description, terminated by two zero bytes on an even
+		// offset.
+		for i := 0; i+1 < len(rest); i += 2 {
+			if rest[i] == 0 && rest[i+1] == 0 {
+				return rest[i+2:]
+			}
+		}
+		return nil
+	}
+	descEnd := bytes.IndexByte(rest, 0)
+	if descEnd < 0 {
+		return nil
+	}
+	return rest[descEnd+1:]
+}
+
+func flacPicture(data []byte) []byte {
+	offset := 4
+	for offset+4 <= len(data) {
+		header := data[offset]
+		size := int(data[offset+1])<<16 | int(data[offset+2])<<8 | int(data[offset+3])
+		body := offset + 4
+		if body+size > len(data) {
+			return nil
+		}
+		if header&0x7f == 6 {
+			return flacPictureData(data[body : body+size])
+		}
+		if header&0x80 != 0 {
+			return nil
+		}
+		offset = body + size
+	}
+	return nil
+}
+
+// flacPictureData reads a METADATA_BLOCK_PICTURE: type, MIME type,
+// description, four picture properties, then the data.
+func flacPictureData(block []byte) []byte {
+	offset := 4
+	for i := 0; i < 2; i++ {
+		if offset+4 > len(block) {
+			return nil
+		}
+		offset += 4 + int(binary.BigEndian.Uint32(block[offset:]))
+	}
+	offset += 16
+	if offset+4 > len(block) {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint32(block[offset:]))
+	offset += 4
+	if offset+size > len(block) {
+		return nil
+	}
+	return block[offset : offset+size]
+}
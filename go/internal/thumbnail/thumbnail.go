@@ -0,0 +1,131 @@
+package thumbnail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	imageutil "github.com/nerdneilsfield/telegram-upload-watcher/go/internal/image"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/pdf"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
+)
+
+var ffmpegPath = sync.OnceValue(func() string { path, _ := exec.LookPath("ffmpeg"); return path })
+
+// Generate is a telegram.ThumbnailHook. It renders the first page of PDFs,
+// scales images, grabs a frame of videos with ffmpeg and uses the embedded
+// album art of audio files. Files it cannot handle get no thumbnail.
+func Generate(ctx context.Context, kind string, file telegram.MediaFile) []byte {
+	source, err := source(ctx, kind, file)
+	if err != nil {
+		log.Printf("thumbnail for %s: %v", file.Filename, err)
+		return nil
+	}
+	if source == nil {
+		return nil
+	}
+	thumb, err := imageutil.Thumbnail(source)
+	if err != nil {
+		log.Printf("thumbnail for %s: %v", file.Filename, err)
+		return nil
+	}
+	return thumb
+}
+
+// source returns the image to scale down for file, or nil.
+func source(ctx context.Context, kind string, file telegram.MediaFile) ([]byte, error) {
+	name := strings.ToLower(file.Filename)
+	switch {
+	case kind == "video" || hasExt(name, constants.VideoExtensions):
+		return videoFrame(ctx, file)
+	case kind == "audio" || hasExt(name, constants.AudioExtensions):
+		if art := albumArt(file.Data); art != nil {
+			return art, nil
+		}
+		// Tag formats not parsed here (MP4, Ogg) are left to ffmpeg,
+		// which exposes cover art as a video stream. Most audio files
+		// have none, so a failure is not worth a log line.
+		art, _ := videoFrame(ctx, file)
+		return art, nil
+	case hasExt(name, constants.ImageExtensions):
+		return file.Data, nil
+	case strings.HasSuffix(name, ".pdf"):
+		return pdfPage(ctx, file)
+	}
+	return nil, nil
+}
+
+func videoFrame(ctx context.Context, file telegram.MediaFile) ([]byte, error) {
+	ffmpeg := ffmpegPath()
+	if ffmpeg == "" {
+		return nil, nil
+	}
+	dir, input, err := writeTemp(file)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "frame.jpg")
+	// Seek a second in to skip black lead-in frames; very short clips fall
+	// back to the first frame.
+	for _, seek := range []string{"1", "0"} {
+		args := []string{"-hide_banner", "-loglevel", "error", "-y", "-ss", seek, "-i", input, "-map", "0:v:0", "-frames:v", "1", output}
+		if out, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput(); err != nil {
+			if seek == "0" {
+				return nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+			}
+			continue
+		}
+		if data, err := os.ReadFile(output); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+	return nil, nil
+}
+
+func pdfPage(ctx context.Context, file telegram.MediaFile) ([]byte, error) {
+	dir, input, err := writeTemp(file)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	pages, err := pdf.Rasterize(ctx, input, 72, 1, 1, dir)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(pages[0].Path)
+}
+
+// writeTemp returns a temporary directory and a copy of file in it; a file
+// streamed from disk is used where it is.
+func writeTemp(file telegram.MediaFile) (string, string, error) {
+	dir, err := tempdir.MkdirTemp("thumb-")
+	if err != nil {
+		return "", "", err
+	}
+	if file.Data == nil && file.Path != "" {
+		return dir, file.Path, nil
+	}
+	input := filepath.Join(dir, "input"+strings.ToLower(filepath.Ext(file.Filename)))
+	if err := os.WriteFile(input, file.Data, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, input, nil
+}
+
+func hasExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
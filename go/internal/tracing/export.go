@@ -0,0 +1,270 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	exportBatch    = 256
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+	// exportBuffer is how many ended spans wait for the exporter; more are
+	// dropped rather than slowing sends down.
+	exportBuffer = 4096
+)
+
+// Config says where spans go. Endpoint is the collector's OTLP/HTTP base
+// URL, such as http://localhost:4318; "/v1/traces" is added unless it is
+// already there. Headers are sent with every export, for collectors that
+// want an API key.
+type Config struct {
+	Endpoint string
+	Headers  map[string]string
+	Service  string
+	Version  string
+}
+
+// ConfigFromEnv fills the OTLP settings the OpenTelemetry SDKs read:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME.
+func ConfigFromEnv() Config {
+	cfg := Config{Endpoint: os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), Service: os.Getenv("OTEL_SERVICE_NAME")}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if headers := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); headers != "" {
+		cfg.Headers, _ = ParseHeaders(strings.Split(headers, ","))
+	}
+	return cfg
+}
+
+// ParseHeaders reads KEY=VALUE pairs.
+func ParseHeaders(values []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (want KEY=VALUE)", value)
+		}
+		headers[key] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+type exporter struct {
+	url      string
+	headers  map[string]string
+	resource map[string]any
+	spans    chan otlpSpan
+	done     chan struct{}
+	client   *fasthttp.Client
+	failing  bool
+	// mu keeps add from sending on spans once stop closed it.
+	mu     sync.Mutex
+	closed bool
+}
+
+// Setup starts exporting spans as cfg says. An empty Endpoint leaves
+// tracing off.
+func Setup(cfg Config) error {
+	endpoint := strings.TrimRight(strings.TrimSpace(cfg.Endpoint), "/")
+	if endpoint == "" {
+		return nil
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("invalid OTLP endpoint %q (want an http:// or https:// URL)", cfg.Endpoint)
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	service := cfg.Service
+	if service == "" {
+		service = "telegram-upload-watcher"
+	}
+	resource := []map[string]any{otlpAttribute("service.name", service)}
+	if cfg.Version != "" {
+		resource = append(resource, otlpAttribute("service.version", cfg.Version))
+	}
+	if host, err := os.Hostname(); err == nil {
+		resource = append(resource, otlpAttribute("host.name", host))
+	}
+	exp := &exporter{
+		url:      endpoint,
+		headers:  cfg.Headers,
+		resource: map[string]any{"attributes": resource},
+		spans:    make(chan otlpSpan, exportBuffer),
+		done:     make(chan struct{}),
+		client:   &fasthttp.Client{ReadTimeout: exportTimeout, WriteTimeout: exportTimeout},
+	}
+	if previous := active.Swap(exp); previous != nil {
+		previous.stop(exportTimeout)
+	}
+	go exp.loop()
+	return nil
+}
+
+// Shutdown stops tracing and exports the spans not sent yet, waiting at
+// most timeout.
+func Shutdown(timeout time.Duration) {
+	if exp := active.Swap(nil); exp != nil {
+		exp.stop(timeout)
+	}
+}
+
+func (e *exporter) add(span otlpSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+	}
+}
+
+func (e *exporter) stop(timeout time.Duration) {
+	e.mu.Lock()
+	e.closed = true
+	close(e.spans)
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+	case <-time.After(timeout):
+	}
+}
+
+func (e *exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := []otlpSpan{}
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				e.export(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) < exportBatch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.export(batch)
+		batch = batch[:0]
+	}
+}
+
+// export posts spans to the collector. Failures are logged when they start
+// and when exports work again, not for every batch.
+func (e *exporter) export(spans []otlpSpan) {
+	if len(spans) == 0 {
+		return
+	}
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": e.resource,
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/nerdneilsfield/telegram-upload-watcher"},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("trace export failed: %v", err)
+		return
+	}
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(e.url)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	req.SetBody(body)
+	err = e.client.DoTimeout(req, resp, exportTimeout)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = fmt.Errorf("%s answered %d", e.url, resp.StatusCode())
+	}
+	switch {
+	case err != nil && !e.failing:
+		log.Printf("trace export failed, dropping %d span(s): %v", len(spans), err)
+		e.failing = true
+	case err == nil && e.failing:
+		log.Printf("trace export to %s works again", e.url)
+		e.failing = false
+	}
+}
+
+// otlpSpan is a span in the OTLP JSON encoding: hex IDs, and times and
+// integers as decimal strings.
+type otlpSpan struct {
+	TraceID      string           `json:"traceId"`
+	SpanID       string           `json:"spanId"`
+	ParentSpanID string           `json:"parentSpanId,omitempty"`
+	Name         string           `json:"name"`
+	Kind         int              `json:"kind"`
+	Start        string           `json:"startTimeUnixNano"`
+	End          string           `json:"endTimeUnixNano"`
+	Attributes   []map[string]any `json:"attributes,omitempty"`
+	Status       map[string]any   `json:"status,omitempty"`
+}
+
+func (s *Span) finish(end time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:      s.traceID,
+		SpanID:       s.spanID,
+		ParentSpanID: s.parentID,
+		Name:         s.name,
+		Kind:         s.kind,
+		Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+		End:          strconv.FormatInt(end.UnixNano(), 10),
+	}
+	for _, attr := range s.attrs {
+		span.Attributes = append(span.Attributes, otlpAttribute(attr.key, attr.value))
+	}
+	if s.err != "" {
+		span.Status = map[string]any{"code": 2, "message": s.err}
+	}
+	return span
+}
+
+func otlpAttribute(key string, value any) map[string]any {
+	var encoded map[string]any
+	switch v := value.(type) {
+	case string:
+		encoded = map[string]any{"stringValue": v}
+	case bool:
+		encoded = map[string]any{"boolValue": v}
+	case int:
+		encoded = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]any{"doubleValue": v}
+	default:
+		encoded = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+	return map[string]any{"key": key, "value": encoded}
+}
@@ -0,0 +1,153 @@
+// Package tracing records send pipelines as OpenTelemetry traces and
+// exports them over OTLP/HTTP with JSON encoding, so a collector gathers the
+// spans of many watchers in one place. Until Setup is called every span is
+// nil and costs nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span kinds, as numbered by OTLP.
+const (
+	kindInternal = 1
+	kindClient   = 3
+)
+
+// Span is one timed operation of a trace. A nil *Span ignores every call,
+// so callers need not check whether tracing is on.
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []attribute
+	err   string
+	ended bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+type spanKey struct{}
+
+var active atomic.Pointer[exporter]
+
+// Start begins a span named name as a child of the span in ctx, or as the
+// root of a new trace when ctx has none, and returns ctx carrying it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, kindInternal)
+}
+
+// StartChild is Start for work only worth recording as part of a trace:
+// without a span in ctx it records nothing, so background calls such as
+// health probes do not start traces of their own.
+func StartChild(ctx context.Context, name string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return start(ctx, name, kindInternal)
+}
+
+// StartRequest is StartChild for a request to another service.
+func StartRequest(ctx context.Context, name string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return start(ctx, name, kindClient)
+}
+
+func start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if active.Load() == nil {
+		return ctx, nil
+	}
+	span := &Span{name: name, kind: kind, start: time.Now(), spanID: randomID(8)}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Name returns the span's name, or "" for a nil span.
+func (s *Span) Name() string {
+	if s == nil {
+		return ""
+	}
+	return s.name
+}
+
+// Set records an attribute of the span: a string, bool, integer or float.
+// Setting a key again replaces its value.
+func (s *Span) Set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].key == key {
+			s.attrs[i].value = value
+			return
+		}
+	}
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed with err; a nil err does nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and hands it to the exporter. Later calls do
+// nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+	if exp := active.Load(); exp != nil {
+		exp.add(s.finish(time.Now()))
+	}
+}
+
+func randomID(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand does not fail on supported platforms; an ID made
+		// from the clock still keeps spans apart.
+		return fmt.Sprintf("%0*x", size*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
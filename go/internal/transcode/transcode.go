@@ -0,0 +1,219 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/tempdir"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
+)
+
+// Preset is an H.264/AAC MP4 target for videos Telegram cannot play inline
+// or that are over the upload limit.
+type Preset struct {
+	Name      string
+	MaxHeight int
+	CRF       int
+	// MaxRate caps the video bitrate (kbit/s); oversized videos are capped
+	// lower so the result fits the upload limit.
+	MaxRate   int
+	AudioRate int
+}
+
+var presets = []Preset{
+	{Name: "telegram-480p", MaxHeight: 480, CRF: 26, MaxRate: 1200, AudioRate: 96},
+	{Name: "telegram-720p", MaxHeight: 720, CRF: 24, MaxRate: 2500, AudioRate: 128},
+	{Name: "telegram-1080p", MaxHeight: 1080, CRF: 23, MaxRate: 5000, AudioRate: 160},
+}
+
+// ParsePreset returns the named preset, or nil for "" and "none".
+func ParsePreset(value string) (*Preset, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	names := make([]string, 0, len(presets))
+	for _, preset := range presets {
+		if preset.Name == name {
+			preset := preset
+			return &preset, nil
+		}
+		names = append(names, preset.Name)
+	}
+	return nil, fmt.Errorf("invalid video preset %q (use %s or none)", value, strings.Join(names, ", "))
+}
+
+var (
+	ffmpegPath  = sync.OnceValue(func() string { path, _ := exec.LookPath("ffmpeg"); return path })
+	ffprobePath = sync.OnceValue(func() string { path, _ := exec.LookPath("ffprobe"); return path })
+	warnMissing sync.Once
+)
+
+// playableExtensions are containers Telegram streams inline when they hold
+// H.264 video.
+var playableExtensions = []string{".mp4", ".m4v", ".mov"}
+
+// Hook returns a telegram.VideoHook that transcodes with p, or nil when p is
+// nil.
+func (p *Preset) Hook() telegram.VideoHook {
+	if p == nil {
+		return nil
+	}
+	return p.Prepare
+}
+
+// Prepare transcodes file when it is over the Bot API upload limit or not
+// H.264 video in an MP4/MOV container. Without ffmpeg such videos are sent as
+// documents instead; a failed transcode does the same.
+func (p *Preset) Prepare(ctx context.Context, file telegram.MediaFile) (telegram.MediaFile, bool, error) {
+	oversized := file.Len() > constants.BotAPIUploadMaxBytes
+	playableContainer := hasExt(file.Filename, playableExtensions)
+	ffmpeg := ffmpegPath()
+	if ffmpeg == "" {
+		if oversized || !playableContainer {
+			warnMissing.Do(func() {
+				log.Printf("video preset %s: ffmpeg not found in PATH, sending videos that need transcoding as documents", p.Name)
+			})
+			return file, true, nil
+		}
+		return file, false, nil
+	}
+
+	dir, err := tempdir.MkdirTemp("video-")
+	if err != nil {
+		return file, false, err
+	}
+	defer os.RemoveAll(dir)
+	input := file.Path
+	if file.Data != nil || input == "" {
+		input = filepath.Join(dir, "input"+strings.ToLower(filepath.Ext(file.Filename)))
+		if err := os.WriteFile(input, file.Data, 0o600); err != nil {
+			return file, false, err
+		}
+	}
+	info := probe(ctx, input)
+	if !oversized && playableContainer && info.playable() {
+		return file, false, nil
+	}
+
+	// The result outlives the scratch directory: it is streamed from disk
+	// and removed by the client after the upload.
+	out, err := tempdir.CreateTemp("video-*.mp4")
+	if err != nil {
+		return file, false, err
+	}
+	output := out.Name()
+	out.Close()
+	if err := p.run(ctx, ffmpeg, input, output, info, oversized); err != nil {
+		os.Remove(output)
+		if ctx.Err() != nil {
+			return file, false, ctx.Err()
+		}
+		log.Printf("transcode %s failed, sending it as a document: %v", file.Filename, err)
+		return file, true, nil
+	}
+	converted, err := os.Stat(output)
+	if err != nil {
+		os.Remove(output)
+		return file, false, err
+	}
+	log.Printf("transcoded %s with %s: %d -> %d bytes", file.Filename, p.Name, file.Len(), converted.Size())
+	file.Data = nil
+	file.Path = output
+	file.Size = converted.Size()
+	file.Temporary = true
+	file.Filename = strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename)) + ".mp4"
+	return file, false, nil
+}
+
+func (p *Preset) run(ctx context.Context, ffmpeg string, input string, output string, info mediaInfo, oversized bool) error {
+	rate := p.MaxRate
+	if oversized && info.duration > 0 {
+		// Leave 8% for container overhead and rate-control overshoot.
+		budget := int(float64(constants.BotAPIUploadMaxBytes)*8*0.92/info.duration/1000) - p.AudioRate
+		rate = max(min(rate, budget), 100)
+	}
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y", "-i", input,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", strconv.Itoa(p.CRF),
+		"-maxrate", fmt.Sprintf("%dk", rate), "-bufsize", fmt.Sprintf("%dk", rate*2),
+		"-vf", fmt.Sprintf("scale=-2:trunc(min(%d\\,ih)/2)*2", p.MaxHeight), "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", p.AudioRate),
+		"-movflags", "+faststart", output,
+	}
+	if out, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type mediaInfo struct {
+	known      bool
+	videoCodec string
+	audioCodec string
+	duration   float64
+}
+
+// playable reports whether Telegram clients can play the streams inline. An
+// unprobed file is assumed playable.
+func (m mediaInfo) playable() bool {
+	if !m.known {
+		return true
+	}
+	return m.videoCodec == "h264" && (m.audioCodec == "" || m.audioCodec == "aac" || m.audioCodec == "mp3")
+}
+
+// probe reads codecs and duration with ffprobe, when it is installed.
+func probe(ctx context.Context, path string) mediaInfo {
+	ffprobe := ffprobePath()
+	if ffprobe == "" {
+		return mediaInfo{}
+	}
+	out, err := exec.CommandContext(ctx, ffprobe, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return mediaInfo{}
+	}
+	var parsed struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return mediaInfo{}
+	}
+	info := mediaInfo{known: true}
+	for _, stream := range parsed.Streams {
+		switch {
+		case stream.CodecType == "video" && info.videoCodec == "":
+			info.videoCodec = stream.CodecName
+		case stream.CodecType == "audio" && info.audioCodec == "":
+			info.audioCodec = stream.CodecName
+		}
+	}
+	info.duration, _ = strconv.ParseFloat(parsed.Format.Duration, 64)
+	return info
+}
+
+func hasExt(name string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, candidate := range exts {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
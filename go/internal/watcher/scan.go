@@ -0,0 +1,151 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
+)
+
+// dirCacheMinAge is how old a directory's mtime must be before the cache
+// trusts it; coarse filesystem timestamps (FAT, some NAS shares) would
+// otherwise hide a file added in the same tick as the last read.
+const dirCacheMinAge = 5 * time.Second
+
+// dirIndex remembers the directories of the last parallel scan so that, with
+// Config.DirCache, directories whose mtime is unchanged are not read again.
+type dirIndex struct {
+	key  string
+	dirs map[string]dirEntry
+}
+
+type dirEntry struct {
+	mtimeNS int64
+	subdirs []fswalk.Dir
+	// pending forces a re-read next scan: the directory holds files that
+	// have not settled yet, or its mtime was too recent to trust.
+	pending bool
+}
+
+type scanFile struct {
+	path    string
+	info    os.FileInfo
+	sortKey string
+}
+
+func newDirIndex() *dirIndex {
+	return &dirIndex{dirs: map[string]dirEntry{}}
+}
+
+// indexKey covers every setting that changes which files a directory
+// contributes; a reload that changes one of them drops the cache.
+func indexKey(cfg Config) string {
+	return fmt.Sprintf("%s|%v|%v|%v|%v|%v|%v|%v|%v|%v|%s|%v", cfg.Root, cfg.Recursive, cfg.IncludeGlobs, cfg.ExcludeGlobs, cfg.WithImage, cfg.WithVideo, cfg.WithAudio, cfg.WithAll, cfg.FollowSymlinks, cfg.IncludeHidden, cfg.IgnoreFile, cfg.Skip)
+}
+
+// markPending flags the directory of a file that has not settled yet.
+func (idx *dirIndex) markPending(path string) {
+	dir := filepath.Dir(path)
+	if entry, ok := idx.dirs[dir]; ok {
+		entry.pending = true
+		idx.dirs[dir] = entry
+	}
+}
+
+// walkParallel lists the candidate files under cfg.Root with up to
+// cfg.ScanWorkers directories read at once. Files come back in the same
+// depth-first lexical order as filepath.WalkDir so enqueue order does not
+// depend on scheduling. The index is replaced with the directories seen.
+// Paths that could not be read are returned as problems.
+func walkParallel(cfg Config, index *dirIndex) ([]scanFile, []error) {
+	key := indexKey(cfg)
+	var previous map[string]dirEntry
+	if cfg.DirCache && index.key == key {
+		previous = index.dirs
+	}
+
+	var mu sync.Mutex
+	files := []scanFile{}
+	problems := []error{}
+	dirs := map[string]dirEntry{}
+	sem := make(chan struct{}, max(cfg.ScanWorkers, 1))
+	var wg sync.WaitGroup
+	var visit func(dir fswalk.Dir)
+	visit = func(dir fswalk.Dir) {
+		defer wg.Done()
+		sem <- struct{}{}
+		entry, found, readProblems, ok := readScanDir(cfg, dir, previous)
+		<-sem
+		mu.Lock()
+		problems = append(problems, readProblems...)
+		if ok {
+			dirs[dir.Path] = entry
+			files = append(files, found...)
+		}
+		mu.Unlock()
+		if !ok {
+			return
+		}
+		for _, sub := range entry.subdirs {
+			wg.Add(1)
+			go visit(sub)
+		}
+	}
+	wg.Add(1)
+	visit(fswalk.NewRoot(cfg.Root))
+	wg.Wait()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].sortKey < files[j].sortKey
+	})
+	index.key = key
+	index.dirs = dirs
+	return files, problems
+}
+
+// readScanDir reads one directory, or reuses its cached entry when the
+// directory is unchanged. Cached directories contribute no files: every file
+// in them was already handled and settled. A directory with unreadable
+// entries stays pending so they are retried next scan.
+func readScanDir(cfg Config, dir fswalk.Dir, previous map[string]dirEntry) (dirEntry, []scanFile, []error, bool) {
+	info, err := os.Stat(fswalk.LongPath(dir.Path))
+	if err != nil {
+		return dirEntry{}, nil, []error{err}, false
+	}
+	mtimeNS := info.ModTime().UnixNano()
+	if cached, ok := previous[dir.Path]; ok && !cached.pending && cached.mtimeNS == mtimeNS {
+		return cached, nil, nil, true
+	}
+
+	entries, problems, err := dir.Read(cfg.walkOptions())
+	if err != nil {
+		return dirEntry{}, nil, []error{err}, false
+	}
+	entry := dirEntry{
+		mtimeNS: mtimeNS,
+		pending: time.Since(info.ModTime()) < dirCacheMinAge || len(problems) > 0,
+	}
+	files := []scanFile{}
+	for _, item := range entries {
+		rel, err := filepath.Rel(cfg.Root, item.Path)
+		if err != nil {
+			continue
+		}
+		if !matchesInclude(rel, cfg.IncludeGlobs) || matchesExclude(rel, cfg.ExcludeGlobs) {
+			continue
+		}
+		if item.Dir != nil {
+			entry.subdirs = append(entry.subdirs, *item.Dir)
+			continue
+		}
+		// Mapping the separator below every other byte makes a plain
+		// string sort match WalkDir's per-directory order.
+		files = append(files, scanFile{path: item.Path, info: item.Info, sortKey: strings.ReplaceAll(item.Path, string(filepath.Separator), "\x00")})
+	}
+	return entry, files, problems, true
+}
@@ -0,0 +1,54 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TopicMap routes enqueued files to forum topics by send type ("image",
+// "video", "audio", "file") or extension (".pdf"); "*" matches everything
+// else. An extension entry wins over a type entry.
+type TopicMap map[string]int
+
+// ParseTopicMap parses entries such as "image=5", ".pdf=11" or "*=9".
+func ParseTopicMap(values []string) (TopicMap, error) {
+	topics := TopicMap{}
+	for _, value := range values {
+		key, idText, ok := strings.Cut(value, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid topic mapping %q: expected <type|.ext|*>=<topic id>", value)
+		}
+		switch key {
+		case "image", "video", "audio", "file", "*":
+		default:
+			if !strings.HasPrefix(key, ".") {
+				return nil, fmt.Errorf("invalid topic mapping %q: key must be image, video, audio, file, .ext or *", value)
+			}
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(idText))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid topic mapping %q: topic id must be a positive number", value)
+		}
+		topics[key] = id
+	}
+	if len(topics) == 0 {
+		return nil, nil
+	}
+	return topics, nil
+}
+
+// Topic returns the topic for a file, or nil to use the default topic.
+func (m TopicMap) Topic(name string, sendType string) *int {
+	if len(m) == 0 {
+		return nil
+	}
+	for _, key := range []string{strings.ToLower(filepath.Ext(name)), sendType, "*"} {
+		if id, ok := m[key]; ok && key != "" {
+			return &id
+		}
+	}
+	return nil
+}
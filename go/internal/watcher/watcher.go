@@ -3,6 +3,8 @@ package watcher
 import (
 	"archive/zip"
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path"
@@ -10,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/fswalk"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/runcontrol"
 	"github.com/nerdneilsfield/telegram-upload-watcher/go/pkgs/constants"
@@ -26,11 +29,45 @@ type Config struct {
 	WithAll       bool
 	ScanInterval  time.Duration
 	SettleSeconds int
+	// Priority is stored on enqueued items; see queue.ParsePriority.
+	Priority int
+	// Topics stamps a per-type forum topic onto enqueued items.
+	Topics TopicMap
+	// ScanWorkers above 1 reads that many directories of a recursive scan
+	// concurrently.
+	ScanWorkers int
+	// DirCache skips directories whose mtime has not changed since the last
+	// scan. Files modified in place are not noticed until their directory
+	// changes.
+	DirCache bool
+	// FollowSymlinks and IncludeHidden are passed to fswalk.Options.
+	FollowSymlinks bool
+	IncludeHidden  bool
+	// Strict skips a scan that finds unreadable paths instead of enqueueing
+	// what could be read.
+	Strict bool
+	// IgnoreFile is the per-directory ignore file; see fswalk.Options.
+	IgnoreFile string
+	// Skip lists directories left out of scans, such as the quarantine
+	// folder; see fswalk.Options.
+	Skip []string
+	// Unreadable, when set, receives the unreadable path count of each scan.
+	Unreadable *fswalk.Unreadable
+}
+
+func (cfg Config) walkOptions() fswalk.Options {
+	return fswalk.Options{FollowSymlinks: cfg.FollowSymlinks, IncludeHidden: cfg.IncludeHidden, IgnoreFile: cfg.IgnoreFile, Skip: cfg.Skip}
 }
 
 type stabilityTracker struct {
 	settleSeconds int
 	state         map[string]entry
+	// problems holds the unreadable paths already logged, so a persistent
+	// problem is logged once rather than on every scan.
+	problems map[string]struct{}
+	// incomplete holds the source fingerprint of zips already logged as
+	// incomplete.
+	incomplete map[string]string
 }
 
 type entry struct {
@@ -43,7 +80,21 @@ func newTracker(settleSeconds int) *stabilityTracker {
 	return &stabilityTracker{
 		settleSeconds: settleSeconds,
 		state:         map[string]entry{},
+		problems:      map[string]struct{}{},
+		incomplete:    map[string]string{},
+	}
+}
+
+func (t *stabilityTracker) reportProblems(problems []error) {
+	current := make(map[string]struct{}, len(problems))
+	for _, problem := range problems {
+		key := problem.Error()
+		current[key] = struct{}{}
+		if _, ok := t.problems[key]; !ok {
+			log.Printf("cannot read: %v", problem)
+		}
 	}
+	t.problems = current
 }
 
 func (t *stabilityTracker) isStable(path string, size int64, mtimeNS int64) bool {
@@ -149,130 +200,190 @@ func sendTypeForName(name string, cfg Config) string {
 	return ""
 }
 
-func scanOnce(cfg Config, q *queue.Queue, tracker *stabilityTracker) int {
+func scanOnce(cfg Config, q *queue.Queue, tracker *stabilityTracker, index *dirIndex) int {
 	root := cfg.Root
 	enqueued := 0
 	seen := map[string]struct{}{}
 
-	handleFile := func(path string, info os.FileInfo) {
+	// handleFile reports whether the file is still settling.
+	handleFile := func(path string, info os.FileInfo) bool {
 		seen[path] = struct{}{}
 		nameLower := strings.ToLower(info.Name())
 		sendType := sendTypeForName(nameLower, cfg)
 		if sendType == "" && !strings.HasSuffix(nameLower, ".zip") {
-			return
+			return false
 		}
 
 		mtimeNS := info.ModTime().UnixNano()
 		fingerprint := queue.BuildFingerprint("file", path, nil, info.Size(), &mtimeNS, nil)
 		if q.HasFingerprint(fingerprint) {
-			return
+			return false
 		}
 
 		if strings.HasSuffix(nameLower, ".zip") {
 			sourceFingerprint := queue.BuildSourceFingerprint(path, info.Size(), &mtimeNS)
 			if q.HasSourceFingerprint("zip", sourceFingerprint) {
-				return
+				return false
 			}
 			if !tracker.isStable(path, info.Size(), mtimeNS) {
-				return
+				return true
 			}
-			enqueued += enqueueZip(q, path, info, cfg, cfg.IncludeGlobs, cfg.ExcludeGlobs)
-			return
+			count, err := enqueueZip(q, path, info, cfg, cfg.IncludeGlobs, cfg.ExcludeGlobs)
+			if err != nil {
+				// Most likely still being copied; check again once it settles.
+				if tracker.incomplete[path] != sourceFingerprint {
+					log.Printf("zip %s is incomplete, waiting: %v", path, err)
+					tracker.incomplete[path] = sourceFingerprint
+				}
+				return true
+			}
+			delete(tracker.incomplete, path)
+			enqueued += count
+			return false
 		}
 
 		if !tracker.isStable(path, info.Size(), mtimeNS) {
-			return
-		}
-		item := queue.Item{
-			SourceType:        "file",
-			SourcePath:        path,
-			SourceFingerprint: queue.BuildSourceFingerprint(path, info.Size(), &mtimeNS),
-			Path:              path,
-			Size:              info.Size(),
-			MTimeNS:           &mtimeNS,
-			Fingerprint:       fingerprint,
-			SendType:          sendType,
+			return true
 		}
-		if _, err := q.Enqueue(item); err == nil {
+		if _, err := q.Enqueue(NewFileItem(cfg, path, info, sendType)); err == nil {
 			enqueued++
 		}
+		return false
 	}
 
-	if cfg.Recursive {
-		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return nil
-			}
-			if path == root {
-				return nil
-			}
+	files, problems := listFiles(cfg, index)
+	cfg.Unreadable.Set(root, len(problems))
+	tracker.reportProblems(problems)
+	if cfg.Strict && len(problems) > 0 {
+		log.Printf("scan of %s skipped: %d unreadable path(s) (--strict)", root, len(problems))
+		return 0
+	}
+	for _, file := range files {
+		if handleFile(file.path, file.info) {
+			index.markPending(file.path)
+		}
+	}
+
+	tracker.prune(seen)
+	return enqueued
+}
+
+// listFiles lists the files under cfg.Root that pass the include and exclude
+// globs, and the paths that could not be read.
+func listFiles(cfg Config, index *dirIndex) ([]scanFile, []error) {
+	root := cfg.Root
+	var files []scanFile
+	var problems []error
+	if cfg.Recursive && (cfg.ScanWorkers > 1 || cfg.DirCache) {
+		files, problems = walkParallel(cfg, index)
+	} else if cfg.Recursive {
+		err := fswalk.Walk(root, cfg.walkOptions(), func(path string, info os.FileInfo) error {
 			rel, err := filepath.Rel(root, path)
 			if err != nil {
 				return nil
 			}
-			if !matchesInclude(rel, cfg.IncludeGlobs) {
-				if d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if matchesExclude(rel, cfg.ExcludeGlobs) {
-				if d.IsDir() {
+			if !matchesInclude(rel, cfg.IncludeGlobs) || matchesExclude(rel, cfg.ExcludeGlobs) {
+				if info.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-			if d.IsDir() {
-				return nil
-			}
-			info, err := d.Info()
-			if err != nil {
+			if info.IsDir() {
 				return nil
 			}
-			handleFile(path, info)
+			files = append(files, scanFile{path: path, info: info})
 			return nil
 		})
+		var unreadable fswalk.Errors
+		if errors.As(err, &unreadable) {
+			problems = unreadable
+		}
 	} else {
-		entries, err := os.ReadDir(root)
+		entries, readProblems, err := fswalk.NewRoot(root).Read(cfg.walkOptions())
+		problems = readProblems
 		if err != nil {
-			return 0
+			problems = append(problems, err)
 		}
 		for _, entry := range entries {
-			if entry.IsDir() {
+			if entry.Dir != nil {
 				continue
 			}
-			if !matchesInclude(entry.Name(), cfg.IncludeGlobs) {
+			if !matchesInclude(entry.Name, cfg.IncludeGlobs) {
 				continue
 			}
-			if matchesExclude(entry.Name(), cfg.ExcludeGlobs) {
+			if matchesExclude(entry.Name, cfg.ExcludeGlobs) {
 				continue
 			}
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-			handleFile(filepath.Join(root, entry.Name()), info)
+			files = append(files, scanFile{path: entry.Path, info: entry.Info})
 		}
 	}
 
-	tracker.prune(seen)
-	return enqueued
+	return files, problems
+}
+
+// NewFileItem is the queue item a scan enqueues for the file at path.
+func NewFileItem(cfg Config, path string, info os.FileInfo, sendType string) queue.Item {
+	mtimeNS := info.ModTime().UnixNano()
+	return queue.Item{
+		SourceType:        "file",
+		SourcePath:        path,
+		SourceFingerprint: queue.BuildSourceFingerprint(path, info.Size(), &mtimeNS),
+		Path:              path,
+		Size:              info.Size(),
+		MTimeNS:           &mtimeNS,
+		Fingerprint:       queue.BuildFingerprint("file", path, nil, info.Size(), &mtimeNS, nil),
+		SendType:          sendType,
+		Priority:          cfg.Priority,
+		TopicID:           cfg.Topics.Topic(path, sendType),
+	}
+}
+
+// Candidate is a file a scan would enqueue once it has settled.
+type Candidate struct {
+	Path     string
+	Info     os.FileInfo
+	SendType string
+}
+
+// Candidates lists the files a scan of cfg.Root would enqueue. Zip
+// archives, whose entries are enqueued one by one, are left out.
+func Candidates(cfg Config) ([]Candidate, []error) {
+	files, problems := listFiles(cfg, newDirIndex())
+	candidates := make([]Candidate, 0, len(files))
+	for _, file := range files {
+		nameLower := strings.ToLower(file.info.Name())
+		sendType := sendTypeForName(nameLower, cfg)
+		if sendType == "" || strings.HasSuffix(nameLower, ".zip") {
+			continue
+		}
+		candidates = append(candidates, Candidate{Path: file.path, Info: file.info, SendType: sendType})
+	}
+	return candidates, problems
 }
 
-func enqueueZip(q *queue.Queue, zipPath string, info os.FileInfo, cfg Config, include []string, exclude []string) int {
+// enqueueZip enqueues the matching entries of the zip at zipPath. A zip
+// whose central directory is missing or points past the end of the file is
+// not enqueued and returns an error. Unsent items of an older version of
+// the zip are moved to this version when their entry is unchanged and
+// skipped otherwise.
+func enqueueZip(q *queue.Queue, zipPath string, info os.FileInfo, cfg Config, include []string, exclude []string) (int, error) {
 	count := 0
 	sourceFingerprint := queue.BuildSourceFingerprint(zipPath, info.Size(), ptrInt64(info.ModTime().UnixNano()))
 	if q.HasSourceFingerprint("zip", sourceFingerprint) {
-		return 0
+		return 0, nil
 	}
 
 	archive, err := zip.OpenReader(zipPath)
 	if err != nil {
-		log.Printf("invalid zip: %s", zipPath)
-		return 0
+		return 0, err
 	}
 	defer archive.Close()
+	if err := validateZip(archive, info.Size()); err != nil {
+		return 0, err
+	}
 
+	items := []queue.Item{}
+	current := map[string]bool{}
 	for _, file := range archive.File {
 		if file.FileInfo().IsDir() {
 			continue
@@ -298,15 +409,44 @@ func enqueueZip(q *queue.Queue, zipPath string, info os.FileInfo, cfg Config, in
 			Path:              zipPath,
 			InnerPath:         &innerCopy,
 			Size:              size,
+			MTimeNS:           ptrInt64(file.Modified.UnixNano()),
 			Fingerprint:       queue.BuildFingerprint("zip", zipPath, &innerCopy, size, nil, &crc),
 			CRC:               &crc,
 			SendType:          sendType,
+			Priority:          cfg.Priority,
+			TopicID:           cfg.Topics.Topic(inner, sendType),
 		}
-		if _, err := q.Enqueue(item); err == nil {
+		items = append(items, item)
+		current[item.Fingerprint] = true
+	}
+	kept, superseded, err := q.SupersedeSource("zip", zipPath, sourceFingerprint, current)
+	if err != nil {
+		log.Printf("queue update failed: %v", err)
+	}
+	if kept+superseded > 0 {
+		log.Printf("zip %s changed: kept %d queued item(s), skipped %d no longer in it", zipPath, kept, superseded)
+	}
+	for _, item := range items {
+		if added, err := q.Enqueue(item); err == nil && added != nil {
 			count++
 		}
 	}
-	return count
+	return count, nil
+}
+
+// validateZip checks that every entry of archive lies within the first
+// size bytes of the file, which a zip still being written may not.
+func validateZip(archive *zip.ReadCloser, size int64) error {
+	for _, file := range archive.File {
+		offset, err := file.DataOffset()
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", file.Name, err)
+		}
+		if offset+int64(file.CompressedSize64) > size {
+			return fmt.Errorf("entry %s ends past the end of the file", file.Name)
+		}
+	}
+	return nil
 }
 
 func ptrInt64(value int64) *int64 {
@@ -315,8 +455,9 @@ func ptrInt64(value int64) *int64 {
 
 func WatchLoop(cfg Config, q *queue.Queue) {
 	tracker := newTracker(cfg.SettleSeconds)
+	index := newDirIndex()
 	for {
-		enqueued := scanOnce(cfg, q, tracker)
+		enqueued := scanOnce(cfg, q, tracker, index)
 		if enqueued > 0 {
 			log.Printf("enqueued %d file(s)", enqueued)
 		}
@@ -325,31 +466,47 @@ func WatchLoop(cfg Config, q *queue.Queue) {
 }
 
 func WatchLoopWithContext(ctx context.Context, cfg Config, q *queue.Queue, pause *runcontrol.PauseGate) {
-	tracker := newTracker(cfg.SettleSeconds)
+	WatchLoopLive(ctx, runcontrol.NewLive(cfg), q, pause)
+}
+
+// WatchLoopLive re-reads the config before every scan so filters, intervals
+// and media types can be changed while the loop runs.
+func WatchLoopLive(ctx context.Context, live *runcontrol.Live[Config], q *queue.Queue, pause *runcontrol.PauseGate) {
+	WatchLoopTriggered(ctx, live, q, pause, nil)
+}
+
+// WatchLoopTriggered is WatchLoopLive that also scans as soon as scan fires
+// instead of waiting out the scan interval.
+func WatchLoopTriggered(ctx context.Context, live *runcontrol.Live[Config], q *queue.Queue, pause *runcontrol.PauseGate, scan *runcontrol.Trigger) {
+	tracker := newTracker(live.Load().SettleSeconds)
+	index := newDirIndex()
 	for {
 		if pause != nil && !pause.Wait(ctx) {
 			return
 		}
-		enqueued := scanOnce(cfg, q, tracker)
+		cfg := live.Load()
+		tracker.settleSeconds = cfg.SettleSeconds
+		enqueued := scanOnce(cfg, q, tracker, index)
 		if enqueued > 0 {
 			log.Printf("enqueued %d file(s)", enqueued)
 		}
-		if !sleepWithContext(ctx, cfg.ScanInterval) {
+		if !waitForScan(ctx, cfg.ScanInterval, scan) {
 			return
 		}
 	}
 }
 
-func sleepWithContext(ctx context.Context, d time.Duration) bool {
-	if d <= 0 {
-		return true
-	}
-	timer := time.NewTimer(d)
+// waitForScan waits for the scan interval or until scan fires. It returns
+// false once ctx is done.
+func waitForScan(ctx context.Context, d time.Duration, scan *runcontrol.Trigger) bool {
+	timer := time.NewTimer(max(d, 0))
 	defer timer.Stop()
 	select {
 	case <-ctx.Done():
 		return false
 	case <-timer.C:
 		return true
+	case <-scan.C():
+		return true
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"crypto/subtle"
 	"encoding/binary"
@@ -54,6 +55,44 @@ func EffectiveMethod(file *zip.File) uint16 {
 	return file.Method
 }
 
+// Encryption names how file is encrypted: "none", "zipcrypto", "aes-128",
+// "aes-192" or "aes-256".
+func Encryption(file *zip.File) string {
+	if !IsEncrypted(file) {
+		return "none"
+	}
+	if aesInfo, ok := parseAESExtra(file.Extra); ok {
+		if keyLen := aesKeyLen(aesInfo.strength); keyLen > 0 {
+			return fmt.Sprintf("aes-%d", keyLen*8)
+		}
+		return "aes"
+	}
+	return "zipcrypto"
+}
+
+// MatchPassword returns the index in passwords of the first password that
+// decrypts file, or -1 when none does. Unencrypted entries return -1.
+func MatchPassword(file *zip.File, passwords []string) (int, error) {
+	if !IsEncrypted(file) {
+		return -1, nil
+	}
+	raw, err := readRaw(file)
+	if err != nil {
+		return -1, err
+	}
+	aesInfo, aesOK := parseAESExtra(file.Extra)
+	for idx, password := range passwords {
+		password = strings.TrimSpace(password)
+		if password == "" {
+			continue
+		}
+		if _, err := decryptAndDecompress(file, raw, password, aesInfo, aesOK); err == nil {
+			return idx, nil
+		}
+	}
+	return -1, nil
+}
+
 func ReadFile(file *zip.File, passwords []string) ([]byte, error) {
 	return ReadFileWithOptions(file, passwords, ReadOptions{})
 }
@@ -319,6 +358,27 @@ func (z *zipCrypto) decrypt(ciphertext []byte) []byte {
 	return plain
 }
 
+func (z *zipCrypto) encrypt(plain []byte) []byte {
+	ciphertext := make([]byte, len(plain))
+	for i, v := range plain {
+		ciphertext[i] = v ^ z.magicByte()
+		z.updateKeys(v)
+	}
+	return ciphertext
+}
+
+// EncryptZipCrypto encrypts compressed entry data with traditional PKWARE
+// encryption, prefixing the 12-byte header whose last byte checks crc.
+func EncryptZipCrypto(password string, compressed []byte, crc uint32) ([]byte, error) {
+	header := make([]byte, zipCryptoHeader)
+	if _, err := rand.Read(header[:zipCryptoHeader-1]); err != nil {
+		return nil, err
+	}
+	header[zipCryptoHeader-1] = byte(crc >> 24)
+	z := newZipCrypto([]byte(password))
+	return append(z.encrypt(header), z.encrypt(compressed)...), nil
+}
+
 func crc32update(pCrc32 uint32, bval byte) uint32 {
 	return crc32.IEEETable[(pCrc32^uint32(bval))&0xff] ^ (pCrc32 >> 8)
 }
@@ -8,6 +8,8 @@ var ImageExtensions = []string{
 	".gif",
 	".bmp",
 	".webp",
+	".heic",
+	".heif",
 }
 
 // VideoExtensions lists supported video file suffixes (lowercase).
@@ -32,3 +34,15 @@ var AudioExtensions = []string{
 	".wav",
 	".flac",
 }
+
+// AlbumVideoMaxBytes is the largest video batched into a mixed photo/video
+// album; bigger videos are sent on their own.
+const AlbumVideoMaxBytes int64 = 20 * 1024 * 1024
+
+// BotAPIUploadMaxBytes is the largest file the public Bot API accepts for
+// upload.
+const BotAPIUploadMaxBytes int64 = 50 * 1024 * 1024
+
+// StreamMinBytes is the size from which documents, videos and audio are
+// uploaded straight from disk instead of being read into memory first.
+const StreamMinBytes int64 = 32 * 1024 * 1024
@@ -0,0 +1,213 @@
+// Package telegramsend is the public Go API of telegram-upload-watcher.
+//
+// It wraps the Telegram client, the JSONL queue, the folder watcher and the
+// queue sender used by the CLI so they can be embedded in other programs:
+//
+//	client, _ := telegramsend.NewClient(telegramsend.ClientOptions{Tokens: []string{token}})
+//	q, _ := telegramsend.OpenQueue("uploads.jsonl")
+//	defer q.Close()
+//	w, _ := telegramsend.NewWatcher(q, telegramsend.WatcherOptions{Dirs: []string{"/data/in"}})
+//	s, _ := telegramsend.NewSender(client, q, telegramsend.SenderOptions{ChatID: "-100123"})
+//	go w.Run(ctx)
+//	s.Run(ctx)
+package telegramsend
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/config"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/thumbnail"
+)
+
+// DefaultAPIURL is used when ClientOptions.APIURLs is empty.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Errors returned by Client sends for failed Bot API replies; inspect them
+// with errors.As. Each of the specific types wraps an *APIError.
+type (
+	APIError        = telegram.APIError
+	ErrFloodWait    = telegram.ErrFloodWait
+	ErrTooBig       = telegram.ErrTooBig
+	ErrUnauthorized = telegram.ErrUnauthorized
+	ErrBadRequest   = telegram.ErrBadRequest
+)
+
+// IsPermanent reports whether retrying the send that returned err cannot
+// succeed, e.g. the chat does not exist or the file is too big.
+func IsPermanent(err error) bool {
+	return telegram.IsPermanent(err)
+}
+
+// Poll and Location describe the non-file messages of SendPoll and
+// SendLocation.
+type (
+	Poll     = telegram.Poll
+	Location = telegram.Location
+)
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	// APIURLs are Bot API endpoints, rotated per request. Defaults to DefaultAPIURL.
+	APIURLs []string
+	// PreferURLs are used, in order, whenever they are healthy. Endpoints
+	// that keep failing are ejected and probed until they recover.
+	PreferURLs []string
+	// Tokens are bot tokens, rotated per request. At least one is required.
+	Tokens []string
+	// MaxRetries is the number of attempts per API call (default 3).
+	MaxRetries int
+	// RetryDelay is the wait between attempts (default 3s).
+	RetryDelay time.Duration
+	// Spoiler hides photos and videos behind a spoiler; ProtectContent
+	// blocks forwarding and saving of everything sent.
+	Spoiler        bool
+	ProtectContent bool
+	// Silent sends without notifying chat members.
+	Silent bool
+	// ReplyTo sends everything as a reply to this message ID (0 disables).
+	ReplyTo int
+	// Thumbnails generates a thumbnail for documents, videos and audio
+	// sent without File.Thumb (PDF first page, video frame, album art).
+	Thumbnails bool
+}
+
+// Album item types for File.Type.
+const (
+	MediaPhoto = telegram.MediaPhoto
+	MediaVideo = telegram.MediaVideo
+)
+
+// File is an in-memory file to upload.
+type File struct {
+	Filename string
+	Data     []byte
+	// Type marks an album item as MediaPhoto (default) or MediaVideo.
+	Type string
+	// Caption is sent with the file when set.
+	Caption string
+	// Thumb is a JPEG thumbnail (at most 320x320, 200 kB) for documents,
+	// videos and audio.
+	Thumb []byte
+}
+
+// Client sends messages and files through the Telegram Bot API.
+type Client struct {
+	client *telegram.Client
+	retry  telegram.RetryConfig
+}
+
+// NewClient builds a Client from opts.
+func NewClient(opts ClientOptions) (*Client, error) {
+	apiURLs := []string{}
+	for _, value := range opts.APIURLs {
+		if value = config.NormalizeAPIURL(value); value != "" {
+			apiURLs = append(apiURLs, value)
+		}
+	}
+	if len(apiURLs) == 0 {
+		apiURLs = append(apiURLs, DefaultAPIURL)
+	}
+	tokens := []string{}
+	for _, value := range opts.Tokens {
+		if value = strings.TrimSpace(value); value != "" {
+			tokens = append(tokens, value)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("telegramsend: no bot token provided")
+	}
+
+	retry := telegram.RetryConfig{MaxRetries: opts.MaxRetries, Delay: opts.RetryDelay}
+	if retry.MaxRetries <= 0 {
+		retry.MaxRetries = 3
+	}
+	if retry.Delay <= 0 {
+		retry.Delay = 3 * time.Second
+	}
+	preferURLs := []string{}
+	for _, value := range opts.PreferURLs {
+		if value = config.NormalizeAPIURL(value); value != "" {
+			preferURLs = append(preferURLs, value)
+		}
+	}
+	urlPool := telegram.NewURLPool(apiURLs)
+	urlPool.SetPreferred(preferURLs)
+	sendOpts := telegram.SendOptions{
+		Spoiler:        opts.Spoiler,
+		ProtectContent: opts.ProtectContent,
+		Silent:         opts.Silent,
+		ReplyTo:        opts.ReplyTo,
+	}
+	if opts.Thumbnails {
+		sendOpts.Thumbnail = thumbnail.Generate
+	}
+	client := telegram.NewClient(urlPool, telegram.NewTokenPool(tokens)).WithSendOptions(sendOpts)
+	return &Client{
+		client: client,
+		retry:  retry,
+	}, nil
+}
+
+// SendMessage sends a text message. topicID may be nil.
+func (c *Client) SendMessage(ctx context.Context, chatID string, text string, topicID *int) error {
+	return c.client.SendMessage(ctx, chatID, text, topicID, c.retry)
+}
+
+// SendMediaGroup sends up to 10 photos and videos as one album; a single
+// file is sent on its own.
+func (c *Client) SendMediaGroup(ctx context.Context, chatID string, files []File, topicID *int) error {
+	_, err := c.client.SendMediaGroup(ctx, chatID, mediaFiles(files), topicID, c.retry)
+	return err
+}
+
+// SendPhoto sends a single image as a photo.
+func (c *Client) SendPhoto(ctx context.Context, chatID string, file File, topicID *int) error {
+	_, err := c.client.SendPhoto(ctx, chatID, file.media(), topicID, c.retry)
+	return err
+}
+
+// SendDocument sends a file as a document.
+func (c *Client) SendDocument(ctx context.Context, chatID string, file File, topicID *int) error {
+	_, err := c.client.SendDocument(ctx, chatID, file.media(), topicID, c.retry)
+	return err
+}
+
+// SendVideo sends a video file.
+func (c *Client) SendVideo(ctx context.Context, chatID string, file File, topicID *int) error {
+	_, err := c.client.SendVideo(ctx, chatID, file.media(), topicID, c.retry)
+	return err
+}
+
+// SendAudio sends an audio file.
+func (c *Client) SendAudio(ctx context.Context, chatID string, file File, topicID *int) error {
+	_, err := c.client.SendAudio(ctx, chatID, file.media(), topicID, c.retry)
+	return err
+}
+
+// SendPoll posts a poll with 2-10 options.
+func (c *Client) SendPoll(ctx context.Context, chatID string, poll Poll, topicID *int) error {
+	_, err := c.client.SendPoll(ctx, chatID, poll, topicID, c.retry)
+	return err
+}
+
+// SendLocation posts a map point, or a live location when LivePeriod is set.
+func (c *Client) SendLocation(ctx context.Context, chatID string, location Location, topicID *int) error {
+	_, err := c.client.SendLocation(ctx, chatID, location, topicID, c.retry)
+	return err
+}
+
+func (f File) media() telegram.MediaFile {
+	return telegram.MediaFile{Filename: f.Filename, Data: f.Data, Type: f.Type, Caption: f.Caption, Thumb: f.Thumb}
+}
+
+func mediaFiles(files []File) []telegram.MediaFile {
+	media := make([]telegram.MediaFile, 0, len(files))
+	for _, file := range files {
+		media = append(media, file.media())
+	}
+	return media
+}
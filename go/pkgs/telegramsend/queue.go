@@ -0,0 +1,98 @@
+package telegramsend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/queue"
+)
+
+// Queue item statuses.
+const (
+	StatusQueued  = queue.StatusQueued
+	StatusSending = queue.StatusSending
+	StatusSent    = queue.StatusSent
+	StatusFailed  = queue.StatusFailed
+	StatusSkipped = queue.StatusSkipped
+	// StatusFailedPermanent items were rejected by Telegram for good and
+	// are not retried.
+	StatusFailedPermanent = queue.StatusFailedPermanent
+	// StatusSourceMissing items lost their file before they were sent and
+	// are not retried.
+	StatusSourceMissing = queue.StatusSourceMissing
+)
+
+// Send types accepted by Queue.AddFile.
+const (
+	SendTypeImage    = "image"
+	SendTypeVideo    = "video"
+	SendTypeAudio    = "audio"
+	SendTypeDocument = "file"
+)
+
+// Queue is a persistent JSONL upload queue. Files already recorded in the
+// queue (same path, size and mtime) are never enqueued twice.
+type Queue struct {
+	q *queue.Queue
+}
+
+// OpenQueue opens or creates the queue file at path.
+func OpenQueue(path string) (*Queue, error) {
+	q, err := queue.New(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{q: q}, nil
+}
+
+// Close stops the background writer. Pending writes are flushed first.
+func (q *Queue) Close() {
+	q.q.Close()
+}
+
+// AddFile enqueues a file on disk. It reports false when the file is
+// already in the queue.
+func (q *Queue) AddFile(path string, sendType string) (bool, error) {
+	switch sendType {
+	case SendTypeImage, SendTypeVideo, SendTypeAudio, SendTypeDocument:
+	default:
+		return false, fmt.Errorf("telegramsend: unsupported send type %q", sendType)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return false, fmt.Errorf("telegramsend: %s is a directory", absPath)
+	}
+	mtimeNS := info.ModTime().UnixNano()
+	added, err := q.q.Enqueue(queue.Item{
+		SourceType:        "file",
+		SourcePath:        absPath,
+		SourceFingerprint: queue.BuildSourceFingerprint(absPath, info.Size(), &mtimeNS),
+		Path:              absPath,
+		Size:              info.Size(),
+		MTimeNS:           &mtimeNS,
+		SendType:          sendType,
+		Fingerprint:       queue.BuildFingerprint("file", absPath, nil, info.Size(), &mtimeNS, nil),
+	})
+	if err != nil {
+		return false, err
+	}
+	return added != nil, nil
+}
+
+// Stats returns item counts keyed by status.
+func (q *Queue) Stats() map[string]int {
+	return q.q.Stats()
+}
+
+// Pending returns the number of queued or in-flight items.
+func (q *Queue) Pending() int {
+	return len(q.q.Pending(0))
+}
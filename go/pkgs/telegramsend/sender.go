@@ -0,0 +1,111 @@
+package telegramsend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/sender"
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/telegram"
+)
+
+// Progress is reported after each file or album the Sender handles.
+type Progress = sender.ProgressUpdate
+
+// SenderOptions configures a Sender. Zero values use the CLI defaults.
+type SenderOptions struct {
+	ChatID  string
+	TopicID *int
+	// GroupSize is the number of images per album (default 4, clamped to
+	// 2-10).
+	GroupSize int
+	// GroupMaxBytes splits an album once its images exceed this many bytes
+	// (0 disables).
+	GroupMaxBytes int64
+	// SendInterval is the idle poll interval (default 30s).
+	SendInterval time.Duration
+	// BatchDelay is the wait between albums (default 3s).
+	BatchDelay time.Duration
+	// PauseEvery pauses for PauseSeconds after this many sent items (0 disables).
+	PauseEvery   int
+	PauseSeconds time.Duration
+	// MaxDimension and MaxBytes bound images before upload.
+	MaxDimension  int
+	MaxBytes      int
+	PNGStartLevel int
+	ZipPasswords  []string
+	// PHashDedup skips images within PHashDistance bits (perceptual hash) of
+	// an image already sent from the queue.
+	PHashDedup    bool
+	PHashDistance int
+	// AlbumVideos batches videos up to 20 MB into albums with images.
+	AlbumVideos bool
+	// OnProgress, when set, receives progress updates.
+	OnProgress func(Progress)
+}
+
+// Sender drains a Queue to a chat.
+type Sender struct {
+	client *Client
+	q      *Queue
+	cfg    sender.Config
+	report sender.ProgressReporter
+}
+
+// NewSender validates opts and returns a Sender.
+func NewSender(client *Client, q *Queue, opts SenderOptions) (*Sender, error) {
+	if opts.ChatID == "" {
+		return nil, errors.New("telegramsend: chat id is required")
+	}
+	if opts.GroupSize <= 0 {
+		opts.GroupSize = 4
+	}
+	opts.GroupSize = telegram.ClampGroupSize(opts.GroupSize)
+	if opts.SendInterval <= 0 {
+		opts.SendInterval = 30 * time.Second
+	}
+	if opts.BatchDelay <= 0 {
+		opts.BatchDelay = 3 * time.Second
+	}
+	if opts.MaxDimension <= 0 {
+		opts.MaxDimension = 2000
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 5 * 1024 * 1024
+	}
+	if opts.PNGStartLevel <= 0 {
+		opts.PNGStartLevel = 8
+	}
+	s := &Sender{
+		client: client,
+		q:      q,
+		cfg: sender.Config{
+			ChatID:        opts.ChatID,
+			TopicID:       opts.TopicID,
+			GroupSize:     opts.GroupSize,
+			GroupMaxBytes: opts.GroupMaxBytes,
+			SendInterval:  opts.SendInterval,
+			BatchDelay:    opts.BatchDelay,
+			PauseEvery:    opts.PauseEvery,
+			PauseSeconds:  opts.PauseSeconds,
+			MaxDimension:  opts.MaxDimension,
+			MaxBytes:      opts.MaxBytes,
+			PNGStartLevel: opts.PNGStartLevel,
+			Retry:         client.retry,
+			ZipPasswords:  opts.ZipPasswords,
+			PHashDedup:    opts.PHashDedup,
+			PHashDistance: opts.PHashDistance,
+			AlbumVideos:   opts.AlbumVideos,
+		},
+	}
+	if opts.OnProgress != nil {
+		s.report = sender.ProgressReporter(opts.OnProgress)
+	}
+	return s, nil
+}
+
+// Run sends queued items until ctx is cancelled.
+func (s *Sender) Run(ctx context.Context) error {
+	sender.LoopWithContext(ctx, s.cfg, s.q.q, s.client.client, nil, s.report)
+	return ctx.Err()
+}
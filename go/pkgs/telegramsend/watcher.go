@@ -0,0 +1,88 @@
+package telegramsend
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nerdneilsfield/telegram-upload-watcher/go/internal/watcher"
+)
+
+// WatcherOptions configures a Watcher. With no media type selected, images
+// are watched.
+type WatcherOptions struct {
+	Dirs      []string
+	Recursive bool
+	// Include and Exclude are glob patterns matched against paths relative
+	// to the watched folder.
+	Include   []string
+	Exclude   []string
+	WithImage bool
+	WithVideo bool
+	WithAudio bool
+	WithAll   bool
+	// ScanInterval defaults to 30s.
+	ScanInterval time.Duration
+	// SettleSeconds is how long a file must stay unchanged before it is
+	// enqueued (default 5).
+	SettleSeconds int
+}
+
+// Watcher scans folders (and zip files inside them) and enqueues new files.
+type Watcher struct {
+	q       *Queue
+	configs []watcher.Config
+}
+
+// NewWatcher validates opts and returns a Watcher feeding q.
+func NewWatcher(q *Queue, opts WatcherOptions) (*Watcher, error) {
+	if len(opts.Dirs) == 0 {
+		return nil, errors.New("telegramsend: no watch dir provided")
+	}
+	if opts.ScanInterval <= 0 {
+		opts.ScanInterval = 30 * time.Second
+	}
+	if opts.SettleSeconds <= 0 {
+		opts.SettleSeconds = 5
+	}
+	if !opts.WithImage && !opts.WithVideo && !opts.WithAudio && !opts.WithAll {
+		opts.WithImage = true
+	}
+
+	configs := make([]watcher.Config, 0, len(opts.Dirs))
+	for _, dir := range opts.Dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, watcher.Config{
+			Root:          absDir,
+			Recursive:     opts.Recursive,
+			IncludeGlobs:  opts.Include,
+			ExcludeGlobs:  opts.Exclude,
+			WithImage:     opts.WithImage || opts.WithAll,
+			WithVideo:     opts.WithVideo || opts.WithAll,
+			WithAudio:     opts.WithAudio || opts.WithAll,
+			WithAll:       opts.WithAll,
+			ScanInterval:  opts.ScanInterval,
+			SettleSeconds: opts.SettleSeconds,
+		})
+	}
+	return &Watcher{q: q, configs: configs}, nil
+}
+
+// Run scans until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, cfg := range w.configs {
+		wg.Add(1)
+		go func(cfg watcher.Config) {
+			defer wg.Done()
+			watcher.WatchLoopWithContext(ctx, cfg, w.q.q, nil)
+		}(cfg)
+	}
+	wg.Wait()
+	return ctx.Err()
+}